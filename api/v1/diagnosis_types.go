@@ -49,12 +49,29 @@ const (
 	OperationSetNotFound DiagnosisConditionType = "OperationSetNotFound"
 	// OperationNotFound means the operation is not found when running Diagnosis.
 	OperationNotFound DiagnosisConditionType = "OperationNotFound"
+	// DiagnosisPhaseTimeout means the diagnosis has been in a non terminal phase longer than the configured timeout.
+	DiagnosisPhaseTimeout DiagnosisConditionType = "PhaseTimeout"
+
+	// DiagnosisSeverityCritical means the diagnosis targets an issue which requires immediate attention.
+	DiagnosisSeverityCritical DiagnosisSeverity = "Critical"
+	// DiagnosisSeverityWarning means the diagnosis targets an issue which requires attention eventually.
+	DiagnosisSeverityWarning DiagnosisSeverity = "Warning"
+	// DiagnosisSeverityInfo means the diagnosis is informational and requires no attention.
+	DiagnosisSeverityInfo DiagnosisSeverity = "Info"
 )
 
 // DiagnosisSpec defines the desired state of Diagnosis.
 type DiagnosisSpec struct {
+	// One of OperationSet and OperationSetSelector must be specified.
 	// OperationSet is the name of operation set which represents diagnosis pipeline to be executed.
-	OperationSet string `json:"operationSet"`
+	// +optional
+	OperationSet string `json:"operationSet,omitempty"`
+	// OperationSetSelector selects an operation set by label for the diagnosis pipeline to be executed.
+	// The operation set with the lexicographically smallest name is picked if multiple operation sets
+	// are matched by the selector.
+	// OperationSet and OperationSetSelector are mutually exclusive.
+	// +optional
+	OperationSetSelector *metav1.LabelSelector `json:"operationSetSelector,omitempty"`
 	// One of NodeName and PodReference must be specified.
 	// NodeName is a specific node which the diagnosis is on.
 	// +optional
@@ -62,11 +79,34 @@ type DiagnosisSpec struct {
 	// PodReference contains details of the target pod.
 	// +optional
 	PodReference *PodReference `json:"podReference,omitempty"`
+	// PodReferences contains details of a set of target pods involved in one issue, e.g. all
+	// replicas of a workload on a node. Processors reading the target pod receive the first
+	// reference of the set.
+	// PodReference and PodReferences are mutually exclusive.
+	// +optional
+	PodReferences []PodReference `json:"podReferences,omitempty"`
 	// Parameters is a set of the parameters to be passed to opreations.
 	// Parameters and OperationResults are encoded into a json object and sent to operation processor when
 	// running diagnosis.
 	// +optional
 	Parameters map[string]string `json:"parameters,omitempty"`
+	// PathConcurrency is the maximum number of paths in the diagnosis pipeline which could be executed
+	// concurrently. The diagnosis succeeds if any one of the paths succeeds and results of succeeded
+	// paths are merged in path order.
+	// Paths are executed sequentially if not specified or not greater than 1.
+	// +optional
+	PathConcurrency int32 `json:"pathConcurrency,omitempty"`
+	// Severity indicates the importance of the issue targeted by the diagnosis for triaging.
+	// Valid values are Critical, Warning and Info. The severity is included in events recorded
+	// for the diagnosis.
+	// +optional
+	Severity DiagnosisSeverity `json:"severity,omitempty"`
+	// TTLSecondsAfterFinished limits the lifetime of a diagnosis that has finished execution, which is
+	// either Succeeded or Failed. The diagnosis is eligible to be garbage collected by diagnosis reaper
+	// after the TTL since it finished expires.
+	// The global time to live of diagnoses applies if not specified.
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
 }
 
 // PodReference contains details of the target pod.
@@ -156,6 +196,9 @@ type Checkpoint struct {
 // DiagnosisPhase is a label for the condition of a diagnosis at the current time.
 type DiagnosisPhase string
 
+// DiagnosisSeverity is a label for the importance of the issue targeted by a diagnosis.
+type DiagnosisSeverity string
+
 // DiagnosisConditionType is a valid value for DiagnosisCondition.Type.
 type DiagnosisConditionType string
 
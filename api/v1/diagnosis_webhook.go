@@ -17,6 +17,9 @@ limitations under the License.
 package v1
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -30,6 +33,11 @@ import (
 // diagnosislog is for logging of diagnosis webhook.
 var diagnosislog = logf.Log.WithName("diagnosis-webhook")
 
+// TraceIDAnnotation is the annotation carrying the trace id of a diagnosis. The trace id
+// originates when the diagnosis is created and is propagated to operation processors through
+// w3c traceparent headers.
+const TraceIDAnnotation = "diagnosis.kubediag.org/trace-id"
+
 // SetupWebhookWithManager setups the Diagnosis webhook.
 func (r *Diagnosis) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
@@ -47,6 +55,17 @@ func (r *Diagnosis) Default() {
 		Name:      r.Name,
 		Namespace: r.Namespace,
 	})
+
+	// Record a trace id on creation so the whole lifecycle of the diagnosis can be traced.
+	if _, ok := r.Annotations[TraceIDAnnotation]; !ok {
+		traceID := make([]byte, 16)
+		if _, err := rand.Read(traceID); err == nil {
+			if r.Annotations == nil {
+				r.Annotations = make(map[string]string)
+			}
+			r.Annotations[TraceIDAnnotation] = hex.EncodeToString(traceID)
+		}
+	}
 }
 
 // +kubebuilder:webhook:verbs=create;update,path=/validate-diagnosis-kubediag-org-v1-diagnosis,mutating=false,failurePolicy=fail,groups=diagnosis.kubediag.org,resources=diagnoses,versions=v1,name=vdiagnosis.kb.io
@@ -85,16 +104,7 @@ func (r *Diagnosis) ValidateDelete() error {
 
 // validateDiagnosis validates Diagnosis and returns err if any invalidation is found.
 func (r *Diagnosis) validateDiagnosis() error {
-	var allErrs field.ErrorList
-
-	if r.Spec.OperationSet == "" {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("operationSet"),
-			r.Spec.OperationSet, "must not be empty"))
-	}
-	if r.Spec.NodeName == "" && r.Spec.PodReference == nil {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("nodeName"),
-			r.Spec.NodeName, "must not be empty if podReference is empty"))
-	}
+	allErrs := ValidateDiagnosisSpec(r.Spec, field.NewPath("spec"))
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -103,3 +113,52 @@ func (r *Diagnosis) validateDiagnosis() error {
 		schema.GroupKind{Group: "diagnosis.kubediag.org", Kind: "Diagnosis"},
 		r.Name, allErrs)
 }
+
+// ValidateDiagnosisSpec validates the spec of a Diagnosis and returns aggregated errors of all
+// invalid fields. It is independent of the webhook server and usable in unit tests.
+func ValidateDiagnosisSpec(spec DiagnosisSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.OperationSet == "" && spec.OperationSetSelector == nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("operationSet"),
+			spec.OperationSet, "must not be empty if operationSetSelector is empty"))
+	}
+	if spec.OperationSet != "" && spec.OperationSetSelector != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("operationSetSelector"),
+			spec.OperationSetSelector, "must not be specified if operationSet is specified"))
+	}
+	if spec.NodeName == "" && spec.PodReference == nil && len(spec.PodReferences) == 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("nodeName"),
+			spec.NodeName, "must not be empty if podReference and podReferences are empty"))
+	}
+	if spec.PodReference != nil && (spec.PodReference.Namespace == "" || spec.PodReference.Name == "") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("podReference"),
+			spec.PodReference, "must specify namespace and name"))
+	}
+	if spec.PodReference != nil && len(spec.PodReferences) > 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("podReferences"),
+			spec.PodReferences, "must not be specified if podReference is specified"))
+	}
+	for i, podReference := range spec.PodReferences {
+		if podReference.Namespace == "" || podReference.Name == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("podReferences").Index(i),
+				podReference, "must specify namespace and name"))
+		}
+	}
+	if spec.PathConcurrency < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("pathConcurrency"),
+			spec.PathConcurrency, "must not be negative"))
+	}
+	if spec.TTLSecondsAfterFinished != nil && *spec.TTLSecondsAfterFinished < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("ttlSecondsAfterFinished"),
+			*spec.TTLSecondsAfterFinished, "must not be negative"))
+	}
+	switch spec.Severity {
+	case "", DiagnosisSeverityCritical, DiagnosisSeverityWarning, DiagnosisSeverityInfo:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("severity"),
+			spec.Severity, []string{string(DiagnosisSeverityCritical), string(DiagnosisSeverityWarning), string(DiagnosisSeverityInfo)}))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateDiagnosisSpec(t *testing.T) {
+	tests := []struct {
+		spec     DiagnosisSpec
+		expected int
+		desc     string
+	}{
+		{
+			spec: DiagnosisSpec{
+				OperationSet: "operationset1",
+				NodeName:     "node1",
+			},
+			expected: 0,
+			desc:     "valid diagnosis with node name",
+		},
+		{
+			spec: DiagnosisSpec{
+				OperationSet: "operationset1",
+				PodReference: &PodReference{
+					NamespacedName: NamespacedName{
+						Namespace: "namespace1",
+						Name:      "pod1",
+					},
+				},
+			},
+			expected: 0,
+			desc:     "valid diagnosis with pod reference",
+		},
+		{
+			spec: DiagnosisSpec{
+				NodeName: "node1",
+			},
+			expected: 1,
+			desc:     "empty operation set",
+		},
+		{
+			spec: DiagnosisSpec{
+				OperationSet: "operationset1",
+			},
+			expected: 1,
+			desc:     "neither node name nor pod reference specified",
+		},
+		{
+			spec: DiagnosisSpec{
+				OperationSet: "operationset1",
+				PodReference: &PodReference{
+					NamespacedName: NamespacedName{
+						Namespace: "namespace1",
+					},
+				},
+			},
+			expected: 1,
+			desc:     "pod reference without name",
+		},
+		{
+			spec: DiagnosisSpec{
+				OperationSet: "operationset1",
+				PodReferences: []PodReference{
+					{
+						NamespacedName: NamespacedName{
+							Namespace: "namespace1",
+							Name:      "pod1",
+						},
+					},
+					{
+						NamespacedName: NamespacedName{
+							Namespace: "namespace1",
+							Name:      "pod2",
+						},
+					},
+				},
+			},
+			expected: 0,
+			desc:     "valid diagnosis with pod references",
+		},
+		{
+			spec: DiagnosisSpec{
+				OperationSet: "operationset1",
+				PodReference: &PodReference{
+					NamespacedName: NamespacedName{
+						Namespace: "namespace1",
+						Name:      "pod1",
+					},
+				},
+				PodReferences: []PodReference{
+					{
+						NamespacedName: NamespacedName{
+							Namespace: "namespace1",
+							Name:      "pod2",
+						},
+					},
+				},
+			},
+			expected: 1,
+			desc:     "pod reference and pod references both specified",
+		},
+		{
+			spec: DiagnosisSpec{
+				OperationSet: "operationset1",
+				PodReferences: []PodReference{
+					{
+						NamespacedName: NamespacedName{
+							Namespace: "namespace1",
+						},
+					},
+				},
+			},
+			expected: 1,
+			desc:     "pod references entry without name",
+		},
+		{
+			spec: DiagnosisSpec{
+				OperationSet: "operationset1",
+				NodeName:     "node1",
+				Severity:     "Unknown",
+			},
+			expected: 1,
+			desc:     "unsupported severity",
+		},
+	}
+
+	for _, test := range tests {
+		allErrs := ValidateDiagnosisSpec(test.spec, field.NewPath("spec"))
+		assert.Equal(t, test.expected, len(allErrs), test.desc)
+	}
+}
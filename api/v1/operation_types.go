@@ -42,10 +42,23 @@ type Processor struct {
 	// ScriptRunner contains the information to run a script.
 	// +optional
 	ScriptRunner *ScriptRunner `json:"scriptRunner,omitempty"`
+	// GRPCServer specifies the grpc server to do operations.
+	// +optional
+	GRPCServer *GRPCServer `json:"grpcServer,omitempty"`
 	// Number of seconds after which the processor times out.
 	// Defaults to 30 seconds. Minimum value is 1.
 	// +optional
 	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// Number of retries of a processor request on connection errors or 5xx responses.
+	// Requests failing with a 4xx response are never retried.
+	// Defaults to 0 which disables retries.
+	// +optional
+	Retries *int32 `json:"retries,omitempty"`
+	// Base number of seconds between retries of a processor request. The delay is doubled on
+	// each retry and jittered.
+	// Defaults to 1 second. Minimum value is 1.
+	// +optional
+	RetryDelaySeconds *int32 `json:"retryDelaySeconds,omitempty"`
 }
 
 // Storage represents the type of storage for operation results.
@@ -78,6 +91,22 @@ type HTTPServer struct {
 	// Scheme is the serving scheme of processor. It must be either http or https.
 	// +optional
 	Scheme *string `json:"scheme,omitempty"`
+	// HealthPath is the http path probed with a GET request before the operation request is
+	// sent. The operation is skipped with the probe failure recorded in operation results if
+	// the probe fails. No probe is performed if not specified.
+	// +optional
+	HealthPath *string `json:"healthPath,omitempty"`
+}
+
+// GRPCServer specifies the grpc server to do operations. The processor must implement the
+// OperationProcessor service defined in the kubediag rpc package.
+type GRPCServer struct {
+	// Address is the serving address of the processor. It must be either an ip or a dns address.
+	// Defaults to kubediag agent advertised address if not specified.
+	// +optional
+	Address *string `json:"address,omitempty"`
+	// Port is the serving port of the processor.
+	Port int32 `json:"port"`
 }
 
 // ScriptRunner contains the information to run a script.
@@ -93,6 +122,40 @@ type ScriptRunner struct {
 	// Execution results will not be updated if not specified.
 	// +optional
 	OperationResultKey *string `json:"operationResultKey,omitempty"`
+	// Env is a list of environment variables set for the script. Values resolved from secrets
+	// are scrubbed from recorded script output and error messages.
+	// +optional
+	Env []EnvVar `json:"env,omitempty"`
+}
+
+// EnvVar represents an environment variable set for a script.
+type EnvVar struct {
+	// Name of the environment variable.
+	Name string `json:"name"`
+	// Value is the literal value of the environment variable.
+	// +optional
+	Value string `json:"value,omitempty"`
+	// ValueFrom is the source of the value. It takes precedence over the literal value.
+	// +optional
+	ValueFrom *EnvVarSource `json:"valueFrom,omitempty"`
+}
+
+// EnvVarSource represents a source of the value of an environment variable.
+type EnvVarSource struct {
+	// SecretKeyRef selects a key of a secret. The namespace is required since operations are
+	// cluster scoped.
+	// +optional
+	SecretKeyRef *SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// SecretKeySelector selects a key of a secret.
+type SecretKeySelector struct {
+	// Namespace of the secret.
+	Namespace string `json:"namespace"`
+	// Name of the secret.
+	Name string `json:"name"`
+	// Key of the secret to select from.
+	Key string `json:"key"`
 }
 
 // +kubebuilder:object:root=true
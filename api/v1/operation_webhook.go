@@ -92,10 +92,20 @@ func (r *Operation) ValidateDelete() error {
 func (r *Operation) validateOperation() error {
 	var allErrs field.ErrorList
 
-	if r.Spec.Processor.HTTPServer == nil && r.Spec.Processor.ScriptRunner == nil {
+	specified := 0
+	if r.Spec.Processor.HTTPServer != nil {
+		specified++
+	}
+	if r.Spec.Processor.ScriptRunner != nil {
+		specified++
+	}
+	if r.Spec.Processor.GRPCServer != nil {
+		specified++
+	}
+	if specified == 0 {
 		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("processor"),
-			r.Spec.Processor, "must specify either http server or script runner"))
-	} else if r.Spec.Processor.HTTPServer != nil && r.Spec.Processor.ScriptRunner != nil {
+			r.Spec.Processor, "must specify either http server, grpc server or script runner"))
+	} else if specified > 1 {
 		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("processor"),
 			r.Spec.Processor, "one and only one processor should be specified."))
 	} else if r.Spec.Processor.HTTPServer != nil {
@@ -117,11 +127,36 @@ func (r *Operation) validateOperation() error {
 					r.Spec.Processor.HTTPServer.Scheme, "must be either http or https"))
 			}
 		}
+	} else if r.Spec.Processor.GRPCServer != nil {
+		if r.Spec.Processor.GRPCServer.Address != nil {
+			if net.ParseIP(*r.Spec.Processor.GRPCServer.Address) == nil && !govalidator.IsDNSName(*r.Spec.Processor.GRPCServer.Address) {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("processor").Child("grpcServer").Child("address"),
+					r.Spec.Processor.GRPCServer.Address, "must be a valid ip or dns address"))
+			}
+		}
+		if r.Spec.Processor.GRPCServer.Port <= 0 || r.Spec.Processor.GRPCServer.Port > 65535 {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("processor").Child("grpcServer").Child("port"),
+				r.Spec.Processor.GRPCServer.Port, "must be greater than 0 and less equal to 65535"))
+		}
+	}
+	allErrs = append(allErrs, ValidateTimeoutSeconds(r.Spec.Processor.TimeoutSeconds,
+		field.NewPath("spec").Child("processor").Child("timeoutSeconds"))...)
+	if r.Spec.Processor.Retries != nil {
+		if *r.Spec.Processor.Retries < 0 {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("processor").Child("retries"),
+				r.Spec.Processor.Retries, "must not be negative"))
+		}
+	}
+	if r.Spec.Processor.RetryDelaySeconds != nil {
+		if *r.Spec.Processor.RetryDelaySeconds <= 0 {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("processor").Child("retryDelaySeconds"),
+				r.Spec.Processor.RetryDelaySeconds, "must be greater than 0"))
+		}
 	}
-	if r.Spec.Processor.TimeoutSeconds != nil {
-		if *r.Spec.Processor.TimeoutSeconds <= 0 {
-			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("processor").Child("timeoutSeconds"),
-				r.Spec.Processor.TimeoutSeconds, "must be greater than 0"))
+	for i, dependence := range r.Spec.Dependences {
+		if dependence == r.Name {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("dependences").Index(i),
+				dependence, "must not depend on the operation itself"))
 		}
 	}
 	if len(allErrs) == 0 {
@@ -43,6 +43,13 @@ type Node struct {
 	// Dependences is the list of depended node ids.
 	// +optional
 	Dependences NodeSet `json:"dependences,omitempty"`
+	// Weight is the percentage of diagnoses which execute the operation on this node. It is used
+	// to canary a new operation on a fraction of diagnoses. Whether a diagnosis executes the node
+	// is decided by consistent hashing on the diagnosis uid so the decision is stable across
+	// retries. A diagnosis excluded by the weight skips the node and continues along the path.
+	// Defaults to 100 which executes the operation for every diagnosis. Must be between 0 and 100.
+	// +optional
+	Weight *int32 `json:"weight,omitempty"`
 }
 
 // NodeSet is the set of node ids.
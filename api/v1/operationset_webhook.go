@@ -87,6 +87,14 @@ func (r *OperationSet) validateOperationSet() error {
 				r.Spec.AdjacencyList, "must not contains any operation or dependences"))
 		}
 	}
+	for i, node := range r.Spec.AdjacencyList {
+		if node.Weight != nil {
+			if *node.Weight < 0 || *node.Weight > 100 {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("adjacencyList").Index(i).Child("weight"),
+					node.Weight, "must be between 0 and 100"))
+			}
+		}
+	}
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -71,6 +71,11 @@ type PrometheusAlertTemplate struct {
 	// All label names and values will be set as key value pairs in ".spec.parameters" field.
 	// +optional
 	ParameterInjectionLabels []model.LabelName `json:"parameterInjectionLabels,omitempty"`
+	// CooldownSeconds specifies how long to suppress new diagnosis creations for an alert label set
+	// after a diagnosis has been created for it. The last creation time of each alert label set is
+	// recorded in ".status.lastAlertTimes" field. Defaults to 0 which disables the cooldown.
+	// +optional
+	CooldownSeconds *int32 `json:"cooldownSeconds,omitempty"`
 }
 
 // PrometheusAlertTemplateRegexp is the regular expression for matching prometheus alert template.
@@ -104,6 +109,12 @@ type PrometheusAlertTemplateRegexp struct {
 type KubernetesEventTemplate struct {
 	// Regexp is the regular expression for matching kubernetes event template.
 	Regexp KubernetesEventTemplateRegexp `json:"regexp"`
+	// CooldownSeconds specifies how long to suppress new diagnosis creations for an involved object
+	// after a diagnosis has been created for one of its events. The last creation time of each
+	// involved object is recorded in ".status.lastEventTimes" field. Defaults to 0 which disables
+	// the cooldown.
+	// +optional
+	CooldownSeconds *int32 `json:"cooldownSeconds,omitempty"`
 }
 
 // KubernetesEventTemplateRegexp is the regular expression for matching kubernetes event template.
@@ -121,6 +132,10 @@ type KubernetesEventTemplateRegexp struct {
 	// Message is the regular expression for matching "Message" of kubernetes event.
 	// +optional
 	Message string `json:"message,omitempty"`
+	// InvolvedObject is the regular expression for matching "InvolvedObject" of kubernetes event.
+	// Only "Kind", "Namespace" and "Name" fields of "InvolvedObject" are matched as regular expressions.
+	// +optional
+	InvolvedObject corev1.ObjectReference `json:"involvedObject,omitempty"`
 	// Source is the regular expression for matching "Source" of kubernetes event.
 	// All fields of "Source" are regular expressions.
 	// +optional
@@ -139,6 +154,16 @@ type TriggerStatus struct {
 	// LastScheduleTime is the last time the cron was successfully scheduled.
 	// +optional
 	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastAlertTimes contains the last time a diagnosis was created for an alert label set. It is
+	// keyed by the fingerprint of the alert label set and maintained only if a cooldown is defined
+	// in the prometheus alert template.
+	// +optional
+	LastAlertTimes map[string]metav1.Time `json:"lastAlertTimes,omitempty"`
+	// LastEventTimes contains the last time a diagnosis was created for an involved object of a
+	// kubernetes event. It is keyed by the kind, namespace and name of the involved object and
+	// maintained only if a cooldown is defined in the kubernetes event template.
+	// +optional
+	LastEventTimes map[string]metav1.Time `json:"lastEventTimes,omitempty"`
 }
 
 // +kubebuilder:object:root=true
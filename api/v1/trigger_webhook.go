@@ -73,37 +73,55 @@ func (r *Trigger) ValidateDelete() error {
 
 // validateTrigger validates Trigger and returns err if any invalidation is found.
 func (r *Trigger) validateTrigger() error {
+	allErrs := ValidateTriggerSpec(r.Spec, field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: "diagnosis.kubediag.org", Kind: "Trigger"},
+		r.Name, allErrs)
+}
+
+// ValidateTriggerSpec validates the spec of a Trigger and returns aggregated errors of all
+// invalid fields. It is independent of the webhook server and usable in unit tests.
+func ValidateTriggerSpec(spec TriggerSpec, fldPath *field.Path) field.ErrorList {
 	var allErrs field.ErrorList
 
-	if r.Spec.OperationSet == "" {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("operationSet"),
-			r.Spec.OperationSet, "must not be empty"))
+	if spec.OperationSet == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("operationSet"),
+			spec.OperationSet, "must not be empty"))
 	}
-	if r.Spec.SourceTemplate.PrometheusAlertTemplate == nil && r.Spec.SourceTemplate.KubernetesEventTemplate == nil && r.Spec.SourceTemplate.CronTemplate == nil {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("sourceTemplate"),
-			r.Spec.SourceTemplate, "must specify a source template"))
-	} else if r.Spec.SourceTemplate.PrometheusAlertTemplate != nil && r.Spec.SourceTemplate.KubernetesEventTemplate != nil ||
-		r.Spec.SourceTemplate.KubernetesEventTemplate != nil && r.Spec.SourceTemplate.CronTemplate != nil ||
-		r.Spec.SourceTemplate.PrometheusAlertTemplate != nil && r.Spec.SourceTemplate.CronTemplate != nil {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("sourceTemplate"),
-			r.Spec.SourceTemplate, "one and only one template should be specified."))
+	if spec.SourceTemplate.PrometheusAlertTemplate == nil && spec.SourceTemplate.KubernetesEventTemplate == nil && spec.SourceTemplate.CronTemplate == nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("sourceTemplate"),
+			spec.SourceTemplate, "must specify a source template"))
+	} else if spec.SourceTemplate.PrometheusAlertTemplate != nil && spec.SourceTemplate.KubernetesEventTemplate != nil ||
+		spec.SourceTemplate.KubernetesEventTemplate != nil && spec.SourceTemplate.CronTemplate != nil ||
+		spec.SourceTemplate.PrometheusAlertTemplate != nil && spec.SourceTemplate.CronTemplate != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("sourceTemplate"),
+			spec.SourceTemplate, "one and only one template should be specified."))
 	}
-	if r.Spec.SourceTemplate.CronTemplate != nil {
-		_, err := cron.ParseStandard(r.Spec.SourceTemplate.CronTemplate.Schedule)
+	if spec.SourceTemplate.PrometheusAlertTemplate != nil && spec.SourceTemplate.PrometheusAlertTemplate.CooldownSeconds != nil &&
+		*spec.SourceTemplate.PrometheusAlertTemplate.CooldownSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("sourceTemplate").Child("prometheusAlertTemplate").Child("cooldownSeconds"),
+			*spec.SourceTemplate.PrometheusAlertTemplate.CooldownSeconds, "must not be negative"))
+	}
+	if spec.SourceTemplate.KubernetesEventTemplate != nil && spec.SourceTemplate.KubernetesEventTemplate.CooldownSeconds != nil &&
+		*spec.SourceTemplate.KubernetesEventTemplate.CooldownSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("sourceTemplate").Child("kubernetesEventTemplate").Child("cooldownSeconds"),
+			*spec.SourceTemplate.KubernetesEventTemplate.CooldownSeconds, "must not be negative"))
+	}
+	if spec.SourceTemplate.CronTemplate != nil {
+		_, err := cron.ParseStandard(spec.SourceTemplate.CronTemplate.Schedule)
 		if err != nil {
-			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("sourceTemplate").Child("cronTemplate").Child("schedule"),
-				r.Spec.SourceTemplate.CronTemplate.Schedule, "must be valid schedule format"))
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("sourceTemplate").Child("cronTemplate").Child("schedule"),
+				spec.SourceTemplate.CronTemplate.Schedule, "must be valid schedule format"))
 		}
-		if r.Spec.NodeName == "" {
-			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("nodeName"),
-				r.Spec.NodeName, "must not be empty"))
+		if spec.NodeName == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("nodeName"),
+				spec.NodeName, "must not be empty"))
 		}
 	}
-	if len(allErrs) == 0 {
-		return nil
-	}
 
-	return apierrors.NewInvalid(
-		schema.GroupKind{Group: "diagnosis.kubediag.org", Kind: "Trigger"},
-		r.Name, allErrs)
+	return allErrs
 }
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateTriggerSpec(t *testing.T) {
+	negativeCooldownSeconds := int32(-1)
+	tests := []struct {
+		spec     TriggerSpec
+		expected int
+		desc     string
+	}{
+		{
+			spec: TriggerSpec{
+				OperationSet: "operationset1",
+				SourceTemplate: SourceTemplate{
+					PrometheusAlertTemplate: &PrometheusAlertTemplate{},
+				},
+			},
+			expected: 0,
+			desc:     "valid trigger with prometheus alert template",
+		},
+		{
+			spec: TriggerSpec{
+				OperationSet: "operationset1",
+				NodeName:     "node1",
+				SourceTemplate: SourceTemplate{
+					CronTemplate: &CronTemplate{
+						Schedule: "@every 10m",
+					},
+				},
+			},
+			expected: 0,
+			desc:     "valid trigger with cron template",
+		},
+		{
+			spec: TriggerSpec{
+				SourceTemplate: SourceTemplate{
+					KubernetesEventTemplate: &KubernetesEventTemplate{},
+				},
+			},
+			expected: 1,
+			desc:     "empty operation set",
+		},
+		{
+			spec: TriggerSpec{
+				OperationSet: "operationset1",
+			},
+			expected: 1,
+			desc:     "no source template specified",
+		},
+		{
+			spec: TriggerSpec{
+				OperationSet: "operationset1",
+				SourceTemplate: SourceTemplate{
+					PrometheusAlertTemplate: &PrometheusAlertTemplate{},
+					KubernetesEventTemplate: &KubernetesEventTemplate{},
+				},
+			},
+			expected: 1,
+			desc:     "more than one source template specified",
+		},
+		{
+			spec: TriggerSpec{
+				OperationSet: "operationset1",
+				SourceTemplate: SourceTemplate{
+					PrometheusAlertTemplate: &PrometheusAlertTemplate{
+						CooldownSeconds: &negativeCooldownSeconds,
+					},
+				},
+			},
+			expected: 1,
+			desc:     "negative cooldown seconds",
+		},
+		{
+			spec: TriggerSpec{
+				OperationSet: "operationset1",
+				SourceTemplate: SourceTemplate{
+					CronTemplate: &CronTemplate{
+						Schedule: "invalid schedule",
+					},
+				},
+			},
+			expected: 2,
+			desc:     "invalid cron schedule without node name",
+		},
+	}
+
+	for _, test := range tests {
+		allErrs := ValidateTriggerSpec(test.spec, field.NewPath("spec"))
+		assert.Equal(t, test.expected, len(allErrs), test.desc)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	// MaximumTimeoutSeconds is the ceiling of a valid timeout in seconds. A timeout beyond the
+	// ceiling keeps an operation running long after its diagnosis has been given up on.
+	MaximumTimeoutSeconds int32 = 3600
+	// MaximumExpirationSeconds is the ceiling of a valid expiration in seconds. An expiration
+	// beyond the ceiling keeps a profiler endpoint served long after it is of any use.
+	MaximumExpirationSeconds int64 = 86400
+)
+
+// ValidateTimeoutSeconds validates a timeout in seconds and returns field path errors for values
+// which are not positive or beyond MaximumTimeoutSeconds. A nil timeout is valid since defaulting
+// happens separately.
+func ValidateTimeoutSeconds(timeoutSeconds *int32, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if timeoutSeconds == nil {
+		return allErrs
+	}
+	if *timeoutSeconds <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, timeoutSeconds, "must be greater than 0"))
+	} else if *timeoutSeconds > MaximumTimeoutSeconds {
+		allErrs = append(allErrs, field.Invalid(fldPath, timeoutSeconds,
+			fmt.Sprintf("must not be greater than %d", MaximumTimeoutSeconds)))
+	}
+
+	return allErrs
+}
+
+// ValidateExpirationSeconds validates an expiration in seconds and returns field path errors for
+// values which are not positive or beyond MaximumExpirationSeconds.
+func ValidateExpirationSeconds(expirationSeconds int64, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if expirationSeconds <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, expirationSeconds, "must be greater than 0"))
+	} else if expirationSeconds > MaximumExpirationSeconds {
+		allErrs = append(allErrs, field.Invalid(fldPath, expirationSeconds,
+			fmt.Sprintf("must not be greater than %d", MaximumExpirationSeconds)))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateTimeoutSeconds(t *testing.T) {
+	negative := int32(-1)
+	zero := int32(0)
+	one := int32(1)
+	ceiling := MaximumTimeoutSeconds
+	beyondCeiling := MaximumTimeoutSeconds + 1
+	tests := []struct {
+		timeoutSeconds *int32
+		expected       int
+		desc           string
+	}{
+		{
+			timeoutSeconds: nil,
+			expected:       0,
+			desc:           "nil timeout seconds",
+		},
+		{
+			timeoutSeconds: &one,
+			expected:       0,
+			desc:           "minimum valid timeout seconds",
+		},
+		{
+			timeoutSeconds: &ceiling,
+			expected:       0,
+			desc:           "maximum valid timeout seconds",
+		},
+		{
+			timeoutSeconds: &zero,
+			expected:       1,
+			desc:           "zero timeout seconds",
+		},
+		{
+			timeoutSeconds: &negative,
+			expected:       1,
+			desc:           "negative timeout seconds",
+		},
+		{
+			timeoutSeconds: &beyondCeiling,
+			expected:       1,
+			desc:           "timeout seconds beyond ceiling",
+		},
+	}
+
+	for _, test := range tests {
+		allErrs := ValidateTimeoutSeconds(test.timeoutSeconds, field.NewPath("spec").Child("processor").Child("timeoutSeconds"))
+		assert.Equal(t, test.expected, len(allErrs), test.desc)
+	}
+}
+
+func TestValidateExpirationSeconds(t *testing.T) {
+	tests := []struct {
+		expirationSeconds int64
+		expected          int
+		desc              string
+	}{
+		{
+			expirationSeconds: 1,
+			expected:          0,
+			desc:              "minimum valid expiration seconds",
+		},
+		{
+			expirationSeconds: MaximumExpirationSeconds,
+			expected:          0,
+			desc:              "maximum valid expiration seconds",
+		},
+		{
+			expirationSeconds: 0,
+			expected:          1,
+			desc:              "zero expiration seconds",
+		},
+		{
+			expirationSeconds: -1,
+			expected:          1,
+			desc:              "negative expiration seconds",
+		},
+		{
+			expirationSeconds: MaximumExpirationSeconds + 1,
+			expected:          1,
+			desc:              "expiration seconds beyond ceiling",
+		},
+	}
+
+	for _, test := range tests {
+		allErrs := ValidateExpirationSeconds(test.expirationSeconds, field.NewPath("expirationSeconds"))
+		assert.Equal(t, test.expected, len(allErrs), test.desc)
+	}
+}
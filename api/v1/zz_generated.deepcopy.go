@@ -1,3 +1,4 @@
+//go:build !ignore_autogenerated
 // +build !ignore_autogenerated
 
 /*
@@ -22,6 +23,7 @@ package v1
 
 import (
 	"github.com/prometheus/common/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -133,11 +135,21 @@ func (in *DiagnosisList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DiagnosisSpec) DeepCopyInto(out *DiagnosisSpec) {
 	*out = *in
+	if in.OperationSetSelector != nil {
+		in, out := &in.OperationSetSelector, &out.OperationSetSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.PodReference != nil {
 		in, out := &in.PodReference, &out.PodReference
 		*out = new(PodReference)
 		**out = **in
 	}
+	if in.PodReferences != nil {
+		in, out := &in.PodReferences, &out.PodReferences
+		*out = make([]PodReference, len(*in))
+		copy(*out, *in)
+	}
 	if in.Parameters != nil {
 		in, out := &in.Parameters, &out.Parameters
 		*out = make(map[string]string, len(*in))
@@ -145,6 +157,11 @@ func (in *DiagnosisSpec) DeepCopyInto(out *DiagnosisSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiagnosisSpec.
@@ -212,6 +229,66 @@ func (in *DiagnosisStatus) DeepCopy() *DiagnosisStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvVar) DeepCopyInto(out *EnvVar) {
+	*out = *in
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = new(EnvVarSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvVar.
+func (in *EnvVar) DeepCopy() *EnvVar {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvVar)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvVarSource) DeepCopyInto(out *EnvVarSource) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(SecretKeySelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvVarSource.
+func (in *EnvVarSource) DeepCopy() *EnvVarSource {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvVarSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GRPCServer) DeepCopyInto(out *GRPCServer) {
+	*out = *in
+	if in.Address != nil {
+		in, out := &in.Address, &out.Address
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GRPCServer.
+func (in *GRPCServer) DeepCopy() *GRPCServer {
+	if in == nil {
+		return nil
+	}
+	out := new(GRPCServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HTTPServer) DeepCopyInto(out *HTTPServer) {
 	*out = *in
@@ -235,6 +312,11 @@ func (in *HTTPServer) DeepCopyInto(out *HTTPServer) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.HealthPath != nil {
+		in, out := &in.HealthPath, &out.HealthPath
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPServer.
@@ -266,6 +348,11 @@ func (in *HostPath) DeepCopy() *HostPath {
 func (in *KubernetesEventTemplate) DeepCopyInto(out *KubernetesEventTemplate) {
 	*out = *in
 	out.Regexp = in.Regexp
+	if in.CooldownSeconds != nil {
+		in, out := &in.CooldownSeconds, &out.CooldownSeconds
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesEventTemplate.
@@ -281,6 +368,7 @@ func (in *KubernetesEventTemplate) DeepCopy() *KubernetesEventTemplate {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubernetesEventTemplateRegexp) DeepCopyInto(out *KubernetesEventTemplateRegexp) {
 	*out = *in
+	out.InvolvedObject = in.InvolvedObject
 	out.Source = in.Source
 }
 
@@ -322,6 +410,11 @@ func (in *Node) DeepCopyInto(out *Node) {
 		*out = make(NodeSet, len(*in))
 		copy(*out, *in)
 	}
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Node.
@@ -596,11 +689,26 @@ func (in *Processor) DeepCopyInto(out *Processor) {
 		*out = new(ScriptRunner)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.GRPCServer != nil {
+		in, out := &in.GRPCServer, &out.GRPCServer
+		*out = new(GRPCServer)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.TimeoutSeconds != nil {
 		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
 		*out = new(int32)
 		**out = **in
 	}
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RetryDelaySeconds != nil {
+		in, out := &in.RetryDelaySeconds, &out.RetryDelaySeconds
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Processor.
@@ -622,6 +730,11 @@ func (in *PrometheusAlertTemplate) DeepCopyInto(out *PrometheusAlertTemplate) {
 		*out = make([]model.LabelName, len(*in))
 		copy(*out, *in)
 	}
+	if in.CooldownSeconds != nil {
+		in, out := &in.CooldownSeconds, &out.CooldownSeconds
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusAlertTemplate.
@@ -676,6 +789,13 @@ func (in *ScriptRunner) DeepCopyInto(out *ScriptRunner) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScriptRunner.
@@ -688,6 +808,21 @@ func (in *ScriptRunner) DeepCopy() *ScriptRunner {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeySelector) DeepCopyInto(out *SecretKeySelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeySelector.
+func (in *SecretKeySelector) DeepCopy() *SecretKeySelector {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeySelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SourceTemplate) DeepCopyInto(out *SourceTemplate) {
 	*out = *in
@@ -699,7 +834,7 @@ func (in *SourceTemplate) DeepCopyInto(out *SourceTemplate) {
 	if in.KubernetesEventTemplate != nil {
 		in, out := &in.KubernetesEventTemplate, &out.KubernetesEventTemplate
 		*out = new(KubernetesEventTemplate)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.CronTemplate != nil {
 		in, out := &in.CronTemplate, &out.CronTemplate
@@ -820,6 +955,20 @@ func (in *TriggerStatus) DeepCopyInto(out *TriggerStatus) {
 		in, out := &in.LastScheduleTime, &out.LastScheduleTime
 		*out = (*in).DeepCopy()
 	}
+	if in.LastAlertTimes != nil {
+		in, out := &in.LastAlertTimes, &out.LastAlertTimes
+		*out = make(map[string]metav1.Time, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.LastEventTimes != nil {
+		in, out := &in.LastEventTimes, &out.LastEventTimes
+		*out = make(map[string]metav1.Time, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TriggerStatus.
@@ -48,7 +48,9 @@ import (
 	"github.com/kubediag/kubediag/pkg/features"
 	"github.com/kubediag/kubediag/pkg/graphbuilder"
 	"github.com/kubediag/kubediag/pkg/kafka"
+	"github.com/kubediag/kubediag/pkg/processors"
 	"github.com/kubediag/kubediag/pkg/processors/register"
+	"github.com/kubediag/kubediag/pkg/util"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -70,6 +72,9 @@ type KubeDiagOptions struct {
 	Port int
 	// NodeName specifies the node name.
 	NodeName string
+	// NodeNamePatterns restricts the agent to diagnoses whose node name matches one of the glob
+	// or regular expression patterns. The node name is matched exactly if empty.
+	NodeNamePatterns []string
 	// MetricsPort is the port the metric endpoint to serve on.
 	MetricsPort int
 	// EnableLeaderElection enables leader election for kubediag master.
@@ -95,11 +100,70 @@ type KubeDiagOptions struct {
 	MinimumDiagnosisTTLDuration time.Duration
 	// MaximumDiagnosesPerNode is maximum number of finished diagnoses to retain per node.
 	MaximumDiagnosesPerNode int32
+	// PendingPhaseTimeout is amount of time a diagnosis may stay in Pending phase before it is failed.
+	// A zero value disables the timeout.
+	PendingPhaseTimeout time.Duration
+	// RunningPhaseTimeout is amount of time a diagnosis may stay in Running phase before it is failed.
+	// A zero value disables the timeout.
+	RunningPhaseTimeout time.Duration
 	// FeatureGates is a map of feature names to bools that enable or disable features. This field modifies
 	// piecemeal the default values from "github.com/kubediag/kubediag/pkg/features/features.go".
 	FeatureGates map[string]bool
 	// DataRoot is root directory of persistent kubediag data.
 	DataRoot string
+	// ProcessorMaxRequestsInFlight is the maximum number of requests a processor handles simultaneously.
+	ProcessorMaxRequestsInFlight int
+	// ProcessorTokenFile is the path of a file containing the bearer token which processor requests
+	// are authenticated against. Authentication is disabled if empty.
+	ProcessorTokenFile string
+	// ProfilerSessionReaperInterval is the interval on which expired profiler sessions are shut
+	// down and their ports are freed.
+	ProfilerSessionReaperInterval time.Duration
+	// FileCollectorAllowedPathPrefixes is the list of path prefixes the file collector may read
+	// files from.
+	FileCollectorAllowedPathPrefixes []string
+	// DisableTriggerCascading disables setting the owner reference of generated diagnoses to
+	// their trigger so diagnoses outlive trigger deletion.
+	DisableTriggerCascading bool
+	// WebhookNotifierURL is the default url which the webhook notifier delivers notifications to.
+	WebhookNotifierURL string
+	// ExecutorMaxSyncRetries is the maximum number of retries of a diagnosis sync on transient
+	// errors. A diagnosis is marked as failed once the limit is exceeded. Zero means unlimited retries.
+	ExecutorMaxSyncRetries int
+	// ExecutorMaxContextBytes is the maximum size of a single operation result value recorded in
+	// a diagnosis. Larger values are spilled into files under the data root. Zero disables the
+	// limit.
+	ExecutorMaxContextBytes int
+	// ExecutorChannelBufferSize is the buffer size of the channel which queues diagnoses to the
+	// executor.
+	ExecutorChannelBufferSize int
+	// ExecutorQueueOverflowPolicy determines the behavior of enqueuing a diagnosis when the
+	// executor channel is full. One of reject-new, drop-oldest and block.
+	ExecutorQueueOverflowPolicy string
+	// ExecutorDrainTimeout is the maximum time the executor spends processing queued diagnoses
+	// after receiving a stop signal. Zero disables draining.
+	ExecutorDrainTimeout time.Duration
+	// ExecutorBreakerFailureThreshold is the number of consecutive failed requests to one
+	// operation processor url after which its circuit breaker opens. Zero disables circuit
+	// breaking.
+	ExecutorBreakerFailureThreshold int
+	// ExecutorBreakerCooldown is the time an open circuit breaker short-circuits dispatch to
+	// its operation processor url before a half open probe is allowed through.
+	ExecutorBreakerCooldown time.Duration
+	// ExecutorTransportCAFile is the path of a ca bundle for verifying operation processor
+	// certificates. Certificate verification is skipped if empty.
+	ExecutorTransportCAFile string
+	// ExecutorTransportClientCertFile is the path of a client certificate presented to operation
+	// processors.
+	ExecutorTransportClientCertFile string
+	// ExecutorTransportClientKeyFile is the path of the private key of the client certificate.
+	ExecutorTransportClientKeyFile string
+	// ExecutorTransportEnableKeepAlives enables http keep alive connections to operation
+	// processors.
+	ExecutorTransportEnableKeepAlives bool
+	// ExecutorTransportMaxIdleConns is the maximum number of idle connections to operation
+	// processors.
+	ExecutorTransportMaxIdleConns int
 }
 
 func init() {
@@ -144,18 +208,27 @@ of an Diagnosis.`,
 // NewKubeDiagOptions creates a new KubeDiagOptions with a default config.
 func NewKubeDiagOptions() (*KubeDiagOptions, error) {
 	return &KubeDiagOptions{
-		Mode:                        "agent",
-		BindAddress:                 "0.0.0.0",
-		Port:                        8090,
-		MetricsPort:                 10357,
-		EnableLeaderElection:        false,
-		WebhookPort:                 9443,
-		CertDir:                     defaultCertDir,
-		AlertmanagerRepeatInterval:  6 * time.Hour,
-		DiagnosisTTL:                240 * time.Hour,
-		MinimumDiagnosisTTLDuration: 30 * time.Minute,
-		MaximumDiagnosesPerNode:     20,
-		DataRoot:                    defaultDataRoot,
+		Mode:                             "agent",
+		BindAddress:                      "0.0.0.0",
+		Port:                             8090,
+		MetricsPort:                      10357,
+		EnableLeaderElection:             false,
+		WebhookPort:                      9443,
+		CertDir:                          defaultCertDir,
+		AlertmanagerRepeatInterval:       6 * time.Hour,
+		DiagnosisTTL:                     240 * time.Hour,
+		MinimumDiagnosisTTLDuration:      30 * time.Minute,
+		MaximumDiagnosesPerNode:          20,
+		DataRoot:                         defaultDataRoot,
+		ProfilerSessionReaperInterval:    processors.DefaultProfilerSessionReaperInterval,
+		FileCollectorAllowedPathPrefixes: []string{"/etc", "/proc", "/var/log"},
+		ExecutorMaxSyncRetries:           5,
+		ExecutorChannelBufferSize:        1000,
+		ExecutorQueueOverflowPolicy:      string(util.QueueOverflowPolicyRejectNew),
+		ExecutorMaxContextBytes:          512 * 1024,
+		ExecutorDrainTimeout:             30 * time.Second,
+		ExecutorBreakerFailureThreshold:  5,
+		ExecutorBreakerCooldown:          time.Minute,
 	}, nil
 }
 
@@ -215,6 +288,7 @@ func (opts *KubeDiagOptions) Run() error {
 			mgr.GetClient(),
 			mgr.GetCache(),
 			opts.AlertmanagerRepeatInterval,
+			opts.DisableTriggerCascading,
 			featureGate.Enabled(features.Alertmanager),
 		)
 
@@ -225,6 +299,7 @@ func (opts *KubeDiagOptions) Run() error {
 			mgr.GetClient(),
 			mgr.GetCache(),
 			eventChainCh,
+			opts.DisableTriggerCascading,
 			featureGate.Enabled(features.Eventer),
 		)
 		go func(stopCh chan struct{}) {
@@ -237,6 +312,7 @@ func (opts *KubeDiagOptions) Run() error {
 			ctrl.Log.WithName("cronscheduler"),
 			mgr.GetClient(),
 			mgr.GetCache(),
+			opts.DisableTriggerCascading,
 			featureGate.Enabled(features.CronScheduler),
 		)
 		go func(stopCh chan struct{}) {
@@ -280,9 +356,12 @@ func (opts *KubeDiagOptions) Run() error {
 			mgr.GetClient(),
 			ctrl.Log.WithName("controllers").WithName("Diagnosis"),
 			mgr.GetScheme(),
+			mgr.GetEventRecorderFor("kubediag/diagnosiscontroller"),
 			opts.Mode,
 			opts.NodeName,
+			opts.NodeNamePatterns,
 			nil,
+			util.QueueOverflowPolicy(opts.ExecutorQueueOverflowPolicy),
 		)).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "Diagnosis")
 			return fmt.Errorf("unable to create controller for Diagnosis: %v", err)
@@ -366,23 +445,42 @@ func (opts *KubeDiagOptions) Run() error {
 		}
 
 		// Channel for queuing Diagnoses to pipeline for executing operations.
-		executorCh := make(chan diagnosisv1.Diagnosis, 1000)
+		executorCh := make(chan diagnosisv1.Diagnosis, opts.ExecutorChannelBufferSize)
 		stopCh := SetupSignalHandler()
 
 		// Run executor.
-		executor := executor.NewExecutor(
+		executor, err := executor.NewExecutor(
 			context.Background(),
 			ctrl.Log.WithName("executor"),
 			mgr.GetClient(),
+			mgr.GetAPIReader(),
 			mgr.GetEventRecorderFor("kubediag/executor"),
 			mgr.GetScheme(),
 			mgr.GetCache(),
 			opts.NodeName,
+			opts.NodeNamePatterns,
 			opts.BindAddress,
 			opts.Port,
 			opts.DataRoot,
+			opts.ProcessorTokenFile,
+			opts.ExecutorMaxSyncRetries,
+			opts.ExecutorDrainTimeout,
+			opts.ExecutorMaxContextBytes,
+			opts.ExecutorBreakerFailureThreshold,
+			opts.ExecutorBreakerCooldown,
+			executor.TransportConfig{
+				CAFile:           opts.ExecutorTransportCAFile,
+				ClientCertFile:   opts.ExecutorTransportClientCertFile,
+				ClientKeyFile:    opts.ExecutorTransportClientKeyFile,
+				EnableKeepAlives: opts.ExecutorTransportEnableKeepAlives,
+				MaxIdleConns:     opts.ExecutorTransportMaxIdleConns,
+			},
 			executorCh,
 		)
+		if err != nil {
+			setupLog.Error(err, "unable to create executor")
+			return fmt.Errorf("unable to create executor: %v", err)
+		}
 		go func(stopCh chan struct{}) {
 			executor.Run(stopCh)
 		}(stopCh)
@@ -392,12 +490,15 @@ func (opts *KubeDiagOptions) Run() error {
 			context.Background(),
 			ctrl.Log.WithName("diagnosisreaper"),
 			mgr.GetClient(),
+			mgr.GetEventRecorderFor("kubediag/diagnosisreaper"),
 			mgr.GetScheme(),
 			mgr.GetCache(),
 			opts.NodeName,
 			opts.DiagnosisTTL,
 			opts.MinimumDiagnosisTTLDuration,
 			opts.MaximumDiagnosesPerNode,
+			opts.PendingPhaseTimeout,
+			opts.RunningPhaseTimeout,
 			opts.DataRoot,
 		)
 		go func(stopCh chan struct{}) {
@@ -406,15 +507,20 @@ func (opts *KubeDiagOptions) Run() error {
 
 		router := mux.NewRouter()
 		router.HandleFunc("/healthz", HealthCheckHandler)
+		router.HandleFunc("/healthz/executor", executor.Healthz)
 		// Start pprof server.
 		router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
 
 		// Setup operation processors.
 		registryOpt := &register.RegistryOption{
-			NodeName:       opts.NodeName,
-			DockerEndpoint: opts.DockerEndpoint,
-			DataRoot:       opts.DataRoot,
-			BindAddress:    opts.BindAddress,
+			NodeName:                         opts.NodeName,
+			DockerEndpoint:                   opts.DockerEndpoint,
+			DataRoot:                         opts.DataRoot,
+			BindAddress:                      opts.BindAddress,
+			MaxRequestsInFlight:              opts.ProcessorMaxRequestsInFlight,
+			TokenFile:                        opts.ProcessorTokenFile,
+			WebhookNotifierURL:               opts.WebhookNotifierURL,
+			FileCollectorAllowedPathPrefixes: opts.FileCollectorAllowedPathPrefixes,
 		}
 		err = register.RegisterProcessors(mgr, registryOpt, featureGate, router, setupLog)
 		if err != nil {
@@ -422,6 +528,9 @@ func (opts *KubeDiagOptions) Run() error {
 			return fmt.Errorf("unable to register processors for Diagnosis: %v", err)
 		}
 
+		// Shutdown expired profiler sessions in the background to free their ports.
+		go processors.RunProfilerSessionReaper(ctrl.Log.WithName("profilersessionreaper"), opts.ProfilerSessionReaperInterval, stopCh)
+
 		// Start http server.
 		go func(stopCh chan struct{}) {
 			if err := http.ListenAndServe(fmt.Sprintf("%s:%d", opts.BindAddress, opts.Port), router); err != nil {
@@ -435,9 +544,12 @@ func (opts *KubeDiagOptions) Run() error {
 			mgr.GetClient(),
 			ctrl.Log.WithName("controllers").WithName("Diagnosis"),
 			mgr.GetScheme(),
+			mgr.GetEventRecorderFor("kubediag/diagnosiscontroller"),
 			opts.Mode,
 			opts.NodeName,
+			opts.NodeNamePatterns,
 			executorCh,
+			util.QueueOverflowPolicy(opts.ExecutorQueueOverflowPolicy),
 		)).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "Diagnosis")
 			return fmt.Errorf("unable to create controller for Diagnosis: %v", err)
@@ -472,6 +584,7 @@ func (opts *KubeDiagOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&opts.BindAddress, "bind-address", opts.BindAddress, "The address on which to advertise.")
 	fs.IntVar(&opts.Port, "port", opts.Port, "The port for the kubediag to serve on.")
 	fs.StringVar(&opts.NodeName, "node-name", opts.NodeName, "The node name.")
+	fs.StringSliceVar(&opts.NodeNamePatterns, "node-name-patterns", opts.NodeNamePatterns, "The list of glob or regular expression patterns of node names the agent is responsible for. Regular expressions are wrapped in slashes. The node name is matched exactly if empty.")
 	fs.IntVar(&opts.MetricsPort, "metrics-port", opts.MetricsPort, "The port the metric endpoint to serve on.")
 	fs.BoolVar(&opts.EnableLeaderElection, "enable-leader-election", opts.EnableLeaderElection, "Enables leader election for kubediag master.")
 	fs.StringVar(&opts.DockerEndpoint, "docker-endpoint", "unix:///var/run/docker.sock", "The docker endpoint.")
@@ -479,13 +592,33 @@ func (opts *KubeDiagOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&opts.Host, "host", opts.Host, "The hostname that the webhook server binds to.")
 	fs.StringVar(&opts.CertDir, "cert-dir", opts.CertDir, "The directory that contains the server key and certificate.")
 	fs.DurationVar(&opts.AlertmanagerRepeatInterval, "repeat-interval", opts.AlertmanagerRepeatInterval, "How long to wait before sending a notification again if it has already been sent successfully for an alert.")
+	fs.BoolVar(&opts.DisableTriggerCascading, "disable-trigger-cascading", opts.DisableTriggerCascading, "Disable setting the owner reference of generated diagnoses to their trigger. Diagnoses are not garbage collected on trigger deletion if set.")
 	fs.StringSliceVar(&opts.KafkaBrokers, "kafka-brokers", opts.KafkaBrokers, "The list of broker addresses used to connect to the kafka cluster.")
 	fs.StringVar(&opts.KafkaTopic, "kafka-topic", opts.KafkaTopic, "The topic to read messages from.")
 	fs.DurationVar(&opts.DiagnosisTTL, "diagnosis-ttl", opts.DiagnosisTTL, "Amount of time to retain diagnoses.")
 	fs.DurationVar(&opts.MinimumDiagnosisTTLDuration, "minimum-diagnosis-ttl-duration", opts.MinimumDiagnosisTTLDuration, "Minimum age for a finished diagnosis before it is garbage collected.")
 	fs.Int32Var(&opts.MaximumDiagnosesPerNode, "maximum-diagnoses-per-node", opts.MaximumDiagnosesPerNode, "Maximum number of finished diagnoses to retain per node.")
+	fs.DurationVar(&opts.PendingPhaseTimeout, "pending-phase-timeout", opts.PendingPhaseTimeout, "Amount of time a diagnosis may stay in Pending phase before it is failed. Zero disables the timeout.")
+	fs.DurationVar(&opts.RunningPhaseTimeout, "running-phase-timeout", opts.RunningPhaseTimeout, "Amount of time a diagnosis may stay in Running phase before it is failed. Zero disables the timeout.")
 	fs.Var(flag.NewMapStringBool(&opts.FeatureGates), "feature-gates", "A map of feature names to bools that enable or disable features. Options are:\n"+strings.Join(features.NewFeatureGate().KnownFeatures(), "\n"))
 	fs.StringVar(&opts.DataRoot, "data-root", opts.DataRoot, "Root directory of persistent kubediag data.")
+	fs.IntVar(&opts.ProcessorMaxRequestsInFlight, "processor-max-requests-in-flight", opts.ProcessorMaxRequestsInFlight, "Maximum number of requests a processor handles simultaneously. Defaults to 0 which means unlimited.")
+	fs.StringVar(&opts.ProcessorTokenFile, "processor-token-file", opts.ProcessorTokenFile, "Path of a file containing the bearer token which processor requests are authenticated against. Authentication is disabled if empty.")
+	fs.DurationVar(&opts.ProfilerSessionReaperInterval, "profiler-session-reaper-interval", opts.ProfilerSessionReaperInterval, "Interval on which expired profiler sessions are shut down and their ports are freed.")
+	fs.StringSliceVar(&opts.FileCollectorAllowedPathPrefixes, "file-collector-allowed-path-prefixes", opts.FileCollectorAllowedPathPrefixes, "The list of path prefixes the file collector may read files from. Paths outside the prefixes are reported as skipped.")
+	fs.StringVar(&opts.WebhookNotifierURL, "webhook-notifier-url", opts.WebhookNotifierURL, "The default url which the webhook notifier delivers notifications to.")
+	fs.IntVar(&opts.ExecutorMaxSyncRetries, "executor-max-sync-retries", opts.ExecutorMaxSyncRetries, "Maximum number of retries of a diagnosis sync on transient errors. A diagnosis is marked as failed once the limit is exceeded. Zero means unlimited retries.")
+	fs.IntVar(&opts.ExecutorChannelBufferSize, "executor-channel-buffer-size", opts.ExecutorChannelBufferSize, "Buffer size of the channel which queues diagnoses to the executor.")
+	fs.StringVar(&opts.ExecutorQueueOverflowPolicy, "executor-queue-overflow-policy", opts.ExecutorQueueOverflowPolicy, "Behavior of enqueuing a diagnosis when the executor channel is full. One of reject-new, drop-oldest and block.")
+	fs.DurationVar(&opts.ExecutorDrainTimeout, "executor-drain-timeout", opts.ExecutorDrainTimeout, "Maximum time the executor spends processing queued diagnoses after receiving a stop signal. Zero disables draining.")
+	fs.IntVar(&opts.ExecutorBreakerFailureThreshold, "executor-breaker-failure-threshold", opts.ExecutorBreakerFailureThreshold, "Number of consecutive failed requests to one operation processor url after which its circuit breaker opens. Zero disables circuit breaking.")
+	fs.DurationVar(&opts.ExecutorBreakerCooldown, "executor-breaker-cooldown", opts.ExecutorBreakerCooldown, "Time an open circuit breaker short-circuits dispatch to its operation processor url before a half open probe is allowed through.")
+	fs.IntVar(&opts.ExecutorMaxContextBytes, "executor-max-context-bytes", opts.ExecutorMaxContextBytes, "Maximum size in bytes of a single operation result value recorded in a diagnosis. Larger values are spilled into files under the data root. Zero disables the limit.")
+	fs.StringVar(&opts.ExecutorTransportCAFile, "executor-transport-ca-file", opts.ExecutorTransportCAFile, "Path of a ca bundle for verifying operation processor certificates. Certificate verification is skipped if empty.")
+	fs.StringVar(&opts.ExecutorTransportClientCertFile, "executor-transport-client-cert-file", opts.ExecutorTransportClientCertFile, "Path of a client certificate presented to operation processors.")
+	fs.StringVar(&opts.ExecutorTransportClientKeyFile, "executor-transport-client-key-file", opts.ExecutorTransportClientKeyFile, "Path of the private key of the client certificate presented to operation processors.")
+	fs.BoolVar(&opts.ExecutorTransportEnableKeepAlives, "executor-transport-enable-keep-alives", opts.ExecutorTransportEnableKeepAlives, "Enable http keep alive connections to operation processors.")
+	fs.IntVar(&opts.ExecutorTransportMaxIdleConns, "executor-transport-max-idle-conns", opts.ExecutorTransportMaxIdleConns, "Maximum number of idle connections to operation processors. Defaults to 0 which applies the default of the http package.")
 }
 
 // SetupSignalHandler registers for SIGTERM and SIGINT. A stop channel is returned
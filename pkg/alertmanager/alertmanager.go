@@ -45,6 +45,9 @@ var (
 	PrometheusAlertGeneratedDiagnosisPrefix = "prometheus-alert"
 	// PrometheusAlertAnnotation is the annotation used to store the prometheus alert that triggers a diagnosis.
 	PrometheusAlertAnnotation = util.KubeDiagPrefix + PrometheusAlertGeneratedDiagnosisPrefix
+	// ParameterKeyAlertStartsAt is the parameter key recording the start time of the prometheus
+	// alert which generated the diagnosis.
+	ParameterKeyAlertStartsAt = "alert.starts_at"
 )
 
 var (
@@ -90,6 +93,9 @@ type alertmanager struct {
 	repeatInterval time.Duration
 	// firingAlertSet contains all alerts fired by alertmanager.
 	firingAlertSet map[uint64]time.Time
+	// triggerCascadingDisabled indicates whether generated diagnoses omit the owner reference
+	// to their trigger so they outlive trigger deletion.
+	triggerCascadingDisabled bool
 	// alertmanagerEnabled indicates whether alertmanager is enabled.
 	alertmanagerEnabled bool
 }
@@ -101,6 +107,7 @@ func NewAlertmanager(
 	cli client.Client,
 	cache cache.Cache,
 	repeatInterval time.Duration,
+	triggerCascadingDisabled bool,
 	alertmanagerEnabled bool,
 ) Alertmanager {
 	metrics.Registry.MustRegister(
@@ -112,13 +119,14 @@ func NewAlertmanager(
 	firingAlertSet := make(map[uint64]time.Time)
 
 	return &alertmanager{
-		Context:             ctx,
-		Logger:              logger,
-		client:              cli,
-		cache:               cache,
-		repeatInterval:      repeatInterval,
-		firingAlertSet:      firingAlertSet,
-		alertmanagerEnabled: alertmanagerEnabled,
+		Context:                  ctx,
+		Logger:                   logger,
+		client:                   cli,
+		cache:                    cache,
+		repeatInterval:           repeatInterval,
+		firingAlertSet:           firingAlertSet,
+		triggerCascadingDisabled: triggerCascadingDisabled,
+		alertmanagerEnabled:      alertmanagerEnabled,
 	}
 }
 
@@ -220,10 +228,29 @@ func (am *alertmanager) createDiagnosisFromPrometheusAlert(triggers []diagnosisv
 			}
 
 			if matched {
+				// Skip if a diagnosis generated from the alert has not been completed yet. This avoids
+				// duplicated diagnoses on the same firing alert.
+				unresolved, err := am.unresolvedDiagnosisExists(alert)
+				if err != nil {
+					am.Error(err, "failed to check unresolved diagnoses of prometheus alert")
+					continue
+				}
+				if unresolved {
+					am.Info("skipping prometheus alert with unresolved diagnosis", "alert", alert.String())
+					continue
+				}
+
+				// Skip if the alert label set is in the cooldown window defined by the trigger. This
+				// prevents diagnosis storms on rapidly repeating alerts.
+				now := time.Now()
+				if alertInCooldown(trigger, alert, now) {
+					am.Info("skipping prometheus alert in cooldown window", "alert", alert.String(), "trigger", trigger.Name)
+					continue
+				}
+
 				am.Info("creating Diagnosis from prometheus alert", "alert", alert.String())
 
 				// Create diagnosis according to the prometheus alert.
-				now := time.Now()
 				name := fmt.Sprintf("%s.%s.%s.%d", PrometheusAlertGeneratedDiagnosisPrefix, strings.ToLower(alert.Name()), alert.Fingerprint().String()[:7], now.Unix())
 				namespace := util.DefautlNamespace
 				annotations := make(map[string]string)
@@ -272,16 +299,38 @@ func (am *alertmanager) createDiagnosisFromPrometheusAlert(triggers []diagnosisv
 						parameters[string(label)] = string(value)
 					}
 				}
+				if !alert.StartsAt.IsZero() {
+					parameters[ParameterKeyAlertStartsAt] = alert.StartsAt.Format(time.RFC3339)
+				}
 				diagnosis.Spec.Parameters = parameters
 
-				if err := am.client.Create(am, &diagnosis); err != nil {
+				// Set the trigger as the controller owner so the diagnosis is garbage collected
+				// on trigger deletion unless cascading is disabled.
+				if !am.triggerCascadingDisabled {
+					util.SetDiagnosisOwnerReferenceToTrigger(&diagnosis, trigger)
+				}
+
+				created, merged, err := util.CreateOrMergeDiagnosis(am, am.client, am.cache, &diagnosis, nil)
+				if err != nil {
 					if !apierrors.IsAlreadyExists(err) {
 						am.Error(err, "unable to create Diagnosis")
 						return &diagnosis, err
 					}
+					created = &diagnosis
+				}
+				if merged {
+					am.Info("merged duplicate diagnosis into existing one", "diagnosis", client.ObjectKey{
+						Name:      created.Name,
+						Namespace: created.Namespace,
+					})
 				}
 
-				return &diagnosis, nil
+				// Record the creation time of the alert label set in trigger status for the cooldown.
+				if err := am.updateTriggerLastAlertTime(trigger, alert, now); err != nil {
+					am.Error(err, "unable to update last alert time of Trigger", "trigger", trigger.Name)
+				}
+
+				return created, nil
 			}
 		}
 	}
@@ -289,6 +338,64 @@ func (am *alertmanager) createDiagnosisFromPrometheusAlert(triggers []diagnosisv
 	return nil, nil
 }
 
+// unresolvedDiagnosisExists reports whether a diagnosis generated from the provided prometheus alert
+// exists and has not been completed yet.
+func (am *alertmanager) unresolvedDiagnosisExists(alert *types.Alert) (bool, error) {
+	var diagnosisList diagnosisv1.DiagnosisList
+	if err := am.cache.List(am, &diagnosisList, client.InNamespace(util.DefautlNamespace)); err != nil {
+		return false, err
+	}
+
+	// Diagnoses generated from the same alert share the name prefix constructed from alert name and fingerprint.
+	namePrefix := fmt.Sprintf("%s.%s.%s.", PrometheusAlertGeneratedDiagnosisPrefix, strings.ToLower(alert.Name()), alert.Fingerprint().String()[:7])
+	for _, diagnosis := range diagnosisList.Items {
+		if strings.HasPrefix(diagnosis.Name, namePrefix) && !util.IsDiagnosisCompleted(diagnosis) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// updateTriggerLastAlertTime records the creation time of the alert label set in trigger status and
+// prunes entries which have passed the cooldown window. It is a no-op if no cooldown is defined in
+// the prometheus alert template of the trigger.
+func (am *alertmanager) updateTriggerLastAlertTime(trigger diagnosisv1.Trigger, alert *types.Alert, now time.Time) error {
+	prometheusAlertTemplate := trigger.Spec.SourceTemplate.PrometheusAlertTemplate
+	if prometheusAlertTemplate == nil || prometheusAlertTemplate.CooldownSeconds == nil || *prometheusAlertTemplate.CooldownSeconds <= 0 {
+		return nil
+	}
+
+	cooldown := time.Duration(*prometheusAlertTemplate.CooldownSeconds) * time.Second
+	if trigger.Status.LastAlertTimes == nil {
+		trigger.Status.LastAlertTimes = make(map[string]metav1.Time)
+	}
+	for fingerprint, lastAlertTime := range trigger.Status.LastAlertTimes {
+		if lastAlertTime.Add(cooldown).Before(now) {
+			delete(trigger.Status.LastAlertTimes, fingerprint)
+		}
+	}
+	trigger.Status.LastAlertTimes[alert.Fingerprint().String()] = metav1.NewTime(now)
+
+	return am.client.Status().Update(am, &trigger)
+}
+
+// alertInCooldown reports whether diagnosis creation for the alert label set should be suppressed
+// according to the cooldown defined in the prometheus alert template of the trigger.
+func alertInCooldown(trigger diagnosisv1.Trigger, alert *types.Alert, now time.Time) bool {
+	prometheusAlertTemplate := trigger.Spec.SourceTemplate.PrometheusAlertTemplate
+	if prometheusAlertTemplate == nil || prometheusAlertTemplate.CooldownSeconds == nil || *prometheusAlertTemplate.CooldownSeconds <= 0 {
+		return false
+	}
+
+	lastAlertTime, ok := trigger.Status.LastAlertTimes[alert.Fingerprint().String()]
+	if !ok {
+		return false
+	}
+
+	return lastAlertTime.Add(time.Duration(*prometheusAlertTemplate.CooldownSeconds) * time.Second).After(now)
+}
+
 // matchPrometheusAlert reports whether the diagnosis contains all match of the regular expression pattern
 // defined in prometheus alert template.
 func matchPrometheusAlert(prometheusAlertTemplate diagnosisv1.PrometheusAlertTemplate, alert *types.Alert) (bool, error) {
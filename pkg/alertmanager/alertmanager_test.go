@@ -25,6 +25,7 @@ import (
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
 )
@@ -275,3 +276,96 @@ func TestMatchPrometheusAlert(t *testing.T) {
 		}
 	}
 }
+
+func TestAlertInCooldown(t *testing.T) {
+	now := time.Now()
+	cooldownSeconds := int32(60)
+	alert := &types.Alert{
+		Alert: model.Alert{
+			Labels: model.LabelSet{
+				"alertname": "alert1",
+				"node":      "node1",
+			},
+		},
+	}
+	triggerWithCooldown := func(lastAlertTime time.Time) diagnosisv1.Trigger {
+		return diagnosisv1.Trigger{
+			Spec: diagnosisv1.TriggerSpec{
+				SourceTemplate: diagnosisv1.SourceTemplate{
+					PrometheusAlertTemplate: &diagnosisv1.PrometheusAlertTemplate{
+						CooldownSeconds: &cooldownSeconds,
+					},
+				},
+			},
+			Status: diagnosisv1.TriggerStatus{
+				LastAlertTimes: map[string]metav1.Time{
+					alert.Fingerprint().String(): metav1.NewTime(lastAlertTime),
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		trigger  diagnosisv1.Trigger
+		alert    *types.Alert
+		expected bool
+		desc     string
+	}{
+		{
+			trigger: diagnosisv1.Trigger{
+				Spec: diagnosisv1.TriggerSpec{
+					SourceTemplate: diagnosisv1.SourceTemplate{
+						PrometheusAlertTemplate: &diagnosisv1.PrometheusAlertTemplate{},
+					},
+				},
+			},
+			alert:    alert,
+			expected: false,
+			desc:     "cooldown not defined",
+		},
+		{
+			trigger: diagnosisv1.Trigger{
+				Spec: diagnosisv1.TriggerSpec{
+					SourceTemplate: diagnosisv1.SourceTemplate{
+						PrometheusAlertTemplate: &diagnosisv1.PrometheusAlertTemplate{
+							CooldownSeconds: &cooldownSeconds,
+						},
+					},
+				},
+			},
+			alert:    alert,
+			expected: false,
+			desc:     "alert label set not recorded",
+		},
+		{
+			trigger:  triggerWithCooldown(now),
+			alert:    alert,
+			expected: true,
+			desc:     "repeated alert in cooldown window",
+		},
+		{
+			trigger:  triggerWithCooldown(now.Add(-2 * time.Minute)),
+			alert:    alert,
+			expected: false,
+			desc:     "cooldown window passed",
+		},
+		{
+			trigger: triggerWithCooldown(now),
+			alert: &types.Alert{
+				Alert: model.Alert{
+					Labels: model.LabelSet{
+						"alertname": "alert1",
+						"node":      "node2",
+					},
+				},
+			},
+			expected: false,
+			desc:     "different alert label set not suppressed",
+		},
+	}
+
+	for _, test := range tests {
+		suppressed := alertInCooldown(test.trigger, test.alert, now)
+		assert.Equal(t, test.expected, suppressed, test.desc)
+	}
+}
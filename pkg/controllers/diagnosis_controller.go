@@ -19,12 +19,15 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -33,6 +36,15 @@ import (
 	"github.com/kubediag/kubediag/pkg/util"
 )
 
+var (
+	// ReprocessAnnotation marks a finished diagnosis to be run through the pipeline again. The
+	// annotation is removed and the status is reset when the reprocess is started.
+	ReprocessAnnotation = util.KubeDiagPrefix + "reprocess"
+	// PreviousStartTimeAnnotation preserves the start time of the previous run of a reprocessed
+	// diagnosis.
+	PreviousStartTimeAnnotation = util.KubeDiagPrefix + "previous-start-time"
+)
+
 // Kubediag master metrics
 var (
 	diagnosisMasterSkipCount = prometheus.NewCounter(
@@ -65,6 +77,15 @@ var (
 			Help: "Counter of total fail diagnosis",
 		},
 	)
+	diagnosisSourcePhaseCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "diagnosis_source_phase_count",
+			Help: "Counter of diagnoses by source and phase",
+		},
+		// Label cardinality is bounded since the source is one of the known source constants and
+		// the phase is one of the diagnosis phases.
+		[]string{"source", "phase"},
+	)
 	diagnosisInfo = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "diagnosis_info",
@@ -88,6 +109,12 @@ var (
 			Help: "Counter of diagnosis sync queued by agent",
 		},
 	)
+	diagnosisAgentQueueErrorCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "diagnosis_agent_queue_error_count",
+			Help: "Counter of diagnoses which could not be queued by agent",
+		},
+	)
 )
 
 // DiagnosisReconciler reconciles a Diagnosis object.
@@ -96,9 +123,17 @@ type DiagnosisReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 
-	mode       string
-	nodeName   string
-	executorCh chan diagnosisv1.Diagnosis
+	mode     string
+	nodeName string
+	// nodeNamePatterns restricts the agent to diagnoses whose node name matches one of the glob
+	// or regular expression patterns. The node name is matched exactly if empty.
+	nodeNamePatterns []string
+	// eventRecorder knows how to record events on behalf of an EventSource.
+	eventRecorder record.EventRecorder
+	executorCh    chan diagnosisv1.Diagnosis
+	// queueOverflowPolicy determines the behavior of enqueuing a diagnosis when the executor
+	// channel is full.
+	queueOverflowPolicy util.QueueOverflowPolicy
 }
 
 // NewDiagnosisReconciler creates a new DiagnosisReconciler.
@@ -106,9 +141,12 @@ func NewDiagnosisReconciler(
 	cli client.Client,
 	log logr.Logger,
 	scheme *runtime.Scheme,
+	eventRecorder record.EventRecorder,
 	mode string,
 	nodeName string,
+	nodeNamePatterns []string,
 	executorCh chan diagnosisv1.Diagnosis,
+	queueOverflowPolicy util.QueueOverflowPolicy,
 ) *DiagnosisReconciler {
 	if mode == "master" {
 		metrics.Registry.MustRegister(
@@ -117,29 +155,45 @@ func NewDiagnosisReconciler(
 			diagnosisTotalCount,
 			diagnosisTotalSuccessCount,
 			diagnosisTotalFailCount,
+			diagnosisSourcePhaseCount,
 			diagnosisInfo,
 		)
 	} else if mode == "agent" {
 		metrics.Registry.MustRegister(
 			diagnosisAgentSkipCount,
 			diagnosisAgentQueuedCount,
+			diagnosisAgentQueueErrorCount,
 		)
 	}
 
 	return &DiagnosisReconciler{
-		Client:     cli,
-		Log:        log,
-		Scheme:     scheme,
-		mode:       mode,
-		nodeName:   nodeName,
-		executorCh: executorCh,
+		Client:              cli,
+		Log:                 log,
+		Scheme:              scheme,
+		eventRecorder:       eventRecorder,
+		mode:                mode,
+		nodeName:            nodeName,
+		nodeNamePatterns:    nodeNamePatterns,
+		executorCh:          executorCh,
+		queueOverflowPolicy: queueOverflowPolicy,
+	}
+}
+
+// isDiagnosisOnNode checks if the diagnosis should be processed by this agent. The diagnosis is
+// matched against the node name patterns if configured and against the node name otherwise.
+func (r *DiagnosisReconciler) isDiagnosisOnNode(diagnosis diagnosisv1.Diagnosis) bool {
+	if len(r.nodeNamePatterns) != 0 {
+		return util.IsDiagnosisNodeMatchedByPattern(diagnosis, r.nodeNamePatterns)
 	}
+
+	return util.IsDiagnosisNodeNameMatched(diagnosis, r.nodeName)
 }
 
 // +kubebuilder:rbac:groups=diagnosis.kubediag.org,resources=diagnoses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=diagnosis.kubediag.org,resources=diagnoses/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=diagnosis.kubediag.org,resources=operations,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=core,resources=pods/eviction,verbs=create
 // +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch
@@ -168,20 +222,46 @@ func (r *DiagnosisReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	if r.mode == "master" {
 		switch diagnosis.Status.Phase {
 		case "":
-			if diagnosis.Spec.NodeName == "" && diagnosis.Spec.PodReference == nil {
-				// Ignore diagnosis if nodeName and podReference are both empty.
-				log.Error(fmt.Errorf("nodeName and podReference are both empty"), "ignoring invalid Diagnosis")
+			if diagnosis.Spec.OperationSet == "" && diagnosis.Spec.OperationSetSelector != nil {
+				// Resolve operation set selector to the name of a matched operation set.
+				operationSetName, err := r.resolveOperationSetSelector(ctx, diagnosis)
+				if err != nil {
+					log.Error(err, "unable to resolve operation set selector, ignoring invalid Diagnosis")
+
+					diagnosisMasterSkipCount.Inc()
+					diagnosisTotalCount.Inc()
+
+					return ctrl.Result{}, nil
+				}
+
+				diagnosis.Spec.OperationSet = operationSetName
+				if err := r.Update(ctx, &diagnosis); err != nil {
+					log.Error(err, "unable to update Diagnosis")
+					return ctrl.Result{}, client.IgnoreNotFound(err)
+				}
+
+				return ctrl.Result{}, nil
+			}
+
+			if diagnosis.Spec.NodeName == "" && diagnosis.Spec.PodReference == nil && len(diagnosis.Spec.PodReferences) == 0 {
+				// Ignore diagnosis if nodeName, podReference and podReferences are all empty.
+				log.Error(fmt.Errorf("nodeName, podReference and podReferences are all empty"), "ignoring invalid Diagnosis")
 
 				diagnosisMasterSkipCount.Inc()
 				diagnosisTotalCount.Inc()
 
 				return ctrl.Result{}, nil
 			} else if diagnosis.Spec.NodeName == "" {
-				// Set diagnosis NodeName if NodeName is empty and PodReference is not nil.
+				// Set diagnosis NodeName if NodeName is empty and a pod reference is specified.
+				// The first reference determines the node if a set of pods is referenced.
+				podReference := diagnosis.Spec.PodReference
+				if podReference == nil {
+					podReference = &diagnosis.Spec.PodReferences[0]
+				}
 				var pod corev1.Pod
 				if err := r.Get(ctx, client.ObjectKey{
-					Name:      diagnosis.Spec.PodReference.Name,
-					Namespace: diagnosis.Spec.PodReference.Namespace,
+					Name:      podReference.Name,
+					Namespace: podReference.Namespace,
 				}, &pod); err != nil {
 					log.Error(err, "unable to fetch Pod")
 					return ctrl.Result{}, client.IgnoreNotFound(err)
@@ -202,19 +282,38 @@ func (r *DiagnosisReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 				diagnosis.Status.StartTime = metav1.Now()
 				diagnosis.Status.Phase = diagnosisv1.DiagnosisPending
+				// Record the admission stage in conditions so that a diagnosis stuck in Pending
+				// is distinguishable from one never admitted. The condition is set to true by the
+				// agent on the node once it accepts the diagnosis.
+				util.UpdateDiagnosisCondition(&diagnosis.Status, &diagnosisv1.DiagnosisCondition{
+					Type:    diagnosisv1.DiagnosisAccepted,
+					Status:  corev1.ConditionFalse,
+					Reason:  "DiagnosisQueued",
+					Message: fmt.Sprintf("Diagnosis is waiting to be accepted by agent on node %s", diagnosis.Spec.NodeName),
+				})
 				if err := r.Status().Update(ctx, &diagnosis); err != nil {
 					log.Error(err, "unable to update Diagnosis")
 					return ctrl.Result{}, client.IgnoreNotFound(err)
 				}
 				diagnosisTotalCount.Inc()
+				diagnosisSourcePhaseCount.WithLabelValues(util.DiagnosisSource(diagnosis), string(diagnosisv1.DiagnosisPending)).Inc()
+				RecordDiagnosisPhaseChange(r.eventRecorder, &diagnosis, "master", "diagnosis accepted by kubediag master")
 			}
 		case diagnosisv1.DiagnosisFailed:
+			if diagnosis.Annotations[ReprocessAnnotation] == "true" {
+				return r.reprocessDiagnosis(ctx, log, diagnosis)
+			}
 			diagnosisTotalFailCount.Inc()
+			diagnosisSourcePhaseCount.WithLabelValues(util.DiagnosisSource(diagnosis), string(diagnosisv1.DiagnosisFailed)).Inc()
 		case diagnosisv1.DiagnosisSucceeded:
+			if diagnosis.Annotations[ReprocessAnnotation] == "true" {
+				return r.reprocessDiagnosis(ctx, log, diagnosis)
+			}
 			diagnosisTotalSuccessCount.Inc()
+			diagnosisSourcePhaseCount.WithLabelValues(util.DiagnosisSource(diagnosis), string(diagnosisv1.DiagnosisSucceeded)).Inc()
 		}
 	} else if r.mode == "agent" {
-		if !util.IsDiagnosisNodeNameMatched(diagnosis, r.nodeName) {
+		if !r.isDiagnosisOnNode(diagnosis) {
 			return ctrl.Result{}, nil
 		}
 
@@ -236,11 +335,15 @@ func (r *DiagnosisReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				log.Error(err, "unable to update Diagnosis")
 				return ctrl.Result{}, client.IgnoreNotFound(err)
 			}
+			RecordDiagnosisPhaseChange(r.eventRecorder, &diagnosis, "agent", fmt.Sprintf("diagnosis accepted by agent on node %s", diagnosis.Spec.NodeName))
 
 		case diagnosisv1.DiagnosisRunning:
-			err := util.QueueDiagnosis(ctx, r.executorCh, diagnosis)
+			err := util.QueueDiagnosisWithPolicy(ctx, r.executorCh, diagnosis, r.queueOverflowPolicy)
 			if err != nil {
 				log.Error(err, "failed to send diagnosis to executor queue")
+				diagnosisAgentQueueErrorCount.Inc()
+				r.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "DiagnosisDropped", "Diagnosis %s/%s dropped since executor queue is full", diagnosis.Namespace, diagnosis.Name)
+				break
 			}
 			diagnosisAgentQueuedCount.Inc()
 		case diagnosisv1.DiagnosisSucceeded:
@@ -255,6 +358,75 @@ func (r *DiagnosisReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
+// reprocessDiagnosis runs a finished diagnosis through the pipeline again. The status is reset
+// so the diagnosis is accepted as a new one while the spec is preserved. The start time of the
+// previous run is preserved in an annotation and the reprocess annotation is removed so one
+// annotation update starts exactly one rerun.
+func (r *DiagnosisReconciler) reprocessDiagnosis(ctx context.Context, log logr.Logger, diagnosis diagnosisv1.Diagnosis) (ctrl.Result, error) {
+	log.Info("reprocessing finished Diagnosis", "diagnosis", client.ObjectKey{
+		Name:      diagnosis.Name,
+		Namespace: diagnosis.Namespace,
+	}, "phase", diagnosis.Status.Phase)
+
+	if !diagnosis.Status.StartTime.IsZero() {
+		diagnosis.Annotations[PreviousStartTimeAnnotation] = diagnosis.Status.StartTime.UTC().Format(time.RFC3339)
+	}
+	delete(diagnosis.Annotations, ReprocessAnnotation)
+	if err := r.Update(ctx, &diagnosis); err != nil {
+		log.Error(err, "unable to update Diagnosis")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Clear conditions, operation results, checkpoint and paths. The empty phase causes the
+	// diagnosis to be accepted again with a new start time.
+	diagnosis.Status = diagnosisv1.DiagnosisStatus{}
+	if err := r.Status().Update(ctx, &diagnosis); err != nil {
+		log.Error(err, "unable to update Diagnosis")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	r.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "DiagnosisReprocessed", "Diagnosis %s/%s is reset for reprocessing", diagnosis.Namespace, diagnosis.Name)
+
+	return ctrl.Result{}, nil
+}
+
+// RecordDiagnosisPhaseChange emits a normal event marking the transition of the diagnosis into
+// its current phase. All components record phase transitions through this helper so the timeline
+// of a diagnosis is legible from kubectl describe without reading component logs.
+func RecordDiagnosisPhaseChange(eventRecorder record.EventRecorder, diagnosis *diagnosisv1.Diagnosis, component string, reason string) {
+	message := fmt.Sprintf("Diagnosis entered phase %s on %s", diagnosis.Status.Phase, component)
+	if reason != "" {
+		message = fmt.Sprintf("%s: %s", message, reason)
+	}
+	eventRecorder.Event(diagnosis, corev1.EventTypeNormal, "DiagnosisPhaseChanged", message)
+}
+
+// resolveOperationSetSelector resolves the operation set selector of a diagnosis to the name of a matched
+// operation set. The operation set with the lexicographically smallest name is picked if multiple operation
+// sets are matched by the selector.
+func (r *DiagnosisReconciler) resolveOperationSetSelector(ctx context.Context, diagnosis diagnosisv1.Diagnosis) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(diagnosis.Spec.OperationSetSelector)
+	if err != nil {
+		return "", fmt.Errorf("invalid operation set selector: %v", err)
+	}
+
+	var operationSetList diagnosisv1.OperationSetList
+	if err := r.List(ctx, &operationSetList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return "", err
+	}
+	if len(operationSetList.Items) == 0 {
+		return "", fmt.Errorf("no operation set matched by selector %s", selector.String())
+	}
+
+	names := make([]string, 0, len(operationSetList.Items))
+	for _, operationSet := range operationSetList.Items {
+		names = append(names, operationSet.Name)
+	}
+	sort.Strings(names)
+
+	return names[0], nil
+}
+
 // SetupWithManager setups DiagnosisReconciler with the provided manager.
 func (r *DiagnosisReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
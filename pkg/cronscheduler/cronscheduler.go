@@ -74,6 +74,9 @@ type cronScheduler struct {
 	client client.Client
 	// cache knows how to load Kubernetes objects.
 	cache cache.Cache
+	// triggerCascadingDisabled indicates whether generated diagnoses omit the owner reference
+	// to their trigger so they outlive trigger deletion.
+	triggerCascadingDisabled bool
 	// cronSchedulerEnabled indicates whether cron scheduler is enabled.
 	cronSchedulerEnabled bool
 }
@@ -84,6 +87,7 @@ func NewCronScheduler(
 	logger logr.Logger,
 	cli client.Client,
 	cache cache.Cache,
+	triggerCascadingDisabled bool,
 	cronSchedulerEnabled bool,
 ) CronScheduler {
 	metrics.Registry.MustRegister(
@@ -92,11 +96,12 @@ func NewCronScheduler(
 	)
 
 	return &cronScheduler{
-		Context:              ctx,
-		Logger:               logger,
-		client:               cli,
-		cache:                cache,
-		cronSchedulerEnabled: cronSchedulerEnabled,
+		Context:                  ctx,
+		Logger:                   logger,
+		client:                   cli,
+		cache:                    cache,
+		triggerCascadingDisabled: triggerCascadingDisabled,
+		cronSchedulerEnabled:     cronSchedulerEnabled,
 	}
 }
 
@@ -225,14 +230,28 @@ func (cs *cronScheduler) createDiagnosisFromCron(trigger diagnosisv1.Trigger) (*
 			},
 		}
 
-		if err := cs.client.Create(cs, &diagnosis); err != nil {
+		// Set the trigger as the controller owner so the diagnosis is garbage collected on
+		// trigger deletion unless cascading is disabled.
+		if !cs.triggerCascadingDisabled {
+			util.SetDiagnosisOwnerReferenceToTrigger(&diagnosis, trigger)
+		}
+
+		created, merged, err := util.CreateOrMergeDiagnosis(cs, cs.client, cs.cache, &diagnosis, nil)
+		if err != nil {
 			if !apierrors.IsAlreadyExists(err) {
 				cs.Error(err, "unable to create Diagnosis")
 				return &diagnosis, err
 			}
+			created = &diagnosis
+		}
+		if merged {
+			cs.Info("merged duplicate diagnosis into existing one", "diagnosis", client.ObjectKey{
+				Name:      created.Name,
+				Namespace: created.Namespace,
+			})
 		}
 
-		return &diagnosis, nil
+		return created, nil
 	}
 
 	return nil, nil
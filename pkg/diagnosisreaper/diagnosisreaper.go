@@ -18,6 +18,7 @@ package diagnosisreaper
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -26,8 +27,10 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -56,6 +59,12 @@ var (
 			Help: "Counter of erroneous diagnosis garbage collections",
 		},
 	)
+	diagnosisPhaseTimeoutCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "diagnosis_phase_timeout_count",
+			Help: "Counter of diagnoses failed on phase timeouts",
+		},
+	)
 )
 
 // DiagnosisReaper manages garbage collections of finished diagnoses.
@@ -67,6 +76,8 @@ type DiagnosisReaper struct {
 
 	// client knows how to perform CRUD operations on Kubernetes objects.
 	client client.Client
+	// eventRecorder knows how to record events on behalf of an EventSource.
+	eventRecorder record.EventRecorder
 	// scheme defines methods for serializing and deserializing API objects.
 	scheme *runtime.Scheme
 	// cache knows how to load Kubernetes objects.
@@ -79,6 +90,12 @@ type DiagnosisReaper struct {
 	minimumDiagnosisTTLDuration time.Duration
 	// maximumDiagnosesPerNode is maximum number of finished diagnoses to retain per node.
 	maximumDiagnosesPerNode int32
+	// pendingPhaseTimeout is amount of time a diagnosis may stay in Pending phase before it is failed.
+	// A zero value disables the timeout.
+	pendingPhaseTimeout time.Duration
+	// runningPhaseTimeout is amount of time a diagnosis may stay in Running phase before it is failed.
+	// A zero value disables the timeout.
+	runningPhaseTimeout time.Duration
 	// dataRoot is root directory of persistent kubediag data.
 	dataRoot string
 }
@@ -88,12 +105,15 @@ func NewDiagnosisReaper(
 	ctx context.Context,
 	logger logr.Logger,
 	cli client.Client,
+	eventRecorder record.EventRecorder,
 	scheme *runtime.Scheme,
 	cache cache.Cache,
 	nodeName string,
 	diagnosisTTL time.Duration,
 	minimumDiagnosisTTLDuration time.Duration,
 	maximumDiagnosesPerNode int32,
+	pendingPhaseTimeout time.Duration,
+	runningPhaseTimeout time.Duration,
 	dataRoot string,
 ) *DiagnosisReaper {
 
@@ -101,18 +121,22 @@ func NewDiagnosisReaper(
 		diagnosisGarbageCollectionCycleCount,
 		diagnosisGarbageCollectionSuccessCount,
 		diagnosisGarbageCollectionErrorCount,
+		diagnosisPhaseTimeoutCount,
 	)
 
 	return &DiagnosisReaper{
 		Context:                     ctx,
 		Logger:                      logger,
 		client:                      cli,
+		eventRecorder:               eventRecorder,
 		scheme:                      scheme,
 		cache:                       cache,
 		nodeName:                    nodeName,
 		diagnosisTTL:                diagnosisTTL,
 		minimumDiagnosisTTLDuration: minimumDiagnosisTTLDuration,
 		maximumDiagnosesPerNode:     maximumDiagnosesPerNode,
+		pendingPhaseTimeout:         pendingPhaseTimeout,
+		runningPhaseTimeout:         runningPhaseTimeout,
 		dataRoot:                    dataRoot,
 	}
 }
@@ -138,6 +162,9 @@ func (dr *DiagnosisReaper) Run(stopCh <-chan struct{}) {
 			return
 		}
 
+		// Fail diagnoses which have been stuck in a non terminal phase longer than the configured timeouts.
+		dr.failStuckDiagnoses(diagnoses)
+
 		reapedDiagnoses := make([]diagnosisv1.Diagnosis, 0)
 		retainedDiagnoses := make([]diagnosisv1.Diagnosis, 0)
 		if len(diagnoses) != 0 {
@@ -145,11 +172,16 @@ func (dr *DiagnosisReaper) Run(stopCh <-chan struct{}) {
 				// Garbage collect the diagnosis if it is under any of the following conditions:
 				//
 				// Its age is longer than diagnosisTTL.
+				// Its phase is Failed or Succeeded and its time to live after finished expires.
 				// Its age is longer than minimumDiagnosisTTLDuration and its phase is Failed or Succeeded.
 				if time.Now().Sub(diagnosis.Status.StartTime.Time) > dr.diagnosisTTL {
 					reapedDiagnoses = append(reapedDiagnoses, diagnosis)
-				} else if diagnosis.Status.Phase == diagnosisv1.DiagnosisFailed || diagnosis.Status.Phase == diagnosisv1.DiagnosisSucceeded {
-					if time.Now().Sub(diagnosis.Status.StartTime.Time) > dr.minimumDiagnosisTTLDuration {
+				} else if util.IsDiagnosisCompleted(diagnosis) {
+					if diagnosis.Spec.TTLSecondsAfterFinished != nil {
+						if time.Now().Sub(diagnosisCompletionTime(diagnosis)) > time.Duration(*diagnosis.Spec.TTLSecondsAfterFinished)*time.Second {
+							reapedDiagnoses = append(reapedDiagnoses, diagnosis)
+						}
+					} else if time.Now().Sub(diagnosis.Status.StartTime.Time) > dr.minimumDiagnosisTTLDuration {
 						reapedDiagnoses = append(reapedDiagnoses, diagnosis)
 					}
 				}
@@ -202,6 +234,72 @@ func (dr *DiagnosisReaper) Run(stopCh <-chan struct{}) {
 	}, housekeepingInterval, stopCh)
 }
 
+// failStuckDiagnoses transitions diagnoses which have been in a non terminal phase longer than the
+// configured timeout of the phase to Failed. A phase timeout of zero disables the watchdog for the phase.
+func (dr *DiagnosisReaper) failStuckDiagnoses(diagnoses []diagnosisv1.Diagnosis) {
+	for i := range diagnoses {
+		diagnosis := diagnoses[i]
+		var timeout time.Duration
+		switch diagnosis.Status.Phase {
+		case diagnosisv1.DiagnosisPending:
+			timeout = dr.pendingPhaseTimeout
+		case diagnosisv1.DiagnosisRunning:
+			timeout = dr.runningPhaseTimeout
+		default:
+			continue
+		}
+		if timeout == 0 || time.Now().Sub(diagnosisLastTransitionTime(diagnosis)) <= timeout {
+			continue
+		}
+
+		dr.Info("failing diagnosis on phase timeout", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		}, "phase", diagnosis.Status.Phase, "timeout", timeout)
+		dr.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "PhaseTimeout", "Diagnosis %s/%s has been in phase %s longer than %s", diagnosis.Namespace, diagnosis.Name, diagnosis.Status.Phase, timeout)
+		util.UpdateDiagnosisCondition(&diagnosis.Status, &diagnosisv1.DiagnosisCondition{
+			Type:    diagnosisv1.DiagnosisPhaseTimeout,
+			Status:  corev1.ConditionTrue,
+			Reason:  "PhaseTimeout",
+			Message: fmt.Sprintf("Diagnosis has been in phase %s longer than %s", diagnosis.Status.Phase, timeout),
+		})
+		diagnosis.Status.Phase = diagnosisv1.DiagnosisFailed
+		if err := dr.client.Status().Update(dr, &diagnosis); err != nil {
+			dr.Error(err, "unable to update diagnosis", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			})
+			continue
+		}
+		diagnosisPhaseTimeoutCount.Inc()
+	}
+}
+
+// diagnosisLastTransitionTime retrieves the time at which the diagnosis last made progress. The latest
+// transition time of all conditions is taken, or the start time of the diagnosis if no condition is present.
+func diagnosisLastTransitionTime(diagnosis diagnosisv1.Diagnosis) time.Time {
+	lastTransitionTime := diagnosis.Status.StartTime.Time
+	for _, condition := range diagnosis.Status.Conditions {
+		if condition.LastTransitionTime.Time.After(lastTransitionTime) {
+			lastTransitionTime = condition.LastTransitionTime.Time
+		}
+	}
+
+	return lastTransitionTime
+}
+
+// diagnosisCompletionTime retrieves the time at which the diagnosis completed its execution. The last
+// transition time of DiagnosisComplete condition is taken as the completion time, or the start time of
+// the diagnosis if the condition is not present.
+func diagnosisCompletionTime(diagnosis diagnosisv1.Diagnosis) time.Time {
+	_, condition := util.GetDiagnosisCondition(&diagnosis.Status, diagnosisv1.DiagnosisComplete)
+	if condition != nil {
+		return condition.LastTransitionTime.Time
+	}
+
+	return diagnosis.Status.StartTime.Time
+}
+
 // listDiagnoses lists Diagnoses from cache.
 func (dr *DiagnosisReaper) listDiagnoses() ([]diagnosisv1.Diagnosis, error) {
 	var diagnosisList diagnosisv1.DiagnosisList
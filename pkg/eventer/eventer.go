@@ -82,6 +82,9 @@ type eventer struct {
 	cache cache.Cache
 	// eventChainCh is a channel for queuing Events to be processed by eventer.
 	eventChainCh chan corev1.Event
+	// triggerCascadingDisabled indicates whether generated diagnoses omit the owner reference
+	// to their trigger so they outlive trigger deletion.
+	triggerCascadingDisabled bool
 	// eventerEnabled indicates whether eventer is enabled.
 	eventerEnabled bool
 }
@@ -93,6 +96,7 @@ func NewEventer(
 	cli client.Client,
 	cache cache.Cache,
 	eventChainCh chan corev1.Event,
+	triggerCascadingDisabled bool,
 	eventerEnabled bool,
 ) Eventer {
 	metrics.Registry.MustRegister(
@@ -102,10 +106,13 @@ func NewEventer(
 	)
 
 	return &eventer{
-		Context:        ctx,
-		Logger:         logger,
-		eventChainCh:   eventChainCh,
-		eventerEnabled: eventerEnabled,
+		Context:                  ctx,
+		Logger:                   logger,
+		client:                   cli,
+		cache:                    cache,
+		eventChainCh:             eventChainCh,
+		triggerCascadingDisabled: triggerCascadingDisabled,
+		eventerEnabled:           eventerEnabled,
 	}
 }
 
@@ -177,13 +184,23 @@ func (ev *eventer) createDiagnosisFromKubernetesEvent(triggers []diagnosisv1.Tri
 			}
 
 			if matched {
+				// Skip if the involved object of the event is in the cooldown window defined by the
+				// trigger. This prevents diagnosis storms on rapidly repeating events of one object.
+				now := time.Now()
+				if eventInCooldown(trigger, event, now) {
+					ev.Info("skipping kubernetes event in cooldown window", "event", client.ObjectKey{
+						Name:      event.Name,
+						Namespace: event.Namespace,
+					}, "trigger", trigger.Name)
+					continue
+				}
+
 				ev.Info("creating Diagnosis from kubernetes event", "event", client.ObjectKey{
 					Name:      event.Name,
 					Namespace: event.Namespace,
 				})
 
 				// Create diagnosis according to the kubernetes event.
-				now := time.Now()
 				name := fmt.Sprintf("%s.%s.%s.%d", KubernetesEventGeneratedDiagnosisPrefix, event.Namespace, event.Name, now.Unix())
 				namespace := util.DefautlNamespace
 				annotations := make(map[string]string)
@@ -199,6 +216,15 @@ func (ev *eventer) createDiagnosisFromKubernetesEvent(triggers []diagnosisv1.Tri
 					},
 				}
 
+				if event.InvolvedObject.Kind == "Pod" && event.InvolvedObject.Namespace != "" && event.InvolvedObject.Name != "" {
+					diagnosis.Spec.PodReference = &diagnosisv1.PodReference{
+						NamespacedName: diagnosisv1.NamespacedName{
+							Namespace: event.InvolvedObject.Namespace,
+							Name:      event.InvolvedObject.Name,
+						},
+					}
+				}
+
 				if event.Source.Host != "" {
 					diagnosis.Spec.NodeName = event.Source.Host
 				} else if trigger.Spec.NodeName != "" {
@@ -214,14 +240,33 @@ func (ev *eventer) createDiagnosisFromKubernetesEvent(triggers []diagnosisv1.Tri
 					continue
 				}
 
-				if err := ev.client.Create(ev, &diagnosis); err != nil {
+				// Set the trigger as the controller owner so the diagnosis is garbage collected
+				// on trigger deletion unless cascading is disabled.
+				if !ev.triggerCascadingDisabled {
+					util.SetDiagnosisOwnerReferenceToTrigger(&diagnosis, trigger)
+				}
+
+				created, merged, err := util.CreateOrMergeDiagnosis(ev, ev.client, ev.cache, &diagnosis, nil)
+				if err != nil {
 					if !apierrors.IsAlreadyExists(err) {
 						ev.Error(err, "unable to create Diagnosis")
 						return &diagnosis, err
 					}
+					created = &diagnosis
+				}
+				if merged {
+					ev.Info("merged duplicate diagnosis into existing one", "diagnosis", client.ObjectKey{
+						Name:      created.Name,
+						Namespace: created.Namespace,
+					})
+				}
+
+				// Record the creation time of the involved object in trigger status for the cooldown.
+				if err := ev.updateTriggerLastEventTime(trigger, event, now); err != nil {
+					ev.Error(err, "unable to update last event time of Trigger", "trigger", trigger.Name)
 				}
 
-				return &diagnosis, nil
+				return created, nil
 			}
 		}
 	}
@@ -229,6 +274,51 @@ func (ev *eventer) createDiagnosisFromKubernetesEvent(triggers []diagnosisv1.Tri
 	return nil, nil
 }
 
+// eventInvolvedObjectKey returns the key of the involved object of a kubernetes event in
+// ".status.lastEventTimes" of a trigger.
+func eventInvolvedObjectKey(event corev1.Event) string {
+	return fmt.Sprintf("%s/%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Namespace, event.InvolvedObject.Name)
+}
+
+// updateTriggerLastEventTime records the creation time of the involved object of the event in
+// trigger status and prunes entries which have passed the cooldown window. It is a no-op if no
+// cooldown is defined in the kubernetes event template of the trigger.
+func (ev *eventer) updateTriggerLastEventTime(trigger diagnosisv1.Trigger, event corev1.Event, now time.Time) error {
+	kubernetesEventTemplate := trigger.Spec.SourceTemplate.KubernetesEventTemplate
+	if kubernetesEventTemplate == nil || kubernetesEventTemplate.CooldownSeconds == nil || *kubernetesEventTemplate.CooldownSeconds <= 0 {
+		return nil
+	}
+
+	cooldown := time.Duration(*kubernetesEventTemplate.CooldownSeconds) * time.Second
+	if trigger.Status.LastEventTimes == nil {
+		trigger.Status.LastEventTimes = make(map[string]metav1.Time)
+	}
+	for key, lastEventTime := range trigger.Status.LastEventTimes {
+		if lastEventTime.Add(cooldown).Before(now) {
+			delete(trigger.Status.LastEventTimes, key)
+		}
+	}
+	trigger.Status.LastEventTimes[eventInvolvedObjectKey(event)] = metav1.NewTime(now)
+
+	return ev.client.Status().Update(ev, &trigger)
+}
+
+// eventInCooldown reports whether diagnosis creation for the involved object of the event should
+// be suppressed according to the cooldown defined in the kubernetes event template of the trigger.
+func eventInCooldown(trigger diagnosisv1.Trigger, event corev1.Event, now time.Time) bool {
+	kubernetesEventTemplate := trigger.Spec.SourceTemplate.KubernetesEventTemplate
+	if kubernetesEventTemplate == nil || kubernetesEventTemplate.CooldownSeconds == nil || *kubernetesEventTemplate.CooldownSeconds <= 0 {
+		return false
+	}
+
+	lastEventTime, ok := trigger.Status.LastEventTimes[eventInvolvedObjectKey(event)]
+	if !ok {
+		return false
+	}
+
+	return lastEventTime.Add(time.Duration(*kubernetesEventTemplate.CooldownSeconds) * time.Second).After(now)
+}
+
 // matchKubernetesEvent reports whether the diagnosis contains all match of the regular expression pattern
 // defined in kubernetes event template.
 func matchKubernetesEvent(kubernetesEventTemplate diagnosisv1.KubernetesEventTemplate, event corev1.Event) (bool, error) {
@@ -264,6 +354,30 @@ func matchKubernetesEvent(kubernetesEventTemplate diagnosisv1.KubernetesEventTem
 		return false, nil
 	}
 
+	re, err = regexp.Compile(kubernetesEventTemplate.Regexp.InvolvedObject.Kind)
+	if err != nil {
+		return false, err
+	}
+	if !re.MatchString(event.InvolvedObject.Kind) {
+		return false, nil
+	}
+
+	re, err = regexp.Compile(kubernetesEventTemplate.Regexp.InvolvedObject.Namespace)
+	if err != nil {
+		return false, err
+	}
+	if !re.MatchString(event.InvolvedObject.Namespace) {
+		return false, nil
+	}
+
+	re, err = regexp.Compile(kubernetesEventTemplate.Regexp.InvolvedObject.Name)
+	if err != nil {
+		return false, err
+	}
+	if !re.MatchString(event.InvolvedObject.Name) {
+		return false, nil
+	}
+
 	re, err = regexp.Compile(kubernetesEventTemplate.Regexp.Source.Component)
 	if err != nil {
 		return false, err
@@ -19,6 +19,7 @@ package eventer
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -200,6 +201,49 @@ func TestMatchKubernetesEvent(t *testing.T) {
 			},
 			desc: "event source host not match",
 		},
+		{
+			kubernetesEventTemplate: diagnosisv1.KubernetesEventTemplate{
+				Regexp: diagnosisv1.KubernetesEventTemplateRegexp{
+					InvolvedObject: corev1.ObjectReference{
+						Kind: "Pod",
+						Name: "pod1",
+					},
+				},
+			},
+			event: corev1.Event{
+				InvolvedObject: corev1.ObjectReference{
+					Kind:      "Pod",
+					Namespace: "namespace1",
+					Name:      "pod1",
+				},
+			},
+			expected: expectedStruct{
+				matched: true,
+				err:     nil,
+			},
+			desc: "event involved object match",
+		},
+		{
+			kubernetesEventTemplate: diagnosisv1.KubernetesEventTemplate{
+				Regexp: diagnosisv1.KubernetesEventTemplateRegexp{
+					InvolvedObject: corev1.ObjectReference{
+						Kind: "Node",
+					},
+				},
+			},
+			event: corev1.Event{
+				InvolvedObject: corev1.ObjectReference{
+					Kind:      "Pod",
+					Namespace: "namespace1",
+					Name:      "pod1",
+				},
+			},
+			expected: expectedStruct{
+				matched: false,
+				err:     nil,
+			},
+			desc: "event involved object kind not match",
+		},
 		{
 			kubernetesEventTemplate: diagnosisv1.KubernetesEventTemplate{
 				Regexp: diagnosisv1.KubernetesEventTemplateRegexp{
@@ -229,3 +273,97 @@ func TestMatchKubernetesEvent(t *testing.T) {
 		}
 	}
 }
+
+func TestEventInCooldown(t *testing.T) {
+	cooldownSeconds := int32(300)
+	now := time.Now()
+	event := corev1.Event{
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: "namespace1",
+			Name:      "pod1",
+		},
+	}
+
+	tests := []struct {
+		trigger  diagnosisv1.Trigger
+		event    corev1.Event
+		expected bool
+		desc     string
+	}{
+		{
+			trigger: diagnosisv1.Trigger{
+				Spec: diagnosisv1.TriggerSpec{
+					SourceTemplate: diagnosisv1.SourceTemplate{
+						KubernetesEventTemplate: &diagnosisv1.KubernetesEventTemplate{},
+					},
+				},
+				Status: diagnosisv1.TriggerStatus{
+					LastEventTimes: map[string]metav1.Time{
+						"Pod/namespace1/pod1": metav1.NewTime(now),
+					},
+				},
+			},
+			event:    event,
+			expected: false,
+			desc:     "no cooldown defined",
+		},
+		{
+			trigger: diagnosisv1.Trigger{
+				Spec: diagnosisv1.TriggerSpec{
+					SourceTemplate: diagnosisv1.SourceTemplate{
+						KubernetesEventTemplate: &diagnosisv1.KubernetesEventTemplate{
+							CooldownSeconds: &cooldownSeconds,
+						},
+					},
+				},
+			},
+			event:    event,
+			expected: false,
+			desc:     "involved object not recorded",
+		},
+		{
+			trigger: diagnosisv1.Trigger{
+				Spec: diagnosisv1.TriggerSpec{
+					SourceTemplate: diagnosisv1.SourceTemplate{
+						KubernetesEventTemplate: &diagnosisv1.KubernetesEventTemplate{
+							CooldownSeconds: &cooldownSeconds,
+						},
+					},
+				},
+				Status: diagnosisv1.TriggerStatus{
+					LastEventTimes: map[string]metav1.Time{
+						"Pod/namespace1/pod1": metav1.NewTime(now.Add(-time.Minute)),
+					},
+				},
+			},
+			event:    event,
+			expected: true,
+			desc:     "involved object in cooldown window",
+		},
+		{
+			trigger: diagnosisv1.Trigger{
+				Spec: diagnosisv1.TriggerSpec{
+					SourceTemplate: diagnosisv1.SourceTemplate{
+						KubernetesEventTemplate: &diagnosisv1.KubernetesEventTemplate{
+							CooldownSeconds: &cooldownSeconds,
+						},
+					},
+				},
+				Status: diagnosisv1.TriggerStatus{
+					LastEventTimes: map[string]metav1.Time{
+						"Pod/namespace1/pod1": metav1.NewTime(now.Add(-time.Hour)),
+					},
+				},
+			},
+			event:    event,
+			expected: false,
+			desc:     "cooldown window passed",
+		},
+	}
+
+	for _, test := range tests {
+		result := eventInCooldown(test.trigger, test.event, now)
+		assert.Equal(t, test.expected, result, test.desc)
+	}
+}
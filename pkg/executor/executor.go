@@ -18,30 +18,49 @@ package executor
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
 	"github.com/kubediag/kubediag/pkg/controllers"
+	"github.com/kubediag/kubediag/pkg/rpc"
 	"github.com/kubediag/kubediag/pkg/util"
 )
 
@@ -64,8 +83,69 @@ const (
 	ContainerTelemetryKey = "container"
 	// NodeTelemetryKey is the telemetry key of node.
 	NodeTelemetryKey = "node"
+	// PodReferencesTelemetryKey is the telemetry key of the json encoded set of target pods.
+	PodReferencesTelemetryKey = "pod.references"
+	// DiagnosisEventsTelemetryKey is the telemetry key of the json encoded, ordered list of
+	// timestamped notes recorded by the executor while running the diagnosis.
+	DiagnosisEventsTelemetryKey = "diagnosis.events"
+
+	// ResponseSubDirectory is the subdirectory of data root which stores processor responses
+	// too large to be recorded in a diagnosis.
+	ResponseSubDirectory = "responses"
+
+	// ContextSubDirectory is the subdirectory of data root which stores operation result values
+	// too large to be recorded in a diagnosis.
+	ContextSubDirectory = "contexts"
+
+	// CompressedContextValuePrefix marks an operation result value which has been gzip
+	// compressed and base64 encoded to keep the diagnosis below the etcd object size limit.
+	// Values bearing the prefix are transparently decompressed with DecodeContextValue before
+	// they are passed to operation processors.
+	CompressedContextValuePrefix = "gzip64://"
+
+	// ResponseFilePathTelemetryKey is the telemetry key of the file which a large processor
+	// response has been streamed into.
+	ResponseFilePathTelemetryKey = "executor.response.file.path"
+	// ResponseFileSizeTelemetryKey is the telemetry key of the size of a streamed processor response.
+	ResponseFileSizeTelemetryKey = "executor.response.file.size"
+	// ResponseFileChecksumTelemetryKey is the telemetry key of the sha256 checksum of a streamed
+	// processor response.
+	ResponseFileChecksumTelemetryKey = "executor.response.file.checksum"
+
+	// executorQueueSaturationThreshold is the queued fraction of the executor channel capacity
+	// over which the executor reports itself as unhealthy.
+	executorQueueSaturationThreshold = 0.9
+
+	// maxSeverityBypasses is the maximum number of consecutive dispatches which may bypass a
+	// queued diagnosis of a lower severity. The oldest bypassed diagnosis is dispatched once
+	// the limit is reached to protect lower severity diagnoses from starvation.
+	maxSeverityBypasses = 10
+
+	// defaultErrorLogInterval is the default minimum interval between two logged sync errors of
+	// one diagnosis and error category.
+	defaultErrorLogInterval = time.Minute
+
+	// operationHealthProbeTimeout is the timeout of a health probe of an operation processor.
+	operationHealthProbeTimeout = 5 * time.Second
+
+	// maxDiagnosisContextEvents is the maximum number of notes kept in the event trail of a
+	// diagnosis. The oldest notes are dropped once the limit is reached to bound the size of
+	// the diagnosis object.
+	maxDiagnosisContextEvents = 50
 )
 
+// ErrContextValueTooLarge indicates an operation result value exceeded the maximum context value
+// size and could not be spilled into a file. Callers may treat the error as non-fatal since all
+// remaining operation results are still recorded.
+var ErrContextValueTooLarge = errors.New("operation result value exceeds max context value size")
+
+// severityDispatchOrder lists diagnosis severities from the most to the least important.
+var severityDispatchOrder = []diagnosisv1.DiagnosisSeverity{
+	diagnosisv1.DiagnosisSeverityCritical,
+	diagnosisv1.DiagnosisSeverityWarning,
+	diagnosisv1.DiagnosisSeverityInfo,
+}
+
 var (
 	executorSyncSuccessCount = prometheus.NewCounter(
 		prometheus.CounterOpts{
@@ -109,6 +189,27 @@ var (
 			Help: "Counter of fail diagnosis syncs by operation",
 		},
 	)
+	executorOperationTimeoutCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "executor_operation_timeout_counter",
+			Help: "Counter of timed out operation executions by executor",
+		},
+	)
+	executorOperationProcessorDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "executor_operation_processor_duration_seconds",
+			Help:    "Histogram of round trip duration of http requests to operation processors by operation",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+	executorBreakerTransitionCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "executor_circuit_breaker_transitions_total",
+			Help: "Counter of circuit breaker state transitions of operation processors by state",
+		},
+		[]string{"state"},
+	)
 )
 
 // Executor changes the state of a diagnosis by executing operations.
@@ -119,6 +220,8 @@ type Executor interface {
 	logr.Logger
 	// Run runs the Executor.
 	Run(<-chan struct{})
+	// Healthz handles http requests for executor health.
+	Healthz(http.ResponseWriter, *http.Request)
 }
 
 // executor runs the diagnosis pipeline by executing operations defined in diagnosis.
@@ -130,6 +233,10 @@ type executor struct {
 
 	// client knows how to perform CRUD operations on Kubernetes objects.
 	client client.Client
+	// apiReader reads objects directly from the api server. It is consulted when an operation
+	// set or operation is not found in the cache, which happens briefly after the object is
+	// created. Cache misses are not retried against the api server if nil.
+	apiReader client.Reader
 	// eventRecorder knows how to record events on behalf of an EventSource.
 	eventRecorder record.EventRecorder
 	// scheme defines methods for serializing and deserializing API objects.
@@ -138,6 +245,9 @@ type executor struct {
 	cache cache.Cache
 	// nodeName specifies the node name.
 	nodeName string
+	// nodeNamePatterns restricts the executor to diagnoses whose node name matches one of the
+	// glob or regular expression patterns. The node name is matched exactly if empty.
+	nodeNamePatterns []string
 	// transport is the transport for sending http requests to executors.
 	transport *http.Transport
 	// bindAddress is the address on which to advertise.
@@ -146,8 +256,103 @@ type executor struct {
 	port int
 	// dataRoot is root directory of persistent kubediag data.
 	dataRoot string
+	// processorTokenFile is the path of a file containing the bearer token attached to processor
+	// requests. No token is attached if empty.
+	processorTokenFile string
+	// maxSyncRetries is the maximum number of retries of a diagnosis sync on transient errors.
+	// A diagnosis is marked as failed once the limit is exceeded. Zero means unlimited retries.
+	maxSyncRetries int
+	// syncRetries tracks the number of erroneous sync attempts of diagnoses by uid.
+	syncRetries map[types.UID]int
+	// executedOperations tracks results of operations which have been executed but whose status
+	// update failed, keyed by diagnosis uid. The recorded result is reused instead of invoking the
+	// operation again when the diagnosis is requeued so that recover operations with side effects
+	// are not repeated.
+	executedOperations map[types.UID]operationExecutionMarker
+	// executedPathOperations tracks results of operations which have been executed during a
+	// concurrent path sync whose status update failed, keyed by diagnosis uid and the position of
+	// the operation in the paths. Recorded results are reused instead of invoking the operations
+	// again when the diagnosis is requeued so that operations with side effects are not repeated.
+	executedPathOperations map[types.UID]map[pathStep]operationResult
+	// executedPathOperationsMutex protects executedPathOperations against concurrent path workers.
+	executedPathOperationsMutex sync.Mutex
+	// drainTimeout is the maximum time the executor spends processing buffered diagnoses after
+	// receiving the stop signal. Zero disables draining.
+	drainTimeout time.Duration
+	// maxContextValueBytes is the maximum size of a single operation result value recorded in a
+	// diagnosis. Larger values are spilled into files under data root to keep the diagnosis below
+	// the etcd object size limit. Zero disables the limit.
+	maxContextValueBytes int
 	// executorCh is a channel for queuing Diagnoses to be processed by executor.
 	executorCh chan diagnosisv1.Diagnosis
+	// severityBuffers holds queued diagnoses grouped by severity so that diagnoses targeting
+	// more important issues are dispatched first.
+	severityBuffers map[diagnosisv1.DiagnosisSeverity][]diagnosisv1.Diagnosis
+	// severityBypasses counts consecutive dispatches which bypassed a queued diagnosis of a
+	// lower severity.
+	severityBypasses int
+	// statusMutex protects fields published through the executor health endpoint.
+	statusMutex sync.Mutex
+	// cacheSynced indicates whether the cache has been synced.
+	cacheSynced bool
+	// lastSuccessfulSync is the time of the last successful diagnosis sync.
+	lastSuccessfulSync time.Time
+	// bufferedDiagnoses is the number of diagnoses currently held in the severity buffers.
+	bufferedDiagnoses int
+	// errorLogInterval is the minimum interval between two logged sync errors of one diagnosis
+	// and error category. Repeated identical failures within the interval are counted and
+	// summarized on the next emitted log line. Zero disables the rate limiting.
+	errorLogInterval time.Duration
+	// suppressedErrorLogs tracks the last logged time and the suppressed count of sync errors
+	// by diagnosis key and error category.
+	suppressedErrorLogs map[string]*suppressedErrorLog
+	// breakerFailureThreshold is the number of consecutive failures of requests to one processor
+	// url after which the circuit breaker of the url opens. Zero disables circuit breaking.
+	breakerFailureThreshold int
+	// breakerCooldown is the time an open circuit breaker short-circuits dispatch to its
+	// processor url before a half open probe is allowed through.
+	breakerCooldown time.Duration
+	// breakerMutex protects breakers.
+	breakerMutex sync.Mutex
+	// breakers tracks circuit breaker state by processor url.
+	breakers map[string]*circuitBreaker
+}
+
+// circuitBreaker tracks consecutive failures of requests to one processor url. The breaker opens
+// once the failure threshold is reached so a consistently erroring processor does not receive a
+// request on every matching diagnosis and mask healthier paths.
+type circuitBreaker struct {
+	// consecutiveFailures is the number of consecutive failed requests to the processor.
+	consecutiveFailures int
+	// openUntil is the time until which the breaker short-circuits dispatch. A half open probe
+	// is allowed through once the time has passed.
+	openUntil time.Time
+}
+
+// suppressedErrorLog records rate limiting state of sync error logging for one diagnosis key and
+// error category.
+type suppressedErrorLog struct {
+	// lastLogged is the time the error was last logged.
+	lastLogged time.Time
+	// suppressed is the number of errors suppressed since the error was last logged.
+	suppressed int
+}
+
+// TransportConfig configures the transport for requests to operation processors. The zero value
+// keeps the insecure defaults of skipping certificate verification and disabling keep alives.
+type TransportConfig struct {
+	// CAFile is the path of a ca bundle for verifying operation processor certificates.
+	// Certificate verification is skipped if empty.
+	CAFile string
+	// ClientCertFile is the path of a client certificate presented to operation processors.
+	ClientCertFile string
+	// ClientKeyFile is the path of the private key of the client certificate.
+	ClientKeyFile string
+	// EnableKeepAlives enables http keep alive connections to operation processors.
+	EnableKeepAlives bool
+	// MaxIdleConns is the maximum number of idle connections to operation processors. The
+	// default of the http package applies if zero.
+	MaxIdleConns int
 }
 
 // NewExecutor creates a new executor.
@@ -155,15 +360,24 @@ func NewExecutor(
 	ctx context.Context,
 	logger logr.Logger,
 	cli client.Client,
+	apiReader client.Reader,
 	eventRecorder record.EventRecorder,
 	scheme *runtime.Scheme,
 	cache cache.Cache,
 	nodeName string,
+	nodeNamePatterns []string,
 	bindAddress string,
 	port int,
 	dataRoot string,
+	processorTokenFile string,
+	maxSyncRetries int,
+	drainTimeout time.Duration,
+	maxContextValueBytes int,
+	breakerFailureThreshold int,
+	breakerCooldown time.Duration,
+	transportConfig TransportConfig,
 	executorCh chan diagnosisv1.Diagnosis,
-) Executor {
+) (Executor, error) {
 	metrics.Registry.MustRegister(
 		executorSyncSuccessCount,
 		executorSyncSkipCount,
@@ -172,29 +386,84 @@ func NewExecutor(
 		executorOperationErrorCounter,
 		executorOperationSuccessCounter,
 		executorOperationFailCounter,
+		executorOperationTimeoutCounter,
+		executorOperationProcessorDuration,
+		executorBreakerTransitionCounter,
 	)
 
-	transport := utilnet.SetTransportDefaults(
-		&http.Transport{
-			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-			DisableKeepAlives: true,
-			Proxy:             http.ProxyURL(nil),
-		})
+	transport, err := buildTransport(transportConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Default a no-op recorder so the executor functions without an event sink, which makes it
+	// usable from tests and embedded scenarios without wiring up an event broadcaster.
+	if eventRecorder == nil {
+		eventRecorder = &record.FakeRecorder{}
+	}
 
 	return &executor{
-		Context:       ctx,
-		Logger:        logger,
-		client:        cli,
-		eventRecorder: eventRecorder,
-		scheme:        scheme,
-		cache:         cache,
-		nodeName:      nodeName,
-		transport:     transport,
-		bindAddress:   bindAddress,
-		port:          port,
-		dataRoot:      dataRoot,
-		executorCh:    executorCh,
+		Context:                 ctx,
+		Logger:                  logger,
+		client:                  cli,
+		apiReader:               apiReader,
+		eventRecorder:           eventRecorder,
+		scheme:                  scheme,
+		cache:                   cache,
+		nodeName:                nodeName,
+		nodeNamePatterns:        nodeNamePatterns,
+		transport:               transport,
+		bindAddress:             bindAddress,
+		port:                    port,
+		dataRoot:                dataRoot,
+		processorTokenFile:      processorTokenFile,
+		maxSyncRetries:          maxSyncRetries,
+		syncRetries:             make(map[types.UID]int),
+		executedOperations:      make(map[types.UID]operationExecutionMarker),
+		executedPathOperations:  make(map[types.UID]map[pathStep]operationResult),
+		drainTimeout:            drainTimeout,
+		maxContextValueBytes:    maxContextValueBytes,
+		executorCh:              executorCh,
+		severityBuffers:         make(map[diagnosisv1.DiagnosisSeverity][]diagnosisv1.Diagnosis),
+		errorLogInterval:        defaultErrorLogInterval,
+		suppressedErrorLogs:     make(map[string]*suppressedErrorLog),
+		breakerFailureThreshold: breakerFailureThreshold,
+		breakerCooldown:         breakerCooldown,
+		breakers:                make(map[string]*circuitBreaker),
+	}, nil
+}
+
+// buildTransport builds the transport for requests to operation processors from the transport
+// config. Certificate verification is skipped unless a ca bundle is configured and keep alive
+// connections are disabled unless enabled explicitly.
+func buildTransport(config TransportConfig) (*http.Transport, error) {
+	tlsClientConfig := &tls.Config{InsecureSkipVerify: true}
+	if config.CAFile != "" {
+		data, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ca file %s: %v", config.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in ca file %s", config.CAFile)
+		}
+		tlsClientConfig = &tls.Config{RootCAs: pool}
+	}
+	if config.ClientCertFile != "" || config.ClientKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %v", err)
+		}
+		tlsClientConfig.Certificates = []tls.Certificate{certificate}
 	}
+
+	return utilnet.SetTransportDefaults(
+		&http.Transport{
+			TLSClientConfig:   tlsClientConfig,
+			DisableKeepAlives: !config.EnableKeepAlives,
+			MaxIdleConns:      config.MaxIdleConns,
+			Proxy:             http.ProxyURL(nil),
+		}), nil
 }
 
 // Run runs the executor.
@@ -203,63 +472,335 @@ func (ex *executor) Run(stopCh <-chan struct{}) {
 	if !ex.cache.WaitForCacheSync(stopCh) {
 		return
 	}
+	ex.statusMutex.Lock()
+	ex.cacheSynced = true
+	ex.statusMutex.Unlock()
 
 	for {
-		select {
-		// Process diagnoses queuing in executor channel.
-		case diagnosis := <-ex.executorCh:
-			err := ex.client.Get(ex, client.ObjectKey{
-				Name:      diagnosis.Name,
-				Namespace: diagnosis.Namespace,
-			}, &diagnosis)
-			if err != nil {
-				if apierrors.IsNotFound(err) {
-					continue
-				}
-				ex.addDiagnosisToExecutorQueue(diagnosis)
+		// Move all queued diagnoses into the severity buffers before dispatching so that
+		// severities across a burst are compared instead of processing in arrival order.
+		ex.drainExecutorChannel()
+
+		diagnosis, ok := ex.nextDiagnosisBySeverity()
+		if !ok {
+			select {
+			// Buffer diagnoses queuing in executor channel.
+			case diagnosis := <-ex.executorCh:
+				ex.bufferDiagnosisBySeverity(diagnosis)
 				continue
+			// Stop executor on stop signal.
+			case <-stopCh:
+				ex.drainOnShutdown()
+				return
 			}
+		}
 
-			// Only process diagnosis in DiagnosisRunning phase.
-			if diagnosis.Status.Phase != diagnosisv1.DiagnosisRunning {
-				continue
-			}
+		// Stop executor on stop signal.
+		select {
+		case <-stopCh:
+			ex.bufferDiagnosisBySeverity(diagnosis)
+			ex.drainOnShutdown()
+			return
+		default:
+		}
+
+		ex.dispatchDiagnosis(diagnosis)
+	}
+}
+
+// dispatchDiagnosis syncs the dispatched diagnosis and requeues it on transient errors.
+func (ex *executor) dispatchDiagnosis(diagnosis diagnosisv1.Diagnosis) {
+	err := ex.client.Get(ex, client.ObjectKey{
+		Name:      diagnosis.Name,
+		Namespace: diagnosis.Namespace,
+	}, &diagnosis)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return
+		}
+		ex.addDiagnosisToExecutorQueue(diagnosis)
+		return
+	}
+
+	// Only process diagnosis in DiagnosisRunning phase.
+	if diagnosis.Status.Phase != diagnosisv1.DiagnosisRunning {
+		return
+	}
 
-			// Only process diagnosis on designated node.
-			if util.IsDiagnosisNodeNameMatched(diagnosis, ex.nodeName) {
-				diagnosis, err := ex.syncDiagnosis(diagnosis)
-				if err != nil {
-					ex.Error(err, "failed to sync Diagnosis", "diagnosis", client.ObjectKey{
-						Name:      diagnosis.Name,
-						Namespace: diagnosis.Namespace,
-					})
-					executorSyncErrorCount.Inc()
-					ex.addDiagnosisToExecutorQueue(diagnosis)
-					continue
+	// Only process diagnosis on designated node.
+	if ex.isDiagnosisOnNode(diagnosis) {
+		diagnosis, err := ex.syncDiagnosis(diagnosis)
+		if err != nil {
+			ex.logSyncErrorRateLimited(err, diagnosis)
+			executorSyncErrorCount.Inc()
+			// Give up syncing the diagnosis once the retry limit is exceeded instead of
+			// requeueing indefinitely.
+			if ex.maxSyncRetries > 0 {
+				ex.syncRetries[diagnosis.UID]++
+				if ex.syncRetries[diagnosis.UID] > ex.maxSyncRetries {
+					delete(ex.syncRetries, diagnosis.UID)
+					delete(ex.executedOperations, diagnosis.UID)
+					ex.deleteExecutedPathOperations(diagnosis.UID)
+					ex.setDiagnosisFailedOnMaxRetriesExceeded(diagnosis)
+					return
 				}
+			}
+			ex.addDiagnosisToExecutorQueue(diagnosis)
+			return
+		}
+
+		delete(ex.syncRetries, diagnosis.UID)
+		delete(ex.executedOperations, diagnosis.UID)
+		ex.deleteExecutedPathOperations(diagnosis.UID)
+		ex.clearSuppressedErrorLogs(diagnosis)
+		ex.statusMutex.Lock()
+		ex.lastSuccessfulSync = time.Now()
+		ex.statusMutex.Unlock()
+		ex.Info("syncing Diagnosis successfully", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		})
+	}
+}
+
+// logSyncErrorRateLimited logs a sync error of a diagnosis at most once per error log interval
+// per diagnosis and error category. A broken operation processor would otherwise produce
+// thousands of identical log lines per minute on a requeueing diagnosis. The number of errors
+// suppressed since the last emitted line is included in the next one.
+func (ex *executor) logSyncErrorRateLimited(err error, diagnosis diagnosisv1.Diagnosis) {
+	category := syncErrorCategory(err)
+	if ex.errorLogInterval <= 0 {
+		ex.Error(err, "failed to sync Diagnosis", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		}, "category", category)
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", diagnosis.Namespace, diagnosis.Name, category)
+	entry, ok := ex.suppressedErrorLogs[key]
+	if !ok {
+		entry = &suppressedErrorLog{}
+		ex.suppressedErrorLogs[key] = entry
+	}
+
+	now := time.Now()
+	if now.Sub(entry.lastLogged) < ex.errorLogInterval {
+		entry.suppressed++
+		return
+	}
+
+	ex.Error(err, "failed to sync Diagnosis", "diagnosis", client.ObjectKey{
+		Name:      diagnosis.Name,
+		Namespace: diagnosis.Namespace,
+	}, "category", category, "suppressed", entry.suppressed)
+	entry.lastLogged = now
+	entry.suppressed = 0
+}
+
+// clearSuppressedErrorLogs removes rate limiting state of sync error logging for the diagnosis.
+func (ex *executor) clearSuppressedErrorLogs(diagnosis diagnosisv1.Diagnosis) {
+	prefix := fmt.Sprintf("%s/%s/", diagnosis.Namespace, diagnosis.Name)
+	for key := range ex.suppressedErrorLogs {
+		if strings.HasPrefix(key, prefix) {
+			delete(ex.suppressedErrorLogs, key)
+		}
+	}
+}
+
+// isDiagnosisOnNode checks if the diagnosis should be processed by this executor. The diagnosis
+// is matched against the node name patterns if configured and against the node name otherwise.
+func (ex *executor) isDiagnosisOnNode(diagnosis diagnosisv1.Diagnosis) bool {
+	if len(ex.nodeNamePatterns) != 0 {
+		return util.IsDiagnosisNodeMatchedByPattern(diagnosis, ex.nodeNamePatterns)
+	}
 
-				ex.Info("syncing Diagnosis successfully", "diagnosis", client.ObjectKey{
-					Name:      diagnosis.Name,
-					Namespace: diagnosis.Namespace,
-				})
+	return util.IsDiagnosisNodeNameMatched(diagnosis, ex.nodeName)
+}
+
+// syncErrorCategory maps a sync error to a coarse category for log rate limiting.
+func syncErrorCategory(err error) string {
+	switch {
+	case apierrors.IsConflict(err):
+		return "Conflict"
+	case apierrors.IsNotFound(err):
+		return "NotFound"
+	case strings.Contains(err.Error(), "timeout"):
+		return "Timeout"
+	case strings.Contains(err.Error(), "connection refused"):
+		return "ConnectionRefused"
+	default:
+		return "Other"
+	}
+}
+
+// drainOnShutdown processes diagnoses which are still buffered or queued when the stop signal
+// is received. No new diagnoses are accepted and buffered diagnoses are synced until the drain
+// timeout expires. A note is recorded for diagnoses which could not be processed in time since
+// they are requeued on restart while their phase is still Running.
+func (ex *executor) drainOnShutdown() {
+	if ex.drainTimeout > 0 {
+		ex.Info("draining buffered diagnoses on shutdown", "drainTimeout", ex.drainTimeout)
+		deadline := time.Now().Add(ex.drainTimeout)
+		for time.Now().Before(deadline) {
+			ex.drainExecutorChannel()
+			diagnosis, ok := ex.nextDiagnosisBySeverity()
+			if !ok {
+				return
 			}
-		// Stop executor on stop signal.
-		case <-stopCh:
+			ex.dispatchDiagnosis(diagnosis)
+		}
+	}
+
+	ex.drainExecutorChannel()
+	for {
+		diagnosis, ok := ex.nextDiagnosisBySeverity()
+		if !ok {
+			return
+		}
+		ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeNormal, "RequeuedOnShutdown", "Diagnosis %s/%s was not processed before executor shutdown and will be requeued on restart", diagnosis.Namespace, diagnosis.Name)
+	}
+}
+
+// drainExecutorChannel moves all currently queued diagnoses into the severity buffers without
+// blocking.
+func (ex *executor) drainExecutorChannel() {
+	for {
+		select {
+		case diagnosis := <-ex.executorCh:
+			ex.bufferDiagnosisBySeverity(diagnosis)
+		default:
 			return
 		}
 	}
 }
 
+// bufferDiagnosisBySeverity adds the diagnosis to the severity buffer it belongs to. Diagnoses
+// without a severity are buffered as Warning.
+func (ex *executor) bufferDiagnosisBySeverity(diagnosis diagnosisv1.Diagnosis) {
+	severity := diagnosis.Spec.Severity
+	switch severity {
+	case diagnosisv1.DiagnosisSeverityCritical, diagnosisv1.DiagnosisSeverityWarning, diagnosisv1.DiagnosisSeverityInfo:
+	default:
+		severity = diagnosisv1.DiagnosisSeverityWarning
+	}
+
+	ex.severityBuffers[severity] = append(ex.severityBuffers[severity], diagnosis)
+	ex.statusMutex.Lock()
+	ex.bufferedDiagnoses++
+	ex.statusMutex.Unlock()
+}
+
+// nextDiagnosisBySeverity returns the buffered diagnosis to dispatch next. Diagnoses with a
+// more important severity are dispatched first. The oldest diagnosis of the least important
+// waiting severity is dispatched instead after maxSeverityBypasses consecutive dispatches
+// bypassed a lower severity to protect low severity diagnoses from starvation.
+func (ex *executor) nextDiagnosisBySeverity() (diagnosisv1.Diagnosis, bool) {
+	if ex.severityBypasses >= maxSeverityBypasses {
+		for i := len(severityDispatchOrder) - 1; i > 0; i-- {
+			severity := severityDispatchOrder[i]
+			if len(ex.severityBuffers[severity]) > 0 {
+				ex.severityBypasses = 0
+				return ex.popSeverityBuffer(severity), true
+			}
+		}
+	}
+
+	for i, severity := range severityDispatchOrder {
+		if len(ex.severityBuffers[severity]) == 0 {
+			continue
+		}
+
+		// Count the dispatch as a bypass if a diagnosis of a lower severity is waiting.
+		bypassed := false
+		for _, lower := range severityDispatchOrder[i+1:] {
+			if len(ex.severityBuffers[lower]) > 0 {
+				bypassed = true
+				break
+			}
+		}
+		if bypassed {
+			ex.severityBypasses++
+		} else {
+			ex.severityBypasses = 0
+		}
+
+		return ex.popSeverityBuffer(severity), true
+	}
+
+	return diagnosisv1.Diagnosis{}, false
+}
+
+// popSeverityBuffer removes and returns the oldest diagnosis of the severity.
+func (ex *executor) popSeverityBuffer(severity diagnosisv1.DiagnosisSeverity) diagnosisv1.Diagnosis {
+	diagnosis := ex.severityBuffers[severity][0]
+	ex.severityBuffers[severity] = ex.severityBuffers[severity][1:]
+	ex.statusMutex.Lock()
+	ex.bufferedDiagnoses--
+	ex.statusMutex.Unlock()
+
+	return diagnosis
+}
+
+// Healthz handles http requests for executor health. It reports the depth and capacity of the
+// diagnosis queue, whether the cache has synced and the time of the last successful sync. A
+// 503 is returned once the queue is saturated past the threshold.
+func (ex *executor) Healthz(w http.ResponseWriter, r *http.Request) {
+	ex.statusMutex.Lock()
+	cacheSynced := ex.cacheSynced
+	lastSuccessfulSync := ex.lastSuccessfulSync
+	buffered := ex.bufferedDiagnoses
+	ex.statusMutex.Unlock()
+
+	queued := len(ex.executorCh) + buffered
+	capacity := cap(ex.executorCh)
+
+	status := map[string]interface{}{
+		"queuedDiagnoses": queued,
+		"queueCapacity":   capacity,
+		"cacheSynced":     cacheSynced,
+	}
+	if !lastSuccessfulSync.IsZero() {
+		status["lastSuccessfulSyncTime"] = lastSuccessfulSync.Format(time.RFC3339)
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal executor status: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if capacity > 0 && float64(queued) >= float64(capacity)*executorQueueSaturationThreshold {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(data)
+}
+
+// getWithCacheFallback fetches the object with the cached client and falls back to a direct
+// read from the api server if the object is not found in the cache. The cache can be briefly
+// stale after the object is created, which would otherwise fail a diagnosis referencing a just
+// created operation set or operation.
+func (ex *executor) getWithCacheFallback(key client.ObjectKey, obj runtime.Object) error {
+	err := ex.client.Get(ex, key, obj)
+	if err == nil || !apierrors.IsNotFound(err) || ex.apiReader == nil {
+		return err
+	}
+
+	ex.Info("object not found in cache, falling back to direct api get", "object", key)
+	return ex.apiReader.Get(ex, key, obj)
+}
+
 // syncDiagnosis syncs diagnoses.
 func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.Diagnosis, error) {
 	ex.Info("starting to sync Diagnosis", "diagnosis", client.ObjectKey{
 		Name:      diagnosis.Name,
 		Namespace: diagnosis.Namespace,
-	})
+	}, "traceID", diagnosisTraceID(diagnosis))
 
 	// Fetch operationSet according to diagnosis.
 	var operationset diagnosisv1.OperationSet
-	err := ex.client.Get(ex, client.ObjectKey{
+	err := ex.getWithCacheFallback(client.ObjectKey{
 		Name: diagnosis.Spec.OperationSet,
 	}, &operationset)
 	if err != nil {
@@ -269,7 +810,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 				Namespace: diagnosis.Namespace,
 			})
 
-			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s since operation set is not found", diagnosis.Namespace, diagnosis.Name)
+			ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s since operation set is not found", diagnosis.Namespace, diagnosis.Name)
 			diagnosis.Status.Phase = diagnosisv1.DiagnosisFailed
 			util.UpdateDiagnosisCondition(&diagnosis.Status, &diagnosisv1.DiagnosisCondition{
 				Type:    diagnosisv1.OperationSetNotFound,
@@ -277,7 +818,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 				Reason:  "OperationSetNotFound",
 				Message: fmt.Sprintf("OperationSet %s is not found", diagnosis.Spec.OperationSet),
 			})
-			if err := ex.client.Status().Update(ex, &diagnosis); err != nil {
+			if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
 				return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
 			}
 			executorSyncFailCount.Inc()
@@ -291,7 +832,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 	if !operationset.Status.Ready {
 		ex.Info("the graph has not been updated according to the latest specification")
 
-		ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s since operation set is not ready", diagnosis.Namespace, diagnosis.Name)
+		ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s since operation set is not ready", diagnosis.Namespace, diagnosis.Name)
 		diagnosis.Status.Phase = diagnosisv1.DiagnosisFailed
 		util.UpdateDiagnosisCondition(&diagnosis.Status, &diagnosisv1.DiagnosisCondition{
 			Type:    diagnosisv1.OperationSetNotReady,
@@ -299,7 +840,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 			Reason:  "OperationSetNotReady",
 			Message: fmt.Sprintf("OperationSet is not ready because the graph has not been updated according to the latest specification"),
 		})
-		if err := ex.client.Status().Update(ex, &diagnosis); err != nil {
+		if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
 			return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
 		}
 		executorSyncFailCount.Inc()
@@ -332,7 +873,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 	if operationSetAdjacencyListHash != diagnosisAdjacencyListHash {
 		ex.Info("hash value caculated from adjacency list has been changed", "new", operationSetAdjacencyListHash, "old", diagnosisAdjacencyListHash)
 
-		ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s since operation set has been changed during execution", diagnosis.Namespace, diagnosis.Name)
+		ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s since operation set has been changed during execution", diagnosis.Namespace, diagnosis.Name)
 		diagnosis.Status.Phase = diagnosisv1.DiagnosisFailed
 		util.UpdateDiagnosisCondition(&diagnosis.Status, &diagnosisv1.DiagnosisCondition{
 			Type:    diagnosisv1.OperationSetChanged,
@@ -340,13 +881,18 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 			Reason:  "OperationSetChanged",
 			Message: fmt.Sprintf("OperationSet specification has been changed during diagnosis execution"),
 		})
-		if err := ex.client.Status().Update(ex, &diagnosis); err != nil {
+		if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
 			return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
 		}
 		executorSyncFailCount.Inc()
 		return diagnosis, nil
 	}
 
+	// Execute paths concurrently if path concurrency is greater than 1.
+	if diagnosis.Spec.PathConcurrency > 1 {
+		return ex.syncDiagnosisWithConcurrentPaths(diagnosis, operationset)
+	}
+
 	// Set initial checkpoint before operation execution.
 	if diagnosis.Status.Checkpoint == nil {
 		diagnosis.Status.Checkpoint = &diagnosisv1.Checkpoint{
@@ -369,7 +915,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 
 	// Fetch operation according to operation node information.
 	var operation diagnosisv1.Operation
-	err = ex.client.Get(ex, client.ObjectKey{
+	err = ex.getWithCacheFallback(client.ObjectKey{
 		Name: node.Operation,
 	}, &operation)
 	if err != nil {
@@ -379,7 +925,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 				Namespace: diagnosis.Namespace,
 			})
 
-			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s since operation is not found", diagnosis.Namespace, diagnosis.Name)
+			ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s since operation is not found", diagnosis.Namespace, diagnosis.Name)
 			diagnosis.Status.Phase = diagnosisv1.DiagnosisFailed
 			util.UpdateDiagnosisCondition(&diagnosis.Status, &diagnosisv1.DiagnosisCondition{
 				Type:    diagnosisv1.OperationNotFound,
@@ -387,7 +933,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 				Reason:  "OperationNotFound",
 				Message: fmt.Sprintf("Operation %s is not found", node.Operation),
 			})
-			if err := ex.client.Status().Update(ex, &diagnosis); err != nil {
+			if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
 				return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
 			}
 			executorSyncFailCount.Inc()
@@ -403,9 +949,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 	for key, value := range diagnosis.Spec.Parameters {
 		data[key] = value
 	}
-	for key, value := range diagnosis.Status.OperationResults {
-		data[key] = value
-	}
+	ex.mergeDecodedOperationResults(data, diagnosis)
 	updateDiagnosisContext(data, diagnosis)
 
 	ex.Info("running operation", "diagnosis", client.ObjectKey{
@@ -414,24 +958,98 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 	}, "node", node, "operationset", operationset.Name, "path", path)
 
 	// Execute the operation by sending http request to the processor or running predefined script.
-	var succeeded bool
-	var result map[string]string
-	if operation.Spec.Processor.HTTPServer != nil {
-		succeeded, result, err = ex.doHTTPRequestWithContext(operation, data)
+	// The operation is skipped with a reason recorded in operation results if its dependences are
+	// not satisfied in the current path.
+	var execution operationResult
+	if marker, ok := ex.executedOperations[diagnosis.UID]; ok && marker.operation == operation.Name && marker.pathIndex == checkpoint.PathIndex && marker.nodeIndex == checkpoint.NodeIndex {
+		// The operation has already been executed by a sync whose status update failed. Reuse the
+		// recorded result instead of invoking the operation again so that operations with side
+		// effects are not repeated on requeue.
+		ex.Info("reusing result of operation executed on previous sync", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		}, "operation", operation.Name, "outcome", marker.result.Outcome)
+
+		execution = marker.result
+	} else if unmet := unmetOperationDependences(operation, path, checkpoint.NodeIndex, diagnosis.Status.OperationResults); len(unmet) > 0 {
+		ex.Info("skipping operation with unsatisfied dependences", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		}, "operation", operation.Name, "dependences", unmet)
+		ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "OperationSkipped", "Operation %s skipped since dependences %v are not satisfied", operation.Name, unmet)
+
+		execution = operationResult{
+			Outcome: operationSucceeded,
+			Results: map[string]string{
+				operationSkipReasonKey(operation.Name): fmt.Sprintf("dependences %v not satisfied in path", unmet),
+			},
+		}
+	} else if nodeExcludedByWeight(node, diagnosis.UID) {
+		ex.Info("skipping operation excluded by node weight", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		}, "operation", operation.Name, "weight", *node.Weight)
+		ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "OperationSkipped", "Operation %s skipped since diagnosis is excluded by node weight %d", operation.Name, *node.Weight)
+
+		execution = operationResult{
+			Outcome: operationSucceeded,
+			Results: map[string]string{
+				operationSkipReasonKey(operation.Name): fmt.Sprintf("diagnosis excluded by node weight %d", *node.Weight),
+			},
+		}
+	} else if reason, healthy := ex.probeOperationHealth(operation); !healthy {
+		ex.Info("skipping operation which failed its health probe", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		}, "operation", operation.Name, "reason", reason)
+		ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "OperationSkipped", "Operation %s skipped since its processor failed the health probe: %s", operation.Name, reason)
+
+		execution = operationResult{
+			Outcome: operationSucceeded,
+			Results: map[string]string{
+				operationSkipReasonKey(operation.Name): fmt.Sprintf("processor failed health probe: %s", reason),
+			},
+		}
+	} else if operation.Spec.Processor.HTTPServer != nil {
+		execution, err = ex.doHTTPRequestWithContext(operation, data)
+		if err != nil {
+			executorOperationErrorCounter.Inc()
+			return diagnosis, err
+		}
+	} else if operation.Spec.Processor.GRPCServer != nil {
+		execution, err = ex.doGRPCRequestWithContext(operation, data)
 		if err != nil {
 			executorOperationErrorCounter.Inc()
 			return diagnosis, err
 		}
 	} else if operation.Spec.Processor.ScriptRunner != nil {
-		succeeded, result, err = ex.runScriptWithContext(operation, data)
+		execution, err = ex.runScriptWithContext(operation, data)
 		if err != nil {
 			executorOperationErrorCounter.Inc()
 			return diagnosis, err
 		}
 	}
 
+	// Mark the operation as executed before updating the status so that it is not invoked again if
+	// the status update fails and the diagnosis is requeued. The marker is removed once the status
+	// update succeeds.
+	ex.executedOperations[diagnosis.UID] = operationExecutionMarker{
+		diagnosis: client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		},
+		operation: operation.Name,
+		pathIndex: checkpoint.PathIndex,
+		nodeIndex: checkpoint.NodeIndex,
+		result:    execution,
+	}
+
+	// Record the outcome in the event trail of the diagnosis so the progression of the
+	// diagnosis can be audited from the object.
+	AppendDiagnosisContextEvent(&diagnosis, fmt.Sprintf("operation %s of path %d finished with outcome %s", operation.Name, checkpoint.PathIndex, execution.Outcome))
+
 	// Update the operation result into diagnosis status.
-	if succeeded {
+	if execution.succeeded() {
 		ex.Info("operation executed successfully", "diagnosis", client.ObjectKey{
 			Name:      diagnosis.Name,
 			Namespace: diagnosis.Namespace,
@@ -439,12 +1057,27 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 		ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "OperationSucceeded", "Operation %s executed successfully", operation.Name)
 		executorOperationSuccessCounter.Inc()
 
-		// Set operation result according to response from operaton processor.
-		if diagnosis.Status.OperationResults == nil {
-			diagnosis.Status.OperationResults = make(map[string]string)
+		// Reject reserved key modifications by the operation processor. All violations are
+		// aggregated into one error so a non-compliant processor can be fixed in one round.
+		if errs := validateOperationResultAll(execution.Results); len(errs) > 0 {
+			aggregated := utilerrors.NewAggregate(errs)
+			ex.Error(aggregated, "operation result modifies reserved keys", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "operation", operation.Name)
+			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "InvalidOperationResult", "Result of operation %s modifies reserved keys: %v", operation.Name, aggregated)
+			for _, key := range reservedOperationResultKeys {
+				delete(execution.Results, key)
+			}
 		}
-		for key, value := range result {
-			diagnosis.Status.OperationResults[key] = value
+
+		// Set operation result according to response from operaton processor. A value too large
+		// to be recorded is spilled into a file and the error is treated as non-fatal.
+		if err := ex.setDiagnosisOperationResults(&diagnosis, execution.Results); err != nil {
+			ex.Error(err, "failed to record all operation results", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "operation", operation.Name)
 		}
 
 		// Set current path as succeeded path if current operation is succeeded.
@@ -459,7 +1092,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 				Name:      diagnosis.Name,
 				Namespace: diagnosis.Namespace,
 			})
-			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "DiagnosisSucceeded", "Running %s/%s diagnosis successfully", diagnosis.Namespace, diagnosis.Name)
+			ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeNormal, "DiagnosisSucceeded", "Running %s/%s diagnosis successfully", diagnosis.Namespace, diagnosis.Name)
 
 			util.UpdateDiagnosisCondition(&diagnosis.Status, &diagnosisv1.DiagnosisCondition{
 				Type:    diagnosisv1.DiagnosisComplete,
@@ -468,7 +1101,7 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 				Message: fmt.Sprintf("Diagnosis is completed"),
 			})
 			diagnosis.Status.Phase = diagnosisv1.DiagnosisSucceeded
-			if err := ex.client.Status().Update(ex, &diagnosis); err != nil {
+			if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
 				return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
 			}
 			executorSyncSuccessCount.Inc()
@@ -481,9 +1114,14 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 		ex.Info("failed to execute operation", "diagnosis", client.ObjectKey{
 			Name:      diagnosis.Name,
 			Namespace: diagnosis.Namespace,
-		}, "node", node, "operationset", operationset.Name, "path", path)
-		ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "OperationFailed", "Failed to execute operation %s", operation.Name)
-		executorOperationFailCounter.Inc()
+		}, "node", node, "operationset", operationset.Name, "path", path, "outcome", execution.Outcome)
+		if execution.Outcome == operationTimedOut {
+			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "OperationTimedOut", "Operation %s timed out", operation.Name)
+			executorOperationTimeoutCounter.Inc()
+		} else {
+			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "OperationFailed", "Failed to execute operation %s", operation.Name)
+			executorOperationFailCounter.Inc()
+		}
 
 		// Set current path as failed path and clear succeeded path if current operation is failed.
 		if diagnosis.Status.FailedPaths == nil {
@@ -498,9 +1136,15 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 				Name:      diagnosis.Name,
 				Namespace: diagnosis.Namespace,
 			})
-			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s", diagnosis.Namespace, diagnosis.Name)
+			ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s", diagnosis.Namespace, diagnosis.Name)
+			reason := "OperationFailed"
+			if execution.Outcome == operationTimedOut {
+				reason = "OperationTimedOut"
+			}
+			util.SetDiagnosisConditionError(&diagnosis.Status, diagnosisv1.DiagnosisComplete, reason,
+				fmt.Errorf("operation %s of the last path did not succeed with outcome %s", operation.Name, execution.Outcome))
 			diagnosis.Status.Phase = diagnosisv1.DiagnosisFailed
-			if err := ex.client.Status().Update(ex, &diagnosis); err != nil {
+			if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
 				return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
 			}
 			executorSyncFailCount.Inc()
@@ -511,91 +1155,1025 @@ func (ex *executor) syncDiagnosis(diagnosis diagnosisv1.Diagnosis) (diagnosisv1.
 		checkpoint.PathIndex++
 	}
 
-	if err := ex.client.Status().Update(ex, &diagnosis); err != nil {
+	if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
 		return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
 	}
 
 	return diagnosis, nil
 }
 
-// doHTTPRequestWithContext sends a http request to the operation processor with payload.
-// It returns a bool, a map and an error as results.
-func (ex *executor) doHTTPRequestWithContext(operation diagnosisv1.Operation, data map[string]string) (bool, map[string]string, error) {
-	if operation.Spec.Processor.HTTPServer == nil {
-		return false, nil, fmt.Errorf("http server not specified")
-	}
+// syncDiagnosisWithConcurrentPaths executes all paths of the operation set concurrently. The number of
+// concurrently executed paths is bounded by path concurrency of the diagnosis. The diagnosis succeeds if
+// any one of the paths succeeds. Operation results of succeeded paths are merged in path order to keep
+// status updates deterministic.
+func (ex *executor) syncDiagnosisWithConcurrentPaths(diagnosis diagnosisv1.Diagnosis, operationset diagnosisv1.OperationSet) (diagnosisv1.Diagnosis, error) {
+	paths := operationset.Status.Paths
 
-	// Set http request contexts and construct http client. Use kubediag agent bind address as the processor
-	// address if external ip and external port not specified.
-	var host string
-	var port int32
-	if operation.Spec.Processor.HTTPServer.Address != nil {
-		host = *operation.Spec.Processor.HTTPServer.Address
-	} else {
-		host = ex.bindAddress
-	}
-	if operation.Spec.Processor.HTTPServer.Port != nil {
-		port = *operation.Spec.Processor.HTTPServer.Port
-	} else {
-		port = int32(ex.port)
-	}
-	path := *operation.Spec.Processor.HTTPServer.Path
-	scheme := strings.ToLower(string(*operation.Spec.Processor.HTTPServer.Scheme))
-	url := util.FormatURL(scheme, host, strconv.Itoa(int(port)), path)
-	timeout := time.Duration(*operation.Spec.Processor.TimeoutSeconds) * time.Second
-	cli := &http.Client{
-		Timeout:   timeout,
-		Transport: ex.transport,
+	// Execute paths concurrently with a bounded number of workers.
+	succeededResults := make([]map[string]string, len(paths))
+	semaphore := make(chan struct{}, diagnosis.Spec.PathConcurrency)
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() {
+				<-semaphore
+			}()
+
+			succeeded, results := ex.runPath(diagnosis, operationset, paths[index], index)
+			if succeeded {
+				succeededResults[index] = results
+			}
+		}(i)
 	}
+	wg.Wait()
+
+	// Merge operation results of succeeded paths in path order and set failed paths in status.
+	succeededPathIndex := -1
+	for i, path := range paths {
+		if succeededResults[i] == nil {
+			if diagnosis.Status.FailedPaths == nil {
+				diagnosis.Status.FailedPaths = make([]diagnosisv1.Path, 0, len(paths))
+			}
+			diagnosis.Status.FailedPaths = append(diagnosis.Status.FailedPaths, path)
+			AppendDiagnosisContextEvent(&diagnosis, fmt.Sprintf("path %d of operation set %s failed", i, operationset.Name))
+			continue
+		}
 
-	// Marshal request body and construct http request.
-	body, err := json.Marshal(data)
-	if err != nil {
-		return false, nil, fmt.Errorf("failed to marshal request body: %s", err)
-	}
-	req, err := http.NewRequest("POST", url.String(), bytes.NewBuffer(body))
-	if err != nil {
-		return false, nil, err
+		if succeededPathIndex == -1 {
+			succeededPathIndex = i
+		}
+		AppendDiagnosisContextEvent(&diagnosis, fmt.Sprintf("path %d of operation set %s succeeded", i, operationset.Name))
+		if err := ex.setDiagnosisOperationResults(&diagnosis, succeededResults[i]); err != nil {
+			ex.Error(err, "failed to record all operation results", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "path", path)
+		}
 	}
 
-	// Send the http request to operation processor.
-	res, err := cli.Do(req)
-	if err != nil {
-		return false, nil, err
-	}
-	defer res.Body.Close()
-	body, err = ioutil.ReadAll(res.Body)
-	if err != nil {
-		ex.Error(err, "failed to read http response body", "response", string(body))
-		return false, nil, err
-	}
+	if succeededPathIndex != -1 {
+		ex.Info("running diagnosis successfully", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		})
+		ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeNormal, "DiagnosisSucceeded", "Running %s/%s diagnosis successfully", diagnosis.Namespace, diagnosis.Name)
 
-	// Return an error if response body size exceeds max data size.
-	if len(body) > MaxDataSize {
-		return false, nil, fmt.Errorf("response body size %d exceeds max data size %d", len(body), MaxDataSize)
+		diagnosis.Status.SucceededPath = paths[succeededPathIndex]
+		util.UpdateDiagnosisCondition(&diagnosis.Status, &diagnosisv1.DiagnosisCondition{
+			Type:    diagnosisv1.DiagnosisComplete,
+			Status:  corev1.ConditionTrue,
+			Reason:  "DiagnosisComplete",
+			Message: fmt.Sprintf("Diagnosis is completed"),
+		})
+		diagnosis.Status.Phase = diagnosisv1.DiagnosisSucceeded
+		if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
+			return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
+		}
+		executorSyncSuccessCount.Inc()
+		return diagnosis, nil
 	}
 
-	if res.StatusCode != http.StatusOK {
-		ex.Info("http response with erroneous status", "status", res.Status, "response", string(body))
-		return false, nil, nil
+	ex.Info("failed to run diagnosis", "diagnosis", client.ObjectKey{
+		Name:      diagnosis.Name,
+		Namespace: diagnosis.Namespace,
+	})
+	ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeWarning, "DiagnosisFailed", "Failed to run diagnosis %s/%s", diagnosis.Namespace, diagnosis.Name)
+	util.SetDiagnosisConditionError(&diagnosis.Status, diagnosisv1.DiagnosisComplete, "AllPathsFailed",
+		fmt.Errorf("all %d paths of operation set %s failed", len(paths), operationset.Name))
+	diagnosis.Status.Phase = diagnosisv1.DiagnosisFailed
+	if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
+		return diagnosis, fmt.Errorf("unable to update Diagnosis: %s", err)
 	}
+	executorSyncFailCount.Inc()
+	return diagnosis, nil
+}
 
-	var result map[string]string
-	err = json.Unmarshal(body, &result)
+// runPath executes operations of a path sequentially. It returns true and collected operation results if
+// all operations in the path are succeeded. Results of operations recorded by a previous sync whose
+// status update failed are reused instead of invoking the operations again so that operations with
+// side effects are not repeated on requeue.
+func (ex *executor) runPath(diagnosis diagnosisv1.Diagnosis, operationset diagnosisv1.OperationSet, path diagnosisv1.Path, pathIndex int) (bool, map[string]string) {
+	// Construct request data for operations in the path by adding contexts and operation results.
+	data := make(map[string]string)
+	for key, value := range diagnosis.Spec.Parameters {
+		data[key] = value
+	}
+	ex.mergeDecodedOperationResults(data, diagnosis)
+	updateDiagnosisContext(data, diagnosis)
+
+	results := make(map[string]string)
+	for i, node := range path {
+		// Fetch operation according to operation node information.
+		var operation diagnosisv1.Operation
+		err := ex.getWithCacheFallback(client.ObjectKey{
+			Name: node.Operation,
+		}, &operation)
+		if err != nil {
+			ex.Error(err, "unable to fetch Operation", "operation", node.Operation, "operationset", operationset.Name, "path", path)
+			executorOperationErrorCounter.Inc()
+			return false, results
+		}
+
+		// Skip the operation with a reason recorded in operation results if its dependences are
+		// not satisfied in the path.
+		if unmet := unmetOperationDependences(operation, path, i, results); len(unmet) > 0 {
+			ex.Info("skipping operation with unsatisfied dependences", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "operation", operation.Name, "dependences", unmet)
+			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "OperationSkipped", "Operation %s skipped since dependences %v are not satisfied", operation.Name, unmet)
+			results[operationSkipReasonKey(operation.Name)] = fmt.Sprintf("dependences %v not satisfied in path", unmet)
+			continue
+		}
+
+		// Skip the operation with a reason recorded in operation results if the diagnosis is
+		// excluded by the node weight.
+		if nodeExcludedByWeight(node, diagnosis.UID) {
+			ex.Info("skipping operation excluded by node weight", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "operation", operation.Name, "weight", *node.Weight)
+			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "OperationSkipped", "Operation %s skipped since diagnosis is excluded by node weight %d", operation.Name, *node.Weight)
+			results[operationSkipReasonKey(operation.Name)] = fmt.Sprintf("diagnosis excluded by node weight %d", *node.Weight)
+			continue
+		}
+
+		// Skip the operation with a reason recorded in operation results if its processor fails
+		// the configured health probe.
+		if reason, healthy := ex.probeOperationHealth(operation); !healthy {
+			ex.Info("skipping operation which failed its health probe", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "operation", operation.Name, "reason", reason)
+			ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "OperationSkipped", "Operation %s skipped since its processor failed the health probe: %s", operation.Name, reason)
+			results[operationSkipReasonKey(operation.Name)] = fmt.Sprintf("processor failed health probe: %s", reason)
+			continue
+		}
+
+		ex.Info("running operation", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		}, "node", node, "operationset", operationset.Name, "path", path)
+
+		// Execute the operation by sending http request to the processor or running predefined script.
+		var execution operationResult
+		if marker, ok := ex.lookupExecutedPathOperation(diagnosis.UID, pathIndex, i); ok {
+			// The operation has already been executed by a sync whose status update failed. Reuse
+			// the recorded result instead of invoking the operation again so that operations with
+			// side effects are not repeated on requeue.
+			ex.Info("reusing result of operation executed on previous sync", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "operation", operation.Name, "outcome", marker.Outcome)
+
+			execution = marker
+		} else {
+			if operation.Spec.Processor.HTTPServer != nil {
+				execution, err = ex.doHTTPRequestWithContext(operation, data)
+			} else if operation.Spec.Processor.GRPCServer != nil {
+				execution, err = ex.doGRPCRequestWithContext(operation, data)
+			} else if operation.Spec.Processor.ScriptRunner != nil {
+				execution, err = ex.runScriptWithContext(operation, data)
+			}
+			if err != nil {
+				executorOperationErrorCounter.Inc()
+				return false, results
+			}
+
+			// Record the result before the status of the diagnosis is updated so that the
+			// operation is not invoked again if the status update fails and the diagnosis is
+			// requeued. The record is removed once the status update succeeds.
+			ex.recordExecutedPathOperation(diagnosis.UID, pathIndex, i, execution)
+		}
+		if !execution.succeeded() {
+			if execution.Outcome == operationTimedOut {
+				ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "OperationTimedOut", "Operation %s timed out", operation.Name)
+				executorOperationTimeoutCounter.Inc()
+			} else {
+				ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeWarning, "OperationFailed", "Failed to execute operation %s", operation.Name)
+				executorOperationFailCounter.Inc()
+			}
+			return false, results
+		}
+
+		ex.eventRecorder.Eventf(&diagnosis, corev1.EventTypeNormal, "OperationSucceeded", "Operation %s executed successfully", operation.Name)
+		executorOperationSuccessCounter.Inc()
+		for key, value := range execution.Results {
+			data[key] = value
+			results[key] = value
+		}
+	}
+
+	return true, results
+}
+
+// operationSkipReasonKey returns the operation result key which records the reason for skipping
+// the operation.
+func operationSkipReasonKey(operation string) string {
+	return fmt.Sprintf("operation.%s.skip.reason", operation)
+}
+
+// nodeExcludedByWeight reports whether the diagnosis is excluded from executing the operation on
+// the node by the node weight. The decision is made by consistent hashing on the diagnosis uid
+// and the operation name so that it is stable across retries and differs between operations.
+func nodeExcludedByWeight(node diagnosisv1.Node, uid types.UID) bool {
+	if node.Weight == nil || *node.Weight >= 100 {
+		return false
+	}
+	if *node.Weight <= 0 {
+		return true
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(uid))
+	hash.Write([]byte(node.Operation))
+
+	return int32(hash.Sum32()%100) >= *node.Weight
+}
+
+// unmetOperationDependences returns dependences of the operation which are not satisfied in the
+// path. A dependence is satisfied if the depended operation has been executed on a preceding node
+// of the path and has not been skipped. Paths are linear orderings of the operation set graph, so
+// cyclic dependences among operations always leave at least one dependence unsatisfied instead of
+// blocking the executor.
+func unmetOperationDependences(operation diagnosisv1.Operation, path diagnosisv1.Path, nodeIndex int, results map[string]string) []string {
+	var unmet []string
+	for _, dependence := range operation.Spec.Dependences {
+		satisfied := false
+		for i := 0; i < nodeIndex && i < len(path); i++ {
+			if path[i].Operation != dependence {
+				continue
+			}
+			if _, skipped := results[operationSkipReasonKey(dependence)]; !skipped {
+				satisfied = true
+			}
+			break
+		}
+		if !satisfied {
+			unmet = append(unmet, dependence)
+		}
+	}
+
+	return unmet
+}
+
+// updateDiagnosisStatus writes the computed status of the diagnosis with conflict handling. The
+// latest object is refetched and the computed status is reapplied on a conflict so a concurrent
+// metadata update does not force the whole sync including operation executions to be repeated.
+func (ex *executor) updateDiagnosisStatus(diagnosis *diagnosisv1.Diagnosis) error {
+	status := diagnosis.Status.DeepCopy()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := ex.client.Status().Update(ex, diagnosis)
+		if err == nil || !apierrors.IsConflict(err) {
+			return err
+		}
+
+		var latest diagnosisv1.Diagnosis
+		if getErr := ex.client.Get(ex, client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		}, &latest); getErr != nil {
+			return getErr
+		}
+		latest.Status = *status.DeepCopy()
+		*diagnosis = latest
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Diagnoses enter the executor in phase Running, so a successfully written terminal phase
+	// marks a phase transition worth an event on the diagnosis timeline.
+	if diagnosis.Status.Phase == diagnosisv1.DiagnosisSucceeded || diagnosis.Status.Phase == diagnosisv1.DiagnosisFailed {
+		controllers.RecordDiagnosisPhaseChange(ex.eventRecorder, diagnosis, "executor", "")
+	}
+
+	return nil
+}
+
+// setDiagnosisFailedOnMaxRetriesExceeded marks the diagnosis as failed after the sync retry limit
+// has been exceeded. The diagnosis is not requeued afterwards.
+func (ex *executor) setDiagnosisFailedOnMaxRetriesExceeded(diagnosis diagnosisv1.Diagnosis) {
+	ex.Info("giving up syncing Diagnosis on exceeded retry limit", "diagnosis", client.ObjectKey{
+		Name:      diagnosis.Name,
+		Namespace: diagnosis.Namespace,
+	}, "maxSyncRetries", ex.maxSyncRetries)
+	ex.recordDiagnosisEvent(&diagnosis, corev1.EventTypeWarning, "MaxRetriesExceeded", "Failed to run diagnosis %s/%s after %d retries", diagnosis.Namespace, diagnosis.Name, ex.maxSyncRetries)
+	diagnosis.Status.Phase = diagnosisv1.DiagnosisFailed
+	if err := ex.updateDiagnosisStatus(&diagnosis); err != nil {
+		ex.Error(err, "unable to update Diagnosis", "diagnosis", client.ObjectKey{
+			Name:      diagnosis.Name,
+			Namespace: diagnosis.Namespace,
+		})
+	}
+	executorSyncFailCount.Inc()
+}
+
+// recordDiagnosisEvent records an event about the result of a diagnosis with the severity of the
+// diagnosis appended to the message. An event of a diagnosis with critical severity is always
+// recorded as a warning.
+func (ex *executor) recordDiagnosisEvent(diagnosis *diagnosisv1.Diagnosis, eventType string, reason string, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if diagnosis.Spec.Severity != "" {
+		message = fmt.Sprintf("%s (severity: %s)", message, diagnosis.Spec.Severity)
+		if diagnosis.Spec.Severity == diagnosisv1.DiagnosisSeverityCritical {
+			eventType = corev1.EventTypeWarning
+		}
+	}
+
+	ex.eventRecorder.Event(diagnosis, eventType, reason, message)
+}
+
+// operationOutcome classifies the result of executing an operation.
+type operationOutcome string
+
+const (
+	// operationSucceeded means the operation processor returned a usable result.
+	operationSucceeded operationOutcome = "Succeeded"
+	// operationFailed means the operation processor returned an erroneous response.
+	operationFailed operationOutcome = "Failed"
+	// operationTimedOut means the operation processor did not respond within the operation
+	// timeout after all retries.
+	operationTimedOut operationOutcome = "TimedOut"
+)
+
+// operationResult is the structured result of executing an operation. It carries the outcome of
+// the execution so callers can distinguish a processor failure from a timeout instead of folding
+// both into a single boolean.
+type operationResult struct {
+	// Outcome classifies whether the operation succeeded, failed or timed out.
+	Outcome operationOutcome
+	// Results holds the key value pairs returned by the operation processor on success.
+	Results map[string]string
+}
+
+// operationExecutionMarker records an operation which has been executed during a sync whose status
+// update failed. The marker identifies the diagnosis, the operation and its position in the
+// operation set so that the recorded result can be reused when the diagnosis is requeued.
+type operationExecutionMarker struct {
+	// diagnosis is the namespaced name of the diagnosis the operation was executed for.
+	diagnosis client.ObjectKey
+	// operation is the name of the executed operation.
+	operation string
+	// pathIndex is the index of the path the operation was executed in.
+	pathIndex int
+	// nodeIndex is the index of the operation node in the path.
+	nodeIndex int
+	// result is the recorded result of the execution.
+	result operationResult
+}
+
+// pathStep identifies an operation node by the index of its path in the operation set and the
+// index of the node in the path.
+type pathStep struct {
+	// pathIndex is the index of the path.
+	pathIndex int
+	// nodeIndex is the index of the operation node in the path.
+	nodeIndex int
+}
+
+// lookupExecutedPathOperation returns the recorded result of an operation executed during a
+// concurrent path sync whose status update failed.
+func (ex *executor) lookupExecutedPathOperation(uid types.UID, pathIndex int, nodeIndex int) (operationResult, bool) {
+	ex.executedPathOperationsMutex.Lock()
+	defer ex.executedPathOperationsMutex.Unlock()
+
+	result, ok := ex.executedPathOperations[uid][pathStep{pathIndex: pathIndex, nodeIndex: nodeIndex}]
+	return result, ok
+}
+
+// recordExecutedPathOperation records the result of an operation executed during a concurrent
+// path sync.
+func (ex *executor) recordExecutedPathOperation(uid types.UID, pathIndex int, nodeIndex int, result operationResult) {
+	ex.executedPathOperationsMutex.Lock()
+	defer ex.executedPathOperationsMutex.Unlock()
+
+	if ex.executedPathOperations[uid] == nil {
+		ex.executedPathOperations[uid] = make(map[pathStep]operationResult)
+	}
+	ex.executedPathOperations[uid][pathStep{pathIndex: pathIndex, nodeIndex: nodeIndex}] = result
+}
+
+// deleteExecutedPathOperations drops recorded results of concurrent path operations of the
+// diagnosis.
+func (ex *executor) deleteExecutedPathOperations(uid types.UID) {
+	ex.executedPathOperationsMutex.Lock()
+	defer ex.executedPathOperationsMutex.Unlock()
+
+	delete(ex.executedPathOperations, uid)
+}
+
+// succeeded reports whether the operation produced a usable result.
+func (result operationResult) succeeded() bool {
+	return result.Outcome == operationSucceeded
+}
+
+// breakerAllows reports whether dispatch to the processor url is allowed by its circuit
+// breaker. An open breaker short-circuits dispatch until its cooldown has passed, after which a
+// single half open probe request is allowed through.
+func (ex *executor) breakerAllows(target string) bool {
+	if ex.breakerFailureThreshold <= 0 {
+		return true
+	}
+
+	ex.breakerMutex.Lock()
+	defer ex.breakerMutex.Unlock()
+
+	breaker, ok := ex.breakers[target]
+	if !ok || breaker.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(breaker.openUntil) {
+		return false
+	}
+
+	// The cooldown has passed. Let the request through as a half open probe; a failure reopens
+	// the breaker and a success closes it.
+	ex.Info("circuit breaker half open, probing processor", "processor", target)
+	executorBreakerTransitionCounter.WithLabelValues("half-open").Inc()
+	breaker.openUntil = time.Time{}
+	return true
+}
+
+// recordBreakerResult records the result of a request to the processor url in its circuit
+// breaker. The breaker opens for the cooldown once the consecutive failure threshold is reached
+// and closes on the first successful request.
+func (ex *executor) recordBreakerResult(target string, success bool) {
+	if ex.breakerFailureThreshold <= 0 {
+		return
+	}
+
+	ex.breakerMutex.Lock()
+	defer ex.breakerMutex.Unlock()
+
+	breaker, ok := ex.breakers[target]
+	if !ok {
+		breaker = &circuitBreaker{}
+		ex.breakers[target] = breaker
+	}
+
+	if success {
+		if breaker.consecutiveFailures >= ex.breakerFailureThreshold {
+			ex.Info("circuit breaker closed", "processor", target)
+			executorBreakerTransitionCounter.WithLabelValues("closed").Inc()
+		}
+		breaker.consecutiveFailures = 0
+		breaker.openUntil = time.Time{}
+		return
+	}
+
+	breaker.consecutiveFailures++
+	if breaker.consecutiveFailures >= ex.breakerFailureThreshold {
+		ex.Info("circuit breaker open", "processor", target, "consecutiveFailures", breaker.consecutiveFailures, "cooldown", ex.breakerCooldown)
+		executorBreakerTransitionCounter.WithLabelValues("open").Inc()
+		breaker.openUntil = time.Now().Add(ex.breakerCooldown)
+	}
+}
+
+// probeOperationHealth probes the health path of the operation processor with a GET request if
+// one is configured. It returns the reason the processor is considered unhealthy and false if
+// the probe fails. Operations without a health path always pass the probe.
+func (ex *executor) probeOperationHealth(operation diagnosisv1.Operation) (string, bool) {
+	if operation.Spec.Processor.HTTPServer == nil || operation.Spec.Processor.HTTPServer.HealthPath == nil {
+		return "", true
+	}
+
+	var host string
+	var port int32
+	if operation.Spec.Processor.HTTPServer.Address != nil {
+		host = *operation.Spec.Processor.HTTPServer.Address
+	} else {
+		host = ex.bindAddress
+	}
+	if operation.Spec.Processor.HTTPServer.Port != nil {
+		port = *operation.Spec.Processor.HTTPServer.Port
+	} else {
+		port = int32(ex.port)
+	}
+	scheme := strings.ToLower(string(*operation.Spec.Processor.HTTPServer.Scheme))
+	url := util.FormatURL(scheme, host, strconv.Itoa(int(port)), *operation.Spec.Processor.HTTPServer.HealthPath)
+	cli := &http.Client{
+		Timeout:   operationHealthProbeTimeout,
+		Transport: ex.transport,
+	}
+
+	res, err := cli.Get(url.String())
+	if err != nil {
+		return fmt.Sprintf("health probe request failed: %v", err), false
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Sprintf("health probe returned status %d", res.StatusCode), false
+	}
+
+	return "", true
+}
+
+// doHTTPRequestWithContext sends a http request to the operation processor with payload.
+// It returns the structured result of the execution and an error on transient failures.
+func (ex *executor) doHTTPRequestWithContext(operation diagnosisv1.Operation, data map[string]string) (operationResult, error) {
+	if operation.Spec.Processor.HTTPServer == nil {
+		return operationResult{Outcome: operationFailed}, fmt.Errorf("http server not specified")
+	}
+
+	// Set http request contexts and construct http client. Use kubediag agent bind address as the processor
+	// address if external ip and external port not specified.
+	var host string
+	var port int32
+	if operation.Spec.Processor.HTTPServer.Address != nil {
+		host = *operation.Spec.Processor.HTTPServer.Address
+	} else {
+		host = ex.bindAddress
+	}
+	if operation.Spec.Processor.HTTPServer.Port != nil {
+		port = *operation.Spec.Processor.HTTPServer.Port
+	} else {
+		port = int32(ex.port)
+	}
+	path := *operation.Spec.Processor.HTTPServer.Path
+	scheme := strings.ToLower(string(*operation.Spec.Processor.HTTPServer.Scheme))
+	url := util.FormatURL(scheme, host, strconv.Itoa(int(port)), path)
+	timeout := time.Duration(*operation.Spec.Processor.TimeoutSeconds) * time.Second
+	cli := &http.Client{
+		Timeout:   timeout,
+		Transport: ex.transport,
+	}
+
+	// Short-circuit dispatch if the circuit breaker of the processor url is open so that a
+	// consistently erroring processor fails the operation immediately instead of wasting the
+	// timeout on every matching diagnosis.
+	target := url.String()
+	if !ex.breakerAllows(target) {
+		ex.Info("operation skipped with open circuit breaker", "operation", operation.Name, "processor", target, "reason", "CircuitOpen")
+		return operationResult{Outcome: operationFailed}, nil
+	}
+
+	// Marshal request body and construct http request.
+	body, err := json.Marshal(data)
+	if err != nil {
+		return operationResult{Outcome: operationFailed}, fmt.Errorf("failed to marshal request body: %s", err)
+	}
+
+	// Attach the bearer token if processor authentication is configured.
+	token := ""
+	if ex.processorTokenFile != "" {
+		data, err := ioutil.ReadFile(ex.processorTokenFile)
+		if err != nil {
+			return operationResult{Outcome: operationFailed}, fmt.Errorf("failed to read processor token file: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	traceID := data[TraceIDTelemetryKey]
+	retries, retryDelay := operationRetryPolicy(operation)
+
+	// Send the http request to operation processor and observe the round trip duration. The
+	// request is retried on connection errors and 5xx responses until the retry limit of the
+	// operation is exceeded. Responses with a 4xx status are never retried.
+	var res *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("POST", url.String(), bytes.NewBuffer(body))
+		if err != nil {
+			return operationResult{Outcome: operationFailed}, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+
+		// Inject a w3c traceparent header so processor handlers can continue the trace of the
+		// diagnosis.
+		spanID := ""
+		if traceID != "" {
+			spanID = newSpanID()
+			req.Header.Set(traceparentHeader, buildTraceparent(traceID, spanID))
+		}
+
+		startTime := time.Now()
+		res, err = cli.Do(req)
+		duration := time.Since(startTime)
+		executorOperationProcessorDuration.WithLabelValues(operation.Name).Observe(duration.Seconds())
+		if spanID != "" {
+			ex.Info("operation processor span finished", "operation", operation.Name, "traceID", traceID, "spanID", spanID, "duration", duration)
+		}
+
+		retryable := err != nil || res.StatusCode >= http.StatusInternalServerError
+		if !retryable || attempt >= retries {
+			if err != nil {
+				ex.recordBreakerResult(target, false)
+				// A request which timed out after all retries is a terminal outcome of the
+				// operation instead of a transient error so the chain can fail the path and
+				// increment the timeout metric.
+				if isTimeoutError(err) {
+					ex.Info("operation processor request timed out", "operation", operation.Name, "timeout", timeout)
+					return operationResult{Outcome: operationTimedOut}, nil
+				}
+				return operationResult{Outcome: operationFailed}, err
+			}
+			break
+		}
+
+		if res != nil {
+			res.Body.Close()
+		}
+		delay := jitteredBackoff(retryDelay, attempt)
+		ex.Info("retrying operation processor request", "operation", operation.Name, "attempt", attempt+1, "retries", retries, "delay", delay, "error", err)
+		time.Sleep(delay)
+	}
+	defer res.Body.Close()
+
+	// A response below 500 proves the processor is up even if the operation itself failed, so it
+	// counts as a success for the circuit breaker of the processor url.
+	ex.recordBreakerResult(target, res.StatusCode < http.StatusInternalServerError)
+
+	// Stream the response body into data root if the content length exceeds max data size or the
+	// body is binary. Only a file reference is recorded in the diagnosis to avoid blowing past
+	// etcd object size limits.
+	if res.StatusCode == http.StatusOK && responseShouldStreamToFile(res) {
+		result, err := ex.streamResponseBodyToFile(operation, res.Body)
+		if err != nil {
+			return operationResult{Outcome: operationFailed}, err
+		}
+
+		return operationResult{Outcome: operationSucceeded, Results: result}, nil
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		ex.Error(err, "failed to read http response body", "response", string(body))
+		return operationResult{Outcome: operationFailed}, err
+	}
+
+	// Return an error if response body size exceeds max data size.
+	if len(body) > MaxDataSize {
+		return operationResult{Outcome: operationFailed}, fmt.Errorf("response body size %d exceeds max data size %d", len(body), MaxDataSize)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		ex.Info("http response with erroneous status", "status", res.Status, "response", string(body))
+		return operationResult{Outcome: operationFailed}, nil
+	}
+
+	var result map[string]string
+	err = json.Unmarshal(body, &result)
 	if err != nil {
 		ex.Error(err, "failed to marshal response body", "response", string(body))
 		// If response code is 200 but body is not a string-map, we think this processor is finished but failed and will not return error
-		return false, nil, nil
+		return operationResult{Outcome: operationFailed}, nil
+	}
+
+	return operationResult{Outcome: operationSucceeded, Results: result}, nil
+}
+
+// doGRPCRequestWithContext calls the Process method of the grpc operation processor with the
+// diagnosis context. The request is retried on unavailable and internal status codes until the
+// retry limit of the operation is exceeded. A deadline exceeded status is a terminal timeout
+// outcome like its http counterpart.
+func (ex *executor) doGRPCRequestWithContext(operation diagnosisv1.Operation, data map[string]string) (operationResult, error) {
+	if operation.Spec.Processor.GRPCServer == nil {
+		return operationResult{Outcome: operationFailed}, fmt.Errorf("grpc server not specified")
+	}
+
+	host := ex.bindAddress
+	if operation.Spec.Processor.GRPCServer.Address != nil {
+		host = *operation.Spec.Processor.GRPCServer.Address
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(operation.Spec.Processor.GRPCServer.Port)))
+	timeout := time.Duration(*operation.Spec.Processor.TimeoutSeconds) * time.Second
+	retries, retryDelay := operationRetryPolicy(operation)
+
+	conn, err := grpc.Dial(target, grpc.WithInsecure())
+	if err != nil {
+		return operationResult{Outcome: operationFailed}, fmt.Errorf("unable to connect to operation processor at %s: %v", target, err)
+	}
+	defer conn.Close()
+	cli := rpc.NewOperationProcessorClient(conn)
+
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(ex, timeout)
+		startTime := time.Now()
+		response, err := cli.Process(ctx, &rpc.ProcessRequest{Context: data})
+		cancel()
+		executorOperationProcessorDuration.WithLabelValues(operation.Name).Observe(time.Since(startTime).Seconds())
+		if err == nil {
+			return operationResult{Outcome: operationSucceeded, Results: response.Context}, nil
+		}
+
+		code := grpcstatus.Code(err)
+		if code == codes.DeadlineExceeded {
+			ex.Info("operation processor request timed out", "operation", operation.Name, "timeout", timeout)
+			return operationResult{Outcome: operationTimedOut}, nil
+		}
+		retryable := code == codes.Unavailable || code == codes.Internal
+		if !retryable || attempt >= retries {
+			if retryable {
+				return operationResult{Outcome: operationFailed}, err
+			}
+			// A non retryable status is a terminal outcome of the operation like a 4xx http
+			// response so the chain can fail the path.
+			ex.Info("grpc response with erroneous status", "operation", operation.Name, "code", code, "error", err)
+			return operationResult{Outcome: operationFailed}, nil
+		}
+
+		delay := jitteredBackoff(retryDelay, attempt)
+		ex.Info("retrying operation processor request", "operation", operation.Name, "attempt", attempt+1, "retries", retries, "delay", delay, "error", err)
+		time.Sleep(delay)
+	}
+}
+
+// isTimeoutError reports whether the request error was caused by a timeout.
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return os.IsTimeout(err)
+}
+
+// operationRetryPolicy returns the retry count and base retry delay of the operation. Retries
+// are disabled if the operation does not specify a retry count.
+func operationRetryPolicy(operation diagnosisv1.Operation) (int, time.Duration) {
+	retries := 0
+	if operation.Spec.Processor.Retries != nil {
+		retries = int(*operation.Spec.Processor.Retries)
+	}
+	retryDelay := time.Second
+	if operation.Spec.Processor.RetryDelaySeconds != nil {
+		retryDelay = time.Duration(*operation.Spec.Processor.RetryDelaySeconds) * time.Second
+	}
+
+	return retries, retryDelay
+}
+
+// jitteredBackoff returns the delay before the next retry of a processor request. The base
+// delay is doubled on each attempt and jittered by up to half of its value.
+func jitteredBackoff(baseDelay time.Duration, attempt int) time.Duration {
+	delay := baseDelay << uint(attempt)
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// responseShouldStreamToFile reports whether the processor response should be streamed into a file
+// instead of being recorded in the diagnosis. A response is streamed if its content length exceeds
+// max data size or its content type indicates a binary body.
+func responseShouldStreamToFile(res *http.Response) bool {
+	if res.ContentLength > MaxDataSize {
+		return true
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" || strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/") {
+		return false
+	}
+
+	return true
+}
+
+// streamResponseBodyToFile streams the processor response body into a file under data root and
+// returns a result containing the file path, size and sha256 checksum of the body.
+func (ex *executor) streamResponseBodyToFile(operation diagnosisv1.Operation, body io.Reader) (map[string]string, error) {
+	responseDirectory := filepath.Join(ex.dataRoot, ResponseSubDirectory, operation.Name)
+	if err := os.MkdirAll(responseDirectory, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("unable to create directory to store response of operation %s: %v", operation.Name, err)
+	}
+
+	filePath := filepath.Join(responseDirectory, strconv.FormatInt(time.Now().UnixNano(), 10))
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create file to store response of operation %s: %v", operation.Name, err)
+	}
+	defer file.Close()
+
+	checksum := sha256.New()
+	size, err := io.Copy(file, io.TeeReader(body, checksum))
+	if err != nil {
+		return nil, fmt.Errorf("failed to stream response of operation %s to file: %v", operation.Name, err)
+	}
+	ex.Info("streamed large processor response to file", "operation", operation.Name, "path", filePath, "size", size)
+
+	result := make(map[string]string)
+	result[ResponseFilePathTelemetryKey] = filePath
+	result[ResponseFileSizeTelemetryKey] = strconv.FormatInt(size, 10)
+	result[ResponseFileChecksumTelemetryKey] = hex.EncodeToString(checksum.Sum(nil))
+
+	return result, nil
+}
+
+// reservedOperationResultKeys are telemetry keys owned by the executor. An operation result must
+// not modify them since downstream operations rely on them to identify the target of the diagnosis.
+var reservedOperationResultKeys = []string{
+	DiagnosisUIDTelemetryKey,
+	DiagnosisNamespaceTelemetryKey,
+	DiagnosisNameTelemetryKey,
+	PodNamespaceTelemetryKey,
+	PodNameTelemetryKey,
+	ContainerTelemetryKey,
+	NodeTelemetryKey,
+	PodReferencesTelemetryKey,
+	DiagnosisEventsTelemetryKey,
+	ResponseFilePathTelemetryKey,
+	ResponseFileSizeTelemetryKey,
+	ResponseFileChecksumTelemetryKey,
+}
+
+// diagnosisContextEvent is one timestamped note in the event trail of a diagnosis.
+type diagnosisContextEvent struct {
+	// Time is the time the note was recorded.
+	Time time.Time `json:"time"`
+	// Note is a human readable description of what happened.
+	Note string `json:"note"`
+}
+
+// AppendDiagnosisContextEvent appends a timestamped note to the event trail recorded under the
+// diagnosis events telemetry key in the operation results of the diagnosis. The trail is ordered
+// and bounded so that the progression of the diagnosis can be audited from the object without
+// growing it without limit. An unreadable existing trail is replaced instead of failing.
+func AppendDiagnosisContextEvent(diagnosis *diagnosisv1.Diagnosis, note string) {
+	if diagnosis.Status.OperationResults == nil {
+		diagnosis.Status.OperationResults = make(map[string]string)
+	}
+
+	var events []diagnosisContextEvent
+	if value := diagnosis.Status.OperationResults[DiagnosisEventsTelemetryKey]; value != "" {
+		// The trail is rebuilt from scratch if it has been corrupted.
+		_ = json.Unmarshal([]byte(value), &events)
+	}
+
+	events = append(events, diagnosisContextEvent{
+		Time: time.Now(),
+		Note: note,
+	})
+	if len(events) > maxDiagnosisContextEvents {
+		events = events[len(events)-maxDiagnosisContextEvents:]
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		return
+	}
+	diagnosis.Status.OperationResults[DiagnosisEventsTelemetryKey] = string(data)
+}
+
+// validateOperationResult validates that an operation result does not modify any reserved
+// telemetry key and returns the first violation found. It delegates to
+// validateOperationResultAll.
+func validateOperationResult(result map[string]string) error {
+	errs := validateOperationResultAll(result)
+	if len(errs) == 0 {
+		return nil
 	}
 
-	return true, result, nil
+	return errs[0]
+}
+
+// validateOperationResultAll collects every reserved key modification in an operation result so
+// that a non-compliant processor can be fixed in one round instead of one violation per run.
+func validateOperationResultAll(result map[string]string) []error {
+	var errs []error
+	for _, key := range reservedOperationResultKeys {
+		if _, ok := result[key]; ok {
+			errs = append(errs, fmt.Errorf("operation result must not modify reserved key %s", key))
+		}
+	}
+	return errs
+}
+
+// setDiagnosisOperationResults merges operation result values into the operation results of the
+// diagnosis. A value exceeding max context value bytes is compressed if compression brings it
+// below the limit and spilled into a file under data root otherwise, with a reference to the file
+// recorded instead, to keep the diagnosis below the etcd object size limit.
+// ErrContextValueTooLarge is returned if a value could not be spilled; the error is non-fatal
+// since all remaining operation results are still recorded.
+func (ex *executor) setDiagnosisOperationResults(diagnosis *diagnosisv1.Diagnosis, result map[string]string) error {
+	if diagnosis.Status.OperationResults == nil {
+		diagnosis.Status.OperationResults = make(map[string]string)
+	}
+
+	spillFailed := false
+	for key, value := range result {
+		if ex.maxContextValueBytes <= 0 || len(value) <= ex.maxContextValueBytes {
+			diagnosis.Status.OperationResults[key] = value
+			continue
+		}
+
+		if compressed, err := compressContextValue(value); err != nil {
+			ex.Error(err, "failed to compress operation result value", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "key", key, "size", len(value))
+		} else if len(compressed) <= ex.maxContextValueBytes {
+			ex.Info("compressed large operation result value", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "key", key, "size", len(value), "compressed", len(compressed))
+			diagnosis.Status.OperationResults[key] = compressed
+			continue
+		}
+
+		filePath, err := ex.spillContextValueToFile(*diagnosis, key, value)
+		if err != nil {
+			ex.Error(err, "failed to spill operation result value to file", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "key", key, "size", len(value))
+			spillFailed = true
+			continue
+		}
+		diagnosis.Status.OperationResults[key] = fmt.Sprintf("file://%s", filePath)
+	}
+
+	if spillFailed {
+		return ErrContextValueTooLarge
+	}
+
+	return nil
+}
+
+// spillContextValueToFile writes an operation result value into a file under data root and
+// returns the file path. Files are grouped by diagnosis to simplify garbage collection.
+func (ex *executor) spillContextValueToFile(diagnosis diagnosisv1.Diagnosis, key string, value string) (string, error) {
+	contextDirectory := filepath.Join(ex.dataRoot, ContextSubDirectory, fmt.Sprintf("%s.%s", diagnosis.Namespace, diagnosis.Name))
+	if err := os.MkdirAll(contextDirectory, os.ModePerm); err != nil {
+		return "", fmt.Errorf("unable to create directory to store context value of diagnosis %s/%s: %v", diagnosis.Namespace, diagnosis.Name, err)
+	}
+
+	filePath := filepath.Join(contextDirectory, key)
+	if err := ioutil.WriteFile(filePath, []byte(value), 0644); err != nil {
+		return "", fmt.Errorf("unable to write context value of diagnosis %s/%s to file: %v", diagnosis.Namespace, diagnosis.Name, err)
+	}
+	ex.Info("spilled large operation result value to file", "diagnosis", client.ObjectKey{
+		Name:      diagnosis.Name,
+		Namespace: diagnosis.Namespace,
+	}, "key", key, "path", filePath, "size", len(value))
+
+	return filePath, nil
+}
+
+// compressContextValue gzip compresses and base64 encodes an operation result value and prefixes
+// the result with the compressed context value marker.
+func compressContextValue(value string) (string, error) {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if _, err := gzipWriter.Write([]byte(value)); err != nil {
+		return "", fmt.Errorf("unable to compress context value: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return "", fmt.Errorf("unable to compress context value: %v", err)
+	}
+
+	return CompressedContextValuePrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeContextValue decompresses an operation result value bearing the compressed context value
+// marker. A value without the marker is returned unchanged.
+func DecodeContextValue(value string) (string, error) {
+	if !strings.HasPrefix(value, CompressedContextValuePrefix) {
+		return value, nil
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, CompressedContextValuePrefix))
+	if err != nil {
+		return "", fmt.Errorf("unable to decode compressed context value: %v", err)
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", fmt.Errorf("unable to decompress context value: %v", err)
+	}
+	decompressed, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		return "", fmt.Errorf("unable to decompress context value: %v", err)
+	}
+
+	return string(decompressed), nil
+}
+
+// mergeDecodedOperationResults merges operation results of the diagnosis into the request data of
+// an operation, decompressing compressed values so that processors receive the original values.
+// A value which cannot be decompressed is passed through unchanged.
+func (ex *executor) mergeDecodedOperationResults(data map[string]string, diagnosis diagnosisv1.Diagnosis) {
+	for key, value := range diagnosis.Status.OperationResults {
+		decoded, err := DecodeContextValue(value)
+		if err != nil {
+			ex.Error(err, "failed to decompress operation result value", "diagnosis", client.ObjectKey{
+				Name:      diagnosis.Name,
+				Namespace: diagnosis.Namespace,
+			}, "key", key)
+			decoded = value
+		}
+		data[key] = decoded
+	}
 }
 
 // runScriptWithContext runs a script with the arguments provided by context.
 // It returns a bool, a map and an error as results.
-func (ex *executor) runScriptWithContext(operation diagnosisv1.Operation, data map[string]string) (bool, map[string]string, error) {
+func (ex *executor) runScriptWithContext(operation diagnosisv1.Operation, data map[string]string) (operationResult, error) {
 	if operation.Spec.Processor.ScriptRunner == nil {
-		return false, nil, fmt.Errorf("script runner not specified")
+		return operationResult{Outcome: operationFailed}, fmt.Errorf("script runner not specified")
 	}
 
 	// Generate all argument according to script runner definition and execute the script with timeout.
@@ -607,22 +2185,70 @@ func (ex *executor) runScriptWithContext(operation diagnosisv1.Operation, data m
 	}
 	scriptFilePath := filepath.Join(ex.dataRoot, controllers.ScriptSubDirectory, operation.Name)
 	command := append([]string{"/bin/sh", scriptFilePath}, args...)
-	output, err := util.BlockingRunCommandWithTimeout(command, *operation.Spec.Processor.TimeoutSeconds)
+	env, secretValues, err := ex.resolveScriptEnv(operation)
+	if err != nil {
+		return operationResult{Outcome: operationFailed}, err
+	}
+	output, err := util.BlockingRunCommandWithTimeoutEnv(command, env, *operation.Spec.Processor.TimeoutSeconds)
 
-	// Update script execution result with output and error.
+	// Update script execution result with output and error. Values resolved from secrets are
+	// scrubbed so credentials passed to the script never end up in the diagnosis.
 	result := make(map[string]string)
 	if operation.Spec.Processor.ScriptRunner.OperationResultKey != nil {
 		if output != nil {
 			key := strings.Join([]string{"operation", *operation.Spec.Processor.ScriptRunner.OperationResultKey, "output"}, ".")
-			result[key] = string(output)
+			result[key] = scrubValues(string(output), secretValues)
 		}
 		if err != nil {
 			key := strings.Join([]string{"operation", *operation.Spec.Processor.ScriptRunner.OperationResultKey, "error"}, ".")
-			result[key] = err.Error()
+			result[key] = scrubValues(err.Error(), secretValues)
 		}
 	}
 
-	return true, result, nil
+	return operationResult{Outcome: operationSucceeded, Results: result}, nil
+}
+
+// resolveScriptEnv resolves the environment variables of the script runner of the operation into
+// key=value pairs. Values referencing secrets are fetched from the api at run time and returned
+// separately so they can be scrubbed from recorded output; literal values are visible in the
+// operation spec anyway and are not scrubbed. An error mentions the secret reference but never
+// its value.
+func (ex *executor) resolveScriptEnv(operation diagnosisv1.Operation) ([]string, []string, error) {
+	var env []string
+	var secretValues []string
+	for _, envVar := range operation.Spec.Processor.ScriptRunner.Env {
+		value := envVar.Value
+		if envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef != nil {
+			selector := envVar.ValueFrom.SecretKeyRef
+			var secret corev1.Secret
+			if err := ex.client.Get(ex, client.ObjectKey{
+				Namespace: selector.Namespace,
+				Name:      selector.Name,
+			}, &secret); err != nil {
+				return nil, nil, fmt.Errorf("unable to resolve env %s from secret %s/%s: %v", envVar.Name, selector.Namespace, selector.Name, err)
+			}
+			data, ok := secret.Data[selector.Key]
+			if !ok {
+				return nil, nil, fmt.Errorf("unable to resolve env %s: key %s not found in secret %s/%s", envVar.Name, selector.Key, selector.Namespace, selector.Name)
+			}
+			value = string(data)
+			secretValues = append(secretValues, value)
+		}
+		env = append(env, fmt.Sprintf("%s=%s", envVar.Name, value))
+	}
+
+	return env, secretValues, nil
+}
+
+// scrubValues replaces every occurrence of the values in the text with a redaction marker.
+func scrubValues(text string, values []string) string {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		text = strings.ReplaceAll(text, value, "[redacted]")
+	}
+	return text
 }
 
 // addDiagnosisToExecutorQueue adds Diagnosis to the queue processed by executor.
@@ -642,11 +2268,24 @@ func updateDiagnosisContext(data map[string]string, diagnosis diagnosisv1.Diagno
 	data[DiagnosisNameTelemetryKey] = diagnosis.Name
 	data[DiagnosisUIDTelemetryKey] = string(diagnosis.UID)
 	data[NodeTelemetryKey] = diagnosis.Spec.NodeName
-	if diagnosis.Spec.PodReference != nil {
-		data[PodNamespaceTelemetryKey] = diagnosis.Spec.PodReference.Namespace
-		data[PodNameTelemetryKey] = diagnosis.Spec.PodReference.Name
-		if diagnosis.Spec.PodReference.Container != "" {
-			data[ContainerTelemetryKey] = diagnosis.Spec.PodReference.Container
+	data[TraceIDTelemetryKey] = diagnosisTraceID(diagnosis)
+	// Processors reading the target pod receive the first reference if a set of pods is
+	// referenced. The whole set is passed as a json encoded value for processors iterating
+	// over all target pods.
+	podReference := diagnosis.Spec.PodReference
+	if podReference == nil && len(diagnosis.Spec.PodReferences) > 0 {
+		podReference = &diagnosis.Spec.PodReferences[0]
+	}
+	if podReference != nil {
+		data[PodNamespaceTelemetryKey] = podReference.Namespace
+		data[PodNameTelemetryKey] = podReference.Name
+		if podReference.Container != "" {
+			data[ContainerTelemetryKey] = podReference.Container
+		}
+	}
+	if len(diagnosis.Spec.PodReferences) > 0 {
+		if encoded, err := json.Marshal(diagnosis.Spec.PodReferences); err == nil {
+			data[PodReferencesTelemetryKey] = string(encoded)
 		}
 	}
 }
@@ -0,0 +1,778 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+	"github.com/kubediag/kubediag/pkg/rpc"
+)
+
+// newTestOperation creates an operation pointing at the http test server with the retry policy.
+func newTestOperation(t *testing.T, server *httptest.Server, retries int32) diagnosisv1.Operation {
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	portValue, err := strconv.Atoi(serverURL.Port())
+	assert.NoError(t, err)
+
+	address := serverURL.Hostname()
+	port := int32(portValue)
+	path := "/"
+	scheme := "http"
+	timeoutSeconds := int32(10)
+	retryDelaySeconds := int32(1)
+
+	return diagnosisv1.Operation{
+		Spec: diagnosisv1.OperationSpec{
+			Processor: diagnosisv1.Processor{
+				HTTPServer: &diagnosisv1.HTTPServer{
+					Address: &address,
+					Port:    &port,
+					Path:    &path,
+					Scheme:  &scheme,
+				},
+				TimeoutSeconds:    &timeoutSeconds,
+				Retries:           &retries,
+				RetryDelaySeconds: &retryDelaySeconds,
+			},
+		},
+	}
+}
+
+func TestDoHTTPRequestWithContextRetriesOnServerError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			http.Error(w, "transient error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"key1":"value1"}`))
+	}))
+	defer server.Close()
+
+	ex := &executor{
+		Context:   context.Background(),
+		Logger:    ctrl.Log.WithName("executor"),
+		transport: &http.Transport{},
+	}
+
+	result, err := ex.doHTTPRequestWithContext(newTestOperation(t, server, 3), map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, operationSucceeded, result.Outcome)
+	assert.Equal(t, map[string]string{"key1": "value1"}, result.Results)
+	assert.Equal(t, 3, requests)
+}
+
+func TestDoHTTPRequestWithContextDoesNotRetryOnClientError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "validation failure", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	ex := &executor{
+		Context:   context.Background(),
+		Logger:    ctrl.Log.WithName("executor"),
+		transport: &http.Transport{},
+	}
+
+	result, err := ex.doHTTPRequestWithContext(newTestOperation(t, server, 3), map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, operationFailed, result.Outcome)
+	assert.Nil(t, result.Results)
+	assert.Equal(t, 1, requests)
+}
+
+func TestDoHTTPRequestWithContextReportsTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	defer server.Close()
+
+	ex := &executor{
+		Context:   context.Background(),
+		Logger:    ctrl.Log.WithName("executor"),
+		transport: &http.Transport{},
+	}
+
+	operation := newTestOperation(t, server, 0)
+	timeoutSeconds := int32(1)
+	operation.Spec.Processor.TimeoutSeconds = &timeoutSeconds
+
+	result, err := ex.doHTTPRequestWithContext(operation, map[string]string{})
+	assert.NoError(t, err, "timeout is a terminal outcome instead of a transient error")
+	assert.Equal(t, operationTimedOut, result.Outcome)
+	assert.Nil(t, result.Results)
+}
+
+func TestSetDiagnosisOperationResultsSpillsLargeValue(t *testing.T) {
+	dataRoot, err := ioutil.TempDir("", "executor")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dataRoot)
+
+	ex := &executor{
+		Context:              context.Background(),
+		Logger:               ctrl.Log.WithName("executor"),
+		dataRoot:             dataRoot,
+		maxContextValueBytes: 8,
+	}
+	diagnosis := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis1",
+			Namespace: "namespace1",
+		},
+	}
+
+	largeValue := strings.Repeat("x", 64)
+	err = ex.setDiagnosisOperationResults(&diagnosis, map[string]string{
+		"key1": "small",
+		"key2": largeValue,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "small", diagnosis.Status.OperationResults["key1"], "small value recorded verbatim")
+	reference := diagnosis.Status.OperationResults["key2"]
+	assert.Equal(t, true, strings.HasPrefix(reference, "file://"), "large value recorded as file reference")
+
+	content, err := ioutil.ReadFile(strings.TrimPrefix(reference, "file://"))
+	assert.NoError(t, err)
+	assert.Equal(t, largeValue, string(content), "large value spilled to file")
+}
+
+func TestSetDiagnosisOperationResultsReturnsSentinelOnSpillFailure(t *testing.T) {
+	dataRoot, err := ioutil.TempDir("", "executor")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dataRoot)
+
+	// Occupy the context subdirectory path with a file so the spill fails.
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dataRoot, ContextSubDirectory), []byte{}, 0644))
+
+	ex := &executor{
+		Context:              context.Background(),
+		Logger:               ctrl.Log.WithName("executor"),
+		dataRoot:             dataRoot,
+		maxContextValueBytes: 8,
+	}
+	diagnosis := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis1",
+			Namespace: "namespace1",
+		},
+	}
+
+	err = ex.setDiagnosisOperationResults(&diagnosis, map[string]string{
+		"key1": "small",
+		"key2": strings.Repeat("x", 64),
+	})
+	assert.Equal(t, ErrContextValueTooLarge, err)
+	assert.Equal(t, "small", diagnosis.Status.OperationResults["key1"], "remaining operation results recorded")
+	_, ok := diagnosis.Status.OperationResults["key2"]
+	assert.Equal(t, false, ok, "value which could not be spilled is not recorded")
+}
+
+func TestLogSyncErrorRateLimited(t *testing.T) {
+	ex := &executor{
+		Context:             context.Background(),
+		Logger:              ctrl.Log.WithName("executor"),
+		errorLogInterval:    time.Minute,
+		suppressedErrorLogs: make(map[string]*suppressedErrorLog),
+	}
+	diagnosis := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis1",
+			Namespace: "namespace1",
+		},
+	}
+	err := fmt.Errorf("processor unavailable: connection refused")
+	key := "namespace1/diagnosis1/ConnectionRefused"
+
+	ex.logSyncErrorRateLimited(err, diagnosis)
+	assert.Equal(t, 0, ex.suppressedErrorLogs[key].suppressed, "first error logged")
+
+	ex.logSyncErrorRateLimited(err, diagnosis)
+	ex.logSyncErrorRateLimited(err, diagnosis)
+	assert.Equal(t, 2, ex.suppressedErrorLogs[key].suppressed, "repeated errors suppressed within interval")
+
+	// The suppressed count is summarized and reset once the interval has passed.
+	ex.suppressedErrorLogs[key].lastLogged = time.Now().Add(-2 * time.Minute)
+	ex.logSyncErrorRateLimited(err, diagnosis)
+	assert.Equal(t, 0, ex.suppressedErrorLogs[key].suppressed, "suppressed count reset after interval")
+
+	// Errors of another category are rate limited independently.
+	ex.logSyncErrorRateLimited(fmt.Errorf("request timeout"), diagnosis)
+	assert.Equal(t, 2, len(ex.suppressedErrorLogs), "categories tracked independently")
+
+	ex.clearSuppressedErrorLogs(diagnosis)
+	assert.Equal(t, 0, len(ex.suppressedErrorLogs), "state cleared on successful sync")
+}
+
+func TestBuildTransportDefaultsToInsecure(t *testing.T) {
+	transport, err := buildTransport(TransportConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, true, transport.TLSClientConfig.InsecureSkipVerify, "certificate verification skipped by default")
+	assert.Equal(t, true, transport.DisableKeepAlives, "keep alives disabled by default")
+}
+
+func TestBuildTransportWithConfig(t *testing.T) {
+	caFile, err := writeTestCAFile()
+	assert.NoError(t, err)
+	defer os.Remove(caFile)
+
+	transport, err := buildTransport(TransportConfig{
+		CAFile:           caFile,
+		EnableKeepAlives: true,
+		MaxIdleConns:     10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, false, transport.TLSClientConfig.InsecureSkipVerify, "certificate verification enabled with ca file")
+	assert.NotNil(t, transport.TLSClientConfig.RootCAs, "ca bundle loaded into root ca pool")
+	assert.Equal(t, false, transport.DisableKeepAlives, "keep alives enabled")
+	assert.Equal(t, 10, transport.MaxIdleConns)
+}
+
+func TestBuildTransportWithInvalidCAFile(t *testing.T) {
+	caFile, err := ioutil.TempFile("", "executor")
+	assert.NoError(t, err)
+	defer os.Remove(caFile.Name())
+	_, err = caFile.WriteString("not a certificate")
+	assert.NoError(t, err)
+	assert.NoError(t, caFile.Close())
+
+	_, err = buildTransport(TransportConfig{CAFile: caFile.Name()})
+	assert.Error(t, err)
+}
+
+// writeTestCAFile writes a self signed certificate into a temporary file and returns its path.
+func writeTestCAFile() (string, error) {
+	key, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kubediag-test-ca"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	certificate, err := x509.CreateCertificate(cryptorand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return "", err
+	}
+	caFile, err := ioutil.TempFile("", "executor")
+	if err != nil {
+		return "", err
+	}
+	defer caFile.Close()
+	if err := pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: certificate}); err != nil {
+		return "", err
+	}
+
+	return caFile.Name(), nil
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	baseDelay := time.Second
+	for attempt := 0; attempt < 4; attempt++ {
+		delay := jitteredBackoff(baseDelay, attempt)
+		assert.Equal(t, true, delay >= baseDelay<<uint(attempt)/2)
+		assert.Equal(t, true, delay <= baseDelay<<uint(attempt))
+	}
+}
+
+func TestValidateOperationResultAll(t *testing.T) {
+	tests := []struct {
+		result   map[string]string
+		expected int
+		desc     string
+	}{
+		{
+			result:   map[string]string{},
+			expected: 0,
+			desc:     "empty result",
+		},
+		{
+			result: map[string]string{
+				"collector.system.process_list": "[]",
+			},
+			expected: 0,
+			desc:     "result without reserved keys",
+		},
+		{
+			result: map[string]string{
+				PodNameTelemetryKey: "pod1",
+			},
+			expected: 1,
+			desc:     "result modifying one reserved key",
+		},
+		{
+			result: map[string]string{
+				DiagnosisUIDTelemetryKey:        "uid1",
+				PodNamespaceTelemetryKey:        "namespace1",
+				PodNameTelemetryKey:             "pod1",
+				"collector.system.process_list": "[]",
+			},
+			expected: 3,
+			desc:     "all reserved key modifications collected",
+		},
+	}
+
+	for _, test := range tests {
+		errs := validateOperationResultAll(test.result)
+		assert.Equal(t, test.expected, len(errs), test.desc)
+	}
+}
+
+func TestValidateOperationResult(t *testing.T) {
+	assert.NoError(t, validateOperationResult(map[string]string{
+		"collector.system.process_list": "[]",
+	}), "result without reserved keys")
+
+	err := validateOperationResult(map[string]string{
+		DiagnosisUIDTelemetryKey: "uid1",
+		PodNameTelemetryKey:      "pod1",
+	})
+	assert.Error(t, err, "result modifying reserved keys")
+	assert.Equal(t, fmt.Sprintf("operation result must not modify reserved key %s", DiagnosisUIDTelemetryKey), err.Error(), "first violation returned")
+}
+
+// testGRPCProcessor serves the OperationProcessor service with a programmable response.
+type testGRPCProcessor struct {
+	requests int
+	process  func(requests int, in *rpc.ProcessRequest) (*rpc.ProcessResponse, error)
+}
+
+func (p *testGRPCProcessor) Process(ctx context.Context, in *rpc.ProcessRequest) (*rpc.ProcessResponse, error) {
+	p.requests++
+	return p.process(p.requests, in)
+}
+
+// newTestGRPCOperation creates an operation pointing at the grpc test server with the retry policy.
+func newTestGRPCOperation(t *testing.T, listener net.Listener, retries int32) diagnosisv1.Operation {
+	host, portValue, err := net.SplitHostPort(listener.Addr().String())
+	assert.NoError(t, err)
+	portNumber, err := strconv.Atoi(portValue)
+	assert.NoError(t, err)
+
+	port := int32(portNumber)
+	timeoutSeconds := int32(10)
+	retryDelaySeconds := int32(1)
+
+	return diagnosisv1.Operation{
+		Spec: diagnosisv1.OperationSpec{
+			Processor: diagnosisv1.Processor{
+				GRPCServer: &diagnosisv1.GRPCServer{
+					Address: &host,
+					Port:    port,
+				},
+				TimeoutSeconds:    &timeoutSeconds,
+				Retries:           &retries,
+				RetryDelaySeconds: &retryDelaySeconds,
+			},
+		},
+	}
+}
+
+func TestDoGRPCRequestWithContextRetriesOnUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	processor := &testGRPCProcessor{
+		process: func(requests int, in *rpc.ProcessRequest) (*rpc.ProcessResponse, error) {
+			if requests <= 2 {
+				return nil, grpcstatus.Error(codes.Unavailable, "transient error")
+			}
+			return &rpc.ProcessResponse{Context: map[string]string{"key1": "value1"}}, nil
+		},
+	}
+	server := grpc.NewServer()
+	rpc.RegisterOperationProcessorServer(server, processor)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	ex := &executor{
+		Context: context.Background(),
+		Logger:  ctrl.Log.WithName("executor"),
+	}
+
+	result, err := ex.doGRPCRequestWithContext(newTestGRPCOperation(t, listener, 3), map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, operationSucceeded, result.Outcome)
+	assert.Equal(t, map[string]string{"key1": "value1"}, result.Results)
+	assert.Equal(t, 3, processor.requests)
+}
+
+func TestDoGRPCRequestWithContextDoesNotRetryOnInvalidArgument(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	processor := &testGRPCProcessor{
+		process: func(requests int, in *rpc.ProcessRequest) (*rpc.ProcessResponse, error) {
+			return nil, grpcstatus.Error(codes.InvalidArgument, "validation failure")
+		},
+	}
+	server := grpc.NewServer()
+	rpc.RegisterOperationProcessorServer(server, processor)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	ex := &executor{
+		Context: context.Background(),
+		Logger:  ctrl.Log.WithName("executor"),
+	}
+
+	result, err := ex.doGRPCRequestWithContext(newTestGRPCOperation(t, listener, 3), map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, operationFailed, result.Outcome)
+	assert.Nil(t, result.Results)
+	assert.Equal(t, 1, processor.requests)
+}
+
+func TestNodeExcludedByWeight(t *testing.T) {
+	zero := int32(0)
+	full := int32(100)
+	half := int32(50)
+
+	assert.Equal(t, false, nodeExcludedByWeight(diagnosisv1.Node{Operation: "operation1"}, "uid1"), "node without weight never excludes")
+	assert.Equal(t, false, nodeExcludedByWeight(diagnosisv1.Node{Operation: "operation1", Weight: &full}, "uid1"), "full weight never excludes")
+	assert.Equal(t, true, nodeExcludedByWeight(diagnosisv1.Node{Operation: "operation1", Weight: &zero}, "uid1"), "zero weight always excludes")
+
+	// The decision is stable for the same diagnosis and spreads across diagnoses.
+	node := diagnosisv1.Node{Operation: "operation1", Weight: &half}
+	first := nodeExcludedByWeight(node, "uid1")
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, nodeExcludedByWeight(node, "uid1"), "decision is stable for the same diagnosis")
+	}
+	excluded := 0
+	for i := 0; i < 1000; i++ {
+		if nodeExcludedByWeight(node, types.UID(fmt.Sprintf("uid%d", i))) {
+			excluded++
+		}
+	}
+	assert.Equal(t, true, excluded > 400 && excluded < 600, "half weight excludes about half of diagnoses")
+}
+
+func TestAppendDiagnosisContextEvent(t *testing.T) {
+	diagnosis := diagnosisv1.Diagnosis{}
+
+	// Notes are appended in order under the reserved events key.
+	AppendDiagnosisContextEvent(&diagnosis, "first note")
+	AppendDiagnosisContextEvent(&diagnosis, "second note")
+	var events []diagnosisContextEvent
+	err := json.Unmarshal([]byte(diagnosis.Status.OperationResults[DiagnosisEventsTelemetryKey]), &events)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "first note", events[0].Note)
+	assert.Equal(t, "second note", events[1].Note)
+	assert.Equal(t, false, events[0].Time.IsZero(), "notes are timestamped")
+
+	// The trail is bounded and keeps the newest notes.
+	for i := 0; i < maxDiagnosisContextEvents+10; i++ {
+		AppendDiagnosisContextEvent(&diagnosis, fmt.Sprintf("note %d", i))
+	}
+	err = json.Unmarshal([]byte(diagnosis.Status.OperationResults[DiagnosisEventsTelemetryKey]), &events)
+	assert.NoError(t, err)
+	assert.Equal(t, maxDiagnosisContextEvents, len(events))
+	assert.Equal(t, fmt.Sprintf("note %d", maxDiagnosisContextEvents+9), events[len(events)-1].Note)
+
+	// A corrupted trail is replaced instead of failing.
+	diagnosis.Status.OperationResults[DiagnosisEventsTelemetryKey] = "not json"
+	AppendDiagnosisContextEvent(&diagnosis, "after corruption")
+	err = json.Unmarshal([]byte(diagnosis.Status.OperationResults[DiagnosisEventsTelemetryKey]), &events)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "after corruption", events[0].Note)
+}
+
+func TestNewExecutorDefaultsEventRecorder(t *testing.T) {
+	executorCh := make(chan diagnosisv1.Diagnosis)
+	created, err := NewExecutor(
+		context.Background(),
+		ctrl.Log.WithName("executor"),
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		"node1",
+		nil,
+		"0.0.0.0",
+		8090,
+		"/var/lib/kubediag",
+		"",
+		0,
+		0,
+		0,
+		0,
+		0,
+		TransportConfig{},
+		executorCh,
+	)
+	assert.NoError(t, err)
+
+	// Recording an event without an event sink must not panic.
+	ex := created.(*executor)
+	assert.NotNil(t, ex.eventRecorder)
+	ex.recordDiagnosisEvent(&diagnosisv1.Diagnosis{}, "Normal", "Reason", "message")
+}
+
+func TestRunScriptWithContextInjectsEnvAndScrubsOutput(t *testing.T) {
+	dataRoot, err := ioutil.TempDir("", "executor")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dataRoot)
+
+	scriptDirectory := filepath.Join(dataRoot, "scripts")
+	assert.NoError(t, os.MkdirAll(scriptDirectory, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(scriptDirectory, "operation1"), []byte("echo \"token is $TOKEN\"\n"), 0755))
+
+	ex := &executor{
+		Context:  context.Background(),
+		Logger:   ctrl.Log.WithName("executor"),
+		dataRoot: dataRoot,
+	}
+	resultKey := "script"
+	timeoutSeconds := int32(10)
+	operation := diagnosisv1.Operation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "operation1",
+		},
+		Spec: diagnosisv1.OperationSpec{
+			Processor: diagnosisv1.Processor{
+				ScriptRunner: &diagnosisv1.ScriptRunner{
+					OperationResultKey: &resultKey,
+					Env: []diagnosisv1.EnvVar{
+						{
+							Name:  "TOKEN",
+							Value: "supersecret",
+						},
+					},
+				},
+				TimeoutSeconds: &timeoutSeconds,
+			},
+		},
+	}
+
+	result, err := ex.runScriptWithContext(operation, map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, operationSucceeded, result.Outcome)
+	assert.Equal(t, "token is supersecret\n", result.Results["operation.script.output"], "literal env value injected into the script environment")
+}
+
+func TestScrubValues(t *testing.T) {
+	tests := []struct {
+		text     string
+		values   []string
+		expected string
+		desc     string
+	}{
+		{
+			text:     "login failed for password hunter2",
+			values:   []string{"hunter2"},
+			expected: "login failed for password [redacted]",
+			desc:     "secret value scrubbed from text",
+		},
+		{
+			text:     "hunter2 leaked twice: hunter2",
+			values:   []string{"hunter2"},
+			expected: "[redacted] leaked twice: [redacted]",
+			desc:     "every occurrence scrubbed",
+		},
+		{
+			text:     "no secret here",
+			values:   []string{"hunter2", ""},
+			expected: "no secret here",
+			desc:     "text without secrets unchanged and empty values ignored",
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, scrubValues(test.text, test.values), test.desc)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ex := &executor{
+		Context:                 context.Background(),
+		Logger:                  ctrl.Log.WithName("executor"),
+		breakerFailureThreshold: 2,
+		breakerCooldown:         100 * time.Millisecond,
+		breakers:                make(map[string]*circuitBreaker),
+	}
+	target := "http://127.0.0.1:8090/processor/processor1"
+
+	assert.Equal(t, true, ex.breakerAllows(target), "breaker starts closed")
+
+	ex.recordBreakerResult(target, false)
+	assert.Equal(t, true, ex.breakerAllows(target), "breaker stays closed below the failure threshold")
+
+	ex.recordBreakerResult(target, false)
+	assert.Equal(t, false, ex.breakerAllows(target), "breaker opens on reaching the failure threshold")
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, true, ex.breakerAllows(target), "half open probe allowed after the cooldown")
+
+	ex.recordBreakerResult(target, false)
+	assert.Equal(t, false, ex.breakerAllows(target), "failed probe reopens the breaker")
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, true, ex.breakerAllows(target), "half open probe allowed again after the cooldown")
+	ex.recordBreakerResult(target, true)
+	assert.Equal(t, true, ex.breakerAllows(target), "successful probe closes the breaker")
+	ex.recordBreakerResult(target, false)
+	assert.Equal(t, true, ex.breakerAllows(target), "failure count restarts after the breaker closes")
+}
+
+func TestCircuitBreakerDisabledByZeroThreshold(t *testing.T) {
+	ex := &executor{
+		Context: context.Background(),
+		Logger:  ctrl.Log.WithName("executor"),
+	}
+	target := "http://127.0.0.1:8090/processor/processor1"
+
+	for i := 0; i < 10; i++ {
+		ex.recordBreakerResult(target, false)
+	}
+	assert.Equal(t, true, ex.breakerAllows(target), "zero threshold disables circuit breaking")
+}
+
+func TestSetDiagnosisOperationResultsCompressesLargeValue(t *testing.T) {
+	ex := &executor{
+		Context:              context.Background(),
+		Logger:               ctrl.Log.WithName("executor"),
+		maxContextValueBytes: 128,
+	}
+	diagnosis := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis1",
+			Namespace: "namespace1",
+		},
+	}
+
+	largeValue := strings.Repeat("log line which compresses well\n", 100)
+	err := ex.setDiagnosisOperationResults(&diagnosis, map[string]string{
+		"key1": "small",
+		"key2": largeValue,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "small", diagnosis.Status.OperationResults["key1"], "small value recorded verbatim")
+	recorded := diagnosis.Status.OperationResults["key2"]
+	assert.Equal(t, true, strings.HasPrefix(recorded, CompressedContextValuePrefix), "large value recorded compressed")
+	assert.Equal(t, true, len(recorded) <= ex.maxContextValueBytes, "compressed value within max context value size")
+
+	decoded, err := DecodeContextValue(recorded)
+	assert.NoError(t, err)
+	assert.Equal(t, largeValue, decoded, "compressed value round trips")
+}
+
+func TestDecodeContextValue(t *testing.T) {
+	compressed, err := compressContextValue("value1")
+	assert.NoError(t, err)
+
+	type expectedStruct struct {
+		value string
+		err   bool
+	}
+
+	tests := []struct {
+		value    string
+		expected expectedStruct
+		desc     string
+	}{
+		{
+			value:    "value1",
+			expected: expectedStruct{value: "value1"},
+			desc:     "value without marker returned unchanged",
+		},
+		{
+			value:    compressed,
+			expected: expectedStruct{value: "value1"},
+			desc:     "compressed value decompressed",
+		},
+		{
+			value:    CompressedContextValuePrefix + "not base64!",
+			expected: expectedStruct{err: true},
+			desc:     "corrupted compressed value reported",
+		},
+	}
+
+	for _, test := range tests {
+		value, err := DecodeContextValue(test.value)
+		if test.expected.err {
+			assert.Error(t, err, test.desc)
+		} else {
+			assert.NoError(t, err, test.desc)
+			assert.Equal(t, test.expected.value, value, test.desc)
+		}
+	}
+}
+
+func TestExecutedPathOperationMarkers(t *testing.T) {
+	ex := &executor{
+		Context:                context.Background(),
+		Logger:                 ctrl.Log.WithName("executor"),
+		executedPathOperations: make(map[types.UID]map[pathStep]operationResult),
+	}
+	uid := types.UID("uid1")
+	recorded := operationResult{
+		Outcome: operationSucceeded,
+		Results: map[string]string{"key1": "value1"},
+	}
+
+	_, ok := ex.lookupExecutedPathOperation(uid, 0, 1)
+	assert.Equal(t, false, ok, "no result recorded")
+
+	ex.recordExecutedPathOperation(uid, 0, 1, recorded)
+	result, ok := ex.lookupExecutedPathOperation(uid, 0, 1)
+	assert.Equal(t, true, ok, "recorded result found")
+	assert.Equal(t, recorded, result, "recorded result returned")
+	_, ok = ex.lookupExecutedPathOperation(uid, 1, 1)
+	assert.Equal(t, false, ok, "result of another path not returned")
+
+	ex.deleteExecutedPathOperations(uid)
+	_, ok = ex.lookupExecutedPathOperation(uid, 0, 1)
+	assert.Equal(t, false, ok, "recorded results dropped on delete")
+}
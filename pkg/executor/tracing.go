@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+)
+
+const (
+	// TraceIDTelemetryKey is the telemetry key of the trace id of a diagnosis.
+	TraceIDTelemetryKey = "diagnosis.trace.id"
+
+	// traceparentHeader is the w3c trace context header injected into processor requests so
+	// processor handlers can continue the trace of the diagnosis.
+	traceparentHeader = "traceparent"
+)
+
+// diagnosisTraceID returns the trace id of the diagnosis. The trace id recorded in the
+// annotation at creation time is used when present and a trace id derived from the object uid
+// is used otherwise.
+func diagnosisTraceID(diagnosis diagnosisv1.Diagnosis) string {
+	if traceID, ok := diagnosis.Annotations[diagnosisv1.TraceIDAnnotation]; ok && traceID != "" {
+		return traceID
+	}
+
+	sum := sha256.Sum256([]byte(diagnosis.UID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// newSpanID returns a random 8 byte span id in hex.
+func newSpanID() string {
+	spanID := make([]byte, 8)
+	if _, err := rand.Read(spanID); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(spanID)
+}
+
+// buildTraceparent formats the trace id and span id as a w3c traceparent header value.
+func buildTraceparent(traceID string, spanID string) string {
+	return fmt.Sprintf("00-%s-%s-01", traceID, spanID)
+}
@@ -65,6 +65,20 @@ const (
 	// Owner: @huangjiuyuan
 	// Alpha: 0.1.5
 	ContainerCollector featuregate.Feature = "ContainerCollector"
+	// ContainerdCollector fetches inspect metadata of containers of the target pod from
+	// containerd through the cri runtime endpoint.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	ContainerdCollector featuregate.Feature = "ContainerdCollector"
+	// ContainerDiffCollector reports files added, changed or deleted in the writable layer of
+	// the target container relative to its image.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	ContainerDiffCollector featuregate.Feature = "ContainerDiffCollector"
 	// ProcessCollector manages information of all processes on the node.
 	//
 	// Mode: agent
@@ -107,18 +121,121 @@ const (
 	// Owner: @huangjiuyuan
 	// Alpha: 0.2.0
 	ContainerdGoroutineCollector featuregate.Feature = "ContainerdGoroutineCollector"
+	// ArthasThreadDumpCollector takes a one-shot thread dump of the java process in the target
+	// container with arthas.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	ArthasThreadDumpCollector featuregate.Feature = "ArthasThreadDumpCollector"
+	// CgroupMemoryCollector reads memory statistics of the target container from its cgroup.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	CgroupMemoryCollector featuregate.Feature = "CgroupMemoryCollector"
+	// HTTPProbeCollector probes an http endpoint of the target pod and records status code,
+	// latency, tls certificate expiry and a response snippet.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	HTTPProbeCollector featuregate.Feature = "HTTPProbeCollector"
+	// ProcessTreeCollector builds a parent child tree of processes on the node with zombie counts
+	// aggregated per subtree.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	ProcessTreeCollector featuregate.Feature = "ProcessTreeCollector"
+	// NetInterfaceCollector collects rx and tx bytes, errors and drops per network interface on
+	// the node with optional rates computed from two samples.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	NetInterfaceCollector featuregate.Feature = "NetInterfaceCollector"
+	// HeapDumpCollector takes a heap dump of the java process in the target container and stores
+	// the hprof file under the data root.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	HeapDumpCollector featuregate.Feature = "HeapDumpCollector"
+	// KernelStateCollector collects the kernel taint bitmask decoded to human readable flags and
+	// the loaded kernel modules on the node.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	KernelStateCollector featuregate.Feature = "KernelStateCollector"
+	// IptablesCollector dumps iptables or nftables rules on the node with optional filtering by a
+	// service or cluster ip.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	IptablesCollector featuregate.Feature = "IptablesCollector"
+	// FileCollector reads files under allow-listed path prefixes on the node into the diagnosis
+	// context.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	FileCollector featuregate.Feature = "FileCollector"
+	// SMARTCollector runs smartctl against the block devices on the node and records overall
+	// health, reallocated sector counts and temperature.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	SMARTCollector featuregate.Feature = "SMARTCollector"
+	// RestartHistoryCollector extracts restart counts and last terminated states of all containers
+	// of the target pod and correlates them into a timeline.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	RestartHistoryCollector featuregate.Feature = "RestartHistoryCollector"
+	// KubeletStatsCollector scrapes the /stats/summary and /metrics endpoints of the local
+	// kubelet and records node and pod resource usage.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	KubeletStatsCollector featuregate.Feature = "KubeletStatsCollector"
 	// NodeCordon marks node as unschedulable.
 	//
 	// Mode: agent
 	// Owner: @huangjiuyuan
 	// Alpha: 0.2.0
 	NodeCordon featuregate.Feature = "NodeCordon"
+	// NodeUncordon marks node as schedulable to reverse a node cordon once an issue resolves.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	NodeUncordon featuregate.Feature = "NodeUncordon"
+	// NodeDrainRecover marks node as unschedulable and evicts eligible pods from the node
+	// through the eviction api so pod disruption budgets are respected.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	NodeDrainRecover featuregate.Feature = "NodeDrainRecover"
 	// GoProfiler manages go profiler.
 	//
 	// Mode: agent
 	// Owner: @April-Q
 	// Alpha: 0.2.0
 	GoProfiler featuregate.Feature = "GoProfiler"
+	// GoroutineLeakDiagnoser flags stacks accounting for an abnormally high goroutine count in
+	// the goroutine profile of a go program.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	GoroutineLeakDiagnoser featuregate.Feature = "GoroutineLeakDiagnoser"
 	// MountInfoCollector manages mount info on node
 	//
 	// Mode: agent
@@ -132,12 +249,175 @@ const (
 	// Owner: @fzu-huang
 	// Alpha: 0.2.0
 	SubpathRemountDiagnoser featuregate.Feature = "SubpathRemountDiagnoser"
+	// StaleMountDiagnoser identifies bind mounts with deleted sources, stale nfs mounts and
+	// propagation misconfigurations from the collected mountinfo.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	StaleMountDiagnoser featuregate.Feature = "StaleMountDiagnoser"
+	// VolumeDiagnoser identifies stuck volumes of the target pod by inspecting persistent
+	// volume claims, volume attachments and mount events.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	VolumeDiagnoser featuregate.Feature = "VolumeDiagnoser"
 	// ElasticsearchCollector retrieves log info from elasticsearch.
 	//
 	// Mode: agent
 	// Owner: @April-Q
 	// Alpha: 0.2.0
 	ElasticsearchCollector featuregate.Feature = "ElasticsearchCollector"
+	// LokiLogCollector retrieves log lines from loki with a logql query.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	LokiLogCollector featuregate.Feature = "LokiLogCollector"
+	// JournaldCollector retrieves journal entries from systemd journal on the node.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	JournaldCollector featuregate.Feature = "JournaldCollector"
+	// DiskUsageCollector reports bytes and inode usage of mounted filesystems on the node.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	DiskUsageCollector featuregate.Feature = "DiskUsageCollector"
+	// DmesgCollector retrieves messages from the kernel ring buffer on the node.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	DmesgCollector featuregate.Feature = "DmesgCollector"
+	// OOMKillDiagnoser diagnoses out of memory kill events of the target pod.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	OOMKillDiagnoser featuregate.Feature = "OOMKillDiagnoser"
+	// ResourcePressureCollector reports memory, load and pressure stall information of the node.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	ResourcePressureCollector featuregate.Feature = "ResourcePressureCollector"
+	// PythonProfiler manages python profiler backed by py-spy.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	PythonProfiler featuregate.Feature = "PythonProfiler"
+	// WebhookNotifier escalates diagnoses to humans by delivering notifications to a webhook.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	WebhookNotifier featuregate.Feature = "WebhookNotifier"
+	// ConntrackCollector reports the connection tracking table of the node.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	ConntrackCollector featuregate.Feature = "ConntrackCollector"
+	// CPUThrottlingDiagnoser diagnoses cfs quota throttling of the target pod.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	CPUThrottlingDiagnoser featuregate.Feature = "CPUThrottlingDiagnoser"
+	// PodRestartRecover restarts the target pod by deleting it.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	PodRestartRecover featuregate.Feature = "PodRestartRecover"
+	// ContainerLogCollector retrieves logs of the target container.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	ContainerLogCollector featuregate.Feature = "ContainerLogCollector"
+	// CrashLoopDiagnoser diagnoses containers in CrashLoopBackOff of the target pod.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	CrashLoopDiagnoser featuregate.Feature = "CrashLoopDiagnoser"
+	// NodeNotReadyDiagnoser determines the likely cause of a node not being ready.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	NodeNotReadyDiagnoser featuregate.Feature = "NodeNotReadyDiagnoser"
+	// ImagePullDiagnoser diagnoses image pull failures of the target pod and categorizes the
+	// registry error.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	ImagePullDiagnoser featuregate.Feature = "ImagePullDiagnoser"
+	// PerfProfiler manages on cpu profiler for native processes backed by perf.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	PerfProfiler featuregate.Feature = "PerfProfiler"
+	// SysctlCollector reads kernel parameters from procfs on the node.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	SysctlCollector featuregate.Feature = "SysctlCollector"
+	// SocketStatCollector summarizes tcp socket states on the node.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	SocketStatCollector featuregate.Feature = "SocketStatCollector"
+	// FDExhaustionDiagnoser diagnoses processes which are about to exhaust their file descriptor limits.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	FDExhaustionDiagnoser featuregate.Feature = "FDExhaustionDiagnoser"
+	// ClockSkewDiagnoser compares the node system time against a reference time source and
+	// diagnoses the node clock as skewed if the offset exceeds a threshold.
+	//
+	// Mode: agent
+	// Owner: @April-Q
+	// Alpha: 0.2.1
+	ClockSkewDiagnoser featuregate.Feature = "ClockSkewDiagnoser"
+	// DNSResolutionDiagnoser resolves a set of names on the node and diagnoses dns as broken if
+	// any resolution fails or exceeds a latency threshold.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	DNSResolutionDiagnoser featuregate.Feature = "DNSResolutionDiagnoser"
+	// DropCachesRecover frees kernel caches on the node to relieve memory pressure.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	DropCachesRecover featuregate.Feature = "DropCachesRecover"
+	// PrometheusQueryDiagnoser queries a prometheus for the metric context around the start time
+	// of the alert which generated the diagnosis.
+	//
+	// Mode: agent
+	// Owner: @fzu-huang
+	// Alpha: 0.2.1
+	PrometheusQueryDiagnoser featuregate.Feature = "PrometheusQueryDiagnoser"
+	// ScriptRecover executes a script provided in the diagnosis context for multi step
+	// remediations on the node.
+	//
+	// Mode: agent
+	// Owner: @huangjiuyuan
+	// Alpha: 0.2.1
+	ScriptRecover featuregate.Feature = "ScriptRecover"
 )
 
 var (
@@ -157,6 +437,7 @@ var defaultKubeDiagFeatureGates = map[featuregate.Feature]featuregate.FeatureSpe
 	KafkaConsumer:                {Default: true, PreRelease: featuregate.Alpha},
 	PodCollector:                 {Default: true, PreRelease: featuregate.Alpha},
 	ContainerCollector:           {Default: true, PreRelease: featuregate.Alpha},
+	ContainerdCollector:          {Default: false, PreRelease: featuregate.Alpha},
 	ProcessCollector:             {Default: true, PreRelease: featuregate.Alpha},
 	SystemdCollector:             {Default: true, PreRelease: featuregate.Alpha},
 	SignalRecoverer:              {Default: true, PreRelease: featuregate.Alpha},
@@ -164,11 +445,53 @@ var defaultKubeDiagFeatureGates = map[featuregate.Feature]featuregate.FeatureSpe
 	DockerInfoCollector:          {Default: true, PreRelease: featuregate.Alpha},
 	DockerdGoroutineCollector:    {Default: true, PreRelease: featuregate.Alpha},
 	ContainerdGoroutineCollector: {Default: true, PreRelease: featuregate.Alpha},
+	ContainerDiffCollector:       {Default: false, PreRelease: featuregate.Alpha},
+	ArthasThreadDumpCollector:    {Default: false, PreRelease: featuregate.Alpha},
+	CgroupMemoryCollector:        {Default: true, PreRelease: featuregate.Alpha},
+	HTTPProbeCollector:           {Default: true, PreRelease: featuregate.Alpha},
+	ProcessTreeCollector:         {Default: true, PreRelease: featuregate.Alpha},
+	NetInterfaceCollector:        {Default: true, PreRelease: featuregate.Alpha},
+	HeapDumpCollector:            {Default: false, PreRelease: featuregate.Alpha},
+	KernelStateCollector:         {Default: true, PreRelease: featuregate.Alpha},
+	IptablesCollector:            {Default: true, PreRelease: featuregate.Alpha},
+	FileCollector:                {Default: true, PreRelease: featuregate.Alpha},
+	SMARTCollector:               {Default: true, PreRelease: featuregate.Alpha},
+	RestartHistoryCollector:      {Default: true, PreRelease: featuregate.Alpha},
+	KubeletStatsCollector:        {Default: true, PreRelease: featuregate.Alpha},
 	NodeCordon:                   {Default: true, PreRelease: featuregate.Alpha},
+	NodeUncordon:                 {Default: true, PreRelease: featuregate.Alpha},
+	NodeDrainRecover:             {Default: true, PreRelease: featuregate.Alpha},
 	GoProfiler:                   {Default: true, PreRelease: featuregate.Alpha},
+	GoroutineLeakDiagnoser:       {Default: true, PreRelease: featuregate.Alpha},
 	MountInfoCollector:           {Default: true, PreRelease: featuregate.Alpha},
 	SubpathRemountDiagnoser:      {Default: true, PreRelease: featuregate.Alpha},
+	StaleMountDiagnoser:          {Default: true, PreRelease: featuregate.Alpha},
+	VolumeDiagnoser:              {Default: true, PreRelease: featuregate.Alpha},
 	ElasticsearchCollector:       {Default: true, PreRelease: featuregate.Alpha},
+	LokiLogCollector:             {Default: true, PreRelease: featuregate.Alpha},
+	JournaldCollector:            {Default: true, PreRelease: featuregate.Alpha},
+	DiskUsageCollector:           {Default: true, PreRelease: featuregate.Alpha},
+	DmesgCollector:               {Default: true, PreRelease: featuregate.Alpha},
+	OOMKillDiagnoser:             {Default: true, PreRelease: featuregate.Alpha},
+	ResourcePressureCollector:    {Default: true, PreRelease: featuregate.Alpha},
+	PythonProfiler:               {Default: false, PreRelease: featuregate.Alpha},
+	WebhookNotifier:              {Default: false, PreRelease: featuregate.Alpha},
+	ConntrackCollector:           {Default: true, PreRelease: featuregate.Alpha},
+	CPUThrottlingDiagnoser:       {Default: true, PreRelease: featuregate.Alpha},
+	PodRestartRecover:            {Default: false, PreRelease: featuregate.Alpha},
+	ContainerLogCollector:        {Default: true, PreRelease: featuregate.Alpha},
+	CrashLoopDiagnoser:           {Default: true, PreRelease: featuregate.Alpha},
+	NodeNotReadyDiagnoser:        {Default: true, PreRelease: featuregate.Alpha},
+	ImagePullDiagnoser:           {Default: true, PreRelease: featuregate.Alpha},
+	PerfProfiler:                 {Default: false, PreRelease: featuregate.Alpha},
+	SysctlCollector:              {Default: true, PreRelease: featuregate.Alpha},
+	SocketStatCollector:          {Default: true, PreRelease: featuregate.Alpha},
+	FDExhaustionDiagnoser:        {Default: true, PreRelease: featuregate.Alpha},
+	ClockSkewDiagnoser:           {Default: true, PreRelease: featuregate.Alpha},
+	DNSResolutionDiagnoser:       {Default: true, PreRelease: featuregate.Alpha},
+	DropCachesRecover:            {Default: false, PreRelease: featuregate.Alpha},
+	PrometheusQueryDiagnoser:     {Default: false, PreRelease: featuregate.Alpha},
+	ScriptRecover:                {Default: false, PreRelease: featuregate.Alpha},
 }
 
 // KubeDiagFeatureGate indicates whether a given feature is enabled or not and stores flag gates for known features.
@@ -235,14 +235,22 @@ func (c *consumer) createDiagnosisFromMessageValue(message kafkago.Message) (*di
 	}
 	diagnosis.Spec.Parameters = data
 
-	if err := c.client.Create(c, &diagnosis); err != nil {
+	created, merged, err := util.CreateOrMergeDiagnosis(c, c.client, c.client, &diagnosis, nil)
+	if err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			c.Error(err, "unable to create Diagnosis")
 			return &diagnosis, err
 		}
+		created = &diagnosis
+	}
+	if merged {
+		c.Info("merged duplicate diagnosis into existing one", "diagnosis", client.ObjectKey{
+			Name:      created.Name,
+			Namespace: created.Namespace,
+		})
 	}
 
-	return &diagnosis, nil
+	return created, nil
 }
 
 // kafkaMessageHeadersToString converts kafka message headers to a string.
@@ -0,0 +1,302 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyContainerDiffRuntime            = "param.collector.kubernetes.container_diff.runtime"
+	ParameterKeyContainerDiffContainerdEndpoint = "param.collector.kubernetes.container_diff.containerd_endpoint"
+
+	ContextKeyContainerDiffChanges = "collector.kubernetes.container_diff.changes"
+	ContextKeyContainerDiffCount   = "collector.kubernetes.container_diff.count"
+
+	// containerDiffDockerRuntime reads the filesystem diff from the docker daemon.
+	containerDiffDockerRuntime = "docker"
+	// containerDiffContainerdRuntime reads the filesystem diff from the overlay snapshotter
+	// upperdir of containerd.
+	containerDiffContainerdRuntime = "containerd"
+
+	// maxContainerDiffEntries is the maximum number of changed paths recorded in the diagnosis.
+	maxContainerDiffEntries = 1000
+)
+
+// containerDiffCollector reports files added, changed or deleted in the writable layer of the
+// target container relative to its image. It helps diagnose containers which have written large
+// temporary files filling the overlay filesystem.
+type containerDiffCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client is the API client that performs all operations against a docker server.
+	client *client.Client
+	// containerDiffCollectorEnabled indicates whether containerDiffCollector is enabled.
+	containerDiffCollectorEnabled bool
+}
+
+// NewContainerDiffCollector creates a new containerDiffCollector.
+func NewContainerDiffCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	dockerEndpoint string,
+	containerDiffCollectorEnabled bool,
+) (processors.Processor, error) {
+	cli, err := client.NewClientWithOpts(client.WithHost(dockerEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return &containerDiffCollector{
+		Context:                       ctx,
+		Logger:                        logger,
+		client:                        cli,
+		containerDiffCollectorEnabled: containerDiffCollectorEnabled,
+	}, nil
+}
+
+// Handler handles http requests for collecting the filesystem diff of the target container.
+func (cd *containerDiffCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !cd.containerDiffCollectorEnabled {
+		http.Error(w, fmt.Sprintf("container diff collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			cd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		runtime := containerDiffDockerRuntime
+		if value, ok := contexts[ParameterKeyContainerDiffRuntime]; ok && value != "" {
+			runtime = value
+		}
+
+		var changes []string
+		switch runtime {
+		case containerDiffDockerRuntime:
+			changes, err = cd.dockerContainerDiff(podReference.Namespace, podReference.Name, podReference.Container)
+		case containerDiffContainerdRuntime:
+			endpoint := defaultContainerdEndpoint
+			if value, ok := contexts[ParameterKeyContainerDiffContainerdEndpoint]; ok && value != "" {
+				endpoint = value
+			}
+			changes, err = cd.containerdContainerDiff(endpoint, podReference.Namespace, podReference.Name, podReference.Container)
+		default:
+			http.Error(w, fmt.Sprintf("container diff runtime must be %s or %s", containerDiffDockerRuntime, containerDiffContainerdRuntime), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to collect container diff: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		count := len(changes)
+		if count > maxContainerDiffEntries {
+			changes = changes[:maxContainerDiffEntries]
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyContainerDiffChanges] = strings.Join(changes, "\n")
+		result[ContextKeyContainerDiffCount] = strconv.Itoa(count)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// dockerContainerDiff reads the filesystem diff of the target container from the docker daemon.
+// Changes are formatted like docker diff with one "<kind> <path>" line per change.
+func (cd *containerDiffCollector) dockerContainerDiff(namespace string, name string, containerName string) ([]string, error) {
+	cd.client.NegotiateAPIVersion(cd)
+	containers, err := cd.client.ContainerList(cd, dockertypes.ContainerListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list containers: %v", err)
+	}
+
+	var changes []string
+	found := false
+	for _, container := range containers {
+		if container.Labels["io.kubernetes.pod.namespace"] != namespace || container.Labels["io.kubernetes.pod.name"] != name {
+			continue
+		}
+		containerNameLabel := container.Labels["io.kubernetes.container.name"]
+		if containerNameLabel == "POD" {
+			continue
+		}
+		if containerName != "" && containerNameLabel != containerName {
+			continue
+		}
+		found = true
+
+		containerChanges, err := cd.client.ContainerDiff(cd, container.ID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to diff container %s: %v", container.ID, err)
+		}
+		for _, change := range containerChanges {
+			kind := "C"
+			switch change.Kind {
+			case 1:
+				kind = "A"
+			case 2:
+				kind = "D"
+			}
+			changes = append(changes, fmt.Sprintf("%s %s", kind, change.Path))
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no container of pod %s/%s found", namespace, name)
+	}
+
+	return changes, nil
+}
+
+// containerdContainerDiff reads the filesystem diff of the target container from the overlay
+// snapshotter upperdir of containerd. The upperdir holds files added or changed relative to the
+// image and whiteout files marking deletions.
+func (cd *containerDiffCollector) containerdContainerDiff(endpoint string, namespace string, name string, containerName string) ([]string, error) {
+	output, err := util.BlockingRunCommandWithTimeout([]string{"crictl", "--runtime-endpoint", endpoint, "ps", "-a", "-o", "json"}, crictlTimeoutSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list containers: %v", err)
+	}
+
+	var containerList crictlContainerList
+	if err := json.Unmarshal(output, &containerList); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal container list: %v", err)
+	}
+
+	var changes []string
+	found := false
+	for _, container := range containerList.Containers {
+		if container.Labels["io.kubernetes.pod.namespace"] != namespace || container.Labels["io.kubernetes.pod.name"] != name {
+			continue
+		}
+		if containerName != "" && container.Labels["io.kubernetes.container.name"] != containerName {
+			continue
+		}
+
+		upperdir, err := overlayUpperdirOfContainer(container.ID)
+		if err != nil {
+			return nil, err
+		}
+		found = true
+
+		containerChanges, err := walkOverlayUpperdir(upperdir)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, containerChanges...)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no container of pod %s/%s found", namespace, name)
+	}
+
+	return changes, nil
+}
+
+// overlayUpperdirOfContainer resolves the overlay snapshotter upperdir of the container from the
+// mount options of its rootfs overlay mount.
+func overlayUpperdirOfContainer(containerID string) (string, error) {
+	data, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		return "", fmt.Errorf("unable to read mounts: %v", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] != "overlay" || !strings.Contains(fields[1], containerID) {
+			continue
+		}
+		for _, option := range strings.Split(fields[3], ",") {
+			if strings.HasPrefix(option, "upperdir=") {
+				return strings.TrimPrefix(option, "upperdir="), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no overlay mount of container %s found", containerID)
+}
+
+// walkOverlayUpperdir lists files in the overlay upperdir as changes relative to the image.
+// Whiteout files are reported as deletions of the path they cover.
+func walkOverlayUpperdir(upperdir string) ([]string, error) {
+	var changes []string
+	err := filepath.Walk(upperdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == upperdir {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(upperdir, path)
+		if err != nil {
+			return err
+		}
+		base := filepath.Base(relativePath)
+		if strings.HasPrefix(base, ".wh.") {
+			changes = append(changes, fmt.Sprintf("D /%s", filepath.Join(filepath.Dir(relativePath), strings.TrimPrefix(base, ".wh."))))
+			return nil
+		}
+		changes = append(changes, fmt.Sprintf("C /%s", relativePath))
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to walk overlay upperdir %s: %v", upperdir, err)
+	}
+
+	return changes, nil
+}
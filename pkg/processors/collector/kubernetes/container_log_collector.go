@@ -0,0 +1,214 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyContainerLogTailLines = "param.collector.kubernetes.container_log.tail_lines"
+	ParameterKeyContainerLogPrevious  = "param.collector.kubernetes.container_log.previous"
+
+	ContextKeyContainerLog            = "collector.kubernetes.container.log"
+	ContextKeyContainerLogContainerID = "collector.kubernetes.container.log.container.id"
+
+	// DefaultContainerLogTailLines is the default number of lines collected from the end of
+	// the container log.
+	DefaultContainerLogTailLines = 1000
+)
+
+// containerLogCollector manages logs of the target container.
+type containerLogCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client is the API client that performs all operations against a docker server.
+	client *client.Client
+	// containerLogCollectorEnabled indicates whether containerLogCollector is enabled.
+	containerLogCollectorEnabled bool
+}
+
+// NewContainerLogCollector creates a new containerLogCollector.
+func NewContainerLogCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	dockerEndpoint string,
+	containerLogCollectorEnabled bool,
+) (processors.Processor, error) {
+	cli, err := client.NewClientWithOpts(client.WithHost(dockerEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return &containerLogCollector{
+		Context:                      ctx,
+		Logger:                       logger,
+		client:                       cli,
+		containerLogCollectorEnabled: containerLogCollectorEnabled,
+	}, nil
+}
+
+// Handler handles http requests for container logs.
+func (cl *containerLogCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !cl.containerLogCollectorEnabled {
+		http.Error(w, fmt.Sprintf("container log collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			cl.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		tailLines := DefaultContainerLogTailLines
+		if value, ok := contexts[ParameterKeyContainerLogTailLines]; ok {
+			tailLines, err = strconv.Atoi(value)
+			if err != nil || tailLines <= 0 {
+				http.Error(w, fmt.Sprintf("invalid tail lines %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+		previous := contexts[ParameterKeyContainerLogPrevious] == "true"
+
+		containerID, err := cl.findContainer(podReference.Namespace, podReference.Name, podReference.Container, previous)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to find container of pod %s/%s: %v", podReference.Namespace, podReference.Name, err), http.StatusInternalServerError)
+			return
+		}
+
+		log, err := cl.tailContainerLog(containerID, tailLines)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to collect log of container %s: %v", containerID, err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyContainerLog] = log
+		result[ContextKeyContainerLogContainerID] = containerID
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// findContainer finds the target container of the pod by kubernetes labels set on docker containers.
+// The last terminated container is returned instead of the running one if previous is true.
+func (cl *containerLogCollector) findContainer(namespace string, name string, containerName string, previous bool) (string, error) {
+	cl.client.NegotiateAPIVersion(cl)
+	containers, err := cl.client.ContainerList(cl, dockertypes.ContainerListOptions{All: true})
+	if err != nil {
+		return "", err
+	}
+
+	var containerID string
+	var created int64
+	for _, container := range containers {
+		if container.Labels["io.kubernetes.pod.namespace"] != namespace ||
+			container.Labels["io.kubernetes.pod.name"] != name {
+			continue
+		}
+		// Skip the pause container of the pod.
+		if container.Labels["io.kubernetes.container.name"] == "POD" {
+			continue
+		}
+		if containerName != "" && container.Labels["io.kubernetes.container.name"] != containerName {
+			continue
+		}
+		if previous == (container.State == "running") {
+			continue
+		}
+
+		// Pick the most recently created container if multiple containers match.
+		if container.Created > created {
+			containerID = container.ID
+			created = container.Created
+		}
+	}
+	if containerID == "" {
+		if previous {
+			return "", fmt.Errorf("no terminated container found")
+		}
+		return "", fmt.Errorf("no running container found")
+	}
+
+	return containerID, nil
+}
+
+// tailContainerLog reads the last tailLines lines from the log file of the container.
+func (cl *containerLogCollector) tailContainerLog(containerID string, tailLines int) (string, error) {
+	containerJSON, err := cl.client.ContainerInspect(cl, containerID)
+	if err != nil {
+		return "", err
+	}
+	if containerJSON.LogPath == "" {
+		return "", fmt.Errorf("log path of container %s not found", containerID)
+	}
+
+	data, err := utils.ReadFileTail(containerJSON.LogPath, tailLines)
+	if err != nil {
+		return "", err
+	}
+
+	// Docker json-file log entries are json objects with the log message in the "log" field.
+	// Entries which cannot be unmarshaled are kept as they are.
+	var builder strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var entry struct {
+			Log string `json:"log"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err == nil {
+			builder.WriteString(entry.Log)
+		} else {
+			builder.WriteString(line)
+			builder.WriteString("\n")
+		}
+	}
+
+	return builder.String(), nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyContainerdEndpoint = "param.collector.kubernetes.containerd.endpoint"
+
+	ContextKeyContainerdContainers = "collector.kubernetes.containerd.containers"
+
+	// defaultContainerdEndpoint is the default runtime endpoint of containerd.
+	defaultContainerdEndpoint = "unix:///run/containerd/containerd.sock"
+	// crictlTimeoutSeconds is the timeout of a crictl invocation in seconds.
+	crictlTimeoutSeconds = 30
+)
+
+// containerdCollector fetches inspect metadata of containers of the target pod from containerd
+// through the cri runtime endpoint. It provides parity with the docker based container
+// collector on nodes running containerd directly.
+type containerdCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// containerdCollectorEnabled indicates whether containerdCollector is enabled.
+	containerdCollectorEnabled bool
+}
+
+// crictlContainerList is the response body of a crictl container list.
+type crictlContainerList struct {
+	Containers []struct {
+		ID     string            `json:"id"`
+		Labels map[string]string `json:"labels"`
+	} `json:"containers"`
+}
+
+// NewContainerdCollector creates a new containerdCollector.
+func NewContainerdCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	containerdCollectorEnabled bool,
+) processors.Processor {
+	return &containerdCollector{
+		Context:                    ctx,
+		Logger:                     logger,
+		containerdCollectorEnabled: containerdCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for collecting containerd container information of the target pod.
+func (cc *containerdCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !cc.containerdCollectorEnabled {
+		http.Error(w, fmt.Sprintf("containerd collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			cc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		endpoint := defaultContainerdEndpoint
+		if value, ok := contexts[ParameterKeyContainerdEndpoint]; ok && value != "" {
+			endpoint = value
+		}
+
+		inspects, err := cc.inspectPodContainers(endpoint, podReference.Namespace, podReference.Name, podReference.Container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to inspect containers of pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyContainerdContainers] = fmt.Sprintf("[%s]", joinJSONDocuments(inspects))
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// inspectPodContainers lists containers of the pod through the cri runtime endpoint and returns
+// their inspect documents. Only the named container is inspected if containerName is not empty.
+func (cc *containerdCollector) inspectPodContainers(endpoint string, namespace string, name string, containerName string) ([]string, error) {
+	output, err := util.BlockingRunCommandWithTimeout([]string{"crictl", "--runtime-endpoint", endpoint, "ps", "-a", "-o", "json"}, crictlTimeoutSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list containers: %v", err)
+	}
+
+	var containerList crictlContainerList
+	if err := json.Unmarshal(output, &containerList); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal container list: %v", err)
+	}
+
+	var inspects []string
+	for _, container := range containerList.Containers {
+		if container.Labels["io.kubernetes.pod.namespace"] != namespace || container.Labels["io.kubernetes.pod.name"] != name {
+			continue
+		}
+		if containerName != "" && container.Labels["io.kubernetes.container.name"] != containerName {
+			continue
+		}
+
+		inspect, err := util.BlockingRunCommandWithTimeout([]string{"crictl", "--runtime-endpoint", endpoint, "inspect", "-o", "json", container.ID}, crictlTimeoutSeconds)
+		if err != nil {
+			return nil, fmt.Errorf("unable to inspect container %s: %v", container.ID, err)
+		}
+		inspects = append(inspects, string(inspect))
+	}
+
+	if len(inspects) == 0 {
+		return nil, fmt.Errorf("no container of pod %s/%s found", namespace, name)
+	}
+
+	return inspects, nil
+}
+
+// joinJSONDocuments joins json documents with commas to form the elements of a json array.
+func joinJSONDocuments(documents []string) string {
+	joined := ""
+	for i, document := range documents {
+		if i > 0 {
+			joined += ","
+		}
+		joined += document
+	}
+
+	return joined
+}
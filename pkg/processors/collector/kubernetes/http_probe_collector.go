@@ -0,0 +1,275 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyHTTPProbePort            = "param.collector.kubernetes.http_probe.port"
+	ParameterKeyHTTPProbePath            = "param.collector.kubernetes.http_probe.path"
+	ParameterKeyHTTPProbeScheme          = "param.collector.kubernetes.http_probe.scheme"
+	ParameterKeyHTTPProbeTimeoutSeconds  = "param.collector.kubernetes.http_probe.timeout_seconds"
+	ParameterKeyHTTPProbeFollowRedirects = "param.collector.kubernetes.http_probe.follow_redirects"
+
+	ContextKeyHTTPProbeStatusCode               = "collector.kubernetes.http_probe.status_code"
+	ContextKeyHTTPProbeLatencyMilliseconds      = "collector.kubernetes.http_probe.latency_milliseconds"
+	ContextKeyHTTPProbeTLSCertificateExpiration = "collector.kubernetes.http_probe.tls_certificate_expiration"
+	ContextKeyHTTPProbeResponseSnippet          = "collector.kubernetes.http_probe.response_snippet"
+
+	// defaultHTTPProbeTimeoutSeconds is the default timeout in seconds of one probe.
+	defaultHTTPProbeTimeoutSeconds = 10
+	// maxHTTPProbeSnippetBytes is the maximum number of response body bytes recorded in the result.
+	maxHTTPProbeSnippetBytes = 1024
+)
+
+// httpProbeCollector performs an http get against an endpoint of the target pod and records status
+// code, latency, tls certificate expiry and a response snippet. The probe target is resolved from
+// the pod reference and the readiness probe of the target container unless overridden by parameters.
+// This supports diagnosing pods which report healthy while their endpoint returns errors.
+type httpProbeCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// httpProbeCollectorEnabled indicates whether httpProbeCollector is enabled.
+	httpProbeCollectorEnabled bool
+}
+
+// NewHTTPProbeCollector creates a new httpProbeCollector.
+func NewHTTPProbeCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	httpProbeCollectorEnabled bool,
+) processors.Processor {
+	return &httpProbeCollector{
+		Context:                   ctx,
+		Logger:                    logger,
+		cache:                     cache,
+		httpProbeCollectorEnabled: httpProbeCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for probing an endpoint of the target pod.
+func (hp *httpProbeCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !hp.httpProbeCollectorEnabled {
+		http.Error(w, fmt.Sprintf("http probe collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			hp.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		timeoutSeconds := defaultHTTPProbeTimeoutSeconds
+		if value, ok := contexts[ParameterKeyHTTPProbeTimeoutSeconds]; ok {
+			timeoutSeconds, err = strconv.Atoi(value)
+			if err != nil || timeoutSeconds <= 0 {
+				http.Error(w, fmt.Sprintf("invalid timeout seconds %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+		followRedirects := contexts[ParameterKeyHTTPProbeFollowRedirects] == "true"
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var pod corev1.Pod
+		if err := hp.cache.Get(hp, client.ObjectKey{
+			Namespace: podReference.Namespace,
+			Name:      podReference.Name,
+		}, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		probeURL, err := resolveProbeURL(pod, podReference.Container, contexts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to resolve probe target of pod %s/%s: %v", pod.Namespace, pod.Name, err), http.StatusBadRequest)
+			return
+		}
+
+		hp.Info("probing endpoint of pod", "pod", client.ObjectKey{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+		}, "url", probeURL)
+		result, err := hp.probeEndpoint(probeURL, time.Duration(timeoutSeconds)*time.Second, followRedirects)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to probe %s: %v", probeURL, err), http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// resolveProbeURL resolves the url to probe from the pod, the target container and the parameters.
+// Port, path and scheme default to the http get readiness probe of the target container if not
+// specified as parameters.
+func resolveProbeURL(pod corev1.Pod, containerName string, contexts map[string]string) (string, error) {
+	if pod.Status.PodIP == "" {
+		return "", fmt.Errorf("pod has not been assigned an ip address")
+	}
+
+	port := contexts[ParameterKeyHTTPProbePort]
+	path := contexts[ParameterKeyHTTPProbePath]
+	scheme := contexts[ParameterKeyHTTPProbeScheme]
+
+	// Fill unspecified fields from the readiness probe of the target container. The first container
+	// of the pod is taken if no container name is provided.
+	if port == "" || path == "" || scheme == "" {
+		if httpGet := findReadinessHTTPGet(pod, containerName); httpGet != nil {
+			if port == "" {
+				port = httpGet.Port.String()
+			}
+			if path == "" {
+				path = httpGet.Path
+			}
+			if scheme == "" {
+				scheme = strings.ToLower(string(httpGet.Scheme))
+			}
+		}
+	}
+	if port == "" {
+		return "", fmt.Errorf("port not specified and no http get readiness probe found")
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("invalid scheme %s", scheme)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	// A named port in the readiness probe is resolved against the container ports of the pod.
+	if _, err := strconv.Atoi(port); err != nil {
+		resolved := ""
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == port {
+					resolved = strconv.Itoa(int(containerPort.ContainerPort))
+				}
+			}
+		}
+		if resolved == "" {
+			return "", fmt.Errorf("unable to resolve named port %s", port)
+		}
+		port = resolved
+	}
+
+	return fmt.Sprintf("%s://%s:%s%s", scheme, pod.Status.PodIP, port, path), nil
+}
+
+// findReadinessHTTPGet retrieves the http get handler of the readiness probe of the named container.
+// The first container of the pod is taken if no container name is provided. Nil is returned if the
+// container has no http get readiness probe.
+func findReadinessHTTPGet(pod corev1.Pod, containerName string) *corev1.HTTPGetAction {
+	for _, container := range pod.Spec.Containers {
+		if containerName != "" && container.Name != containerName {
+			continue
+		}
+		if container.ReadinessProbe != nil && container.ReadinessProbe.HTTPGet != nil {
+			return container.ReadinessProbe.HTTPGet
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// probeEndpoint performs an http get against the url and records status code, latency, tls
+// certificate expiry and a snippet of the response body. Certificate verification is skipped since
+// the probe reports certificate expiry instead of failing on untrusted certificates.
+func (hp *httpProbeCollector) probeEndpoint(probeURL string, timeout time.Duration, followRedirects bool) (map[string]string, error) {
+	httpClient := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+	if !followRedirects {
+		httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	start := time.Now()
+	res, err := httpClient.Get(probeURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	snippet, err := ioutil.ReadAll(io.LimitReader(res.Body, maxHTTPProbeSnippetBytes))
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+
+	result := make(map[string]string)
+	result[ContextKeyHTTPProbeStatusCode] = strconv.Itoa(res.StatusCode)
+	result[ContextKeyHTTPProbeLatencyMilliseconds] = strconv.FormatInt(latency.Milliseconds(), 10)
+	result[ContextKeyHTTPProbeResponseSnippet] = string(snippet)
+	if res.TLS != nil && len(res.TLS.PeerCertificates) > 0 {
+		result[ContextKeyHTTPProbeTLSCertificateExpiration] = res.TLS.PeerCertificates[0].NotAfter.Format(time.RFC3339)
+	}
+
+	return result, nil
+}
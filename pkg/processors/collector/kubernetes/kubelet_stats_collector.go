@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyKubeletStatsAddress = "param.collector.kubernetes.kubelet_stats.address"
+
+	ContextKeyKubeletStatsNode    = "collector.kubernetes.kubelet_stats.node"
+	ContextKeyKubeletStatsPods    = "collector.kubernetes.kubelet_stats.pods"
+	ContextKeyKubeletStatsMetrics = "collector.kubernetes.kubelet_stats.metrics"
+
+	// defaultKubeletAddress is the address of the local kubelet.
+	defaultKubeletAddress = "https://127.0.0.1:10250"
+	// serviceAccountTokenPath is the path of the service account token the agent authenticates
+	// to the kubelet with.
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// kubeletRequestTimeout is the timeout of one request to the kubelet.
+	kubeletRequestTimeout = 10 * time.Second
+)
+
+// kubeletSummary is the subset of the kubelet /stats/summary response consumed by the collector.
+type kubeletSummary struct {
+	Node kubeletNodeStats  `json:"node"`
+	Pods []kubeletPodStats `json:"pods"`
+}
+
+// kubeletNodeStats contains resource usage of the node reported by the kubelet.
+type kubeletNodeStats struct {
+	NodeName string              `json:"nodeName"`
+	CPU      *kubeletCPUStats    `json:"cpu,omitempty"`
+	Memory   *kubeletMemoryStats `json:"memory,omitempty"`
+	Fs       *kubeletFsStats     `json:"fs,omitempty"`
+}
+
+// kubeletPodStats contains resource usage of one pod reported by the kubelet.
+type kubeletPodStats struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UID       string `json:"uid"`
+	} `json:"podRef"`
+	CPU    *kubeletCPUStats    `json:"cpu,omitempty"`
+	Memory *kubeletMemoryStats `json:"memory,omitempty"`
+}
+
+// kubeletCPUStats contains cpu usage reported by the kubelet.
+type kubeletCPUStats struct {
+	UsageNanoCores       *uint64 `json:"usageNanoCores,omitempty"`
+	UsageCoreNanoSeconds *uint64 `json:"usageCoreNanoSeconds,omitempty"`
+}
+
+// kubeletMemoryStats contains memory usage reported by the kubelet.
+type kubeletMemoryStats struct {
+	WorkingSetBytes *uint64 `json:"workingSetBytes,omitempty"`
+	UsageBytes      *uint64 `json:"usageBytes,omitempty"`
+	RSSBytes        *uint64 `json:"rssBytes,omitempty"`
+}
+
+// kubeletFsStats contains filesystem usage reported by the kubelet.
+type kubeletFsStats struct {
+	AvailableBytes *uint64 `json:"availableBytes,omitempty"`
+	CapacityBytes  *uint64 `json:"capacityBytes,omitempty"`
+	UsedBytes      *uint64 `json:"usedBytes,omitempty"`
+}
+
+// kubeletStatsCollector scrapes the /stats/summary and /metrics endpoints of the local kubelet
+// and records node and pod resource usage into the diagnosis context. The usage data comes
+// straight from the kubelet, so it is available even when metrics-server is down.
+type kubeletStatsCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// kubeletStatsCollectorEnabled indicates whether kubeletStatsCollector is enabled.
+	kubeletStatsCollectorEnabled bool
+}
+
+// NewKubeletStatsCollector creates a new kubeletStatsCollector.
+func NewKubeletStatsCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	kubeletStatsCollectorEnabled bool,
+) processors.Processor {
+	return &kubeletStatsCollector{
+		Context:                      ctx,
+		Logger:                       logger,
+		kubeletStatsCollectorEnabled: kubeletStatsCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for node and pod resource usage from the kubelet.
+func (kc *kubeletStatsCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !kc.kubeletStatsCollectorEnabled {
+		http.Error(w, fmt.Sprintf("kubelet stats collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			kc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		address := defaultKubeletAddress
+		if value, ok := contexts[ParameterKeyKubeletStatsAddress]; ok && value != "" {
+			address = strings.TrimSuffix(value, "/")
+		}
+
+		summaryData, err := kc.requestKubelet(address + "/stats/summary")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to scrape kubelet summary: %v", err), http.StatusInternalServerError)
+			return
+		}
+		summary := kubeletSummary{}
+		err = json.Unmarshal(summaryData, &summary)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to unmarshal kubelet summary: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		nodeData, err := json.Marshal(summary.Node)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal node stats: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeyKubeletStatsNode] = string(nodeData)
+		podsData, err := json.Marshal(summary.Pods)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal pod stats: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeyKubeletStatsPods] = string(podsData)
+
+		// The metrics endpoint complements the summary with cadvisor and kubelet internals. A
+		// scrape failure is not fatal since the summary already carries the usage data.
+		metricsData, err := kc.requestKubelet(address + "/metrics")
+		if err != nil {
+			kc.Info("unable to scrape kubelet metrics", "address", address, "error", err)
+		} else {
+			result[ContextKeyKubeletStatsMetrics] = string(metricsData)
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// requestKubelet sends a GET request to the kubelet authenticated with the service account token
+// of the agent and returns the response body. The kubelet serving certificate is not verified
+// since it is usually self signed.
+func (kc *kubeletStatsCollector) requestKubelet(url string) ([]byte, error) {
+	cli := &http.Client{
+		Timeout: kubeletRequestTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := ioutil.ReadFile(serviceAccountTokenPath)
+	if err != nil {
+		kc.Info("unable to read service account token, requesting kubelet without authentication", "error", err)
+	} else {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", strings.TrimSpace(string(token))))
+	}
+
+	res, err := cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubelet responded with status %d", res.StatusCode)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
@@ -24,13 +24,18 @@ import (
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 
 	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
 	"github.com/kubediag/kubediag/pkg/util"
 )
 
 const (
+	ParameterKeyPodListLabelSelector = "param.collector.kubernetes.pod.list.label_selector"
+	ParameterKeyPodListNamespace     = "param.collector.kubernetes.pod.list.namespace"
+
 	ContextKeyPodList = "collector.kubernetes.pod.list"
 )
 
@@ -75,8 +80,26 @@ func (pc *podListCollector) Handler(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "POST":
-		// List all pods on the node.
-		pods, err := pc.listPods()
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			pc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The result is restricted to pods matching the label selector and namespace if specified.
+		var selector labels.Selector
+		if value, ok := contexts[ParameterKeyPodListLabelSelector]; ok && value != "" {
+			selector, err = labels.Parse(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid label selector %s: %v", value, err), http.StatusBadRequest)
+				return
+			}
+		}
+		namespace := contexts[ParameterKeyPodListNamespace]
+
+		// List all pods on the node which match the filters.
+		pods, err := pc.listPods(namespace, selector)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("failed to list pods: %v", err), http.StatusInternalServerError)
 			return
@@ -103,8 +126,9 @@ func (pc *podListCollector) Handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// listPods lists Pods from cache.
-func (pc *podListCollector) listPods() ([]corev1.Pod, error) {
+// listPods lists Pods from cache. The result contains only pods in the provided namespace which
+// match the label selector. An empty namespace or a nil selector does not restrict the result.
+func (pc *podListCollector) listPods(namespace string, selector labels.Selector) ([]corev1.Pod, error) {
 	pc.Info("listing Pods on node")
 
 	var podList corev1.PodList
@@ -112,7 +136,7 @@ func (pc *podListCollector) listPods() ([]corev1.Pod, error) {
 		return nil, err
 	}
 
-	podsOnNode := util.RetrievePodsOnNode(podList.Items, pc.nodeName)
+	podsOnNode := util.RetrievePodsOnNodeWithSelector(podList.Items, pc.nodeName, namespace, selector)
 
 	return podsOnNode, nil
 }
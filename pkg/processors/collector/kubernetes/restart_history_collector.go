@@ -0,0 +1,215 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/executor"
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ContextKeyRestartHistoryContainers = "collector.kubernetes.restart_history.containers"
+	ContextKeyRestartHistoryTimeline   = "collector.kubernetes.restart_history.timeline"
+)
+
+// containerRestartHistory contains the restart history of one container of the target pod.
+type containerRestartHistory struct {
+	// Container is the name of the container.
+	Container string `json:"container"`
+	// RestartCount is the number of times the container has been restarted.
+	RestartCount int32 `json:"restartCount"`
+	// LastExitCode is the exit code of the last termination of the container.
+	LastExitCode int32 `json:"lastExitCode,omitempty"`
+	// LastSignal is the signal of the last termination of the container.
+	LastSignal int32 `json:"lastSignal,omitempty"`
+	// LastReason is the reason of the last termination of the container.
+	LastReason string `json:"lastReason,omitempty"`
+	// LastFinishedAt is the time the last termination of the container finished.
+	LastFinishedAt *time.Time `json:"lastFinishedAt,omitempty"`
+	// LastStartedAt is the time the last terminated run of the container started.
+	LastStartedAt *time.Time `json:"lastStartedAt,omitempty"`
+}
+
+// restartHistoryCollector extracts restart counts and last terminated states of all containers
+// of the target pod and correlates them into a timeline. Diagnosers such as crash loop and oom
+// kill consume the timeline instead of re-deriving it from the raw pod status.
+type restartHistoryCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// restartHistoryCollectorEnabled indicates whether restartHistoryCollector is enabled.
+	restartHistoryCollectorEnabled bool
+}
+
+// NewRestartHistoryCollector creates a new restartHistoryCollector.
+func NewRestartHistoryCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	restartHistoryCollectorEnabled bool,
+) processors.Processor {
+	return &restartHistoryCollector{
+		Context:                        ctx,
+		Logger:                         logger,
+		cache:                          cache,
+		restartHistoryCollectorEnabled: restartHistoryCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for restart history of the target pod.
+func (rc *restartHistoryCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !rc.restartHistoryCollectorEnabled {
+		http.Error(w, fmt.Sprintf("restart history collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			rc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if contexts[executor.PodNamespaceTelemetryKey] == "" ||
+			contexts[executor.PodNameTelemetryKey] == "" {
+			http.Error(w, fmt.Sprintf("pod namespace and name not found in contexts"), http.StatusNotAcceptable)
+			return
+		}
+
+		pod := corev1.Pod{}
+		err = rc.cache.Get(rc.Context,
+			client.ObjectKey{
+				Namespace: contexts[executor.PodNamespaceTelemetryKey],
+				Name:      contexts[executor.PodNameTelemetryKey],
+			}, &pod)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		histories := collectRestartHistories(pod)
+
+		result := make(map[string]string)
+		historiesData, err := json.Marshal(histories)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal restart histories: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeyRestartHistoryContainers] = string(historiesData)
+		timelineData, err := json.Marshal(buildRestartTimeline(histories))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal restart timeline: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeyRestartHistoryTimeline] = string(timelineData)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// collectRestartHistories extracts the restart history of all containers of the pod from its
+// container statuses including init containers.
+func collectRestartHistories(pod corev1.Pod) []containerRestartHistory {
+	statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+
+	histories := make([]containerRestartHistory, 0, len(statuses))
+	for _, status := range statuses {
+		history := containerRestartHistory{
+			Container:    status.Name,
+			RestartCount: status.RestartCount,
+		}
+		if status.LastTerminationState.Terminated != nil {
+			terminated := status.LastTerminationState.Terminated
+			history.LastExitCode = terminated.ExitCode
+			history.LastSignal = terminated.Signal
+			history.LastReason = terminated.Reason
+			if !terminated.FinishedAt.IsZero() {
+				finishedAt := terminated.FinishedAt.Time
+				history.LastFinishedAt = &finishedAt
+			}
+			if !terminated.StartedAt.IsZero() {
+				startedAt := terminated.StartedAt.Time
+				history.LastStartedAt = &startedAt
+			}
+		}
+		histories = append(histories, history)
+	}
+
+	return histories
+}
+
+// restartTimelineEntry correlates one container termination on the restart timeline of the pod.
+type restartTimelineEntry struct {
+	// Time is the time the termination finished.
+	Time time.Time `json:"time"`
+	// Container is the name of the terminated container.
+	Container string `json:"container"`
+	// ExitCode is the exit code of the termination.
+	ExitCode int32 `json:"exitCode"`
+	// Reason is the reason of the termination.
+	Reason string `json:"reason,omitempty"`
+}
+
+// buildRestartTimeline correlates the last terminations of all containers into a timeline
+// ordered by finish time.
+func buildRestartTimeline(histories []containerRestartHistory) []restartTimelineEntry {
+	timeline := make([]restartTimelineEntry, 0, len(histories))
+	for _, history := range histories {
+		if history.LastFinishedAt == nil {
+			continue
+		}
+		timeline = append(timeline, restartTimelineEntry{
+			Time:      *history.LastFinishedAt,
+			Container: history.Container,
+			ExitCode:  history.LastExitCode,
+			Reason:    history.LastReason,
+		})
+	}
+	sort.Slice(timeline, func(i, j int) bool {
+		return timeline[i].Time.Before(timeline[j].Time)
+	})
+
+	return timeline
+}
@@ -0,0 +1,188 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	LokiEndpoint = "param.collector.log.loki.endpoint"
+	LokiQuery    = "param.collector.log.loki.query"
+	LokiTimeFrom = "param.collector.log.loki.timeFrom"
+	LokiTimeTo   = "param.collector.log.loki.timeTo"
+	LokiLimit    = "param.collector.log.loki.limit"
+
+	ContextKeyLokiResultLines = "collector.log.loki.result.lines"
+	ContextKeyLokiResultCount = "collector.log.loki.result.count"
+
+	// lokiQueryRangePath is the path of the loki range query api.
+	lokiQueryRangePath = "/loki/api/v1/query_range"
+	// defaultLokiLimit is the default maximum number of log lines returned by a loki query.
+	defaultLokiLimit = 100
+	// defaultLokiTimeRange is the default time range of a loki query if no range is specified.
+	defaultLokiTimeRange = time.Hour
+)
+
+// lokiLogCollector queries log lines from loki with a logql query.
+type lokiLogCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+	// lokiLogCollectorEnabled indicates whether lokiLogCollector is enabled.
+	lokiLogCollectorEnabled bool
+}
+
+// NewLokiLogCollector creates a new lokiLogCollector.
+func NewLokiLogCollector(ctx context.Context,
+	logger logr.Logger,
+	lokiLogCollectorEnabled bool,
+) processors.Processor {
+	return &lokiLogCollector{
+		Context:                 ctx,
+		Logger:                  logger,
+		lokiLogCollectorEnabled: lokiLogCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for collecting log lines from loki.
+func (lc *lokiLogCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !lc.lokiLogCollectorEnabled {
+		http.Error(w, fmt.Sprintf("loki log collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			lc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		endpoint, ok := contexts[LokiEndpoint]
+		if !ok || endpoint == "" {
+			http.Error(w, fmt.Sprintf("must specify loki endpoint."), http.StatusBadRequest)
+			return
+		}
+		query, ok := contexts[LokiQuery]
+		if !ok || query == "" {
+			http.Error(w, fmt.Sprintf("must specify loki logql query."), http.StatusBadRequest)
+			return
+		}
+
+		end := time.Now()
+		if value, ok := contexts[LokiTimeTo]; ok && value != "" {
+			end, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid query end time %s: %v", value, err), http.StatusBadRequest)
+				return
+			}
+		}
+		start := end.Add(-defaultLokiTimeRange)
+		if value, ok := contexts[LokiTimeFrom]; ok && value != "" {
+			start, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid query start time %s: %v", value, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		limit := defaultLokiLimit
+		if value, ok := contexts[LokiLimit]; ok && value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				http.Error(w, fmt.Sprintf("invalid loki query limit %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		lines, err := lc.runLokiQuery(endpoint, query, start, end, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to run loki query: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyLokiResultLines] = strings.Join(lines, "\n")
+		result[ContextKeyLokiResultCount] = strconv.Itoa(len(lines))
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal loki log collector results: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// lokiQueryRangeResponse is the response body of a loki range query.
+type lokiQueryRangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]string        `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// runLokiQuery runs the logql query against the loki range query api and returns matched log lines.
+func (lc *lokiLogCollector) runLokiQuery(endpoint, query string, start, end time.Time, limit int) ([]string, error) {
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	values.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	values.Set("limit", strconv.Itoa(limit))
+
+	res, err := http.Get(fmt.Sprintf("%s%s?%s", strings.TrimSuffix(endpoint, "/"), lokiQueryRangePath, values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("loki responded with status code %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var response lokiQueryRangeResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal loki response: %v", err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("loki query did not succeed: %s", response.Status)
+	}
+
+	var lines []string
+	for _, stream := range response.Data.Result {
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				continue
+			}
+			lines = append(lines, value[1])
+		}
+	}
+	lc.Info("loki query finished", "query", query, "lines", len(lines))
+
+	return lines, nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/go-logr/logr"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyArthasThreadDumpBootJar        = "param.collector.runtime.arthas_thread_dump.boot_jar"
+	ParameterKeyArthasThreadDumpTimeoutSeconds = "param.collector.runtime.arthas_thread_dump.timeout_seconds"
+
+	ContextKeyArthasThreadDump    = "collector.runtime.arthas_thread_dump.thread_dump"
+	ContextKeyArthasThreadDumpPID = "collector.runtime.arthas_thread_dump.pid"
+
+	// defaultArthasBootJar is the default path of the arthas boot jar on the node.
+	defaultArthasBootJar = "/opt/arthas/arthas-boot.jar"
+	// defaultArthasThreadDumpTimeoutSeconds is the default timeout of an arthas thread dump
+	// in seconds.
+	defaultArthasThreadDumpTimeoutSeconds = 60
+
+	// arthasPodNamespaceDockerLabel is the docker label containing the pod namespace of a container.
+	arthasPodNamespaceDockerLabel = "io.kubernetes.pod.namespace"
+	// arthasPodNameDockerLabel is the docker label containing the pod name of a container.
+	arthasPodNameDockerLabel = "io.kubernetes.pod.name"
+	// arthasContainerNameDockerLabel is the docker label containing the container name of a container.
+	arthasContainerNameDockerLabel = "io.kubernetes.container.name"
+	// arthasPauseContainerName is the container name of the pod sandbox.
+	arthasPauseContainerName = "POD"
+)
+
+// arthasThreadDumpCollector takes a one-shot thread dump of the java process in the target
+// container with arthas. The dump is written into the diagnosis context synchronously instead
+// of being served at an expiring endpoint like the profilers.
+type arthasThreadDumpCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client is the API client that performs all operations against a docker server.
+	client *dockerclient.Client
+	// arthasThreadDumpCollectorEnabled indicates whether arthasThreadDumpCollector is enabled.
+	arthasThreadDumpCollectorEnabled bool
+}
+
+// NewArthasThreadDumpCollector creates a new arthasThreadDumpCollector.
+func NewArthasThreadDumpCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	dockerEndpoint string,
+	arthasThreadDumpCollectorEnabled bool,
+) (processors.Processor, error) {
+	client, err := dockerclient.NewClientWithOpts(dockerclient.WithHost(dockerEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return &arthasThreadDumpCollector{
+		Context:                          ctx,
+		Logger:                           logger,
+		client:                           client,
+		arthasThreadDumpCollectorEnabled: arthasThreadDumpCollectorEnabled,
+	}, nil
+}
+
+// Handler handles http requests for taking a thread dump of the java process in the target container.
+func (ac *arthasThreadDumpCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !ac.arthasThreadDumpCollectorEnabled {
+		http.Error(w, fmt.Sprintf("arthas thread dump collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			ac.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		bootJar := defaultArthasBootJar
+		if value, ok := contexts[ParameterKeyArthasThreadDumpBootJar]; ok && value != "" {
+			bootJar = value
+		}
+		timeoutSeconds := int32(defaultArthasThreadDumpTimeoutSeconds)
+		if value, ok := contexts[ParameterKeyArthasThreadDumpTimeoutSeconds]; ok {
+			timeout, err := strconv.Atoi(value)
+			if err != nil || timeout <= 0 {
+				http.Error(w, fmt.Sprintf("invalid timeout seconds %s", value), http.StatusBadRequest)
+				return
+			}
+			timeoutSeconds = int32(timeout)
+		}
+
+		pid, err := ac.getContainerPID(podReference)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to resolve pid of target container: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Run arthas in batch mode so the session stops once the thread command finishes.
+		dump, err := util.BlockingRunCommandWithTimeout([]string{"java", "-jar", bootJar, strconv.Itoa(pid), "-c", "thread -all; stop"}, timeoutSeconds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to take thread dump with arthas: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyArthasThreadDump] = string(dump)
+		result[ContextKeyArthasThreadDumpPID] = strconv.Itoa(pid)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// getContainerPID returns the pid of the target container on the node.
+func (ac *arthasThreadDumpCollector) getContainerPID(podReference diagnosisv1.PodReference) (int, error) {
+	containers, err := ac.client.ContainerList(ac, dockertypes.ContainerListOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, container := range containers {
+		if container.Labels[arthasPodNamespaceDockerLabel] != podReference.Namespace ||
+			container.Labels[arthasPodNameDockerLabel] != podReference.Name {
+			continue
+		}
+		if container.Labels[arthasContainerNameDockerLabel] == arthasPauseContainerName {
+			continue
+		}
+		if podReference.Container != "" && container.Labels[arthasContainerNameDockerLabel] != podReference.Container {
+			continue
+		}
+
+		containerJSON, err := ac.client.ContainerInspect(ac, container.ID)
+		if err != nil {
+			return 0, err
+		}
+		if containerJSON.State == nil || containerJSON.State.Pid == 0 {
+			return 0, fmt.Errorf("container %s of pod %s/%s is not running", container.Labels[arthasContainerNameDockerLabel], podReference.Namespace, podReference.Name)
+		}
+
+		return containerJSON.State.Pid, nil
+	}
+
+	return 0, fmt.Errorf("container of pod %s/%s not found on the node", podReference.Namespace, podReference.Name)
+}
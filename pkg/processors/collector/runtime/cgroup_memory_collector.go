@@ -0,0 +1,306 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ContextKeyCgroupMemoryWorkingSetBytes = "collector.runtime.cgroup_memory.working_set_bytes"
+	ContextKeyCgroupMemoryRSSBytes        = "collector.runtime.cgroup_memory.rss_bytes"
+	ContextKeyCgroupMemoryCacheBytes      = "collector.runtime.cgroup_memory.cache_bytes"
+	ContextKeyCgroupMemoryLimitBytes      = "collector.runtime.cgroup_memory.limit_bytes"
+
+	// cgroupRoot is the mount point of the cgroup filesystem. The memory statistics of a container
+	// are located under the memory controller hierarchy on cgroup v1 and under the unified hierarchy
+	// on cgroup v2.
+	cgroupRoot = "/sys/fs/cgroup"
+	// unlimitedCgroupMemoryLimit marks a cgroup without a memory limit in the result. A cgroup v1
+	// limit close to the maximum value of a signed 64 bit integer is reported as unlimited as well.
+	unlimitedCgroupMemoryLimit = "unlimited"
+)
+
+// cgroupMemoryStat holds memory statistics of a container cgroup. The fields are normalized over
+// cgroup v1 and v2 layouts.
+type cgroupMemoryStat struct {
+	// workingSetBytes is the usage of the cgroup minus inactive file backed memory.
+	workingSetBytes uint64
+	// rssBytes is the anonymous memory of the cgroup.
+	rssBytes uint64
+	// cacheBytes is the file backed memory of the cgroup.
+	cacheBytes uint64
+	// limitBytes is the memory limit of the cgroup, or unlimitedCgroupMemoryLimit if no limit is set.
+	limitBytes string
+}
+
+// cgroupMemoryCollector reads memory statistics of the target container from its cgroup. The exact
+// numbers of the container cgroup are more precise for diagnosing memory pressure and out of memory
+// kills than node wide statistics from /proc/meminfo.
+type cgroupMemoryCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// cgroupMemoryCollectorEnabled indicates whether cgroupMemoryCollector is enabled.
+	cgroupMemoryCollectorEnabled bool
+}
+
+// NewCgroupMemoryCollector creates a new cgroupMemoryCollector.
+func NewCgroupMemoryCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	cgroupMemoryCollectorEnabled bool,
+) processors.Processor {
+	return &cgroupMemoryCollector{
+		Context:                      ctx,
+		Logger:                       logger,
+		cache:                        cache,
+		cgroupMemoryCollectorEnabled: cgroupMemoryCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for collecting memory statistics of the target container cgroup.
+func (cm *cgroupMemoryCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !cm.cgroupMemoryCollectorEnabled {
+		http.Error(w, fmt.Sprintf("cgroup memory collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			cm.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var pod corev1.Pod
+		if err := cm.cache.Get(cm, client.ObjectKey{
+			Namespace: podReference.Namespace,
+			Name:      podReference.Name,
+		}, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		containerID, err := retrieveContainerID(pod, podReference.Container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to retrieve container id of pod %s/%s: %v", pod.Namespace, pod.Name, err), http.StatusUnprocessableEntity)
+			return
+		}
+		cgroupPath, err := findContainerCgroupPath(containerID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to resolve cgroup path of container %s: %v", containerID, err), http.StatusUnprocessableEntity)
+			return
+		}
+		stat, err := readCgroupMemoryStat(cgroupPath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to read memory statistics under %s: %v", cgroupPath, err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyCgroupMemoryWorkingSetBytes] = strconv.FormatUint(stat.workingSetBytes, 10)
+		result[ContextKeyCgroupMemoryRSSBytes] = strconv.FormatUint(stat.rssBytes, 10)
+		result[ContextKeyCgroupMemoryCacheBytes] = strconv.FormatUint(stat.cacheBytes, 10)
+		result[ContextKeyCgroupMemoryLimitBytes] = stat.limitBytes
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// retrieveContainerID retrieves the runtime container id of the named container from the pod status.
+// The first container of the pod is taken if no container name is provided.
+func retrieveContainerID(pod corev1.Pod, containerName string) (string, error) {
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return "", fmt.Errorf("pod has no container status")
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerName != "" && containerStatus.Name != containerName {
+			continue
+		}
+		if containerStatus.ContainerID == "" {
+			return "", fmt.Errorf("container %s has not been assigned a container id", containerStatus.Name)
+		}
+		// The container id is prefixed with the runtime scheme, e.g. docker://<id>.
+		index := strings.Index(containerStatus.ContainerID, "://")
+		if index == -1 {
+			return containerStatus.ContainerID, nil
+		}
+		return containerStatus.ContainerID[index+3:], nil
+	}
+
+	return "", fmt.Errorf("container %s not found in pod status", containerName)
+}
+
+// findContainerCgroupPath searches the cgroup filesystem for the cgroup directory of the container.
+// The search covers cgroup v1 and v2 layouts with both the cgroupfs and systemd cgroup drivers.
+func findContainerCgroupPath(containerID string) (string, error) {
+	var cgroupPath string
+	err := filepath.Walk(cgroupRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if !strings.Contains(info.Name(), containerID) {
+			return nil
+		}
+
+		// The directory must expose memory statistics of either cgroup version.
+		if _, err := os.Stat(filepath.Join(path, "memory.stat")); err != nil {
+			return nil
+		}
+
+		cgroupPath = path
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return "", err
+	}
+	if cgroupPath == "" {
+		return "", fmt.Errorf("cgroup of container not found under %s", cgroupRoot)
+	}
+
+	return cgroupPath, nil
+}
+
+// readCgroupMemoryStat reads memory statistics from the container cgroup directory and normalizes
+// them over cgroup v1 and v2 layouts.
+func readCgroupMemoryStat(cgroupPath string) (cgroupMemoryStat, error) {
+	fields, err := parseCgroupMemoryStatFile(filepath.Join(cgroupPath, "memory.stat"))
+	if err != nil {
+		return cgroupMemoryStat{}, err
+	}
+
+	// A cgroup v2 directory exposes current usage in memory.current and the limit in memory.max
+	// while a cgroup v1 directory exposes them in memory.usage_in_bytes and memory.limit_in_bytes.
+	if usage, err := readCgroupMemoryValue(filepath.Join(cgroupPath, "memory.current")); err == nil {
+		stat := cgroupMemoryStat{
+			workingSetBytes: subtractCgroupMemoryValue(usage, fields["inactive_file"]),
+			rssBytes:        fields["anon"],
+			cacheBytes:      fields["file"],
+			limitBytes:      unlimitedCgroupMemoryLimit,
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(cgroupPath, "memory.max")); err == nil {
+			if value := strings.TrimSpace(string(data)); value != "max" {
+				stat.limitBytes = value
+			}
+		}
+		return stat, nil
+	}
+
+	usage, err := readCgroupMemoryValue(filepath.Join(cgroupPath, "memory.usage_in_bytes"))
+	if err != nil {
+		return cgroupMemoryStat{}, err
+	}
+	stat := cgroupMemoryStat{
+		workingSetBytes: subtractCgroupMemoryValue(usage, fields["total_inactive_file"]),
+		rssBytes:        fields["total_rss"],
+		cacheBytes:      fields["total_cache"],
+		limitBytes:      unlimitedCgroupMemoryLimit,
+	}
+	if limit, err := readCgroupMemoryValue(filepath.Join(cgroupPath, "memory.limit_in_bytes")); err == nil {
+		// A cgroup v1 memory cgroup without a limit reports a page aligned value close to the
+		// maximum value of a signed 64 bit integer.
+		if limit < uint64(1)<<62 {
+			stat.limitBytes = strconv.FormatUint(limit, 10)
+		}
+	}
+
+	return stat, nil
+}
+
+// parseCgroupMemoryStatFile parses a memory.stat file into a map of field names to values.
+func parseCgroupMemoryStatFile(path string) (map[string]uint64, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		fields[parts[0]] = value
+	}
+
+	return fields, nil
+}
+
+// readCgroupMemoryValue reads a cgroup file containing a single unsigned integer value.
+func readCgroupMemoryValue(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// subtractCgroupMemoryValue subtracts the subtrahend from the usage without wrapping around zero.
+func subtractCgroupMemoryValue(usage uint64, subtrahend uint64) uint64 {
+	if subtrahend > usage {
+		return 0
+	}
+
+	return usage - subtrahend
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/go-logr/logr"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyHeapDumpTimeoutSeconds   = "param.collector.runtime.heap_dump.timeout_seconds"
+	ParameterKeyHeapDumpLiveObjectsOnly  = "param.collector.runtime.heap_dump.live_objects_only"
+	ParameterKeyHeapDumpMinimumFreeBytes = "param.collector.runtime.heap_dump.minimum_free_bytes"
+
+	ContextKeyHeapDumpFilePath = "collector.runtime.heap_dump.file_path"
+	ContextKeyHeapDumpPID      = "collector.runtime.heap_dump.pid"
+
+	// heapDumpSubPath is the directory under the data root where heap dumps are stored.
+	heapDumpSubPath = "collectors/java/heapdump"
+	// defaultHeapDumpTimeoutSeconds is the default timeout of a heap dump in seconds.
+	defaultHeapDumpTimeoutSeconds = 300
+	// defaultHeapDumpMinimumFreeBytes is the default free space in bytes required on the data
+	// root before taking a heap dump. A dump can be as large as the live heap of the target
+	// process and must not fill up the disk backing kubediag data.
+	defaultHeapDumpMinimumFreeBytes = 1 << 30
+)
+
+// heapDumpCollector takes a heap dump of the live java process in the target container with
+// jmap. The hprof file is stored under the data root for later analysis and its path is written
+// into the diagnosis context so that a downstream operation can pick it up.
+type heapDumpCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client is the API client that performs all operations against a docker server.
+	client *dockerclient.Client
+	// dataRoot is root directory of persistent kubediag data.
+	dataRoot string
+	// heapDumpCollectorEnabled indicates whether heapDumpCollector is enabled.
+	heapDumpCollectorEnabled bool
+}
+
+// NewHeapDumpCollector creates a new heapDumpCollector.
+func NewHeapDumpCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	dockerEndpoint string,
+	dataRoot string,
+	heapDumpCollectorEnabled bool,
+) (processors.Processor, error) {
+	client, err := dockerclient.NewClientWithOpts(dockerclient.WithHost(dockerEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return &heapDumpCollector{
+		Context:                  ctx,
+		Logger:                   logger,
+		client:                   client,
+		dataRoot:                 dataRoot,
+		heapDumpCollectorEnabled: heapDumpCollectorEnabled,
+	}, nil
+}
+
+// Handler handles http requests for taking a heap dump of the java process in the target container.
+func (hc *heapDumpCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !hc.heapDumpCollectorEnabled {
+		http.Error(w, fmt.Sprintf("heap dump collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			hc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		timeoutSeconds := int32(defaultHeapDumpTimeoutSeconds)
+		if value, ok := contexts[ParameterKeyHeapDumpTimeoutSeconds]; ok {
+			timeout, err := strconv.Atoi(value)
+			if err != nil || timeout <= 0 {
+				http.Error(w, fmt.Sprintf("invalid timeout seconds %s", value), http.StatusBadRequest)
+				return
+			}
+			timeoutSeconds = int32(timeout)
+		}
+		minimumFreeBytes := uint64(defaultHeapDumpMinimumFreeBytes)
+		if value, ok := contexts[ParameterKeyHeapDumpMinimumFreeBytes]; ok {
+			bytes, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid minimum free bytes %s", value), http.StatusBadRequest)
+				return
+			}
+			minimumFreeBytes = bytes
+		}
+		liveObjectsOnly := contexts[ParameterKeyHeapDumpLiveObjectsOnly] == "true"
+
+		// A heap dump can be as large as the live heap of the target process. Refuse to take one
+		// if the disk backing the data root is short on space.
+		datadir := filepath.Join(hc.dataRoot, heapDumpSubPath)
+		err = os.MkdirAll(datadir, os.ModePerm)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to create directory for heap dumps: %v", err), http.StatusInternalServerError)
+			return
+		}
+		freeBytes := util.GetFreeBytes(datadir)
+		if freeBytes < minimumFreeBytes {
+			http.Error(w, fmt.Sprintf("insufficient disk space for heap dump: %d bytes free, %d bytes required", freeBytes, minimumFreeBytes), http.StatusInternalServerError)
+			return
+		}
+
+		pid, err := hc.getContainerPID(podReference)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to resolve pid of target container: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		filePath := filepath.Join(datadir, fmt.Sprintf("%s_%s_%d_%d.hprof", podReference.Namespace, podReference.Name, pid, time.Now().Unix()))
+		dumpOption := "-dump:format=b,file=" + filePath
+		if liveObjectsOnly {
+			dumpOption = "-dump:live,format=b,file=" + filePath
+		}
+		output, err := util.BlockingRunCommandWithTimeout([]string{"jmap", dumpOption, strconv.Itoa(pid)}, timeoutSeconds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to take heap dump with jmap: %v: %s", err, string(output)), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyHeapDumpFilePath] = filePath
+		result[ContextKeyHeapDumpPID] = strconv.Itoa(pid)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// getContainerPID returns the pid of the target container on the node.
+func (hc *heapDumpCollector) getContainerPID(podReference diagnosisv1.PodReference) (int, error) {
+	containers, err := hc.client.ContainerList(hc, dockertypes.ContainerListOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, container := range containers {
+		if container.Labels[arthasPodNamespaceDockerLabel] != podReference.Namespace ||
+			container.Labels[arthasPodNameDockerLabel] != podReference.Name {
+			continue
+		}
+		if container.Labels[arthasContainerNameDockerLabel] == arthasPauseContainerName {
+			continue
+		}
+		if podReference.Container != "" && container.Labels[arthasContainerNameDockerLabel] != podReference.Container {
+			continue
+		}
+
+		containerJSON, err := hc.client.ContainerInspect(hc, container.ID)
+		if err != nil {
+			return 0, err
+		}
+		if containerJSON.State == nil || containerJSON.State.Pid == 0 {
+			return 0, fmt.Errorf("container %s of pod %s/%s is not running", container.Labels[arthasContainerNameDockerLabel], podReference.Namespace, podReference.Name)
+		}
+
+		return containerJSON.State.Pid, nil
+	}
+
+	return 0, fmt.Errorf("container of pod %s/%s not found on the node", podReference.Namespace, podReference.Name)
+}
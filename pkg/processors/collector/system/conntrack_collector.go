@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyConntrackDestinationIP   = "param.collector.system.conntrack.destination_ip"
+	ParameterKeyConntrackDestinationPort = "param.collector.system.conntrack.destination_port"
+
+	ContextKeyConntrackTable = "collector.system.conntrack.table"
+	ContextKeyConntrackCount = "collector.system.conntrack.count"
+	ContextKeyConntrackMax   = "collector.system.conntrack.max"
+
+	// conntrackTablePath is the path of the connection tracking table.
+	conntrackTablePath = "/proc/net/nf_conntrack"
+	// conntrackCountPath is the path of the file containing the connection tracking entry count.
+	conntrackCountPath = "/proc/sys/net/netfilter/nf_conntrack_count"
+	// conntrackMaxPath is the path of the file containing the connection tracking table capacity.
+	conntrackMaxPath = "/proc/sys/net/netfilter/nf_conntrack_max"
+)
+
+// conntrackCollector reports the connection tracking table of the node.
+type conntrackCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// conntrackCollectorEnabled indicates whether conntrackCollector is enabled.
+	conntrackCollectorEnabled bool
+}
+
+// NewConntrackCollector creates a new conntrackCollector.
+func NewConntrackCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	conntrackCollectorEnabled bool,
+) processors.Processor {
+	return &conntrackCollector{
+		Context:                   ctx,
+		Logger:                    logger,
+		conntrackCollectorEnabled: conntrackCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for connection tracking information.
+func (cc *conntrackCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !cc.conntrackCollectorEnabled {
+		http.Error(w, fmt.Sprintf("conntrack collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			cc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		raw, err := ioutil.ReadFile(conntrackTablePath)
+		if err != nil {
+			// The connection tracking table is not readable if the nf_conntrack module is not loaded.
+			http.Error(w, fmt.Sprintf("unable to read %s, nf_conntrack module is probably not loaded: %v", conntrackTablePath, err), http.StatusUnprocessableEntity)
+			return
+		}
+
+		table := filterConntrackEntries(string(raw), contexts[ParameterKeyConntrackDestinationIP], contexts[ParameterKeyConntrackDestinationPort])
+
+		result := make(map[string]string)
+		result[ContextKeyConntrackTable] = table
+		if count, err := ioutil.ReadFile(conntrackCountPath); err == nil {
+			result[ContextKeyConntrackCount] = strings.TrimSpace(string(count))
+		} else {
+			cc.Error(err, fmt.Sprintf("unable to read %s", conntrackCountPath))
+		}
+		if max, err := ioutil.ReadFile(conntrackMaxPath); err == nil {
+			result[ContextKeyConntrackMax] = strings.TrimSpace(string(max))
+		} else {
+			cc.Error(err, fmt.Sprintf("unable to read %s", conntrackMaxPath))
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// filterConntrackEntries filters entries of the connection tracking table by destination ip and
+// destination port. All entries are returned if neither is specified.
+func filterConntrackEntries(table string, destinationIP string, destinationPort string) string {
+	if destinationIP == "" && destinationPort == "" {
+		return table
+	}
+
+	matched := make([]string, 0)
+	for _, line := range strings.Split(table, "\n") {
+		if destinationIP != "" && !strings.Contains(line, fmt.Sprintf("dst=%s ", destinationIP)) {
+			continue
+		}
+		if destinationPort != "" && !strings.Contains(line, fmt.Sprintf("dport=%s ", destinationPort)) {
+			continue
+		}
+		matched = append(matched, line)
+	}
+
+	return strings.Join(matched, "\n")
+}
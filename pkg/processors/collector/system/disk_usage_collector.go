@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/types"
+)
+
+const (
+	ContextKeyFilesystemUsageList = "collector.system.diskusage.filesystems"
+)
+
+// diskUsageCollector reports bytes and inode usage of mounted filesystems on the node.
+type diskUsageCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// diskUsageCollectorEnabled indicates whether diskUsageCollector is enabled.
+	diskUsageCollectorEnabled bool
+}
+
+// NewDiskUsageCollector creates a new diskUsageCollector.
+func NewDiskUsageCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	diskUsageCollectorEnabled bool,
+) processors.Processor {
+	return &diskUsageCollector{
+		Context:                   ctx,
+		Logger:                    logger,
+		diskUsageCollectorEnabled: diskUsageCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for filesystem usage information.
+func (dc *diskUsageCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !dc.diskUsageCollectorEnabled {
+		http.Error(w, fmt.Sprintf("disk usage collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		filesystemUsages, err := dc.listFilesystemUsages()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to list filesystem usages: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		raw, err := json.Marshal(filesystemUsages)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal filesystem usages: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyFilesystemUsageList] = string(raw)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// listFilesystemUsages enumerates mount points of the node and reports bytes and inode usage of each
+// mounted filesystem. Pseudo filesystems without blocks are omitted from the result.
+func (dc *diskUsageCollector) listFilesystemUsages() ([]types.FilesystemUsage, error) {
+	dc.Info("listing filesystem usages")
+
+	mountPoints, err := listMountPoints()
+	if err != nil {
+		return nil, err
+	}
+
+	filesystemUsages := make([]types.FilesystemUsage, 0, len(mountPoints))
+	for _, mountPoint := range mountPoints {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(mountPoint, &stat); err != nil {
+			dc.Error(err, fmt.Sprintf("unable to get filesystem statistics of %s", mountPoint))
+			continue
+		}
+
+		// Skip pseudo filesystems which do not have blocks.
+		if stat.Blocks == 0 {
+			continue
+		}
+
+		filesystemUsage := types.FilesystemUsage{
+			MountPoint:     mountPoint,
+			TotalBytes:     stat.Blocks * uint64(stat.Bsize),
+			FreeBytes:      stat.Bfree * uint64(stat.Bsize),
+			AvailableBytes: stat.Bavail * uint64(stat.Bsize),
+			UsedBytes:      (stat.Blocks - stat.Bfree) * uint64(stat.Bsize),
+			TotalInodes:    stat.Files,
+			FreeInodes:     stat.Ffree,
+			UsedInodes:     stat.Files - stat.Ffree,
+		}
+		filesystemUsages = append(filesystemUsages, filesystemUsage)
+	}
+
+	return filesystemUsages, nil
+}
+
+// listMountPoints enumerates mount points of the node by parsing mountinfo file.
+func listMountPoints() ([]string, error) {
+	mountInfoData, err := ioutil.ReadFile(mountinfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mountinfo file %s: %v", mountinfoPath, err)
+	}
+
+	mountPointSet := make(map[string]struct{})
+	mountPoints := make([]string, 0)
+	for _, line := range strings.Split(string(mountInfoData), "\n") {
+		// The mount point is the fifth field of a mountinfo entry.
+		// See proc(5) linux manual page for more details.
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+
+		mountPoint := fields[4]
+		if _, ok := mountPointSet[mountPoint]; ok {
+			continue
+		}
+		mountPointSet[mountPoint] = struct{}{}
+		mountPoints = append(mountPoints, mountPoint)
+	}
+
+	return mountPoints, nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyDmesgFilter = "param.collector.system.dmesg.filter"
+
+	ContextKeyDmesgLog = "collector.system.dmesg.log"
+)
+
+// dmesgCollector retrieves messages from the kernel ring buffer on the node.
+type dmesgCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// dmesgCollectorEnabled indicates whether dmesgCollector is enabled.
+	dmesgCollectorEnabled bool
+}
+
+// NewDmesgCollector creates a new dmesgCollector.
+func NewDmesgCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	dmesgCollectorEnabled bool,
+) processors.Processor {
+	return &dmesgCollector{
+		Context:               ctx,
+		Logger:                logger,
+		dmesgCollectorEnabled: dmesgCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for kernel ring buffer messages.
+func (dc *dmesgCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !dc.dmesgCollectorEnabled {
+		http.Error(w, fmt.Sprintf("dmesg collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			dc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var filter *regexp.Regexp
+		if value, ok := contexts[ParameterKeyDmesgFilter]; ok {
+			filter, err = regexp.Compile(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid dmesg filter %s: %v", value, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		log, err := dc.collectDmesgLog(filter)
+		if err != nil {
+			// The kernel ring buffer is not readable typically due to insufficient permissions.
+			http.Error(w, fmt.Sprintf("failed to read kernel ring buffer: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyDmesgLog] = log
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// collectDmesgLog reads the kernel ring buffer by executing "dmesg" command. Messages are filtered by
+// the regular expression if a filter is specified.
+func (dc *dmesgCollector) collectDmesgLog(filter *regexp.Regexp) (string, error) {
+	dc.Info("collecting kernel ring buffer messages", "filter", filter)
+
+	out, err := util.BlockingRunCommandWithTimeout([]string{"dmesg", "--ctime"}, processors.DefaultTimeoutSeconds)
+	if err != nil {
+		return "", fmt.Errorf("execute command dmesg with error %v: %s", err, string(out))
+	}
+
+	if filter == nil {
+		return string(out), nil
+	}
+
+	matched := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if filter.MatchString(line) {
+			matched = append(matched, line)
+		}
+	}
+
+	return strings.Join(matched, "\n"), nil
+}
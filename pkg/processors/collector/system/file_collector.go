@@ -0,0 +1,220 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyFileCollectorPaths = "param.collector.system.file.paths"
+
+	ContextKeyFileCollectorFiles   = "collector.system.file.files"
+	ContextKeyFileCollectorSkipped = "collector.system.file.skipped"
+
+	// maxFileCollectorFileBytes caps the size of one collected file to stay under the context
+	// size limit. Files beyond the cap are truncated.
+	maxFileCollectorFileBytes = 256 * 1024
+)
+
+// collectedFile contains the content of one file read from the node.
+type collectedFile struct {
+	// Path is the path of the file on the node.
+	Path string `json:"path"`
+	// Content is the content of the file, truncated at the size cap.
+	Content string `json:"content"`
+	// Truncated indicates whether the content has been truncated.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// skippedFile reports a file which has not been collected along with the reason.
+type skippedFile struct {
+	// Path is the path of the file on the node.
+	Path string `json:"path"`
+	// Reason is the reason the file has not been collected.
+	Reason string `json:"reason"`
+}
+
+// fileCollector reads specified files from the node into the diagnosis context. Only files
+// under the allow-listed path prefixes configured by the operator are read to prevent
+// exfiltration of secrets. Disallowed or unreadable paths are reported as skipped with a
+// reason.
+type fileCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// allowedPathPrefixes is the list of path prefixes files may be collected from.
+	allowedPathPrefixes []string
+	// fileCollectorEnabled indicates whether fileCollector is enabled.
+	fileCollectorEnabled bool
+}
+
+// NewFileCollector creates a new fileCollector.
+func NewFileCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	allowedPathPrefixes []string,
+	fileCollectorEnabled bool,
+) processors.Processor {
+	return &fileCollector{
+		Context:              ctx,
+		Logger:               logger,
+		allowedPathPrefixes:  allowedPathPrefixes,
+		fileCollectorEnabled: fileCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for file contents on the node.
+func (fc *fileCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !fc.fileCollectorEnabled {
+		http.Error(w, fmt.Sprintf("file collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			fc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if contexts[ParameterKeyFileCollectorPaths] == "" {
+			http.Error(w, fmt.Sprintf("must specify %s", ParameterKeyFileCollectorPaths), http.StatusNotAcceptable)
+			return
+		}
+		paths := strings.Split(contexts[ParameterKeyFileCollectorPaths], ",")
+
+		files := make([]collectedFile, 0, len(paths))
+		skipped := make([]skippedFile, 0)
+		for _, path := range paths {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+
+			file, reason := fc.collectFile(path)
+			if reason != "" {
+				skipped = append(skipped, skippedFile{
+					Path:   path,
+					Reason: reason,
+				})
+				continue
+			}
+			files = append(files, file)
+		}
+
+		result := make(map[string]string)
+		filesData, err := json.Marshal(files)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal collected files: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeyFileCollectorFiles] = string(filesData)
+		skippedData, err := json.Marshal(skipped)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal skipped files: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeyFileCollectorSkipped] = string(skippedData)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// collectFile reads the file at the specified path subject to the allow-list and the size cap.
+// It returns a non empty reason instead of the file if the path is disallowed or unreadable.
+func (fc *fileCollector) collectFile(path string) (collectedFile, string) {
+	if !fc.pathAllowed(path) {
+		fc.Info("skipping file not in allow-list", "path", path, "allowedPathPrefixes", fc.allowedPathPrefixes)
+		return collectedFile{}, fmt.Sprintf("path is not under any allowed path prefix %v", fc.allowedPathPrefixes)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return collectedFile{}, fmt.Sprintf("failed to stat file: %v", err)
+	}
+	if info.IsDir() {
+		return collectedFile{}, "path is a directory"
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return collectedFile{}, fmt.Sprintf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	// Read one byte over the cap to detect truncation.
+	content := make([]byte, maxFileCollectorFileBytes+1)
+	length, err := io.ReadFull(file, content)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return collectedFile{}, fmt.Sprintf("failed to read file: %v", err)
+	}
+
+	truncated := false
+	if length > maxFileCollectorFileBytes {
+		length = maxFileCollectorFileBytes
+		truncated = true
+	}
+
+	return collectedFile{
+		Path:      path,
+		Content:   string(content[:length]),
+		Truncated: truncated,
+	}, ""
+}
+
+// pathAllowed reports whether the cleaned path is under one of the allowed path prefixes. The
+// path is cleaned before matching so the allow-list can not be escaped with path traversal.
+func (fc *fileCollector) pathAllowed(path string) bool {
+	cleaned := filepath.Clean(path)
+	if !filepath.IsAbs(cleaned) {
+		return false
+	}
+
+	for _, prefix := range fc.allowedPathPrefixes {
+		prefix = filepath.Clean(prefix)
+		if cleaned == prefix || strings.HasPrefix(cleaned, prefix+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyIptablesTables = "param.collector.system.iptables.tables"
+	ParameterKeyIptablesFilter = "param.collector.system.iptables.filter"
+
+	ContextKeyIptablesRules     = "collector.system.iptables.rules"
+	ContextKeyIptablesBackend   = "collector.system.iptables.backend"
+	ContextKeyIptablesTruncated = "collector.system.iptables.truncated"
+
+	// defaultIptablesTables are the tables dumped if not specified. Network policy and kube-proxy
+	// issues almost always involve the nat and filter tables.
+	defaultIptablesTables = "nat,filter"
+	// iptablesCommandTimeoutSeconds is the timeout of one rule dump command in seconds.
+	iptablesCommandTimeoutSeconds = 30
+	// maxIptablesRulesBytes caps the size of the collected rules to stay under the context size
+	// limit. Rules beyond the cap are truncated with a notice.
+	maxIptablesRulesBytes = 512 * 1024
+	// iptablesTruncationNotice marks a truncated rule dump.
+	iptablesTruncationNotice = "... rules truncated by iptables collector ..."
+)
+
+// iptablesCollector dumps iptables or nftables rules on the node into the diagnosis context.
+// The nft ruleset is dumped if the nft backend is in use and the legacy iptables tables are
+// dumped otherwise. The dump can be filtered by a string such as a service or cluster ip.
+type iptablesCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// iptablesCollectorEnabled indicates whether iptablesCollector is enabled.
+	iptablesCollectorEnabled bool
+}
+
+// NewIptablesCollector creates a new iptablesCollector.
+func NewIptablesCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	iptablesCollectorEnabled bool,
+) processors.Processor {
+	return &iptablesCollector{
+		Context:                  ctx,
+		Logger:                   logger,
+		iptablesCollectorEnabled: iptablesCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for iptables or nftables rules on the node.
+func (ic *iptablesCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !ic.iptablesCollectorEnabled {
+		http.Error(w, fmt.Sprintf("iptables collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			ic.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tables := defaultIptablesTables
+		if value, ok := contexts[ParameterKeyIptablesTables]; ok && value != "" {
+			tables = value
+		}
+		filter := contexts[ParameterKeyIptablesFilter]
+
+		rules, backend, err := ic.collectRules(strings.Split(tables, ","))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to collect rules: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if filter != "" {
+			rules = filterRuleLines(rules, filter)
+		}
+		truncated := false
+		if len(rules) > maxIptablesRulesBytes {
+			rules = rules[:maxIptablesRulesBytes] + "\n" + iptablesTruncationNotice
+			truncated = true
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyIptablesRules] = rules
+		result[ContextKeyIptablesBackend] = backend
+		result[ContextKeyIptablesTruncated] = fmt.Sprintf("%t", truncated)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// collectRules dumps the rules of the specified tables and reports the backend in use. The nft
+// ruleset is authoritative if the node uses the nft backend, where per table iptables-save output
+// only shows a translated subset.
+func (ic *iptablesCollector) collectRules(tables []string) (string, string, error) {
+	ic.Info("collecting iptables rules", "tables", tables)
+
+	// The nft backend is detected by listing the nftables ruleset. The legacy backend is assumed
+	// if the nft command is unavailable or the ruleset is empty.
+	out, err := util.BlockingRunCommandWithTimeout([]string{"nft", "list", "ruleset"}, iptablesCommandTimeoutSeconds)
+	if err == nil && strings.TrimSpace(string(out)) != "" {
+		return string(out), "nft", nil
+	}
+
+	dumps := make([]string, 0, len(tables))
+	for _, table := range tables {
+		table = strings.TrimSpace(table)
+		if table == "" {
+			continue
+		}
+		out, err := util.BlockingRunCommandWithTimeout([]string{"iptables-save", "-t", table}, iptablesCommandTimeoutSeconds)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to dump iptables table %s: %v", table, err)
+		}
+		dumps = append(dumps, string(out))
+	}
+
+	return strings.Join(dumps, "\n"), "legacy", nil
+}
+
+// filterRuleLines keeps the lines containing the filter string along with table and chain
+// declarations so the filtered dump stays loadable in context.
+func filterRuleLines(rules string, filter string) string {
+	lines := strings.Split(rules, "\n")
+	filtered := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.HasPrefix(line, "*") || strings.HasPrefix(line, ":") || strings.Contains(line, filter) {
+			filtered = append(filtered, line)
+		}
+	}
+
+	return strings.Join(filtered, "\n")
+}
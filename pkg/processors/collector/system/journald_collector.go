@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyJournaldLookback = "param.collector.system.journald.lookback"
+	ParameterKeyJournaldUnit     = "param.collector.system.journald.unit"
+
+	ContextKeyJournaldLog = "collector.system.journald.log"
+
+	// defaultJournaldLookback is the default lookback window of journal entries to collect.
+	defaultJournaldLookback = 10 * time.Minute
+)
+
+// journaldCollector retrieves journal entries from systemd journal on the node.
+type journaldCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// journaldCollectorEnabled indicates whether journaldCollector is enabled.
+	journaldCollectorEnabled bool
+}
+
+// NewJournaldCollector creates a new journaldCollector.
+func NewJournaldCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	journaldCollectorEnabled bool,
+) processors.Processor {
+	return &journaldCollector{
+		Context:                  ctx,
+		Logger:                   logger,
+		journaldCollectorEnabled: journaldCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for journal entries.
+func (jc *journaldCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !jc.journaldCollectorEnabled {
+		http.Error(w, fmt.Sprintf("journald collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			jc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		lookback := defaultJournaldLookback
+		if value, ok := contexts[ParameterKeyJournaldLookback]; ok {
+			lookback, err = time.ParseDuration(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid journald lookback %s: %v", value, err), http.StatusBadRequest)
+				return
+			}
+		}
+		unit := contexts[ParameterKeyJournaldUnit]
+
+		log, err := jc.collectJournalLog(lookback, unit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read systemd journal: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyJournaldLog] = log
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// collectJournalLog reads journal entries in the lookback window by executing "journalctl" command.
+// Entries are filtered by systemd unit if a unit is specified.
+func (jc *journaldCollector) collectJournalLog(lookback time.Duration, unit string) (string, error) {
+	jc.Info("collecting journal entries", "lookback", lookback, "unit", unit)
+
+	since := time.Now().Add(-lookback).Format("2006-01-02 15:04:05")
+	command := []string{"journalctl", "--no-pager", "--output", "short-iso", "--since", since}
+	if unit != "" {
+		command = append(command, "--unit", unit)
+	}
+
+	out, err := util.BlockingRunCommandWithTimeout(command, processors.DefaultTimeoutSeconds)
+	if err != nil {
+		return "", fmt.Errorf("execute command journalctl with error %v: %s", err, string(out))
+	}
+
+	return string(out), nil
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+)
+
+const (
+	ContextKeyKernelStateTainted    = "collector.system.kernel_state.tainted"
+	ContextKeyKernelStateTaintFlags = "collector.system.kernel_state.taint_flags"
+	ContextKeyKernelStateModules    = "collector.system.kernel_state.modules"
+
+	// kernelTaintedFile is the procfs file containing the kernel taint bitmask.
+	kernelTaintedFile = "/proc/sys/kernel/tainted"
+	// kernelModulesFile is the procfs file containing the loaded kernel modules.
+	kernelModulesFile = "/proc/modules"
+)
+
+// kernelTaintFlagDescriptions maps each kernel taint bit to a human readable description. The
+// meanings are documented in the kernel admin guide on tainted kernels.
+var kernelTaintFlagDescriptions = []string{
+	"proprietary module was loaded",
+	"module was force loaded",
+	"kernel running on an out of specification system",
+	"module was force unloaded",
+	"processor reported a machine check exception",
+	"bad page referenced or some unexpected page flags",
+	"taint requested by userspace application",
+	"kernel died recently",
+	"acpi table overridden by user",
+	"kernel issued warning",
+	"staging driver was loaded",
+	"workaround for bug in platform firmware applied",
+	"externally built module was loaded",
+	"unsigned module was loaded",
+	"soft lockup occurred",
+	"kernel has been live patched",
+	"auxiliary taint",
+	"kernel was built with the struct randomization plugin",
+	"an in-kernel test has been run",
+}
+
+// kernelModule is one loaded kernel module as reported in procfs.
+type kernelModule struct {
+	// Name is the name of the module.
+	Name string `json:"name"`
+	// Size is the memory size of the module in bytes.
+	Size uint64 `json:"size"`
+	// Instances is the number of instances of the module currently loaded.
+	Instances int `json:"instances"`
+	// UsedBy holds the modules depending on this module.
+	UsedBy []string `json:"usedBy,omitempty"`
+}
+
+// kernelStateCollector reads the kernel taint bitmask and the loaded kernel modules on the node
+// from procfs. A tainted kernel or an unexpected out of tree module is a fact worth surfacing
+// before blaming a workload for node level misbehavior.
+type kernelStateCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// kernelStateCollectorEnabled indicates whether kernelStateCollector is enabled.
+	kernelStateCollectorEnabled bool
+}
+
+// NewKernelStateCollector creates a new kernelStateCollector.
+func NewKernelStateCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	kernelStateCollectorEnabled bool,
+) processors.Processor {
+	return &kernelStateCollector{
+		Context:                     ctx,
+		Logger:                      logger,
+		kernelStateCollectorEnabled: kernelStateCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for kernel taint state and loaded modules.
+func (kc *kernelStateCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !kc.kernelStateCollectorEnabled {
+		http.Error(w, fmt.Sprintf("kernel state collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		kc.Info("collecting kernel state")
+
+		tainted, flags, err := readKernelTaintState()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read kernel taint state: %v", err), http.StatusInternalServerError)
+			return
+		}
+		modules, err := readKernelModules()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read kernel modules: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		rawFlags, err := json.Marshal(flags)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal kernel taint flags: %v", err), http.StatusInternalServerError)
+			return
+		}
+		rawModules, err := json.Marshal(modules)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal kernel modules: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyKernelStateTainted] = strconv.FormatUint(tainted, 10)
+		result[ContextKeyKernelStateTaintFlags] = string(rawFlags)
+		result[ContextKeyKernelStateModules] = string(rawModules)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// readKernelTaintState reads the kernel taint bitmask from procfs and decodes the set bits into
+// human readable descriptions.
+func readKernelTaintState() (uint64, []string, error) {
+	content, err := ioutil.ReadFile(kernelTaintedFile)
+	if err != nil {
+		return 0, nil, err
+	}
+	tainted, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("malformed kernel taint bitmask %q: %v", strings.TrimSpace(string(content)), err)
+	}
+
+	flags := make([]string, 0)
+	for bit := 0; bit < 64; bit++ {
+		if tainted&(1<<uint(bit)) == 0 {
+			continue
+		}
+		if bit < len(kernelTaintFlagDescriptions) {
+			flags = append(flags, kernelTaintFlagDescriptions[bit])
+		} else {
+			flags = append(flags, fmt.Sprintf("unknown taint bit %d", bit))
+		}
+	}
+
+	return tainted, flags, nil
+}
+
+// readKernelModules parses the loaded kernel modules from procfs.
+func readKernelModules() ([]kernelModule, error) {
+	content, err := ioutil.ReadFile(kernelModulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make([]kernelModule, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		// A line contains the module name, memory size, instance count, dependent modules,
+		// state and memory offset.
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		size, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		instances, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+
+		module := kernelModule{
+			Name:      fields[0],
+			Size:      size,
+			Instances: instances,
+		}
+		if fields[3] != "-" {
+			for _, dependent := range strings.Split(strings.TrimRight(fields[3], ","), ",") {
+				if dependent != "" {
+					module.UsedBy = append(module.UsedBy, dependent)
+				}
+			}
+		}
+		modules = append(modules, module)
+	}
+
+	return modules, nil
+}
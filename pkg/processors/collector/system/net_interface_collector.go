@@ -0,0 +1,237 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyNetInterfaceSampleIntervalSeconds = "param.collector.system.net_interface.sample_interval_seconds"
+
+	ContextKeyNetInterfaceStats = "collector.system.net_interface.stats"
+
+	// netInterfaceProcNetDev is the procfs file containing network interface statistics.
+	netInterfaceProcNetDev = "/proc/net/dev"
+	// maxNetInterfaceSampleIntervalSeconds is the maximum interval in seconds between the two
+	// samples taken to compute rates.
+	maxNetInterfaceSampleIntervalSeconds = 60
+)
+
+// netInterfaceStats holds the statistics of one network interface. Rates are computed from two
+// samples if a sample interval is specified.
+type netInterfaceStats struct {
+	// Name is the name of the interface.
+	Name string `json:"name"`
+	// RxBytes is the total number of received bytes.
+	RxBytes uint64 `json:"rxBytes"`
+	// RxErrors is the total number of receive errors.
+	RxErrors uint64 `json:"rxErrors"`
+	// RxDropped is the total number of dropped incoming packets.
+	RxDropped uint64 `json:"rxDropped"`
+	// TxBytes is the total number of transmitted bytes.
+	TxBytes uint64 `json:"txBytes"`
+	// TxErrors is the total number of transmit errors.
+	TxErrors uint64 `json:"txErrors"`
+	// TxDropped is the total number of dropped outgoing packets.
+	TxDropped uint64 `json:"txDropped"`
+	// RxBytesPerSecond is the receive rate over the sample interval.
+	RxBytesPerSecond uint64 `json:"rxBytesPerSecond,omitempty"`
+	// TxBytesPerSecond is the transmit rate over the sample interval.
+	TxBytesPerSecond uint64 `json:"txBytesPerSecond,omitempty"`
+	// RxDroppedDelta is the number of incoming packets dropped during the sample interval.
+	RxDroppedDelta uint64 `json:"rxDroppedDelta,omitempty"`
+	// TxDroppedDelta is the number of outgoing packets dropped during the sample interval.
+	TxDroppedDelta uint64 `json:"txDroppedDelta,omitempty"`
+	// RxErrorsDelta is the number of receive errors during the sample interval.
+	RxErrorsDelta uint64 `json:"rxErrorsDelta,omitempty"`
+	// TxErrorsDelta is the number of transmit errors during the sample interval.
+	TxErrorsDelta uint64 `json:"txErrorsDelta,omitempty"`
+}
+
+// netInterfaceCollector reads rx and tx bytes, errors and drops per network interface on the node
+// from procfs. Growing drop and error counters are a common root cause of pod network flakiness.
+// Two samples are taken to compute deltas and rates if a sample interval is specified.
+type netInterfaceCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// netInterfaceCollectorEnabled indicates whether netInterfaceCollector is enabled.
+	netInterfaceCollectorEnabled bool
+}
+
+// NewNetInterfaceCollector creates a new netInterfaceCollector.
+func NewNetInterfaceCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	netInterfaceCollectorEnabled bool,
+) processors.Processor {
+	return &netInterfaceCollector{
+		Context:                      ctx,
+		Logger:                       logger,
+		netInterfaceCollectorEnabled: netInterfaceCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for network interface statistics.
+func (nc *netInterfaceCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !nc.netInterfaceCollectorEnabled {
+		http.Error(w, fmt.Sprintf("net interface collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			nc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sampleIntervalSeconds := 0
+		if value, ok := contexts[ParameterKeyNetInterfaceSampleIntervalSeconds]; ok && value != "" {
+			sampleIntervalSeconds, err = strconv.Atoi(value)
+			if err != nil || sampleIntervalSeconds < 0 || sampleIntervalSeconds > maxNetInterfaceSampleIntervalSeconds {
+				http.Error(w, fmt.Sprintf("invalid sample interval seconds %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		stats, err := nc.collectNetInterfaceStats(time.Duration(sampleIntervalSeconds) * time.Second)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to collect network interface statistics: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		raw, err := json.Marshal(stats)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal network interface statistics: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyNetInterfaceStats] = string(raw)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// collectNetInterfaceStats reads interface statistics from procfs. A second sample is taken after
+// the sample interval to compute deltas and rates if the interval is not zero.
+func (nc *netInterfaceCollector) collectNetInterfaceStats(sampleInterval time.Duration) ([]netInterfaceStats, error) {
+	nc.Info("collecting network interface statistics")
+
+	first, err := readProcNetDev()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]netInterfaceStats, 0, len(first))
+	if sampleInterval > 0 {
+		time.Sleep(sampleInterval)
+		second, err := readProcNetDev()
+		if err != nil {
+			return nil, err
+		}
+		seconds := uint64(sampleInterval / time.Second)
+		for _, current := range second {
+			previous, ok := first[current.Name]
+			if ok {
+				current.RxBytesPerSecond = (current.RxBytes - previous.RxBytes) / seconds
+				current.TxBytesPerSecond = (current.TxBytes - previous.TxBytes) / seconds
+				current.RxDroppedDelta = current.RxDropped - previous.RxDropped
+				current.TxDroppedDelta = current.TxDropped - previous.TxDropped
+				current.RxErrorsDelta = current.RxErrors - previous.RxErrors
+				current.TxErrorsDelta = current.TxErrors - previous.TxErrors
+			}
+			stats = append(stats, current)
+		}
+	} else {
+		for _, current := range first {
+			stats = append(stats, current)
+		}
+	}
+
+	return stats, nil
+}
+
+// readProcNetDev parses network interface statistics from /proc/net/dev keyed by interface name.
+func readProcNetDev() (map[string]netInterfaceStats, error) {
+	content, err := ioutil.ReadFile(netInterfaceProcNetDev)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]netInterfaceStats)
+	for _, line := range strings.Split(string(content), "\n") {
+		// A statistics line contains the interface name terminated by a colon followed by 16
+		// counter fields. The first two lines are headers.
+		index := strings.Index(line, ":")
+		if index == -1 {
+			continue
+		}
+		name := strings.TrimSpace(line[:index])
+		fields := strings.Fields(line[index+1:])
+		if name == "" || len(fields) < 12 {
+			continue
+		}
+
+		values := make([]uint64, len(fields))
+		for i, field := range fields {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				continue
+			}
+			values[i] = value
+		}
+
+		stats[name] = netInterfaceStats{
+			Name:      name,
+			RxBytes:   values[0],
+			RxErrors:  values[2],
+			RxDropped: values[3],
+			TxBytes:   values[8],
+			TxErrors:  values[10],
+			TxDropped: values[11],
+		}
+	}
+
+	return stats, nil
+}
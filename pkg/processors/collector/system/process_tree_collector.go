@@ -0,0 +1,350 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/go-logr/logr"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyProcessTreeRootPID = "param.collector.system.process_tree.root_pid"
+
+	ContextKeyProcessTree             = "collector.system.process_tree"
+	ContextKeyProcessTreeZombieCount  = "collector.system.process_tree.zombie_count"
+	ContextKeyProcessTreeProcessCount = "collector.system.process_tree.process_count"
+
+	// processTreeProcfsRoot is the mount point of procfs.
+	processTreeProcfsRoot = "/proc"
+
+	// Docker labels which identify the pod and container a docker container belongs to.
+	processTreePodNamespaceDockerLabel  = "io.kubernetes.pod.namespace"
+	processTreePodNameDockerLabel       = "io.kubernetes.pod.name"
+	processTreeContainerNameDockerLabel = "io.kubernetes.container.name"
+	processTreePauseContainerName       = "POD"
+)
+
+// processTreeNode is one process in the process tree. Zombie counts are aggregated per subtree so
+// that a parent accumulating zombie children can be spotted without walking the tree manually.
+type processTreeNode struct {
+	// PID is the process id of the process.
+	PID int32 `json:"pid"`
+	// PPID is the process id of the parent process.
+	PPID int32 `json:"ppid"`
+	// Command is the command line of the process, or the comm value for kernel threads.
+	Command string `json:"command"`
+	// Status is the state of the process as reported in its stat file.
+	Status string `json:"status"`
+	// ZombiesInSubtree is the number of zombie processes in the subtree rooted at this process,
+	// including the process itself.
+	ZombiesInSubtree int `json:"zombiesInSubtree"`
+	// Children holds the child processes ordered by pid.
+	Children []*processTreeNode `json:"children,omitempty"`
+}
+
+// processTreeCollector builds a parent child tree of processes on the node from ppid relationships
+// in procfs. The structured tree supports diagnosing fork bombs and parents accumulating zombie
+// children which a flat process list does not expose. The tree is scoped to the pid namespace of
+// the target container if a pod reference is provided, or of the root pid parameter.
+type processTreeCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client is the API client that performs all operations against a docker server.
+	client *dockerclient.Client
+	// processTreeCollectorEnabled indicates whether processTreeCollector is enabled.
+	processTreeCollectorEnabled bool
+}
+
+// NewProcessTreeCollector creates a new processTreeCollector.
+func NewProcessTreeCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	dockerEndpoint string,
+	processTreeCollectorEnabled bool,
+) (processors.Processor, error) {
+	cli, err := dockerclient.NewClientWithOpts(dockerclient.WithHost(dockerEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return &processTreeCollector{
+		Context:                     ctx,
+		Logger:                      logger,
+		client:                      cli,
+		processTreeCollectorEnabled: processTreeCollectorEnabled,
+	}, nil
+}
+
+// Handler handles http requests for the process tree on the node.
+func (pt *processTreeCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !pt.processTreeCollectorEnabled {
+		http.Error(w, fmt.Sprintf("process tree collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			pt.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The tree is scoped to the pid namespace of the root pid if specified, or of the target
+		// container if a pod reference is provided. The whole node is collected otherwise.
+		rootPID := 0
+		if value, ok := contexts[ParameterKeyProcessTreeRootPID]; ok && value != "" {
+			rootPID, err = strconv.Atoi(value)
+			if err != nil || rootPID <= 0 {
+				http.Error(w, fmt.Sprintf("invalid root pid %s", value), http.StatusBadRequest)
+				return
+			}
+		} else if podReference := utils.GetPodInfoFromContext(contexts); podReference.Namespace != "" && podReference.Name != "" {
+			rootPID, err = pt.getContainerPID(podReference)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to resolve container pid: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		roots, err := pt.buildProcessTree(rootPID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to build process tree: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		zombieCount := 0
+		processCount := 0
+		for _, root := range roots {
+			zombieCount += root.ZombiesInSubtree
+			processCount += countProcessTreeNodes(root)
+		}
+		raw, err := json.Marshal(roots)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal process tree: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyProcessTree] = string(raw)
+		result[ContextKeyProcessTreeZombieCount] = strconv.Itoa(zombieCount)
+		result[ContextKeyProcessTreeProcessCount] = strconv.Itoa(processCount)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// getContainerPID resolves the pid of the target container on the node by inspecting containers
+// of the pod. The first container which is not the pod sandbox is picked if the container name is
+// not specified in the pod reference.
+func (pt *processTreeCollector) getContainerPID(podReference diagnosisv1.PodReference) (int, error) {
+	containers, err := pt.client.ContainerList(pt, dockertypes.ContainerListOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, container := range containers {
+		if container.Labels[processTreePodNamespaceDockerLabel] != podReference.Namespace ||
+			container.Labels[processTreePodNameDockerLabel] != podReference.Name {
+			continue
+		}
+		if container.Labels[processTreeContainerNameDockerLabel] == processTreePauseContainerName {
+			continue
+		}
+		if podReference.Container != "" && container.Labels[processTreeContainerNameDockerLabel] != podReference.Container {
+			continue
+		}
+
+		containerJSON, err := pt.client.ContainerInspect(pt, container.ID)
+		if err != nil {
+			return 0, err
+		}
+		if containerJSON.State == nil || containerJSON.State.Pid == 0 {
+			return 0, fmt.Errorf("container %s of pod %s/%s is not running", container.Labels[processTreeContainerNameDockerLabel], podReference.Namespace, podReference.Name)
+		}
+
+		return containerJSON.State.Pid, nil
+	}
+
+	return 0, fmt.Errorf("container of pod %s/%s not found on the node", podReference.Namespace, podReference.Name)
+}
+
+// buildProcessTree builds the process tree from ppid relationships in procfs. Processes outside the
+// pid namespace of the root pid are excluded if a root pid is provided. Processes whose parent is
+// not included become roots of their own subtree.
+func (pt *processTreeCollector) buildProcessTree(rootPID int) ([]*processTreeNode, error) {
+	pt.Info("building process tree")
+
+	// The pid namespace of the root pid restricts the collected processes.
+	pidNamespace := ""
+	if rootPID != 0 {
+		link, err := os.Readlink(fmt.Sprintf("%s/%d/ns/pid", processTreeProcfsRoot, rootPID))
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve pid namespace of %d: %v", rootPID, err)
+		}
+		pidNamespace = link
+	}
+
+	entries, err := ioutil.ReadDir(processTreeProcfsRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int32]*processTreeNode)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if pidNamespace != "" {
+			link, err := os.Readlink(fmt.Sprintf("%s/%d/ns/pid", processTreeProcfsRoot, pid))
+			if err != nil || link != pidNamespace {
+				continue
+			}
+		}
+
+		node, err := readProcessTreeNode(int32(pid))
+		if err != nil {
+			// The process may have exited between listing and reading.
+			continue
+		}
+		nodes[node.PID] = node
+	}
+
+	// Attach each process to its parent. A process whose parent is not included becomes a root.
+	roots := make([]*processTreeNode, 0)
+	for _, node := range nodes {
+		if parent, ok := nodes[node.PPID]; ok && parent != node {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	for _, node := range nodes {
+		sort.Slice(node.Children, func(i, j int) bool {
+			return node.Children[i].PID < node.Children[j].PID
+		})
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].PID < roots[j].PID
+	})
+	for _, root := range roots {
+		countZombiesInSubtree(root)
+	}
+
+	return roots, nil
+}
+
+// readProcessTreeNode reads pid, ppid, state and command line of a process from procfs.
+func readProcessTreeNode(pid int32) (*processTreeNode, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%d/stat", processTreeProcfsRoot, pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// The comm field is enclosed in parentheses and may contain spaces. Fields after the last
+	// closing parenthesis are state and ppid.
+	stat := string(data)
+	index := strings.LastIndex(stat, ")")
+	if index == -1 {
+		return nil, fmt.Errorf("malformed stat file of process %d", pid)
+	}
+	fields := strings.Fields(stat[index+1:])
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("malformed stat file of process %d", pid)
+	}
+	status := fields[0]
+	ppid, err := strconv.ParseInt(fields[1], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	// The command line is empty for kernel threads and zombies. The comm value is taken instead.
+	command := ""
+	if cmdline, err := ioutil.ReadFile(fmt.Sprintf("%s/%d/cmdline", processTreeProcfsRoot, pid)); err == nil {
+		command = strings.TrimRight(strings.ReplaceAll(string(cmdline), "\x00", " "), " ")
+	}
+	if command == "" {
+		start := strings.Index(stat, "(")
+		if start != -1 && start < index {
+			command = fmt.Sprintf("[%s]", stat[start+1:index])
+		}
+	}
+
+	return &processTreeNode{
+		PID:     pid,
+		PPID:    int32(ppid),
+		Command: command,
+		Status:  status,
+	}, nil
+}
+
+// countZombiesInSubtree computes the number of zombie processes in the subtree rooted at the node,
+// including the node itself.
+func countZombiesInSubtree(node *processTreeNode) int {
+	count := 0
+	if node.Status == "Z" {
+		count++
+	}
+	for _, child := range node.Children {
+		count += countZombiesInSubtree(child)
+	}
+	node.ZombiesInSubtree = count
+
+	return count
+}
+
+// countProcessTreeNodes computes the number of processes in the subtree rooted at the node,
+// including the node itself.
+func countProcessTreeNodes(node *processTreeNode) int {
+	count := 1
+	for _, child := range node.Children {
+		count += countProcessTreeNodes(child)
+	}
+
+	return count
+}
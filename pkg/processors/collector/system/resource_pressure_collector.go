@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+)
+
+const (
+	ContextKeyMemInfo             = "collector.system.pressure.meminfo"
+	ContextKeyLoadAvg             = "collector.system.pressure.loadavg"
+	ContextKeyPSICPU              = "collector.system.pressure.psi.cpu"
+	ContextKeyPSIMemory           = "collector.system.pressure.psi.memory"
+	ContextKeyPSIIO               = "collector.system.pressure.psi.io"
+	ContextKeyPressureMissingKeys = "collector.system.pressure.missing"
+
+	meminfoPath   = "/proc/meminfo"
+	loadavgPath   = "/proc/loadavg"
+	psiCPUPath    = "/proc/pressure/cpu"
+	psiMemoryPath = "/proc/pressure/memory"
+	psiIOPath     = "/proc/pressure/io"
+)
+
+// resourcePressureCollector reports memory, load and pressure stall information of the node.
+type resourcePressureCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// resourcePressureCollectorEnabled indicates whether resourcePressureCollector is enabled.
+	resourcePressureCollectorEnabled bool
+}
+
+// NewResourcePressureCollector creates a new resourcePressureCollector.
+func NewResourcePressureCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	resourcePressureCollectorEnabled bool,
+) processors.Processor {
+	return &resourcePressureCollector{
+		Context:                          ctx,
+		Logger:                           logger,
+		resourcePressureCollectorEnabled: resourcePressureCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for resource pressure information.
+func (rc *resourcePressureCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !rc.resourcePressureCollectorEnabled {
+		http.Error(w, fmt.Sprintf("resource pressure collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		rc.Info("collecting resource pressure information")
+
+		// Pressure stall information files may not exist on older kernels. Sections which could not be
+		// read are noted in the result instead of failing the whole request.
+		sections := []struct {
+			key  string
+			path string
+		}{
+			{ContextKeyMemInfo, meminfoPath},
+			{ContextKeyLoadAvg, loadavgPath},
+			{ContextKeyPSICPU, psiCPUPath},
+			{ContextKeyPSIMemory, psiMemoryPath},
+			{ContextKeyPSIIO, psiIOPath},
+		}
+
+		result := make(map[string]string)
+		missing := make([]string, 0)
+		for _, section := range sections {
+			raw, err := ioutil.ReadFile(section.path)
+			if err != nil {
+				rc.Error(err, fmt.Sprintf("unable to read %s", section.path))
+				missing = append(missing, section.path)
+				continue
+			}
+			result[section.key] = string(raw)
+		}
+		if len(missing) != 0 {
+			result[ContextKeyPressureMissingKeys] = strings.Join(missing, ",")
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeySMARTDevices = "param.collector.system.smart.devices"
+
+	ContextKeySMARTDevices = "collector.system.smart.devices"
+
+	// smartctlCommandTimeoutSeconds is the timeout of one smartctl invocation in seconds.
+	smartctlCommandTimeoutSeconds = 30
+	// sysBlockPath is the path under which block devices are listed on the node.
+	sysBlockPath = "/sys/block"
+
+	// reallocatedSectorCountAttributeID is the smart attribute id of the reallocated sector
+	// count. A growing count indicates a failing disk.
+	reallocatedSectorCountAttributeID = "5"
+	// temperatureCelsiusAttributeID is the smart attribute id of the device temperature.
+	temperatureCelsiusAttributeID = "194"
+)
+
+// smartDeviceHealth contains the smart health of one block device.
+type smartDeviceHealth struct {
+	// Device is the path of the block device.
+	Device string `json:"device"`
+	// Supported indicates whether smart data could be read from the device. It is false if
+	// smartctl is not installed or the device does not support smart such as virtualized disks.
+	Supported bool `json:"supported"`
+	// Health is the overall health self-assessment test result of the device.
+	Health string `json:"health,omitempty"`
+	// ReallocatedSectors is the raw value of the reallocated sector count attribute. It is -1 if
+	// the device does not report the attribute.
+	ReallocatedSectors int64 `json:"reallocatedSectors"`
+	// TemperatureCelsius is the device temperature in degrees celsius. It is -1 if the device
+	// does not report the attribute.
+	TemperatureCelsius int64 `json:"temperatureCelsius"`
+	// Error is the reason smart data could not be read from the device.
+	Error string `json:"error,omitempty"`
+}
+
+// smartCollector runs smartctl against the block devices on the node and records overall health,
+// reallocated sector counts and temperature into the diagnosis context. Devices without smart
+// support are reported per device instead of failing the collection.
+type smartCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// smartCollectorEnabled indicates whether smartCollector is enabled.
+	smartCollectorEnabled bool
+}
+
+// NewSMARTCollector creates a new smartCollector.
+func NewSMARTCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	smartCollectorEnabled bool,
+) processors.Processor {
+	return &smartCollector{
+		Context:               ctx,
+		Logger:                logger,
+		smartCollectorEnabled: smartCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for smart health of block devices on the node.
+func (sc *smartCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !sc.smartCollectorEnabled {
+		http.Error(w, fmt.Sprintf("smart collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			sc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var devices []string
+		if value, ok := contexts[ParameterKeySMARTDevices]; ok && value != "" {
+			for _, device := range strings.Split(value, ",") {
+				device = strings.TrimSpace(device)
+				if device != "" {
+					devices = append(devices, device)
+				}
+			}
+		} else {
+			devices, err = listBlockDevices()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to list block devices: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+		if len(devices) == 0 {
+			http.Error(w, fmt.Sprintf("no block devices found on the node"), http.StatusInternalServerError)
+			return
+		}
+
+		healths := make([]smartDeviceHealth, 0, len(devices))
+		for _, device := range devices {
+			healths = append(healths, sc.collectDeviceHealth(device))
+		}
+
+		result := make(map[string]string)
+		healthsData, err := json.Marshal(healths)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal device healths: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeySMARTDevices] = string(healthsData)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// collectDeviceHealth reads the smart health of one device with smartctl. A missing smartctl
+// binary or a device without smart support is reported in the result instead of an error.
+func (sc *smartCollector) collectDeviceHealth(device string) smartDeviceHealth {
+	health := smartDeviceHealth{
+		Device:             device,
+		ReallocatedSectors: -1,
+		TemperatureCelsius: -1,
+	}
+
+	// Overall health and attributes are read in one invocation. Smartctl exits non zero on
+	// unsupported devices and failing health so the output is parsed regardless of the error.
+	out, err := util.BlockingRunCommandWithTimeout([]string{"smartctl", "-H", "-A", device}, smartctlCommandTimeoutSeconds)
+	output := string(out)
+	if !strings.Contains(output, "self-assessment") {
+		if err != nil {
+			sc.Info("unable to read smart data from device", "device", device, "error", err)
+			health.Error = fmt.Sprintf("failed to run smartctl: %v", err)
+		} else {
+			health.Error = "device does not support smart"
+		}
+		return health
+	}
+
+	health.Supported = true
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "self-assessment") {
+			fields := strings.Split(line, ":")
+			health.Health = strings.TrimSpace(fields[len(fields)-1])
+			continue
+		}
+
+		// Attribute lines start with the attribute id and end with the raw value.
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+		raw, err := strconv.ParseInt(fields[9], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case reallocatedSectorCountAttributeID:
+			health.ReallocatedSectors = raw
+		case temperatureCelsiusAttributeID:
+			health.TemperatureCelsius = raw
+		}
+	}
+
+	return health
+}
+
+// listBlockDevices lists the paths of physical block devices on the node. Virtual devices such
+// as loop devices and device mapper volumes are skipped.
+func listBlockDevices() ([]string, error) {
+	entries, err := ioutil.ReadDir(sysBlockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "dm-") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		devices = append(devices, "/dev/"+name)
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeySocketStatPID   = "param.collector.system.socket_stat.pid"
+	ParameterKeySocketStatPorts = "param.collector.system.socket_stat.ports"
+
+	ContextKeySocketStatSummary     = "collector.system.socket_stat.summary"
+	ContextKeySocketStatStatePrefix = "collector.system.socket_stat.state."
+	ContextKeySocketStatPortPrefix  = "collector.system.socket_stat.port."
+)
+
+// tcpSocketStates maps socket state codes in /proc/net/tcp to state names.
+var tcpSocketStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// socketStatCollector summarizes tcp socket states on the node by parsing /proc/net/tcp and
+// /proc/net/tcp6. High CLOSE_WAIT counts often indicate file descriptor leaks on application
+// level which a diagnoser can threshold on.
+type socketStatCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// socketStatCollectorEnabled indicates whether socketStatCollector is enabled.
+	socketStatCollectorEnabled bool
+}
+
+// NewSocketStatCollector creates a new socketStatCollector.
+func NewSocketStatCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	socketStatCollectorEnabled bool,
+) processors.Processor {
+	return &socketStatCollector{
+		Context:                    ctx,
+		Logger:                     logger,
+		socketStatCollectorEnabled: socketStatCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for summarizing tcp socket states.
+func (sc *socketStatCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !sc.socketStatCollectorEnabled {
+		http.Error(w, fmt.Sprintf("socket stat collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			sc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Sockets are read from the network namespace of the process if a pid is specified.
+		// This allows inspecting the sockets of the target container once its pid has been
+		// resolved by an upstream operation. The host network namespace is inspected otherwise.
+		procNetRoot := "/proc/net"
+		if value, ok := contexts[ParameterKeySocketStatPID]; ok && value != "" {
+			pid, err := strconv.Atoi(value)
+			if err != nil || pid <= 0 {
+				http.Error(w, fmt.Sprintf("invalid pid %s", value), http.StatusBadRequest)
+				return
+			}
+			procNetRoot = fmt.Sprintf("/proc/%d/net", pid)
+		}
+
+		var ports []int
+		if value, ok := contexts[ParameterKeySocketStatPorts]; ok && value != "" {
+			for _, port := range strings.Split(value, ",") {
+				parsed, err := strconv.Atoi(strings.TrimSpace(port))
+				if err != nil || parsed <= 0 || parsed > 65535 {
+					http.Error(w, fmt.Sprintf("invalid port %s", port), http.StatusBadRequest)
+					return
+				}
+				ports = append(ports, parsed)
+			}
+		}
+
+		stateCounts, portStateCounts, err := collectSocketStats(procNetRoot, ports)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to collect socket states: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeySocketStatSummary] = formatSocketStatSummary(stateCounts)
+		for state, count := range stateCounts {
+			result[ContextKeySocketStatStatePrefix+state] = strconv.Itoa(count)
+		}
+		for port, counts := range portStateCounts {
+			data, err := json.Marshal(counts)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to marshal per port socket states: %v", err), http.StatusInternalServerError)
+				return
+			}
+			result[ContextKeySocketStatPortPrefix+strconv.Itoa(port)] = string(data)
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// collectSocketStats parses tcp and tcp6 socket tables under the procfs net directory and
+// returns socket counts by state. Counts by state of the listed local ports are returned
+// additionally if ports is not empty.
+func collectSocketStats(procNetRoot string, ports []int) (map[string]int, map[int]map[string]int, error) {
+	stateCounts := make(map[string]int)
+	portStateCounts := make(map[int]map[string]int)
+	for _, port := range ports {
+		portStateCounts[port] = make(map[string]int)
+	}
+
+	parsed := 0
+	for _, table := range []string{"tcp", "tcp6"} {
+		data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", procNetRoot, table))
+		if err != nil {
+			continue
+		}
+		parsed++
+
+		lines := strings.Split(string(data), "\n")
+		// The first line of a socket table is the header.
+		for _, line := range lines[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				continue
+			}
+
+			state, ok := tcpSocketStates[fields[3]]
+			if !ok {
+				continue
+			}
+			stateCounts[state]++
+
+			localParts := strings.Split(fields[1], ":")
+			if len(localParts) < 2 {
+				continue
+			}
+			localPort, err := strconv.ParseInt(localParts[len(localParts)-1], 16, 32)
+			if err != nil {
+				continue
+			}
+			if counts, ok := portStateCounts[int(localPort)]; ok {
+				counts[state]++
+			}
+		}
+	}
+
+	if parsed == 0 {
+		return nil, nil, fmt.Errorf("no tcp socket table found under %s", procNetRoot)
+	}
+
+	return stateCounts, portStateCounts, nil
+}
+
+// formatSocketStatSummary formats socket counts by state as a stable human readable summary.
+func formatSocketStatSummary(stateCounts map[string]int) string {
+	states := make([]string, 0, len(stateCounts))
+	for state := range stateCounts {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	summaries := make([]string, 0, len(states))
+	for _, state := range states {
+		summaries = append(summaries, fmt.Sprintf("%s: %d", state, stateCounts[state]))
+	}
+
+	return strings.Join(summaries, ", ")
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeySysctlKeys = "param.collector.system.sysctl.keys"
+
+	ContextKeySysctlPrefix = "collector.system.sysctl."
+
+	// procSysPath is the procfs directory containing kernel parameters.
+	procSysPath = "/proc/sys"
+)
+
+// defaultSysctlKeys are the kernel parameters collected if no key list is specified.
+var defaultSysctlKeys = []string{
+	"net.core.somaxconn",
+	"vm.max_map_count",
+	"fs.file-max",
+}
+
+// sysctlCollector reads kernel parameters from procfs on the node.
+type sysctlCollector struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// sysctlCollectorEnabled indicates whether sysctlCollector is enabled.
+	sysctlCollectorEnabled bool
+}
+
+// NewSysctlCollector creates a new sysctlCollector.
+func NewSysctlCollector(
+	ctx context.Context,
+	logger logr.Logger,
+	sysctlCollectorEnabled bool,
+) processors.Processor {
+	return &sysctlCollector{
+		Context:                ctx,
+		Logger:                 logger,
+		sysctlCollectorEnabled: sysctlCollectorEnabled,
+	}
+}
+
+// Handler handles http requests for kernel parameters.
+func (sc *sysctlCollector) Handler(w http.ResponseWriter, r *http.Request) {
+	if !sc.sysctlCollectorEnabled {
+		http.Error(w, fmt.Sprintf("sysctl collector is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			sc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		keys := defaultSysctlKeys
+		if value, ok := contexts[ParameterKeySysctlKeys]; ok && strings.TrimSpace(value) != "" {
+			keys = nil
+			for _, key := range strings.Split(value, ",") {
+				keys = append(keys, strings.TrimSpace(key))
+			}
+		}
+
+		// Unknown or unreadable keys are reported per key instead of failing the whole request
+		// so that a diagnoser can still assert on the collected values.
+		result := make(map[string]string)
+		for _, key := range keys {
+			value, err := readSysctl(key)
+			if err != nil {
+				result[ContextKeySysctlPrefix+key+".error"] = err.Error()
+				continue
+			}
+			result[ContextKeySysctlPrefix+key] = value
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// readSysctl reads the value of the kernel parameter from procfs.
+func readSysctl(key string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(procSysPath, strings.ReplaceAll(key, ".", "/")))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
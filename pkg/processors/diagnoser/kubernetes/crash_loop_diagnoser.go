@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ContextKeyCrashLoopDiagnosisResult = "diagnoser.kubernetes.crash_loop.result"
+	ContextKeyCrashLoopContainer       = "diagnoser.kubernetes.crash_loop.container"
+	ContextKeyCrashLoopRestartCount    = "diagnoser.kubernetes.crash_loop.restart_count"
+	ContextKeyCrashLoopExitCode        = "diagnoser.kubernetes.crash_loop.exit_code"
+	ContextKeyCrashLoopReason          = "diagnoser.kubernetes.crash_loop.reason"
+	ContextKeyCrashLoopMessage         = "diagnoser.kubernetes.crash_loop.message"
+)
+
+// crashLoopDiagnoser inspects container statuses of the target pod for containers in
+// CrashLoopBackOff and extracts details of the last termination.
+type crashLoopDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// crashLoopDiagnoserEnabled indicates whether crashLoopDiagnoser is enabled.
+	crashLoopDiagnoserEnabled bool
+}
+
+// NewCrashLoopDiagnoser creates a new crashLoopDiagnoser.
+func NewCrashLoopDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	crashLoopDiagnoserEnabled bool,
+) processors.Processor {
+	return &crashLoopDiagnoser{
+		Context:                   ctx,
+		Logger:                    logger,
+		cache:                     cache,
+		crashLoopDiagnoserEnabled: crashLoopDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing crash looping containers of the target pod.
+func (cld *crashLoopDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !cld.crashLoopDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("crash loop diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			cld.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var pod corev1.Pod
+		if err := cld.cache.Get(cld, client.ObjectKey{
+			Namespace: podReference.Namespace,
+			Name:      podReference.Name,
+		}, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		containerStatus, found := matchCrashLoopContainerStatus(pod, podReference.Container)
+		if found {
+			message := fmt.Sprintf("Container %s of pod %s/%s is in CrashLoopBackOff with %d restarts.", containerStatus.Name, pod.Namespace, pod.Name, containerStatus.RestartCount)
+			if terminated := containerStatus.LastTerminationState.Terminated; terminated != nil {
+				message = fmt.Sprintf("%s Last termination reason is %s with exit code %d.", message, terminated.Reason, terminated.ExitCode)
+				result[ContextKeyCrashLoopExitCode] = strconv.FormatInt(int64(terminated.ExitCode), 10)
+				result[ContextKeyCrashLoopReason] = terminated.Reason
+				result[ContextKeyCrashLoopMessage] = terminated.Message
+			}
+			result[ContextKeyCrashLoopDiagnosisResult] = message
+			result[ContextKeyCrashLoopContainer] = containerStatus.Name
+			result[ContextKeyCrashLoopRestartCount] = strconv.FormatInt(int64(containerStatus.RestartCount), 10)
+		} else {
+			// An empty result is returned if the pod is not crash looping so that succeeding
+			// operations in the path are still executed.
+			cld.Info("no crash looping container found for pod", "pod", client.ObjectKey{
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+			})
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// matchCrashLoopContainerStatus searches container statuses of the pod for a container in
+// CrashLoopBackOff. Only the named container is inspected if containerName is not empty.
+func matchCrashLoopContainerStatus(pod corev1.Pod, containerName string) (corev1.ContainerStatus, bool) {
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, containerStatus := range statuses {
+		if containerName != "" && containerStatus.Name != containerName {
+			continue
+		}
+		if containerStatus.State.Waiting != nil && containerStatus.State.Waiting.Reason == "CrashLoopBackOff" {
+			return containerStatus, true
+		}
+	}
+
+	return corev1.ContainerStatus{}, false
+}
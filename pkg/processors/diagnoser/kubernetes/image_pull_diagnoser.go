@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ContextKeyImagePullDiagnosisResult = "diagnoser.kubernetes.image_pull.result"
+	ContextKeyImagePullContainer       = "diagnoser.kubernetes.image_pull.container"
+	ContextKeyImagePullImage           = "diagnoser.kubernetes.image_pull.image"
+	ContextKeyImagePullCategory        = "diagnoser.kubernetes.image_pull.category"
+	ContextKeyImagePullMessage         = "diagnoser.kubernetes.image_pull.message"
+
+	// Image pull failure categories recorded in the diagnosis result. A recoverer can branch
+	// on the category, e.g. a missing image pull secret is actionable while an unreachable
+	// registry usually is not.
+	imagePullCategoryMissingPullSecret   = "MissingImagePullSecret"
+	imagePullCategoryAuthenticationError = "AuthenticationError"
+	imagePullCategoryImageNotFound       = "ImageNotFound"
+	imagePullCategoryRegistryUnreachable = "RegistryUnreachable"
+	imagePullCategoryUnknown             = "Unknown"
+)
+
+// imagePullDiagnoser inspects container statuses of the target pod for image pull failures and
+// categorizes the registry error.
+type imagePullDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// imagePullDiagnoserEnabled indicates whether imagePullDiagnoser is enabled.
+	imagePullDiagnoserEnabled bool
+}
+
+// NewImagePullDiagnoser creates a new imagePullDiagnoser.
+func NewImagePullDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	imagePullDiagnoserEnabled bool,
+) processors.Processor {
+	return &imagePullDiagnoser{
+		Context:                   ctx,
+		Logger:                    logger,
+		cache:                     cache,
+		imagePullDiagnoserEnabled: imagePullDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing image pull failures of the target pod.
+func (ip *imagePullDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !ip.imagePullDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("image pull diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			ip.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var pod corev1.Pod
+		if err := ip.cache.Get(ip, client.ObjectKey{
+			Namespace: podReference.Namespace,
+			Name:      podReference.Name,
+		}, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		containerStatus, found := matchImagePullContainerStatus(pod, podReference.Container)
+		if !found {
+			http.Error(w, fmt.Sprintf("no image pull failure found for pod %s/%s", pod.Namespace, pod.Name), http.StatusInternalServerError)
+			return
+		}
+
+		message := containerStatus.State.Waiting.Message
+		category := classifyImagePullError(pod, message)
+		result := make(map[string]string)
+		result[ContextKeyImagePullDiagnosisResult] = fmt.Sprintf("Container %s of pod %s/%s fails to pull image %s: %s.", containerStatus.Name, pod.Namespace, pod.Name, containerStatus.Image, category)
+		result[ContextKeyImagePullContainer] = containerStatus.Name
+		result[ContextKeyImagePullImage] = containerStatus.Image
+		result[ContextKeyImagePullCategory] = category
+		result[ContextKeyImagePullMessage] = message
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// matchImagePullContainerStatus searches container statuses of the pod for a container failing
+// to pull its image. Only the named container is inspected if containerName is not empty.
+func matchImagePullContainerStatus(pod corev1.Pod, containerName string) (corev1.ContainerStatus, bool) {
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, containerStatus := range statuses {
+		if containerName != "" && containerStatus.Name != containerName {
+			continue
+		}
+		if containerStatus.State.Waiting == nil {
+			continue
+		}
+		if containerStatus.State.Waiting.Reason == "ImagePullBackOff" || containerStatus.State.Waiting.Reason == "ErrImagePull" {
+			return containerStatus, true
+		}
+	}
+
+	return corev1.ContainerStatus{}, false
+}
+
+// classifyImagePullError categorizes the registry error of an image pull failure. An
+// authentication error of a pod without image pull secrets is categorized as a missing image
+// pull secret.
+func classifyImagePullError(pod corev1.Pod, message string) string {
+	lowered := strings.ToLower(message)
+	switch {
+	case strings.Contains(lowered, "unauthorized") || strings.Contains(lowered, "pull access denied") || strings.Contains(lowered, "authentication required"):
+		if len(pod.Spec.ImagePullSecrets) == 0 {
+			return imagePullCategoryMissingPullSecret
+		}
+		return imagePullCategoryAuthenticationError
+	case strings.Contains(lowered, "not found") || strings.Contains(lowered, "manifest unknown"):
+		return imagePullCategoryImageNotFound
+	case strings.Contains(lowered, "timeout") || strings.Contains(lowered, "no such host") || strings.Contains(lowered, "connection refused"):
+		return imagePullCategoryRegistryUnreachable
+	default:
+		return imagePullCategoryUnknown
+	}
+}
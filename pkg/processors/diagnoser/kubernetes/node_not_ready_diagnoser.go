@@ -0,0 +1,214 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ContextKeyNodeNotReadyDiagnosisResult = "diagnoser.kubernetes.node_not_ready.result"
+	ContextKeyNodeNotReadyNode            = "diagnoser.kubernetes.node_not_ready.node"
+	ContextKeyNodeNotReadyCause           = "diagnoser.kubernetes.node_not_ready.cause"
+	ContextKeyNodeNotReadyKubeletEvents   = "diagnoser.kubernetes.node_not_ready.kubelet.events"
+
+	// maxKubeletEventMessages is the maximum number of recent kubelet event messages included
+	// in the diagnosis result.
+	maxKubeletEventMessages = 10
+)
+
+// nodeNotReadyDiagnoser inspects conditions of the target node and recent kubelet events to
+// determine the likely cause of the node not being ready.
+type nodeNotReadyDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// nodeName specifies the node name.
+	nodeName string
+	// nodeNotReadyDiagnoserEnabled indicates whether nodeNotReadyDiagnoser is enabled.
+	nodeNotReadyDiagnoserEnabled bool
+}
+
+// NewNodeNotReadyDiagnoser creates a new nodeNotReadyDiagnoser.
+func NewNodeNotReadyDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	nodeName string,
+	nodeNotReadyDiagnoserEnabled bool,
+) processors.Processor {
+	return &nodeNotReadyDiagnoser{
+		Context:                      ctx,
+		Logger:                       logger,
+		cache:                        cache,
+		nodeName:                     nodeName,
+		nodeNotReadyDiagnoserEnabled: nodeNotReadyDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing a node which is not ready.
+func (nd *nodeNotReadyDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !nd.nodeNotReadyDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("node not ready diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			nd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Diagnose the node of the diagnosis if set and fall back to the node the agent runs on.
+		nodeName := contexts["node"]
+		if nodeName == "" {
+			nodeName = nd.nodeName
+		}
+
+		var node corev1.Node
+		if err := nd.cache.Get(nd, client.ObjectKey{
+			Name: nodeName,
+		}, &node); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Node: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		cause, message, notReady := determineNodeNotReadyCause(node)
+		if notReady {
+			result[ContextKeyNodeNotReadyDiagnosisResult] = message
+			result[ContextKeyNodeNotReadyNode] = nodeName
+			result[ContextKeyNodeNotReadyCause] = cause
+
+			messages, err := nd.recentKubeletEventMessages(nodeName)
+			if err != nil {
+				nd.Error(err, "unable to list kubelet events for node", "node", nodeName)
+			} else if len(messages) > 0 {
+				result[ContextKeyNodeNotReadyKubeletEvents] = strings.Join(messages, "\n")
+			}
+		} else {
+			// An empty result is returned if the node is ready so that succeeding operations in
+			// the path are still executed.
+			nd.Info("node is ready", "node", nodeName)
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// determineNodeNotReadyCause inspects conditions of the node and returns the likely cause of
+// the node not being ready. False is returned if the node is ready.
+func determineNodeNotReadyCause(node corev1.Node) (string, string, bool) {
+	var ready *corev1.NodeCondition
+	for i, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			ready = &node.Status.Conditions[i]
+			break
+		}
+	}
+
+	if ready != nil && ready.Status == corev1.ConditionTrue {
+		return "", "", false
+	}
+
+	// Pressure conditions take precedence since they usually explain why the kubelet stopped
+	// reporting the node as ready.
+	for _, condition := range node.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case corev1.NodeDiskPressure:
+			return "DiskPressure", fmt.Sprintf("Node %s is not ready due to disk pressure: %s", node.Name, condition.Message), true
+		case corev1.NodePIDPressure:
+			return "PIDPressure", fmt.Sprintf("Node %s is not ready due to pid pressure: %s", node.Name, condition.Message), true
+		case corev1.NodeMemoryPressure:
+			return "MemoryPressure", fmt.Sprintf("Node %s is not ready due to memory pressure: %s", node.Name, condition.Message), true
+		case corev1.NodeNetworkUnavailable:
+			return "NetworkUnavailable", fmt.Sprintf("Node %s is not ready since the network is unavailable: %s", node.Name, condition.Message), true
+		}
+	}
+
+	// An unknown ready condition indicates that the kubelet stopped posting node status.
+	if ready == nil || ready.Status == corev1.ConditionUnknown {
+		return "KubeletDown", fmt.Sprintf("Node %s is not ready since the kubelet stopped posting node status.", node.Name), true
+	}
+
+	return "NotReady", fmt.Sprintf("Node %s is not ready: %s", node.Name, ready.Message), true
+}
+
+// recentKubeletEventMessages returns messages of the most recent kubelet events of the node.
+func (nd *nodeNotReadyDiagnoser) recentKubeletEventMessages(nodeName string) ([]string, error) {
+	var eventList corev1.EventList
+	if err := nd.cache.List(nd, &eventList); err != nil {
+		return nil, err
+	}
+
+	var events []corev1.Event
+	for _, event := range eventList.Items {
+		if event.InvolvedObject.Kind != "Node" || event.InvolvedObject.Name != nodeName {
+			continue
+		}
+		if event.Source.Component != "kubelet" {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastTimestamp.After(events[j].LastTimestamp.Time)
+	})
+	if len(events) > maxKubeletEventMessages {
+		events = events[:maxKubeletEventMessages]
+	}
+
+	messages := make([]string, 0, len(events))
+	for _, event := range events {
+		messages = append(messages, fmt.Sprintf("%s %s: %s", event.LastTimestamp.Format("2006-01-02T15:04:05Z07:00"), event.Reason, event.Message))
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/collector/system"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ContextKeyOOMKillDiagnosisResult = "diagnoser.kubernetes.oom_kill.result"
+	ContextKeyOOMKillPID             = "diagnoser.kubernetes.oom_kill.pid"
+	ContextKeyOOMKillCgroup          = "diagnoser.kubernetes.oom_kill.cgroup"
+)
+
+// oomKillRegex matches oom kill events reported by the kernel oom killer.
+var oomKillRegex = regexp.MustCompile(`oom-kill:.*task_memcg=([^,]+),task=([^,]+),pid=(\d+)`)
+
+// oomKillDiagnoser correlates kernel ring buffer messages and the target pod of a diagnosis into an
+// out of memory diagnosis.
+type oomKillDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// oomKillDiagnoserEnabled indicates whether oomKillDiagnoser is enabled.
+	oomKillDiagnoserEnabled bool
+}
+
+// NewOOMKillDiagnoser creates a new oomKillDiagnoser.
+func NewOOMKillDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	oomKillDiagnoserEnabled bool,
+) processors.Processor {
+	return &oomKillDiagnoser{
+		Context:                 ctx,
+		Logger:                  logger,
+		cache:                   cache,
+		oomKillDiagnoserEnabled: oomKillDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing oom kill events of the target pod.
+func (okd *oomKillDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !okd.oomKillDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("oom kill diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			okd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if contexts[system.ContextKeyDmesgLog] == "" {
+			http.Error(w, fmt.Sprintf("need %s in extract contexts", system.ContextKeyDmesgLog), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var pod corev1.Pod
+		if err := okd.cache.Get(okd, client.ObjectKey{
+			Namespace: podReference.Namespace,
+			Name:      podReference.Name,
+		}, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		cgroup, task, pid, found := matchOOMKillEvent(contexts[system.ContextKeyDmesgLog], string(pod.UID))
+		if !found {
+			okd.Info("no oom kill event matched for pod", "pod", client.ObjectKey{
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+			})
+			http.Error(w, fmt.Sprintf("no oom kill event matched for pod %s/%s", pod.Namespace, pod.Name), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyOOMKillDiagnosisResult] = fmt.Sprintf("Process %s of pod %s/%s was killed by the kernel oom killer.", task, pod.Namespace, pod.Name)
+		result[ContextKeyOOMKillPID] = pid
+		result[ContextKeyOOMKillCgroup] = cgroup
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// matchOOMKillEvent searches oom kill events of the pod in kernel ring buffer messages. An event is
+// matched if the task memory cgroup of the event contains the pod uid. It returns the memory cgroup,
+// task name and pid of the last matched event.
+func matchOOMKillEvent(dmesgLog string, podUID string) (string, string, string, bool) {
+	// The pod uid is encoded with dashes replaced by underscores in systemd driven cgroup paths.
+	systemdPodUID := strings.ReplaceAll(podUID, "-", "_")
+
+	var cgroup, task, pid string
+	found := false
+	for _, line := range strings.Split(dmesgLog, "\n") {
+		matches := oomKillRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		if !strings.Contains(matches[1], podUID) && !strings.Contains(matches[1], systemdPodUID) {
+			continue
+		}
+
+		cgroup = matches[1]
+		task = matches[2]
+		pid = matches[3]
+		found = true
+	}
+
+	return cgroup, task, pid, found
+}
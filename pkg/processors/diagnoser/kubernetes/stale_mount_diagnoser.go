@@ -0,0 +1,254 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/collector/kubernetes"
+	"github.com/kubediag/kubediag/pkg/processors/collector/system"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ContextKeyStaleMountDiagnosisResult = "diagnoser.kubernetes.stale_mount.result"
+	ContextKeyStaleMountMounts          = "diagnoser.kubernetes.stale_mount.mounts"
+
+	// deletedMountSourceSuffix is appended to the root field of a mountinfo entry whose bind
+	// mount source has been deleted.
+	deletedMountSourceSuffix = "/deleted"
+	// nfsStatTimeout is the timeout of one stat on an nfs mount point. A stat which hangs
+	// longer is treated as a stale mount since a healthy server answers well within it.
+	nfsStatTimeout = 5 * time.Second
+)
+
+// staleMount describes one problematic mount of the target pod.
+type staleMount struct {
+	// MountPoint is the path the mount is mounted on.
+	MountPoint string `json:"mountPoint"`
+	// Root is the root of the mount within its filesystem.
+	Root string `json:"root"`
+	// FSType is the filesystem type of the mount.
+	FSType string `json:"fsType"`
+	// Source is the filesystem specific source of the mount.
+	Source string `json:"source"`
+	// Reason describes why the mount is problematic.
+	Reason string `json:"reason"`
+}
+
+// mountInfoEntry is one parsed line of the mountinfo output of mountInfoCollector.
+type mountInfoEntry struct {
+	// Root is the root of the mount within its filesystem.
+	Root string
+	// MountPoint is the path the mount is mounted on.
+	MountPoint string
+	// OptionalFields are the optional fields of the mountinfo line such as peer group tags.
+	OptionalFields []string
+	// FSType is the filesystem type of the mount.
+	FSType string
+	// Source is the filesystem specific source of the mount.
+	Source string
+}
+
+// staleMountDiagnoser parses the mountinfo collected by mountInfoCollector and identifies bind
+// mounts whose source has been deleted, stale nfs mounts and mounts which break propagation for
+// the volumes of the target pod. It complements subPathRemountDiagnoser which only covers the
+// subpath remount bug.
+type staleMountDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// staleMountDiagnoserEnabled indicates whether staleMountDiagnoser is enabled.
+	staleMountDiagnoserEnabled bool
+}
+
+// NewStaleMountDiagnoser creates a new staleMountDiagnoser.
+func NewStaleMountDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	staleMountDiagnoserEnabled bool,
+) processors.Processor {
+	return &staleMountDiagnoser{
+		Context:                    ctx,
+		Logger:                     logger,
+		staleMountDiagnoserEnabled: staleMountDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing stale mounts of the target pod.
+func (smd *staleMountDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !smd.staleMountDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("stale mount diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			smd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if contexts[system.ContextKeyMountInfo] == "" {
+			http.Error(w, fmt.Sprintf("need %s in extract contexts", system.ContextKeyMountInfo), http.StatusInternalServerError)
+			return
+		}
+
+		// Mounts are restricted to the volumes of the target pod if pod detail has been
+		// collected. All mounts on the node are inspected otherwise.
+		podUID := ""
+		if contexts[kubernetes.ContextKeyPodDetail] != "" {
+			pod := corev1.Pod{}
+			err = json.Unmarshal([]byte(contexts[kubernetes.ContextKeyPodDetail]), &pod)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to unmarshal pod: %v", err), http.StatusInternalServerError)
+				return
+			}
+			podUID = string(pod.UID)
+		}
+
+		staleMounts := make([]staleMount, 0)
+		for _, line := range strings.Split(contexts[system.ContextKeyMountInfo], "\n") {
+			entry, ok := parseMountInfoLine(line)
+			if !ok {
+				continue
+			}
+			if podUID != "" && !strings.Contains(entry.MountPoint, podUID) {
+				continue
+			}
+
+			if reason, stale := smd.diagnoseMount(entry); stale {
+				staleMounts = append(staleMounts, staleMount{
+					MountPoint: entry.MountPoint,
+					Root:       entry.Root,
+					FSType:     entry.FSType,
+					Source:     entry.Source,
+					Reason:     reason,
+				})
+			}
+		}
+		if len(staleMounts) == 0 {
+			smd.Info("no stale mount found", "poduid", podUID)
+			http.Error(w, fmt.Sprintf("no stale mount found"), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyStaleMountDiagnosisResult] = fmt.Sprintf("%d stale or misconfigured mounts have been identified on the node.", len(staleMounts))
+		staleMountsData, err := json.Marshal(staleMounts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal stale mounts: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeyStaleMountMounts] = string(staleMountsData)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// diagnoseMount checks one mount for a deleted bind mount source, a stale nfs file handle or a
+// propagation misconfiguration and returns the reason if the mount is problematic.
+func (smd *staleMountDiagnoser) diagnoseMount(entry mountInfoEntry) (string, bool) {
+	if strings.HasSuffix(entry.Root, deletedMountSourceSuffix) {
+		return "bind mount source has been deleted", true
+	}
+
+	if entry.FSType == "nfs" || entry.FSType == "nfs4" {
+		if err := statWithTimeout(entry.MountPoint, nfsStatTimeout); err != nil {
+			smd.Info("nfs mount point is not accessible", "mountpoint", entry.MountPoint, "error", err)
+			return fmt.Sprintf("nfs mount is stale: %v", err), true
+		}
+	}
+
+	for _, field := range entry.OptionalFields {
+		if field == "unbindable" {
+			return "mount is marked unbindable which breaks mount propagation into containers", true
+		}
+	}
+
+	return "", false
+}
+
+// parseMountInfoLine parses one line of /proc/<pid>/mountinfo. The optional fields after the
+// mount options are terminated by a single dash followed by the filesystem type and source.
+func parseMountInfoLine(line string) (mountInfoEntry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 7 {
+		return mountInfoEntry{}, false
+	}
+
+	entry := mountInfoEntry{
+		Root:       fields[3],
+		MountPoint: fields[4],
+	}
+	for index := 6; index < len(fields); index++ {
+		if fields[index] == "-" {
+			if len(fields) < index+3 {
+				return mountInfoEntry{}, false
+			}
+			entry.FSType = fields[index+1]
+			entry.Source = fields[index+2]
+			return entry, true
+		}
+		entry.OptionalFields = append(entry.OptionalFields, fields[index])
+	}
+
+	return mountInfoEntry{}, false
+}
+
+// statWithTimeout stats the path and gives up after the timeout. A stale nfs file handle and a
+// stat which hangs on an unresponsive server are both reported as errors.
+func statWithTimeout(path string, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := os.Stat(path)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil && errors.Is(err, syscall.ESTALE) {
+			return fmt.Errorf("stale file handle on %s", path)
+		}
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("stat on %s timed out after %v", path, timeout)
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ContextKeyVolumeDiagnosisResult = "diagnoser.kubernetes.volume.result"
+	ContextKeyVolumeDiagnosisVolume = "diagnoser.kubernetes.volume.volume"
+	ContextKeyVolumeDiagnosisClaim  = "diagnoser.kubernetes.volume.claim"
+	ContextKeyVolumeDiagnosisCause  = "diagnoser.kubernetes.volume.cause"
+
+	// volumeCausePVCUnbound indicates that the persistent volume claim of the volume is not bound.
+	volumeCausePVCUnbound = "PVCUnbound"
+	// volumeCauseAttachFailed indicates that the volume attachment reported an attach error.
+	volumeCauseAttachFailed = "AttachFailed"
+	// volumeCauseAttachPending indicates that the volume attachment has not completed.
+	volumeCauseAttachPending = "AttachPending"
+	// volumeCauseMountFailed indicates that the kubelet failed to mount the volume.
+	volumeCauseMountFailed = "MountFailed"
+)
+
+// volumeDiagnoser inspects persistent volume claims, volume attachments and mount events of the
+// target pod to identify which volume is stuck and why.
+type volumeDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// volumeDiagnoserEnabled indicates whether volumeDiagnoser is enabled.
+	volumeDiagnoserEnabled bool
+}
+
+// NewVolumeDiagnoser creates a new volumeDiagnoser.
+func NewVolumeDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	volumeDiagnoserEnabled bool,
+) processors.Processor {
+	return &volumeDiagnoser{
+		Context:                ctx,
+		Logger:                 logger,
+		cache:                  cache,
+		volumeDiagnoserEnabled: volumeDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing volume problems of the target pod.
+func (vd *volumeDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !vd.volumeDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("volume diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			vd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var pod corev1.Pod
+		if err := vd.cache.Get(vd, client.ObjectKey{
+			Namespace: podReference.Namespace,
+			Name:      podReference.Name,
+		}, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		volume, claim, cause, message, found := vd.diagnoseVolumes(pod)
+		if !found {
+			http.Error(w, fmt.Sprintf("no volume problem found for pod %s/%s", pod.Namespace, pod.Name), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyVolumeDiagnosisResult] = message
+		result[ContextKeyVolumeDiagnosisVolume] = volume
+		result[ContextKeyVolumeDiagnosisCause] = cause
+		if claim != "" {
+			result[ContextKeyVolumeDiagnosisClaim] = claim
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// diagnoseVolumes inspects persistent volume claim backed volumes of the pod and returns details
+// of the first volume found to be stuck. Causes are checked in the order they occur during volume
+// setup: an unbound claim, an incomplete or failed attach, then a failed mount.
+func (vd *volumeDiagnoser) diagnoseVolumes(pod corev1.Pod) (string, string, string, string, bool) {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		claimName := volume.PersistentVolumeClaim.ClaimName
+
+		var pvc corev1.PersistentVolumeClaim
+		if err := vd.cache.Get(vd, client.ObjectKey{
+			Namespace: pod.Namespace,
+			Name:      claimName,
+		}, &pvc); err != nil {
+			vd.Error(err, "unable to fetch PersistentVolumeClaim", "persistentvolumeclaim", client.ObjectKey{
+				Namespace: pod.Namespace,
+				Name:      claimName,
+			})
+			continue
+		}
+
+		if pvc.Status.Phase != corev1.ClaimBound {
+			message := fmt.Sprintf("Volume %s of pod %s/%s is backed by persistent volume claim %s which is %s instead of bound.", volume.Name, pod.Namespace, pod.Name, claimName, pvc.Status.Phase)
+			return volume.Name, claimName, volumeCausePVCUnbound, message, true
+		}
+
+		if cause, message, found := vd.matchVolumeAttachment(pod, volume.Name, claimName, pvc.Spec.VolumeName); found {
+			return volume.Name, claimName, cause, message, true
+		}
+
+		if message, found := vd.matchFailedMountEvent(pod, volume.Name); found {
+			return volume.Name, claimName, volumeCauseMountFailed, message, true
+		}
+	}
+
+	return "", "", "", "", false
+}
+
+// matchVolumeAttachment searches volume attachments for the persistent volume on the node of the
+// pod and reports attachments which failed or have not completed.
+func (vd *volumeDiagnoser) matchVolumeAttachment(pod corev1.Pod, volumeName string, claimName string, persistentVolumeName string) (string, string, bool) {
+	if persistentVolumeName == "" || pod.Spec.NodeName == "" {
+		return "", "", false
+	}
+
+	var volumeAttachmentList storagev1.VolumeAttachmentList
+	if err := vd.cache.List(vd, &volumeAttachmentList); err != nil {
+		vd.Error(err, "unable to list VolumeAttachments")
+		return "", "", false
+	}
+
+	for _, volumeAttachment := range volumeAttachmentList.Items {
+		if volumeAttachment.Spec.NodeName != pod.Spec.NodeName {
+			continue
+		}
+		if volumeAttachment.Spec.Source.PersistentVolumeName == nil || *volumeAttachment.Spec.Source.PersistentVolumeName != persistentVolumeName {
+			continue
+		}
+		if volumeAttachment.Status.Attached {
+			return "", "", false
+		}
+		if volumeAttachment.Status.AttachError != nil {
+			message := fmt.Sprintf("Volume %s of pod %s/%s failed to attach to node %s: %s", volumeName, pod.Namespace, pod.Name, pod.Spec.NodeName, volumeAttachment.Status.AttachError.Message)
+			return volumeCauseAttachFailed, message, true
+		}
+		message := fmt.Sprintf("Volume %s of pod %s/%s has not finished attaching to node %s since %s.", volumeName, pod.Namespace, pod.Name, pod.Spec.NodeName, volumeAttachment.CreationTimestamp.Format("2006-01-02T15:04:05Z07:00"))
+		return volumeCauseAttachPending, message, true
+	}
+
+	return "", "", false
+}
+
+// matchFailedMountEvent searches events of the pod for mount failures mentioning the volume.
+func (vd *volumeDiagnoser) matchFailedMountEvent(pod corev1.Pod, volumeName string) (string, bool) {
+	var eventList corev1.EventList
+	if err := vd.cache.List(vd, &eventList); err != nil {
+		vd.Error(err, "unable to list Events")
+		return "", false
+	}
+
+	for _, event := range eventList.Items {
+		if event.InvolvedObject.Kind != "Pod" || event.InvolvedObject.Namespace != pod.Namespace || event.InvolvedObject.Name != pod.Name {
+			continue
+		}
+		if event.Reason != "FailedMount" && event.Reason != "FailedAttachVolume" {
+			continue
+		}
+		if !strings.Contains(event.Message, volumeName) {
+			continue
+		}
+		message := fmt.Sprintf("Volume %s of pod %s/%s failed to mount: %s", volumeName, pod.Namespace, pod.Name, event.Message)
+		return message, true
+	}
+
+	return "", false
+}
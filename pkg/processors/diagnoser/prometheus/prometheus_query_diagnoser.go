@@ -0,0 +1,299 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/alertmanager"
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyPrometheusQueryEndpoint      = "param.diagnoser.prometheus.query.endpoint"
+	ParameterKeyPrometheusQueryTemplate      = "param.diagnoser.prometheus.query.template"
+	ParameterKeyPrometheusQueryThreshold     = "param.diagnoser.prometheus.query.threshold"
+	ParameterKeyPrometheusQueryWindowSeconds = "param.diagnoser.prometheus.query.window_seconds"
+
+	ContextKeyPrometheusQueryDiagnosisResult = "diagnoser.prometheus.query.result"
+	ContextKeyPrometheusQueryQuery           = "diagnoser.prometheus.query.query"
+	ContextKeyPrometheusQueryMaxValue        = "diagnoser.prometheus.query.max_value"
+	ContextKeyPrometheusQuerySamples         = "diagnoser.prometheus.query.samples"
+	ContextKeyPrometheusQuerySampleCount     = "diagnoser.prometheus.query.sample_count"
+
+	// defaultPrometheusQueryWindowSeconds is the default half width in seconds of the time window
+	// around the alert start time which the metric is queried over.
+	defaultPrometheusQueryWindowSeconds = 900
+	// prometheusQueryRangePath is the path of the prometheus range query api.
+	prometheusQueryRangePath = "/api/v1/query_range"
+	// prometheusQueryTimeoutSeconds is the timeout in seconds of one prometheus query.
+	prometheusQueryTimeoutSeconds = 30
+	// maxPrometheusQuerySamples is the maximum number of samples recorded in the diagnosis.
+	maxPrometheusQuerySamples = 100
+)
+
+// prometheusQueryTemplatePlaceholder matches ${key} placeholders in a promql query template.
+var prometheusQueryTemplatePlaceholder = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// prometheusQueryDiagnoser queries a prometheus for the metric context around the start time of
+// the alert which generated the diagnosis. The promql query is rendered from a template with the
+// alert labels injected as diagnosis parameters and the queried samples are evaluated against a
+// threshold.
+type prometheusQueryDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// prometheusQueryDiagnoserEnabled indicates whether prometheusQueryDiagnoser is enabled.
+	prometheusQueryDiagnoserEnabled bool
+}
+
+// NewPrometheusQueryDiagnoser creates a new prometheusQueryDiagnoser.
+func NewPrometheusQueryDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	prometheusQueryDiagnoserEnabled bool,
+) processors.Processor {
+	return &prometheusQueryDiagnoser{
+		Context:                         ctx,
+		Logger:                          logger,
+		prometheusQueryDiagnoserEnabled: prometheusQueryDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing with prometheus metrics at alert time.
+func (pq *prometheusQueryDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !pq.prometheusQueryDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("prometheus query diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			pq.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		endpoint, ok := contexts[ParameterKeyPrometheusQueryEndpoint]
+		if !ok || endpoint == "" {
+			http.Error(w, fmt.Sprintf("must specify prometheus endpoint"), http.StatusBadRequest)
+			return
+		}
+		template, ok := contexts[ParameterKeyPrometheusQueryTemplate]
+		if !ok || template == "" {
+			http.Error(w, fmt.Sprintf("must specify promql query template"), http.StatusBadRequest)
+			return
+		}
+		rawThreshold, ok := contexts[ParameterKeyPrometheusQueryThreshold]
+		if !ok {
+			http.Error(w, fmt.Sprintf("must specify threshold"), http.StatusBadRequest)
+			return
+		}
+		threshold, err := strconv.ParseFloat(rawThreshold, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid threshold %s", rawThreshold), http.StatusBadRequest)
+			return
+		}
+		windowSeconds := defaultPrometheusQueryWindowSeconds
+		if value, ok := contexts[ParameterKeyPrometheusQueryWindowSeconds]; ok {
+			windowSeconds, err = strconv.Atoi(value)
+			if err != nil || windowSeconds <= 0 {
+				http.Error(w, fmt.Sprintf("invalid window seconds %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// The metric is queried around the start time of the alert which generated the diagnosis
+		// and around the current time for diagnoses from other sources.
+		center := time.Now()
+		if value, ok := contexts[alertmanager.ParameterKeyAlertStartsAt]; ok && value != "" {
+			center, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid alert start time %s: %v", value, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		query := renderPrometheusQuery(template, contexts)
+		samples, err := pq.runPrometheusRangeQuery(endpoint, query, center, time.Duration(windowSeconds)*time.Second)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to run prometheus query: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(samples) == 0 {
+			http.Error(w, fmt.Sprintf("prometheus query %s returned no samples", query), http.StatusInternalServerError)
+			return
+		}
+
+		maxValue := samples[0].value
+		for _, sample := range samples {
+			if sample.value > maxValue {
+				maxValue = sample.value
+			}
+		}
+		if maxValue < threshold {
+			http.Error(w, fmt.Sprintf("maximum value %v of prometheus query %s is below threshold %v", maxValue, query, threshold), http.StatusInternalServerError)
+			return
+		}
+
+		if len(samples) > maxPrometheusQuerySamples {
+			samples = samples[len(samples)-maxPrometheusQuerySamples:]
+		}
+		lines := make([]string, 0, len(samples))
+		for _, sample := range samples {
+			lines = append(lines, fmt.Sprintf("%s %v", sample.timestamp.Format(time.RFC3339), sample.value))
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyPrometheusQueryDiagnosisResult] = fmt.Sprintf("Maximum value %v of prometheus query %s around %s exceeds the threshold of %v.", maxValue, query, center.Format(time.RFC3339), threshold)
+		result[ContextKeyPrometheusQueryQuery] = query
+		result[ContextKeyPrometheusQueryMaxValue] = strconv.FormatFloat(maxValue, 'f', -1, 64)
+		result[ContextKeyPrometheusQuerySamples] = strings.Join(lines, "\n")
+		result[ContextKeyPrometheusQuerySampleCount] = strconv.Itoa(len(samples))
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// renderPrometheusQuery substitutes ${key} placeholders in the promql query template with values
+// from the contexts. Placeholders without a corresponding context value are left unchanged.
+func renderPrometheusQuery(template string, contexts map[string]string) string {
+	return prometheusQueryTemplatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		key := strings.TrimSuffix(strings.TrimPrefix(placeholder, "${"), "}")
+		if value, ok := contexts[key]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// prometheusSample is one sample of a prometheus range query result.
+type prometheusSample struct {
+	// timestamp is the time of the sample.
+	timestamp time.Time
+	// value is the value of the sample.
+	value float64
+}
+
+// prometheusQueryRangeResponse is the response body of a prometheus range query.
+type prometheusQueryRangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][]interface{}   `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// runPrometheusRangeQuery runs the promql query against the prometheus range query api over the
+// window around the center time and returns the queried samples ordered by time.
+func (pq *prometheusQueryDiagnoser) runPrometheusRangeQuery(endpoint string, query string, center time.Time, window time.Duration) ([]prometheusSample, error) {
+	start := center.Add(-window)
+	end := center.Add(window)
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	step := window / 30
+	if step < time.Second {
+		step = time.Second
+	}
+
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("start", strconv.FormatInt(start.Unix(), 10))
+	values.Set("end", strconv.FormatInt(end.Unix(), 10))
+	values.Set("step", strconv.FormatInt(int64(step.Seconds()), 10))
+
+	client := &http.Client{
+		Timeout: prometheusQueryTimeoutSeconds * time.Second,
+	}
+	res, err := client.Get(fmt.Sprintf("%s%s?%s", strings.TrimSuffix(endpoint, "/"), prometheusQueryRangePath, values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("prometheus responded with status code %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var response prometheusQueryRangeResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal prometheus response: %v", err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("prometheus query did not succeed: %s", response.Status)
+	}
+
+	var samples []prometheusSample
+	for _, series := range response.Data.Result {
+		for _, pair := range series.Values {
+			if len(pair) < 2 {
+				continue
+			}
+			timestamp, ok := pair[0].(float64)
+			if !ok {
+				continue
+			}
+			raw, ok := pair[1].(string)
+			if !ok {
+				continue
+			}
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+			samples = append(samples, prometheusSample{
+				timestamp: time.Unix(int64(timestamp), 0),
+				value:     value,
+			})
+		}
+	}
+	pq.Info("prometheus query finished", "query", query, "samples", len(samples))
+
+	return samples, nil
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyCPUThrottlingThresholdPercent = "param.diagnoser.runtime.cpu_throttling.threshold_percent"
+
+	ContextKeyCPUThrottlingDiagnosisResult  = "diagnoser.runtime.cpu_throttling.result"
+	ContextKeyCPUThrottlingThrottledPercent = "diagnoser.runtime.cpu_throttling.throttled_percent"
+	ContextKeyCPUThrottlingThrottledPeriods = "diagnoser.runtime.cpu_throttling.throttled_periods"
+	ContextKeyCPUThrottlingElapsedPeriods   = "diagnoser.runtime.cpu_throttling.elapsed_periods"
+
+	// defaultCPUThrottlingThresholdPercent is the default percentage of throttled periods over which
+	// the pod is diagnosed as throttled.
+	defaultCPUThrottlingThresholdPercent = 25
+
+	// cgroupRoot is the mount point of the cgroup filesystem. The cpu.stat file of a pod is located
+	// under the cpu controller hierarchy on cgroup v1 and under the unified hierarchy on cgroup v2.
+	cgroupRoot = "/sys/fs/cgroup"
+)
+
+// cpuThrottlingDiagnoser diagnoses cfs quota throttling of the target pod by reading cpu.stat of
+// the pod cgroup.
+type cpuThrottlingDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// cpuThrottlingDiagnoserEnabled indicates whether cpuThrottlingDiagnoser is enabled.
+	cpuThrottlingDiagnoserEnabled bool
+}
+
+// NewCPUThrottlingDiagnoser creates a new cpuThrottlingDiagnoser.
+func NewCPUThrottlingDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	cpuThrottlingDiagnoserEnabled bool,
+) processors.Processor {
+	return &cpuThrottlingDiagnoser{
+		Context:                       ctx,
+		Logger:                        logger,
+		cache:                         cache,
+		cpuThrottlingDiagnoserEnabled: cpuThrottlingDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing cpu throttling of the target pod.
+func (ctd *cpuThrottlingDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !ctd.cpuThrottlingDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("cpu throttling diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			ctd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		thresholdPercent := float64(defaultCPUThrottlingThresholdPercent)
+		if value, ok := contexts[ParameterKeyCPUThrottlingThresholdPercent]; ok {
+			thresholdPercent, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid threshold percent %s: %v", value, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var pod corev1.Pod
+		if err := ctd.cache.Get(ctd, client.ObjectKey{
+			Namespace: podReference.Namespace,
+			Name:      podReference.Name,
+		}, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		cpuStatPath, err := findPodCPUStatPath(string(pod.UID))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to locate cpu.stat of pod %s/%s: %v", pod.Namespace, pod.Name, err), http.StatusInternalServerError)
+			return
+		}
+		elapsedPeriods, throttledPeriods, err := parseCPUStat(cpuStatPath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to parse %s: %v", cpuStatPath, err), http.StatusInternalServerError)
+			return
+		}
+
+		if elapsedPeriods == 0 {
+			http.Error(w, fmt.Sprintf("no cfs period elapsed for pod %s/%s", pod.Namespace, pod.Name), http.StatusInternalServerError)
+			return
+		}
+		throttledPercent := float64(throttledPeriods) / float64(elapsedPeriods) * 100
+		if throttledPercent < thresholdPercent {
+			ctd.Info("cpu throttling below threshold", "pod", client.ObjectKey{
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+			}, "throttledPercent", throttledPercent, "thresholdPercent", thresholdPercent)
+			http.Error(w, fmt.Sprintf("throttled percentage %.2f of pod %s/%s is below threshold %.2f", throttledPercent, pod.Namespace, pod.Name, thresholdPercent), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyCPUThrottlingDiagnosisResult] = fmt.Sprintf("Pod %s/%s was throttled by cfs quota in %.2f%% of elapsed periods.", pod.Namespace, pod.Name, throttledPercent)
+		result[ContextKeyCPUThrottlingThrottledPercent] = fmt.Sprintf("%.2f", throttledPercent)
+		result[ContextKeyCPUThrottlingThrottledPeriods] = strconv.FormatInt(throttledPeriods, 10)
+		result[ContextKeyCPUThrottlingElapsedPeriods] = strconv.FormatInt(elapsedPeriods, 10)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// findPodCPUStatPath searches the cgroup filesystem for the cpu.stat file of the pod cgroup. The
+// search covers cgroup v1 and v2 layouts with both the cgroupfs and systemd cgroup drivers.
+func findPodCPUStatPath(podUID string) (string, error) {
+	// The pod uid is encoded with dashes replaced by underscores in systemd driven cgroup paths.
+	systemdPodUID := strings.ReplaceAll(podUID, "-", "_")
+
+	var cpuStatPath string
+	err := filepath.Walk(cgroupRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if !strings.Contains(info.Name(), podUID) && !strings.Contains(info.Name(), systemdPodUID) {
+			return nil
+		}
+
+		candidate := filepath.Join(path, "cpu.stat")
+		if _, err := os.Stat(candidate); err != nil {
+			return nil
+		}
+		content, err := ioutil.ReadFile(candidate)
+		if err != nil {
+			return nil
+		}
+		// The cpu.stat file under the cpuacct only hierarchy does not contain throttling statistics.
+		if !strings.Contains(string(content), "nr_periods") {
+			return nil
+		}
+
+		cpuStatPath = candidate
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return "", err
+	}
+	if cpuStatPath == "" {
+		return "", fmt.Errorf("cpu.stat of pod cgroup not found under %s", cgroupRoot)
+	}
+
+	return cpuStatPath, nil
+}
+
+// parseCPUStat parses elapsed and throttled cfs period counts from a cpu.stat file. The nr_periods
+// and nr_throttled fields are reported in the same format on cgroup v1 and v2.
+func parseCPUStat(path string) (int64, int64, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var elapsedPeriods, throttledPeriods int64
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "nr_periods":
+			elapsedPeriods = value
+		case "nr_throttled":
+			throttledPeriods = value
+		}
+	}
+
+	return elapsedPeriods, throttledPeriods, nil
+}
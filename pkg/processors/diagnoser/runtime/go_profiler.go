@@ -306,37 +306,35 @@ func (gp *goProfiler) runGoProfiler(name string, namespace string, bindAddress s
 	}
 	gp.Info("Command executed succeessfully.")
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// Shutdown the go profiler http server by killing the profiler process. It is invoked by
+	// the profiler session reaper after the session expires.
+	shutdown := func() {
+		// Kill the process and all of its children with its process group id.
+		pgid, err := syscall.Getpgid(command.Process.Pid)
+		if err != nil {
+			gp.Error(err, "failed to get process group id on go profiler expired", "source", parameter.Source)
+			return
+		}
+		err = syscall.Kill(-pgid, syscall.SIGKILL)
+		if err != nil {
+			gp.Error(err, "failed to kill process on go profiler expired", "source", parameter.Source)
+			return
+		}
+		gp.Info("Process has been killed", "source", parameter.Source, "endpoint", endpoint)
+	}
 
-	// Start go profiler.
-	exit := make(chan error)
-	go func() {
-		defer cancel()
-		exit <- command.Wait()
-	}()
+	processors.RegisterProfilerSession(processors.ProfilerSession{
+		DiagnosisNamespace: namespace,
+		DiagnosisName:      name,
+		Type:               "Go",
+		Endpoint:           endpoint,
+		ExpirationTime:     time.Now().Add(time.Duration(parameter.ExpirationSeconds) * time.Second),
+		Shutdown:           shutdown,
+	})
 
-	// Shutdown go profiler with expiration duration.
+	// Reap the go profiler process on exit.
 	go func() {
-		select {
-		// Wait for go profiler error.
-		case <-ctx.Done():
-			return
-		// Wait for expiration and shutdown go profiler http server by killing the profiler process.
-		case <-time.After(time.Duration(parameter.ExpirationSeconds) * time.Second):
-			// Kill the process and all of its children with its process group id.
-			pgid, err := syscall.Getpgid(command.Process.Pid)
-			if err != nil {
-				gp.Error(err, "failed to get process group id on go profiler expired", "source", parameter.Source)
-			} else {
-				err = syscall.Kill(-pgid, syscall.SIGKILL)
-				if err != nil {
-					gp.Error(err, "failed to kill process on go profiler expired", "source", parameter.Source)
-				} else {
-					gp.Info("Process has been killed", "source", parameter.Source, "endpoint", endpoint)
-
-				}
-			}
-		}
+		command.Wait()
 	}()
 
 	return fmt.Sprintf("Visit http://%s, this server will expire in %d seconds.", endpoint, parameter.ExpirationSeconds), nil
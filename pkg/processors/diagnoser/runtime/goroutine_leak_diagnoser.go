@@ -0,0 +1,190 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyGoroutineLeakSource    = "param.diagnoser.runtime.goroutine_leak.source"
+	ParameterKeyGoroutineLeakThreshold = "param.diagnoser.runtime.goroutine_leak.threshold"
+
+	ContextKeyGoroutineLeakResult = "diagnoser.runtime.goroutine_leak.result"
+	ContextKeyGoroutineLeakTotal  = "diagnoser.runtime.goroutine_leak.total"
+	ContextKeyGoroutineLeakCount  = "diagnoser.runtime.goroutine_leak.count"
+	ContextKeyGoroutineLeakStack  = "diagnoser.runtime.goroutine_leak.stack"
+
+	// defaultGoroutineLeakThreshold is the default goroutine count of a single stack over which
+	// the stack is flagged as leaking.
+	defaultGoroutineLeakThreshold = 100
+
+	// goroutineProfileTimeoutSeconds is the timeout of fetching the goroutine profile.
+	goroutineProfileTimeoutSeconds = 30
+)
+
+// goroutineLeakDiagnoser fetches the goroutine profile of a go program and flags stacks which
+// account for an abnormally high goroutine count.
+type goroutineLeakDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// goroutineLeakDiagnoserEnabled indicates whether goroutineLeakDiagnoser is enabled.
+	goroutineLeakDiagnoserEnabled bool
+}
+
+// NewGoroutineLeakDiagnoser creates a new goroutineLeakDiagnoser.
+func NewGoroutineLeakDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	goroutineLeakDiagnoserEnabled bool,
+) processors.Processor {
+	return &goroutineLeakDiagnoser{
+		Context:                       ctx,
+		Logger:                        logger,
+		goroutineLeakDiagnoserEnabled: goroutineLeakDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing goroutine leaks of a go program.
+func (gl *goroutineLeakDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !gl.goroutineLeakDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("goroutine leak diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			gl.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		source, ok := contexts[ParameterKeyGoroutineLeakSource]
+		if !ok || source == "" {
+			http.Error(w, fmt.Sprintf("must specify goroutine leak diagnoser source"), http.StatusBadRequest)
+			return
+		}
+
+		threshold := defaultGoroutineLeakThreshold
+		if value, ok := contexts[ParameterKeyGoroutineLeakThreshold]; ok && value != "" {
+			threshold, err = strconv.Atoi(value)
+			if err != nil || threshold <= 0 {
+				http.Error(w, fmt.Sprintf("invalid goroutine leak threshold %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		profile, err := gl.fetchGoroutineProfile(source)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to fetch goroutine profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		total, topCount, topStack := parseGoroutineProfile(profile)
+		if topCount < threshold {
+			http.Error(w, fmt.Sprintf("no goroutine leak found: top stack accounts for %d of %d goroutines with threshold %d", topCount, total, threshold), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyGoroutineLeakResult] = fmt.Sprintf("A single stack accounts for %d of %d goroutines.", topCount, total)
+		result[ContextKeyGoroutineLeakTotal] = strconv.Itoa(total)
+		result[ContextKeyGoroutineLeakCount] = strconv.Itoa(topCount)
+		result[ContextKeyGoroutineLeakStack] = topStack
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// fetchGoroutineProfile fetches the goroutine profile in debug text format from the pprof
+// endpoint of the source.
+func (gl *goroutineLeakDiagnoser) fetchGoroutineProfile(source string) (string, error) {
+	cli := &http.Client{
+		Timeout: goroutineProfileTimeoutSeconds * time.Second,
+	}
+	url := fmt.Sprintf("%s%sgoroutine?debug=1", strings.TrimSuffix(source, "/"), goProfilerPathPrefix)
+	res, err := cli.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to do request to %s: %v", url, res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
+
+// parseGoroutineProfile parses a goroutine profile in debug text format and returns the total
+// goroutine count and the count and text of the stack with the most goroutines. A stack block
+// starts with a "<count> @ <addresses>" line followed by one frame per line.
+func parseGoroutineProfile(profile string) (int, int, string) {
+	total := 0
+	topCount := 0
+	topStack := ""
+	for _, block := range strings.Split(profile, "\n\n") {
+		block = strings.TrimSpace(block)
+		lines := strings.SplitN(block, "\n", 2)
+		fields := strings.Fields(lines[0])
+		if len(fields) < 2 || fields[1] != "@" {
+			continue
+		}
+		count, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		total += count
+		if count > topCount {
+			topCount = count
+			topStack = block
+		}
+	}
+
+	return total, topCount, topStack
+}
@@ -0,0 +1,369 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/go-logr/logr"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+	"github.com/kubediag/kubediag/pkg/executor"
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyPerfProfilerExpirationSeconds = "param.diagnoser.runtime.perf_profiler.expiration_seconds"
+	ParameterKeyPerfProfilerDurationSeconds   = "param.diagnoser.runtime.perf_profiler.duration_seconds"
+
+	ContextKeyPerfProfilerResultEndpoint = "diagnoser.runtime.perf_profiler.result.endpoint"
+
+	// defaultPerfProfilerDurationSeconds is the default sampling duration of perf.
+	defaultPerfProfilerDurationSeconds = 30
+	// perfEventParanoidPath is the procfs path of the kernel perf_event_paranoid setting.
+	perfEventParanoidPath = "/proc/sys/kernel/perf_event_paranoid"
+)
+
+// perfProfiler profiles a native process in the target container with perf and serves the folded
+// flamegraph stacks at a time limited endpoint.
+type perfProfiler struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client is the API client that performs all operations against a docker server.
+	client *dockerclient.Client
+	// dataRoot is root directory of persistent kubediag data.
+	dataRoot string
+	// bindAddress is the address on which to advertise.
+	bindAddress string
+	// perfProfilerEnabled indicates whether perfProfiler is enabled.
+	perfProfilerEnabled bool
+}
+
+// NewPerfProfiler creates a new perfProfiler.
+func NewPerfProfiler(
+	ctx context.Context,
+	logger logr.Logger,
+	dockerEndpoint string,
+	dataRoot string,
+	bindAddress string,
+	perfProfilerEnabled bool,
+) (processors.Processor, error) {
+	cli, err := dockerclient.NewClientWithOpts(dockerclient.WithHost(dockerEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return &perfProfiler{
+		Context:             ctx,
+		Logger:              logger,
+		client:              cli,
+		dataRoot:            dataRoot,
+		bindAddress:         bindAddress,
+		perfProfilerEnabled: perfProfilerEnabled,
+	}, nil
+}
+
+// Handler handles http requests for profiling native programs.
+func (pp *perfProfiler) Handler(w http.ResponseWriter, r *http.Request) {
+	if !pp.perfProfilerEnabled {
+		http.Error(w, fmt.Sprintf("perf profiler is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			pp.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		expirationSeconds := processors.DefaultExpirationSeconds
+		if value, ok := contexts[ParameterKeyPerfProfilerExpirationSeconds]; ok {
+			expirationSeconds, err = strconv.Atoi(value)
+			if err != nil {
+				pp.Error(err, "invalid expirationSeconds field")
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if expirationSeconds <= 0 {
+				expirationSeconds = processors.DefaultExpirationSeconds
+			}
+		}
+		durationSeconds := defaultPerfProfilerDurationSeconds
+		if value, ok := contexts[ParameterKeyPerfProfilerDurationSeconds]; ok {
+			durationSeconds, err = strconv.Atoi(value)
+			if err != nil {
+				pp.Error(err, "invalid durationSeconds field")
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if durationSeconds <= 0 {
+				durationSeconds = defaultPerfProfilerDurationSeconds
+			}
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		// Fail early with a clear message if the kernel forbids profiling.
+		if err := checkPerfEventParanoid(); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		pid, err := pp.getContainerPID(podReference)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to resolve container pid: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		namespace := contexts[executor.DiagnosisNamespaceTelemetryKey]
+		name := contexts[executor.DiagnosisNameTelemetryKey]
+
+		endpoint, err := pp.runPerfProfiler(namespace, name, podReference, pid, durationSeconds, expirationSeconds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to run perf profiler: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyPerfProfilerResultEndpoint] = endpoint
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal perf profiler results: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// getContainerPID resolves the pid of the target container on the node by inspecting containers
+// of the pod. The first container which is not the pod sandbox is picked if the container name is
+// not specified in the pod reference.
+func (pp *perfProfiler) getContainerPID(podReference diagnosisv1.PodReference) (int, error) {
+	containers, err := pp.client.ContainerList(pp, dockertypes.ContainerListOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, container := range containers {
+		if container.Labels[podNamespaceDockerLabel] != podReference.Namespace ||
+			container.Labels[podNameDockerLabel] != podReference.Name {
+			continue
+		}
+		if container.Labels[containerNameDockerLabel] == pauseContainerName {
+			continue
+		}
+		if podReference.Container != "" && container.Labels[containerNameDockerLabel] != podReference.Container {
+			continue
+		}
+
+		containerJSON, err := pp.client.ContainerInspect(pp, container.ID)
+		if err != nil {
+			return 0, err
+		}
+		if containerJSON.State == nil || containerJSON.State.Pid == 0 {
+			return 0, fmt.Errorf("container %s of pod %s/%s is not running", container.Labels[containerNameDockerLabel], podReference.Namespace, podReference.Name)
+		}
+
+		return containerJSON.State.Pid, nil
+	}
+
+	return 0, fmt.Errorf("container of pod %s/%s not found on the node", podReference.Namespace, podReference.Name)
+}
+
+// runPerfProfiler samples the native process with perf, folds the sampled stacks into flamegraph
+// input format and serves the result at an endpoint which expires after the expiration duration.
+func (pp *perfProfiler) runPerfProfiler(namespace string, name string, podReference diagnosisv1.PodReference, pid int, durationSeconds int, expirationSeconds int) (string, error) {
+	pp.Info("Start to run perf profiling", "pod", podReference, "pid", pid)
+
+	// Set perf profiler directory and data file names.
+	now := time.Now().Format("20060102150405")
+	datadir := filepath.Join(pp.dataRoot, "profilers/perf", podReference.Namespace+"."+podReference.Name+"."+podReference.Container, now)
+	if _, err := os.Stat(datadir); os.IsNotExist(err) {
+		err := os.MkdirAll(datadir, os.ModePerm)
+		if err != nil {
+			return "", err
+		}
+	}
+	perfDataFile := filepath.Join(datadir, "perf.data")
+	foldedFile := filepath.Join(datadir, fmt.Sprintf("%s.%s.folded", podReference.Namespace, podReference.Name))
+
+	// Sample the process with call graphs for the duration.
+	out, err := util.BlockingRunCommandWithTimeout([]string{
+		"perf", "record",
+		"-F", "99",
+		"-g",
+		"--pid", strconv.Itoa(pid),
+		"--output", perfDataFile,
+		"--", "sleep", strconv.Itoa(durationSeconds),
+	}, int32(durationSeconds)+processors.DefaultTimeoutSeconds)
+	if err != nil {
+		if strings.Contains(string(out), "perf_event_paranoid") {
+			return "", fmt.Errorf("perf record is not permitted by kernel.perf_event_paranoid: %s", string(out))
+		}
+		return "", fmt.Errorf("execute command perf record with error %v: %s", err, string(out))
+	}
+
+	// Dump the sampled stack traces and fold them into flamegraph input format.
+	out, err = util.BlockingRunCommandWithTimeout([]string{
+		"perf", "script",
+		"--input", perfDataFile,
+	}, processors.DefaultTimeoutSeconds)
+	if err != nil {
+		return "", fmt.Errorf("execute command perf script with error %v: %s", err, string(out))
+	}
+	if err := ioutil.WriteFile(foldedFile, []byte(foldPerfScriptOutput(string(out))), 0644); err != nil {
+		return "", err
+	}
+
+	port, err := util.GetAvailablePort()
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("%s:%d", pp.bindAddress, port)
+
+	// Serve the folded stacks and shutdown the http server on expiration.
+	server := &http.Server{
+		Addr:    endpoint,
+		Handler: http.FileServer(http.Dir(datadir)),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			pp.Error(err, "failed to serve perf profiler result", "endpoint", endpoint)
+		}
+	}()
+	go func() {
+		<-time.After(time.Duration(expirationSeconds) * time.Second)
+		if err := server.Close(); err != nil {
+			pp.Error(err, "failed to shutdown perf profiler server on expiration", "endpoint", endpoint)
+		} else {
+			pp.Info("Perf profiler server has been shutdown", "endpoint", endpoint)
+		}
+	}()
+
+	processors.RegisterProfilerSession(processors.ProfilerSession{
+		DiagnosisNamespace: namespace,
+		DiagnosisName:      name,
+		Type:               "Perf",
+		Endpoint:           endpoint,
+		ExpirationTime:     time.Now().Add(time.Duration(expirationSeconds) * time.Second),
+	})
+
+	return fmt.Sprintf("Visit http://%s, this server will expire in %d seconds.", endpoint, expirationSeconds), nil
+}
+
+// checkPerfEventParanoid returns an error if the kernel perf_event_paranoid setting disallows
+// profiling other processes.
+func checkPerfEventParanoid() error {
+	data, err := ioutil.ReadFile(perfEventParanoidPath)
+	if err != nil {
+		// Leave the decision to perf if the setting cannot be read.
+		return nil
+	}
+
+	paranoid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil
+	}
+	if paranoid > 2 {
+		return fmt.Errorf("kernel.perf_event_paranoid is %d, cpu profiling with perf is not permitted on the node", paranoid)
+	}
+
+	return nil
+}
+
+// foldPerfScriptOutput folds stack traces in perf script output into flamegraph input format. Each
+// output line contains a semicolon separated stack followed by the sample count of the stack.
+func foldPerfScriptOutput(output string) string {
+	counts := make(map[string]int)
+	var frames []string
+	flush := func() {
+		if len(frames) == 0 {
+			return
+		}
+		// Stacks are printed leaf first while flamegraphs expect root first.
+		var stack []string
+		for i := len(frames) - 1; i >= 0; i-- {
+			stack = append(stack, frames[i])
+		}
+		counts[strings.Join(stack, ";")]++
+		frames = nil
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		// Stack frame lines are indented and contain the address, symbol and shared object of
+		// the frame. Event header lines are not indented and terminate the previous stack.
+		if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			flush()
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		symbol := strings.Join(fields[1:len(fields)-1], " ")
+		if symbol == "" {
+			symbol = "[unknown]"
+		}
+		frames = append(frames, symbol)
+	}
+	flush()
+
+	stacks := make([]string, 0, len(counts))
+	for stack := range counts {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	var builder strings.Builder
+	for _, stack := range stacks {
+		builder.WriteString(fmt.Sprintf("%s %d\n", stack, counts[stack]))
+	}
+
+	return builder.String()
+}
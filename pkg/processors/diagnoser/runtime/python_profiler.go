@@ -0,0 +1,275 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/go-logr/logr"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+	"github.com/kubediag/kubediag/pkg/executor"
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyPythonProfilerExpirationSeconds = "param.diagnoser.runtime.python_profiler.expiration_seconds"
+	ParameterKeyPythonProfilerDurationSeconds   = "param.diagnoser.runtime.python_profiler.duration_seconds"
+
+	ContextKeyPythonProfilerResultEndpoint = "diagnoser.runtime.python_profiler.result.endpoint"
+
+	// defaultPythonProfilerDurationSeconds is the default sampling duration of py-spy.
+	defaultPythonProfilerDurationSeconds = 30
+
+	// podNamespaceDockerLabel is the docker label containing the pod namespace of a container.
+	podNamespaceDockerLabel = "io.kubernetes.pod.namespace"
+	// podNameDockerLabel is the docker label containing the pod name of a container.
+	podNameDockerLabel = "io.kubernetes.pod.name"
+	// containerNameDockerLabel is the docker label containing the container name of a container.
+	containerNameDockerLabel = "io.kubernetes.container.name"
+	// pauseContainerName is the container name of the pod sandbox.
+	pauseContainerName = "POD"
+)
+
+// pythonProfiler profiles a python process in the target container with py-spy and serves the
+// generated flamegraph at a time limited endpoint.
+type pythonProfiler struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client is the API client that performs all operations against a docker server.
+	client *dockerclient.Client
+	// dataRoot is root directory of persistent kubediag data.
+	dataRoot string
+	// bindAddress is the address on which to advertise.
+	bindAddress string
+	// pythonProfilerEnabled indicates whether pythonProfiler is enabled.
+	pythonProfilerEnabled bool
+}
+
+// NewPythonProfiler creates a new pythonProfiler.
+func NewPythonProfiler(
+	ctx context.Context,
+	logger logr.Logger,
+	dockerEndpoint string,
+	dataRoot string,
+	bindAddress string,
+	pythonProfilerEnabled bool,
+) (processors.Processor, error) {
+	cli, err := dockerclient.NewClientWithOpts(dockerclient.WithHost(dockerEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pythonProfiler{
+		Context:               ctx,
+		Logger:                logger,
+		client:                cli,
+		dataRoot:              dataRoot,
+		bindAddress:           bindAddress,
+		pythonProfilerEnabled: pythonProfilerEnabled,
+	}, nil
+}
+
+// Handler handles http requests for profiling python programs.
+func (pp *pythonProfiler) Handler(w http.ResponseWriter, r *http.Request) {
+	if !pp.pythonProfilerEnabled {
+		http.Error(w, fmt.Sprintf("python profiler is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			pp.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		expirationSeconds := processors.DefaultExpirationSeconds
+		if value, ok := contexts[ParameterKeyPythonProfilerExpirationSeconds]; ok {
+			expirationSeconds, err = strconv.Atoi(value)
+			if err != nil {
+				pp.Error(err, "invalid expirationSeconds field")
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if expirationSeconds <= 0 {
+				expirationSeconds = processors.DefaultExpirationSeconds
+			}
+		}
+		durationSeconds := defaultPythonProfilerDurationSeconds
+		if value, ok := contexts[ParameterKeyPythonProfilerDurationSeconds]; ok {
+			durationSeconds, err = strconv.Atoi(value)
+			if err != nil {
+				pp.Error(err, "invalid durationSeconds field")
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if durationSeconds <= 0 {
+				durationSeconds = defaultPythonProfilerDurationSeconds
+			}
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		pid, err := pp.getContainerPID(podReference)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to resolve container pid: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		namespace := contexts[executor.DiagnosisNamespaceTelemetryKey]
+		name := contexts[executor.DiagnosisNameTelemetryKey]
+
+		endpoint, err := pp.runPythonProfiler(namespace, name, podReference, pid, durationSeconds, expirationSeconds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to run python profiler: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyPythonProfilerResultEndpoint] = endpoint
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal python profiler results: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// getContainerPID resolves the pid of the target container on the node by inspecting containers
+// of the pod. The first container which is not the pod sandbox is picked if the container name is
+// not specified in the pod reference.
+func (pp *pythonProfiler) getContainerPID(podReference diagnosisv1.PodReference) (int, error) {
+	containers, err := pp.client.ContainerList(pp, dockertypes.ContainerListOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, container := range containers {
+		if container.Labels[podNamespaceDockerLabel] != podReference.Namespace ||
+			container.Labels[podNameDockerLabel] != podReference.Name {
+			continue
+		}
+		if container.Labels[containerNameDockerLabel] == pauseContainerName {
+			continue
+		}
+		if podReference.Container != "" && container.Labels[containerNameDockerLabel] != podReference.Container {
+			continue
+		}
+
+		containerJSON, err := pp.client.ContainerInspect(pp, container.ID)
+		if err != nil {
+			return 0, err
+		}
+		if containerJSON.State == nil || containerJSON.State.Pid == 0 {
+			return 0, fmt.Errorf("container %s of pod %s/%s is not running", container.Labels[containerNameDockerLabel], podReference.Namespace, podReference.Name)
+		}
+
+		return containerJSON.State.Pid, nil
+	}
+
+	return 0, fmt.Errorf("container of pod %s/%s not found on the node", podReference.Namespace, podReference.Name)
+}
+
+// runPythonProfiler generates a flamegraph of the python process by running py-spy and serves the
+// flamegraph at an endpoint which expires after the expiration duration.
+func (pp *pythonProfiler) runPythonProfiler(namespace string, name string, podReference diagnosisv1.PodReference, pid int, durationSeconds int, expirationSeconds int) (string, error) {
+	pp.Info("Start to run python profiling", "pod", podReference, "pid", pid)
+
+	// Set python profiler directory and flamegraph file name.
+	now := time.Now().Format("20060102150405")
+	datadir := filepath.Join(pp.dataRoot, "profilers/python/pyspy", podReference.Namespace+"."+podReference.Name+"."+podReference.Container, now)
+	if _, err := os.Stat(datadir); os.IsNotExist(err) {
+		err := os.MkdirAll(datadir, os.ModePerm)
+		if err != nil {
+			return "", err
+		}
+	}
+	datafile := filepath.Join(datadir, fmt.Sprintf("%s.%s.flamegraph.svg", podReference.Namespace, podReference.Name))
+
+	// Run py-spy against the python process with timeout.
+	out, err := util.BlockingRunCommandWithTimeout([]string{
+		"py-spy", "record",
+		"--pid", strconv.Itoa(pid),
+		"--duration", strconv.Itoa(durationSeconds),
+		"--format", "flamegraph",
+		"--output", datafile,
+	}, int32(durationSeconds)+processors.DefaultTimeoutSeconds)
+	if err != nil {
+		return "", fmt.Errorf("execute command py-spy with error %v: %s", err, string(out))
+	}
+
+	port, err := util.GetAvailablePort()
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("%s:%d", pp.bindAddress, port)
+
+	// Serve the flamegraph and shutdown the http server on expiration.
+	server := &http.Server{
+		Addr:    endpoint,
+		Handler: http.FileServer(http.Dir(datadir)),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			pp.Error(err, "failed to serve python profiler flamegraph", "endpoint", endpoint)
+		}
+	}()
+	go func() {
+		<-time.After(time.Duration(expirationSeconds) * time.Second)
+		if err := server.Close(); err != nil {
+			pp.Error(err, "failed to shutdown python profiler server on expiration", "endpoint", endpoint)
+		} else {
+			pp.Info("Python profiler server has been shutdown", "endpoint", endpoint)
+		}
+	}()
+
+	processors.RegisterProfilerSession(processors.ProfilerSession{
+		DiagnosisNamespace: namespace,
+		DiagnosisName:      name,
+		Type:               "Python",
+		Endpoint:           endpoint,
+		ExpirationTime:     time.Now().Add(time.Duration(expirationSeconds) * time.Second),
+	})
+
+	return fmt.Sprintf("Visit http://%s, this server will expire in %d seconds.", endpoint, expirationSeconds), nil
+}
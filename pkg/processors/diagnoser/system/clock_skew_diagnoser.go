@@ -0,0 +1,250 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyClockSkewReference        = "param.diagnoser.system.clock_skew.reference"
+	ParameterKeyClockSkewThresholdSeconds = "param.diagnoser.system.clock_skew.threshold_seconds"
+
+	ContextKeyClockSkewDiagnosisResult = "diagnoser.system.clock_skew.result"
+	ContextKeyClockSkewOffsetSeconds   = "diagnoser.system.clock_skew.offset_seconds"
+	ContextKeyClockSkewReference       = "diagnoser.system.clock_skew.reference"
+	ContextKeyClockSkewTimeSyncDaemon  = "diagnoser.system.clock_skew.time_sync_daemon"
+
+	// defaultClockSkewReference is the default reference which the node system time is compared
+	// against.
+	defaultClockSkewReference = "pool.ntp.org"
+	// defaultClockSkewThresholdSeconds is the default clock skew in seconds over which the node
+	// clock is diagnosed as skewed.
+	defaultClockSkewThresholdSeconds = 5
+	// clockSkewQueryTimeoutSeconds is the timeout in seconds of one query to the reference.
+	clockSkewQueryTimeoutSeconds = 5
+	// ntpPort is the default udp port of the network time protocol.
+	ntpPort = "123"
+	// ntpEpochOffsetSeconds is the offset in seconds between the ntp epoch of 1900 and the unix
+	// epoch of 1970.
+	ntpEpochOffsetSeconds = 2208988800
+)
+
+// clockSkewDiagnoser compares the node system time against a reference time source and diagnoses
+// the node clock as skewed if the offset exceeds a threshold. Clock skew causes certificate and
+// token validation failures which masquerade as other problems.
+type clockSkewDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// clockSkewDiagnoserEnabled indicates whether clockSkewDiagnoser is enabled.
+	clockSkewDiagnoserEnabled bool
+}
+
+// NewClockSkewDiagnoser creates a new clockSkewDiagnoser.
+func NewClockSkewDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	clockSkewDiagnoserEnabled bool,
+) processors.Processor {
+	return &clockSkewDiagnoser{
+		Context:                   ctx,
+		Logger:                    logger,
+		clockSkewDiagnoserEnabled: clockSkewDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing node clock skew.
+func (cs *clockSkewDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !cs.clockSkewDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("clock skew diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			cs.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		reference := defaultClockSkewReference
+		if value, ok := contexts[ParameterKeyClockSkewReference]; ok && value != "" {
+			reference = value
+		}
+		thresholdSeconds := defaultClockSkewThresholdSeconds
+		if value, ok := contexts[ParameterKeyClockSkewThresholdSeconds]; ok {
+			thresholdSeconds, err = strconv.Atoi(value)
+			if err != nil || thresholdSeconds <= 0 {
+				http.Error(w, fmt.Sprintf("invalid threshold seconds %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// The reference is queried with the http Date header if it is a url and with an sntp
+		// query otherwise.
+		var offset time.Duration
+		if strings.HasPrefix(reference, "http://") || strings.HasPrefix(reference, "https://") {
+			offset, err = queryHTTPDateOffset(reference)
+		} else {
+			offset, err = queryNTPOffset(reference)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to query reference time source %s: %v", reference, err), http.StatusInternalServerError)
+			return
+		}
+
+		daemon := runningTimeSyncDaemon()
+
+		if math.Abs(offset.Seconds()) < float64(thresholdSeconds) {
+			http.Error(w, fmt.Sprintf("node clock skew of %.3f seconds against %s is below threshold of %d seconds", offset.Seconds(), reference, thresholdSeconds), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyClockSkewDiagnosisResult] = fmt.Sprintf("Node clock is skewed by %.3f seconds against %s which exceeds the threshold of %d seconds.", offset.Seconds(), reference, thresholdSeconds)
+		result[ContextKeyClockSkewOffsetSeconds] = fmt.Sprintf("%.3f", offset.Seconds())
+		result[ContextKeyClockSkewReference] = reference
+		result[ContextKeyClockSkewTimeSyncDaemon] = daemon
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// queryHTTPDateOffset measures the offset of the local clock against the Date header of the url.
+// The local time is taken at the midpoint of the request to compensate for the round trip.
+func queryHTTPDateOffset(url string) (time.Duration, error) {
+	client := &http.Client{
+		Timeout: clockSkewQueryTimeoutSeconds * time.Second,
+	}
+
+	before := time.Now()
+	resp, err := client.Head(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	after := time.Now()
+
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return 0, fmt.Errorf("no Date header in response from %s", url)
+	}
+	referenceTime, err := http.ParseTime(date)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header %s: %v", date, err)
+	}
+
+	local := before.Add(after.Sub(before) / 2)
+	return referenceTime.Sub(local), nil
+}
+
+// queryNTPOffset measures the offset of the local clock against the ntp server with an sntp
+// query. The server may be specified with or without a port.
+func queryNTPOffset(server string) (time.Duration, error) {
+	address := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		address = net.JoinHostPort(server, ntpPort)
+	}
+
+	conn, err := net.DialTimeout("udp", address, clockSkewQueryTimeoutSeconds*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(clockSkewQueryTimeoutSeconds * time.Second)); err != nil {
+		return 0, err
+	}
+
+	// A minimal sntp client request with leap indicator not set, version 3 and client mode.
+	request := make([]byte, 48)
+	request[0] = 0x1B
+
+	before := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	response := make([]byte, 48)
+	if _, err := conn.Read(response); err != nil {
+		return 0, err
+	}
+	after := time.Now()
+
+	// The transmit timestamp holds the server time in seconds since 1900 with a 32 bit binary
+	// fraction.
+	seconds := binary.BigEndian.Uint32(response[40:44])
+	fraction := binary.BigEndian.Uint32(response[44:48])
+	referenceTime := time.Unix(int64(seconds)-ntpEpochOffsetSeconds, int64(float64(fraction)/(1<<32)*float64(time.Second)))
+
+	local := before.Add(after.Sub(before) / 2)
+	return referenceTime.Sub(local), nil
+}
+
+// runningTimeSyncDaemon returns the name of the running time synchronization daemon as
+// supplementary evidence, or None if neither chronyd nor ntpd is found in procfs.
+func runningTimeSyncDaemon() string {
+	entries, err := ioutil.ReadDir(procfsRoot)
+	if err != nil {
+		return "None"
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s/comm", procfsRoot, entry.Name()))
+		if err != nil {
+			continue
+		}
+		comm := strings.TrimSpace(string(data))
+		if comm == "chronyd" || comm == "ntpd" || comm == "systemd-timesyn" {
+			return comm
+		}
+	}
+
+	return "None"
+}
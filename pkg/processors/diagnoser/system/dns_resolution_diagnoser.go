@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyDNSResolutionNames                     = "param.diagnoser.system.dns_resolution.names"
+	ParameterKeyDNSResolutionSlowThresholdMilliseconds = "param.diagnoser.system.dns_resolution.slow_threshold_milliseconds"
+
+	ContextKeyDNSResolutionResults    = "diagnoser.system.dns_resolution.results"
+	ContextKeyDNSResolutionResolvConf = "diagnoser.system.dns_resolution.resolv_conf"
+
+	// defaultDNSResolutionNames are the names resolved if not specified. The kubernetes service
+	// name covers cluster dns and the external host covers upstream resolution.
+	defaultDNSResolutionNames = "kubernetes.default.svc.cluster.local,kubernetes.io"
+	// defaultDNSResolutionSlowThresholdMilliseconds is the default latency in milliseconds over
+	// which a resolution is diagnosed as slow.
+	defaultDNSResolutionSlowThresholdMilliseconds = 1000
+	// dnsResolutionTimeoutSeconds is the timeout in seconds of one name resolution.
+	dnsResolutionTimeoutSeconds = 5
+	// resolvConfPath is the path of the resolver configuration on the node.
+	resolvConfPath = "/etc/resolv.conf"
+)
+
+// dnsResolutionResult contains the result of resolving one name.
+type dnsResolutionResult struct {
+	// Name is the name which has been resolved.
+	Name string `json:"name"`
+	// Succeeded indicates whether the resolution succeeded.
+	Succeeded bool `json:"succeeded"`
+	// Slow indicates whether the resolution latency exceeded the slow threshold.
+	Slow bool `json:"slow,omitempty"`
+	// LatencyMilliseconds is the latency of the resolution in milliseconds.
+	LatencyMilliseconds int64 `json:"latencyMilliseconds"`
+	// Addresses are the resolved addresses on success.
+	Addresses []string `json:"addresses,omitempty"`
+	// Error is the resolution error on failure.
+	Error string `json:"error,omitempty"`
+}
+
+// dnsResolutionDiagnoser resolves a set of names on the node and diagnoses dns as broken if any
+// resolution fails or exceeds a latency threshold. Per name latency and the node resolver
+// configuration are recorded as supporting evidence.
+type dnsResolutionDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// dnsResolutionDiagnoserEnabled indicates whether dnsResolutionDiagnoser is enabled.
+	dnsResolutionDiagnoserEnabled bool
+}
+
+// NewDNSResolutionDiagnoser creates a new dnsResolutionDiagnoser.
+func NewDNSResolutionDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	dnsResolutionDiagnoserEnabled bool,
+) processors.Processor {
+	return &dnsResolutionDiagnoser{
+		Context:                       ctx,
+		Logger:                        logger,
+		dnsResolutionDiagnoserEnabled: dnsResolutionDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing dns resolution on the node.
+func (dd *dnsResolutionDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !dd.dnsResolutionDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("dns resolution diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			dd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		names := defaultDNSResolutionNames
+		if value, ok := contexts[ParameterKeyDNSResolutionNames]; ok && value != "" {
+			names = value
+		}
+		slowThresholdMilliseconds := defaultDNSResolutionSlowThresholdMilliseconds
+		if value, ok := contexts[ParameterKeyDNSResolutionSlowThresholdMilliseconds]; ok {
+			slowThresholdMilliseconds, err = strconv.Atoi(value)
+			if err != nil || slowThresholdMilliseconds <= 0 {
+				http.Error(w, fmt.Sprintf("invalid slow threshold milliseconds %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		results := make([]dnsResolutionResult, 0)
+		unhealthy := false
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			resolution := dd.resolveName(name, time.Duration(slowThresholdMilliseconds)*time.Millisecond)
+			if !resolution.Succeeded || resolution.Slow {
+				unhealthy = true
+			}
+			results = append(results, resolution)
+		}
+		if len(results) == 0 {
+			http.Error(w, fmt.Sprintf("must specify at least one name in %s", ParameterKeyDNSResolutionNames), http.StatusNotAcceptable)
+			return
+		}
+
+		if !unhealthy {
+			http.Error(w, fmt.Sprintf("all %d names resolved below the threshold of %d milliseconds", len(results), slowThresholdMilliseconds), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		resultsData, err := json.Marshal(results)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal resolution results: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result[ContextKeyDNSResolutionResults] = string(resultsData)
+		// The resolver configuration is recorded as supporting evidence. A read failure is not
+		// fatal since the resolution results alone identify the problem.
+		resolvConf, err := ioutil.ReadFile(resolvConfPath)
+		if err != nil {
+			dd.Error(err, "failed to read resolver configuration", "path", resolvConfPath)
+		} else {
+			result[ContextKeyDNSResolutionResolvConf] = string(resolvConf)
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// resolveName resolves the name with the node resolver configuration and measures the latency.
+func (dd *dnsResolutionDiagnoser) resolveName(name string, slowThreshold time.Duration) dnsResolutionResult {
+	ctx, cancel := context.WithTimeout(dd, dnsResolutionTimeoutSeconds*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	addresses, err := net.DefaultResolver.LookupHost(ctx, name)
+	latency := time.Since(start)
+
+	resolution := dnsResolutionResult{
+		Name:                name,
+		LatencyMilliseconds: latency.Milliseconds(),
+	}
+	if err != nil {
+		dd.Info("name resolution failed", "name", name, "latency", latency, "error", err)
+		resolution.Error = err.Error()
+		return resolution
+	}
+
+	resolution.Succeeded = true
+	resolution.Addresses = addresses
+	if latency > slowThreshold {
+		dd.Info("name resolution is slow", "name", name, "latency", latency, "threshold", slowThreshold)
+		resolution.Slow = true
+	}
+
+	return resolution
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	systemcollector "github.com/kubediag/kubediag/pkg/processors/collector/system"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/types"
+)
+
+const (
+	ParameterKeyFDExhaustionThresholdPercent = "param.diagnoser.system.fd_exhaustion.threshold_percent"
+
+	ContextKeyFDExhaustionDiagnosisResult = "diagnoser.system.fd_exhaustion.result"
+	ContextKeyFDExhaustionPID             = "diagnoser.system.fd_exhaustion.pid"
+	ContextKeyFDExhaustionOpenFDs         = "diagnoser.system.fd_exhaustion.open_fds"
+	ContextKeyFDExhaustionSoftLimit       = "diagnoser.system.fd_exhaustion.soft_limit"
+	ContextKeyFDExhaustionUsagePercent    = "diagnoser.system.fd_exhaustion.usage_percent"
+
+	// defaultFDExhaustionThresholdPercent is the default file descriptor usage percent over which
+	// a process is diagnosed as exhausting its file descriptor limit.
+	defaultFDExhaustionThresholdPercent = 80
+
+	// procfsRoot is the mount point of procfs.
+	procfsRoot = "/proc"
+)
+
+// fdExhaustionDiagnoser compares open file descriptor counts of processes against their soft
+// limits and diagnoses processes which are about to exhaust the limit.
+type fdExhaustionDiagnoser struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// fdExhaustionDiagnoserEnabled indicates whether fdExhaustionDiagnoser is enabled.
+	fdExhaustionDiagnoserEnabled bool
+}
+
+// NewFDExhaustionDiagnoser creates a new fdExhaustionDiagnoser.
+func NewFDExhaustionDiagnoser(
+	ctx context.Context,
+	logger logr.Logger,
+	fdExhaustionDiagnoserEnabled bool,
+) processors.Processor {
+	return &fdExhaustionDiagnoser{
+		Context:                      ctx,
+		Logger:                       logger,
+		fdExhaustionDiagnoserEnabled: fdExhaustionDiagnoserEnabled,
+	}
+}
+
+// Handler handles http requests for diagnosing file descriptor exhaustion.
+func (fd *fdExhaustionDiagnoser) Handler(w http.ResponseWriter, r *http.Request) {
+	if !fd.fdExhaustionDiagnoserEnabled {
+		http.Error(w, fmt.Sprintf("fd exhaustion diagnoser is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			fd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		thresholdPercent := defaultFDExhaustionThresholdPercent
+		if value, ok := contexts[ParameterKeyFDExhaustionThresholdPercent]; ok {
+			thresholdPercent, err = strconv.Atoi(value)
+			if err != nil || thresholdPercent <= 0 || thresholdPercent > 100 {
+				http.Error(w, fmt.Sprintf("invalid threshold percent %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Work off already collected process data in contexts when present and fall back to
+		// scanning procfs directly.
+		pids, err := fd.resolvePIDs(contexts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to resolve pids: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Pick the process with the highest file descriptor usage percent. Processes whose file
+		// descriptor information cannot be read are skipped.
+		var offendingPID int32
+		var offendingOpen, offendingLimit uint64
+		var offendingPercent float64
+		for _, pid := range pids {
+			open, limit, err := readProcessFDUsage(pid)
+			if err != nil || limit == 0 {
+				continue
+			}
+			percent := float64(open) * 100 / float64(limit)
+			if percent > offendingPercent {
+				offendingPID = pid
+				offendingOpen = open
+				offendingLimit = limit
+				offendingPercent = percent
+			}
+		}
+
+		if offendingPercent < float64(thresholdPercent) {
+			http.Error(w, fmt.Sprintf("no process exceeds file descriptor usage threshold of %d percent", thresholdPercent), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyFDExhaustionDiagnosisResult] = fmt.Sprintf("Process %d has opened %d of %d allowed file descriptors (%.1f percent) and is about to exhaust its file descriptor limit.", offendingPID, offendingOpen, offendingLimit, offendingPercent)
+		result[ContextKeyFDExhaustionPID] = strconv.FormatInt(int64(offendingPID), 10)
+		result[ContextKeyFDExhaustionOpenFDs] = strconv.FormatUint(offendingOpen, 10)
+		result[ContextKeyFDExhaustionSoftLimit] = strconv.FormatUint(offendingLimit, 10)
+		result[ContextKeyFDExhaustionUsagePercent] = fmt.Sprintf("%.1f", offendingPercent)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// resolvePIDs returns the pids to inspect. Pids are taken from the process collector output in
+// contexts when present, otherwise procfs is scanned for all processes on the node.
+func (fd *fdExhaustionDiagnoser) resolvePIDs(contexts map[string]string) ([]int32, error) {
+	if raw, ok := contexts[systemcollector.ContextKeyProcessList]; ok && raw != "" {
+		var processes []types.Process
+		if err := json.Unmarshal([]byte(raw), &processes); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal process list: %v", err)
+		}
+
+		pids := make([]int32, 0, len(processes))
+		for _, process := range processes {
+			pids = append(pids, process.PID)
+		}
+		return pids, nil
+	}
+
+	entries, err := ioutil.ReadDir(procfsRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int32
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pid, err := strconv.ParseInt(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		pids = append(pids, int32(pid))
+	}
+
+	return pids, nil
+}
+
+// readProcessFDUsage returns the open file descriptor count and the soft limit on open files of
+// the process. A zero limit is returned if the limit is unlimited.
+func readProcessFDUsage(pid int32) (uint64, uint64, error) {
+	entries, err := ioutil.ReadDir(fmt.Sprintf("%s/%d/fd", procfsRoot, pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	open := uint64(len(entries))
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%d/limits", procfsRoot, pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			break
+		}
+		if fields[3] == "unlimited" {
+			return open, 0, nil
+		}
+		limit, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		return open, limit, nil
+	}
+
+	return 0, 0, fmt.Errorf("max open files limit of process %d not found", pid)
+}
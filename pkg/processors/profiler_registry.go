@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// DefaultProfilerSessionReaperInterval is the default interval on which the profiler session
+// reaper shuts down expired sessions.
+const DefaultProfilerSessionReaperInterval = 30 * time.Second
+
+// ProfilerSession describes a live profiler endpoint hosted by the node agent. Profiler
+// processors register a session when they start serving a result endpoint so that all live
+// endpoints on the node can be listed in one place.
+type ProfilerSession struct {
+	// DiagnosisNamespace is the namespace of the diagnosis which started the profiler.
+	DiagnosisNamespace string `json:"diagnosisNamespace,omitempty"`
+	// DiagnosisName is the name of the diagnosis which started the profiler.
+	DiagnosisName string `json:"diagnosisName,omitempty"`
+	// Type is the type of the profiler, such as Go, Python or Perf.
+	Type string `json:"type"`
+	// Endpoint is the address on which the profiler result is served.
+	Endpoint string `json:"endpoint"`
+	// ExpirationTime is the time at which the profiler endpoint expires.
+	ExpirationTime time.Time `json:"expirationTime"`
+	// Expired indicates whether the session has passed its expiration time but has not been
+	// reaped yet.
+	Expired bool `json:"expired"`
+	// Shutdown tears down the server or process backing the profiler endpoint and frees its
+	// port. It is invoked once by the session reaper after the session expires.
+	Shutdown func() `json:"-"`
+}
+
+var (
+	// profilerSessionsMutex protects profilerSessions.
+	profilerSessionsMutex sync.Mutex
+	// profilerSessions holds the profiler sessions registered by profiler processors. Expired
+	// sessions are shut down and removed by the session reaper.
+	profilerSessions []ProfilerSession
+)
+
+// RegisterProfilerSession records a live profiler session hosted by the node agent.
+func RegisterProfilerSession(session ProfilerSession) {
+	profilerSessionsMutex.Lock()
+	defer profilerSessionsMutex.Unlock()
+
+	profilerSessions = append(profilerSessions, session)
+}
+
+// ListProfilerSessions returns all registered profiler sessions. Sessions past their
+// expiration time are marked as expired and remain listed until the session reaper shuts
+// them down.
+func ListProfilerSessions() []ProfilerSession {
+	profilerSessionsMutex.Lock()
+	defer profilerSessionsMutex.Unlock()
+
+	now := time.Now()
+	sessions := make([]ProfilerSession, len(profilerSessions))
+	copy(sessions, profilerSessions)
+	for i := range sessions {
+		if !sessions[i].ExpirationTime.After(now) {
+			sessions[i].Expired = true
+		}
+	}
+	return sessions
+}
+
+// RunProfilerSessionReaper shuts down expired profiler sessions on the specified interval
+// until the stop channel is closed. The default interval is applied if the interval is not
+// positive.
+func RunProfilerSessionReaper(logger logr.Logger, interval time.Duration, stopCh <-chan struct{}) {
+	if interval <= 0 {
+		interval = DefaultProfilerSessionReaperInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reapExpiredProfilerSessions(logger)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// reapExpiredProfilerSessions removes all expired profiler sessions from the registry and
+// invokes their shutdown functions to free the ports they are serving on. It returns the
+// number of sessions reaped.
+func reapExpiredProfilerSessions(logger logr.Logger) int {
+	profilerSessionsMutex.Lock()
+	now := time.Now()
+	live := profilerSessions[:0]
+	expired := make([]ProfilerSession, 0)
+	for _, session := range profilerSessions {
+		if session.ExpirationTime.After(now) {
+			live = append(live, session)
+		} else {
+			expired = append(expired, session)
+		}
+	}
+	profilerSessions = live
+	profilerSessionsMutex.Unlock()
+
+	// Shut down the sessions outside the lock since tearing down a profiler process may block.
+	for _, session := range expired {
+		logger.Info("shutting down expired profiler session", "type", session.Type, "endpoint", session.Endpoint, "diagnosis", fmt.Sprintf("%s/%s", session.DiagnosisNamespace, session.DiagnosisName))
+		if session.Shutdown != nil {
+			session.Shutdown()
+		}
+	}
+
+	return len(expired)
+}
+
+// ProfilerSessionsHandler handles http requests for listing live profiler sessions on the node.
+func ProfilerSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		sessions := ListProfilerSessions()
+		data, err := json.Marshal(sessions)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal profiler sessions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processors
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestReapExpiredProfilerSessionsFreesPort(t *testing.T) {
+	profilerSessionsMutex.Lock()
+	profilerSessions = nil
+	profilerSessionsMutex.Unlock()
+
+	// The listener stands in for a profiler server holding a port on the node.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	endpoint := listener.Addr().String()
+
+	RegisterProfilerSession(ProfilerSession{
+		DiagnosisNamespace: "default",
+		DiagnosisName:      "diagnosis1",
+		Type:               "Go",
+		Endpoint:           endpoint,
+		ExpirationTime:     time.Now().Add(-1 * time.Second),
+		Shutdown: func() {
+			listener.Close()
+		},
+	})
+	RegisterProfilerSession(ProfilerSession{
+		DiagnosisNamespace: "default",
+		DiagnosisName:      "diagnosis2",
+		Type:               "Go",
+		Endpoint:           "127.0.0.1:8090",
+		ExpirationTime:     time.Now().Add(time.Hour),
+	})
+
+	sessions := ListProfilerSessions()
+	assert.Equal(t, 2, len(sessions))
+	assert.Equal(t, true, sessions[0].Expired)
+	assert.Equal(t, false, sessions[1].Expired)
+
+	reaped := reapExpiredProfilerSessions(ctrl.Log.WithName("profilerregistry"))
+	assert.Equal(t, 1, reaped)
+
+	// The port of the expired session is released and can be bound again.
+	relisten, err := net.Listen("tcp", endpoint)
+	assert.NoError(t, err)
+	relisten.Close()
+
+	sessions = ListProfilerSessions()
+	assert.Equal(t, 1, len(sessions))
+	assert.Equal(t, "diagnosis2", sessions[0].DiagnosisName)
+}
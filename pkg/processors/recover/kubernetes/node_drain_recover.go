@@ -0,0 +1,206 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyNodeDrainGracePeriodSeconds = "param.recover.kubernetes.node_drain.grace_period_seconds"
+
+	ContextKeyNodeDrainResultName      = "recover.kubernetes.node_drain.result.name"
+	ContextKeyNodeDrainEvictedPods     = "recover.kubernetes.node_drain.evicted_pods"
+	ContextKeyNodeDrainFailedEvictions = "recover.kubernetes.node_drain.failed_evictions"
+)
+
+// nodeDrainRecover marks node as unschedulable and evicts eligible pods from the node. Mirror
+// pods and pods managed by a daemonset are never evicted. Evictions are performed through the
+// eviction api so pod disruption budgets are respected.
+type nodeDrainRecover struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client knows how to perform CRUD operations on Kubernetes objects.
+	client client.Client
+	// kubernetesClient knows how to perform eviction operations which are not supported by client.
+	kubernetesClient kubernetes.Interface
+	// nodeName specifies the node name.
+	nodeName string
+	// nodeDrainRecoverEnabled indicates whether nodeDrainRecover is enabled.
+	nodeDrainRecoverEnabled bool
+}
+
+// NewNodeDrainRecover creates a new nodeDrainRecover.
+func NewNodeDrainRecover(
+	ctx context.Context,
+	logger logr.Logger,
+	client client.Client,
+	kubernetesClient kubernetes.Interface,
+	nodeName string,
+	nodeDrainRecoverEnabled bool,
+) processors.Processor {
+	return &nodeDrainRecover{
+		Context:                 ctx,
+		Logger:                  logger,
+		client:                  client,
+		kubernetesClient:        kubernetesClient,
+		nodeName:                nodeName,
+		nodeDrainRecoverEnabled: nodeDrainRecoverEnabled,
+	}
+}
+
+// Handler handles http requests for marking node as unschedulable and evicting pods from the node.
+func (nd *nodeDrainRecover) Handler(w http.ResponseWriter, r *http.Request) {
+	if !nd.nodeDrainRecoverEnabled {
+		http.Error(w, fmt.Sprintf("node drain recover is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			nd.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var gracePeriodSeconds *int64
+		if value, ok := contexts[ParameterKeyNodeDrainGracePeriodSeconds]; ok {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				http.Error(w, fmt.Sprintf("invalid grace period seconds: %s", value), http.StatusBadRequest)
+				return
+			}
+			gracePeriodSeconds = &parsed
+		}
+
+		var node corev1.Node
+		if err := nd.client.Get(nd, client.ObjectKey{Name: nd.nodeName}, &node); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Node"), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if !node.Spec.Unschedulable {
+			node.Spec.Unschedulable = true
+			if err := nd.client.Update(nd, &node); err != nil {
+				http.Error(w, fmt.Sprintf("unable to update Node"), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+
+		evicted, failed := nd.evictPods(gracePeriodSeconds)
+
+		result := make(map[string]string)
+		result[ContextKeyNodeDrainResultName] = nd.nodeName
+		if len(evicted) > 0 {
+			result[ContextKeyNodeDrainEvictedPods] = strings.Join(evicted, ",")
+		}
+		if len(failed) > 0 {
+			result[ContextKeyNodeDrainFailedEvictions] = strings.Join(failed, "\n")
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// evictPods evicts eligible pods from the node through the eviction api and returns the names of
+// evicted pods and messages of evictions which could not be completed. An eviction rejected by a
+// pod disruption budget is reported as a failed eviction instead of failing the operation.
+func (nd *nodeDrainRecover) evictPods(gracePeriodSeconds *int64) ([]string, []string) {
+	var podList corev1.PodList
+	if err := nd.client.List(nd, &podList); err != nil {
+		return nil, []string{fmt.Sprintf("unable to list Pods: %v", err)}
+	}
+
+	var evicted []string
+	var failed []string
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName != nd.nodeName {
+			continue
+		}
+		if !podEligibleForEviction(pod) {
+			continue
+		}
+
+		eviction := policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+			DeleteOptions: &metav1.DeleteOptions{
+				GracePeriodSeconds: gracePeriodSeconds,
+			},
+		}
+		if err := nd.kubernetesClient.CoreV1().Pods(pod.Namespace).Evict(&eviction); err != nil {
+			nd.Error(err, "unable to evict pod", "pod", client.ObjectKey{
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+			})
+			failed = append(failed, fmt.Sprintf("%s/%s: %v", pod.Namespace, pod.Name, err))
+			continue
+		}
+		evicted = append(evicted, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+	}
+
+	return evicted, failed
+}
+
+// podEligibleForEviction reports whether the pod may be evicted during a node drain. Mirror pods,
+// pods managed by a daemonset, completed pods and pods which are already terminating are skipped.
+func podEligibleForEviction(pod corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if controller := metav1.GetControllerOf(&pod); controller != nil && controller.Kind == "DaemonSet" {
+		return false
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+
+	return true
+}
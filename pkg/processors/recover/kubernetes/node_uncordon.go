@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+)
+
+const (
+	ContextKeyNodeUncordonResultName = "recover.kubernetes.node_uncordon.result.name"
+	ContextKeyNodeUncordonChanged    = "recover.kubernetes.node_uncordon.changed"
+)
+
+// nodeUncordon marks node as schedulable to reverse a node cordon once an issue resolves.
+type nodeUncordon struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client knows how to perform CRUD operations on Kubernetes objects.
+	client client.Client
+	// nodeName specifies the node name.
+	nodeName string
+	// nodeUncordonEnabled indicates whether nodeUncordon is enabled.
+	nodeUncordonEnabled bool
+}
+
+// NewNodeUncordon creates a new nodeUncordon.
+func NewNodeUncordon(
+	ctx context.Context,
+	logger logr.Logger,
+	client client.Client,
+	nodeName string,
+	nodeUncordonEnabled bool,
+) processors.Processor {
+	return &nodeUncordon{
+		Context:             ctx,
+		Logger:              logger,
+		client:              client,
+		nodeName:            nodeName,
+		nodeUncordonEnabled: nodeUncordonEnabled,
+	}
+}
+
+// Handler handles http requests for marking node as schedulable.
+func (nu *nodeUncordon) Handler(w http.ResponseWriter, r *http.Request) {
+	if !nu.nodeUncordonEnabled {
+		http.Error(w, fmt.Sprintf("node uncordon is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		var node corev1.Node
+		if err := nu.client.Get(nu, client.ObjectKey{Name: nu.nodeName}, &node); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Node"), http.StatusUnprocessableEntity)
+			return
+		}
+
+		// The node is left untouched if it is already schedulable. Whether the state was
+		// actually changed is recorded in the result.
+		changed := node.Spec.Unschedulable
+		if changed {
+			node.Spec.Unschedulable = false
+			if err := nu.client.Update(nu, &node); err != nil {
+				http.Error(w, fmt.Sprintf("unable to update Node"), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyNodeUncordonResultName] = nu.nodeName
+		result[ContextKeyNodeUncordonChanged] = strconv.FormatBool(changed)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyPodRestartForce = "param.recover.kubernetes.pod_restart.force"
+
+	ContextKeyPodRestartResult = "recover.kubernetes.pod_restart.result"
+	ContextKeyPodRestartPodUID = "recover.kubernetes.pod_restart.pod.uid"
+)
+
+// podRestart restarts the target pod by deleting it. The pod is recreated by its owning
+// controller.
+type podRestart struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// client knows how to perform CRUD operations on Kubernetes objects.
+	client client.Client
+	// podRestartEnabled indicates whether podRestart is enabled.
+	podRestartEnabled bool
+}
+
+// NewPodRestart creates a new podRestart.
+func NewPodRestart(
+	ctx context.Context,
+	logger logr.Logger,
+	client client.Client,
+	podRestartEnabled bool,
+) processors.Processor {
+	return &podRestart{
+		Context:           ctx,
+		Logger:            logger,
+		client:            client,
+		podRestartEnabled: podRestartEnabled,
+	}
+}
+
+// Handler handles http requests for restarting the target pod.
+func (pr *podRestart) Handler(w http.ResponseWriter, r *http.Request) {
+	if !pr.podRestartEnabled {
+		http.Error(w, fmt.Sprintf("pod restart is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			pr.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		podReference := utils.GetPodInfoFromContext(contexts)
+		if podReference.Namespace == "" || podReference.Name == "" {
+			http.Error(w, fmt.Sprintf("pod reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var pod corev1.Pod
+		if err := pr.client.Get(pr, client.ObjectKey{
+			Namespace: podReference.Namespace,
+			Name:      podReference.Name,
+		}, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// A pod which is not owned by a controller is not recreated after deletion. Restarting such
+		// a pod must be explicitly forced.
+		if metav1.GetControllerOf(&pod) == nil && contexts[ParameterKeyPodRestartForce] != "true" {
+			http.Error(w, fmt.Sprintf("pod %s/%s is not owned by a controller, set %s to true to force a restart", pod.Namespace, pod.Name, ParameterKeyPodRestartForce), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := pr.client.Delete(pr, &pod); err != nil {
+			http.Error(w, fmt.Sprintf("unable to delete Pod: %v", err), http.StatusInternalServerError)
+			return
+		}
+		pr.Info("pod deleted for restart", "pod", client.ObjectKey{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+		}, "uid", pod.UID)
+
+		result := make(map[string]string)
+		result[ContextKeyPodRestartResult] = fmt.Sprintf("PodRestarted: pod %s/%s deleted and left to its controller for recreation", pod.Namespace, pod.Name)
+		result[ContextKeyPodRestartPodUID] = string(pod.UID)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+	"github.com/kubediag/kubediag/pkg/executor"
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyWebhookNotifierURL    = "param.recover.notification.webhook_notifier.url"
+	ParameterKeyWebhookNotifierFormat = "param.recover.notification.webhook_notifier.format"
+
+	ContextKeyWebhookNotifierResult = "recover.notification.webhook_notifier.result"
+
+	// webhookNotifierRetries is the number of attempts to deliver a notification.
+	webhookNotifierRetries = 3
+	// webhookNotifierTimeoutSeconds is the timeout in seconds of a notification delivery.
+	webhookNotifierTimeoutSeconds = 10
+)
+
+// webhookNotificationPayload is the json summary of a diagnosis which is delivered to the webhook.
+type webhookNotificationPayload struct {
+	// Namespace specifies the namespace of the diagnosis.
+	Namespace string `json:"namespace"`
+	// Name specifies the name of the diagnosis.
+	Name string `json:"name"`
+	// NodeName is the node which the diagnosis is on.
+	NodeName string `json:"nodeName,omitempty"`
+	// Phase is a simple, high-level summary of where the diagnosis is in its lifecycle.
+	Phase diagnosisv1.DiagnosisPhase `json:"phase,omitempty"`
+	// Severity indicates the importance of the issue targeted by the diagnosis.
+	Severity diagnosisv1.DiagnosisSeverity `json:"severity,omitempty"`
+	// Conditions contains current service state of the diagnosis.
+	Conditions []diagnosisv1.DiagnosisCondition `json:"conditions,omitempty"`
+}
+
+// webhookNotifier escalates a diagnosis to humans by delivering a summary of the diagnosis to a
+// webhook. It is a terminal recover processor which succeeds by escalating.
+type webhookNotifier struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// cache knows how to load Kubernetes objects.
+	cache cache.Cache
+	// url is the default webhook url which notifications are delivered to.
+	url string
+	// webhookNotifierEnabled indicates whether webhookNotifier is enabled.
+	webhookNotifierEnabled bool
+}
+
+// NewWebhookNotifier creates a new webhookNotifier.
+func NewWebhookNotifier(
+	ctx context.Context,
+	logger logr.Logger,
+	cache cache.Cache,
+	url string,
+	webhookNotifierEnabled bool,
+) processors.Processor {
+	return &webhookNotifier{
+		Context:                ctx,
+		Logger:                 logger,
+		cache:                  cache,
+		url:                    url,
+		webhookNotifierEnabled: webhookNotifierEnabled,
+	}
+}
+
+// Handler handles http requests for delivering diagnosis notifications.
+func (wn *webhookNotifier) Handler(w http.ResponseWriter, r *http.Request) {
+	if !wn.webhookNotifierEnabled {
+		http.Error(w, fmt.Sprintf("webhook notifier is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			wn.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		url := wn.url
+		if value, ok := contexts[ParameterKeyWebhookNotifierURL]; ok && value != "" {
+			url = value
+		}
+		if url == "" {
+			http.Error(w, fmt.Sprintf("webhook url not specified"), http.StatusBadRequest)
+			return
+		}
+
+		namespace := contexts[executor.DiagnosisNamespaceTelemetryKey]
+		name := contexts[executor.DiagnosisNameTelemetryKey]
+		if namespace == "" || name == "" {
+			http.Error(w, fmt.Sprintf("diagnosis reference not found in contexts"), http.StatusBadRequest)
+			return
+		}
+
+		var diagnosis diagnosisv1.Diagnosis
+		if err := wn.cache.Get(wn, client.ObjectKey{
+			Namespace: namespace,
+			Name:      name,
+		}, &diagnosis); err != nil {
+			http.Error(w, fmt.Sprintf("unable to fetch Diagnosis: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// The notification defaults to the json payload unless a summary format is specified.
+		body, contentType, err := renderNotificationBody(diagnosis, contexts[ParameterKeyWebhookNotifierFormat])
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to render notification: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := wn.deliverNotification(url, body, contentType); err != nil {
+			http.Error(w, fmt.Sprintf("failed to deliver notification: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyWebhookNotifierResult] = fmt.Sprintf("NotifiedHuman: diagnosis %s/%s escalated to %s", diagnosis.Namespace, diagnosis.Name, url)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// renderNotificationBody renders the notification body and content type for the diagnosis. The
+// default json payload is rendered if no format is specified, otherwise the summary is rendered
+// with util.FormatDiagnosisSummary.
+func renderNotificationBody(diagnosis diagnosisv1.Diagnosis, format string) ([]byte, string, error) {
+	if format == "" {
+		payload := webhookNotificationPayload{
+			Namespace:  diagnosis.Namespace,
+			Name:       diagnosis.Name,
+			NodeName:   diagnosis.Spec.NodeName,
+			Phase:      diagnosis.Status.Phase,
+			Severity:   diagnosis.Spec.Severity,
+			Conditions: diagnosis.Status.Conditions,
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal notification payload: %v", err)
+		}
+		return body, "application/json", nil
+	}
+
+	summary, err := util.FormatDiagnosisSummary(diagnosis, format)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := "application/json"
+	if format == util.DiagnosisSummaryFormatMarkdown {
+		contentType = "text/markdown"
+	}
+
+	return []byte(summary), contentType, nil
+}
+
+// deliverNotification posts the body to the webhook url with retries and a short timeout.
+func (wn *webhookNotifier) deliverNotification(url string, body []byte, contentType string) error {
+	cli := &http.Client{
+		Timeout: webhookNotifierTimeoutSeconds * time.Second,
+	}
+
+	var lastErr error
+	for i := 0; i < webhookNotifierRetries; i++ {
+		res, err := cli.Post(url, contentType, bytes.NewBuffer(body))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode >= 200 && res.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("webhook responded with status %s", res.Status)
+	}
+
+	return lastErr
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+)
+
+const (
+	ParameterKeyDropCachesLevel          = "param.recover.system.drop_caches.level"
+	ParameterKeyDropCachesMemoryPressure = "param.recover.system.drop_caches.memory_pressure"
+
+	ContextKeyDropCachesResult        = "recover.system.drop_caches.result"
+	ContextKeyDropCachesMemFreeBefore = "recover.system.drop_caches.memfree.before"
+	ContextKeyDropCachesMemFreeAfter  = "recover.system.drop_caches.memfree.after"
+
+	// defaultDropCachesLevel frees page cache only. Level 2 additionally frees reclaimable slab
+	// objects and level 3 frees both.
+	defaultDropCachesLevel = 1
+
+	// dropCachesPath is the procfs path for dropping kernel caches.
+	dropCachesPath = "/proc/sys/vm/drop_caches"
+	// meminfoPath is the procfs path of memory information.
+	meminfoPath = "/proc/meminfo"
+)
+
+// dropCachesRecover frees kernel caches on the node to relieve memory pressure.
+type dropCachesRecover struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// dropCachesRecoverEnabled indicates whether dropCachesRecover is enabled.
+	dropCachesRecoverEnabled bool
+}
+
+// NewDropCachesRecover creates a new dropCachesRecover.
+func NewDropCachesRecover(
+	ctx context.Context,
+	logger logr.Logger,
+	dropCachesRecoverEnabled bool,
+) processors.Processor {
+	return &dropCachesRecover{
+		Context:                  ctx,
+		Logger:                   logger,
+		dropCachesRecoverEnabled: dropCachesRecoverEnabled,
+	}
+}
+
+// Handler handles http requests for dropping kernel caches.
+func (dc *dropCachesRecover) Handler(w http.ResponseWriter, r *http.Request) {
+	if !dc.dropCachesRecoverEnabled {
+		http.Error(w, fmt.Sprintf("drop caches recover is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			dc.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Dropping caches is only meaningful on a node under memory pressure. An operation
+		// upstream in the path is expected to set the memory pressure flag after inspecting
+		// the node.
+		if contexts[ParameterKeyDropCachesMemoryPressure] != "true" {
+			http.Error(w, fmt.Sprintf("node is not under memory pressure, set %s to true to drop caches", ParameterKeyDropCachesMemoryPressure), http.StatusUnprocessableEntity)
+			return
+		}
+
+		level := defaultDropCachesLevel
+		if value, ok := contexts[ParameterKeyDropCachesLevel]; ok {
+			level, err = strconv.Atoi(value)
+			if err != nil || level < 1 || level > 3 {
+				http.Error(w, fmt.Sprintf("invalid drop caches level %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		memFreeBefore, err := readMemFree()
+		if err != nil {
+			dc.Error(err, "unable to read free memory before dropping caches")
+		}
+
+		if err := ioutil.WriteFile(dropCachesPath, []byte(strconv.Itoa(level)), 0200); err != nil {
+			http.Error(w, fmt.Sprintf("failed to drop caches: %v", err), http.StatusInternalServerError)
+			return
+		}
+		dc.Info("kernel caches dropped", "level", level)
+
+		memFreeAfter, err := readMemFree()
+		if err != nil {
+			dc.Error(err, "unable to read free memory after dropping caches")
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyDropCachesResult] = fmt.Sprintf("DroppedCaches: kernel caches dropped with level %d on the node", level)
+		result[ContextKeyDropCachesMemFreeBefore] = memFreeBefore
+		result[ContextKeyDropCachesMemFreeAfter] = memFreeAfter
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// readMemFree returns the MemFree value of the node in kilobytes.
+func readMemFree() (string, error) {
+	data, err := ioutil.ReadFile(meminfoPath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "MemFree:") {
+			return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "MemFree:"), "kB")) + " kB", nil
+		}
+	}
+
+	return "", fmt.Errorf("MemFree not found in %s", meminfoPath)
+}
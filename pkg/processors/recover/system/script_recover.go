@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kubediag/kubediag/pkg/processors"
+	"github.com/kubediag/kubediag/pkg/processors/utils"
+	"github.com/kubediag/kubediag/pkg/util"
+)
+
+const (
+	ParameterKeyScriptRecoverBody           = "param.recover.system.script.body"
+	ParameterKeyScriptRecoverInterpreter    = "param.recover.system.script.interpreter"
+	ParameterKeyScriptRecoverTimeoutSeconds = "param.recover.system.script.timeout_seconds"
+
+	ContextKeyScriptRecoverOutput   = "recover.system.script.output"
+	ContextKeyScriptRecoverExitCode = "recover.system.script.exit_code"
+
+	// defaultScriptRecoverInterpreter is the default interpreter the script is executed with.
+	defaultScriptRecoverInterpreter = "/bin/sh"
+	// scriptRecoverSubDirectory is the subdirectory of data root which holds scripts while they
+	// are executed.
+	scriptRecoverSubDirectory = "recoverers/scripts"
+)
+
+// scriptRecover executes a script provided in the diagnosis context for multi step remediations
+// which are clumsy to express as a single command. The script is written to a temporary file
+// under data root, executed with a timeout and removed afterwards.
+type scriptRecover struct {
+	// Context carries values across API boundaries.
+	context.Context
+	// Logger represents the ability to log messages.
+	logr.Logger
+
+	// dataRoot is root directory of persistent kubediag data.
+	dataRoot string
+	// scriptRecoverEnabled indicates whether scriptRecover is enabled.
+	scriptRecoverEnabled bool
+}
+
+// NewScriptRecover creates a new scriptRecover.
+func NewScriptRecover(
+	ctx context.Context,
+	logger logr.Logger,
+	dataRoot string,
+	scriptRecoverEnabled bool,
+) processors.Processor {
+	return &scriptRecover{
+		Context:              ctx,
+		Logger:               logger,
+		dataRoot:             dataRoot,
+		scriptRecoverEnabled: scriptRecoverEnabled,
+	}
+}
+
+// Handler handles http requests for executing a recovery script.
+func (sr *scriptRecover) Handler(w http.ResponseWriter, r *http.Request) {
+	if !sr.scriptRecoverEnabled {
+		http.Error(w, fmt.Sprintf("script recover is not enabled"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		contexts, err := utils.ExtractParametersFromHTTPContext(r)
+		if err != nil {
+			sr.Error(err, "extract contexts failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		body, ok := contexts[ParameterKeyScriptRecoverBody]
+		if !ok || body == "" {
+			http.Error(w, fmt.Sprintf("must specify script body"), http.StatusBadRequest)
+			return
+		}
+		interpreter := defaultScriptRecoverInterpreter
+		if value, ok := contexts[ParameterKeyScriptRecoverInterpreter]; ok && value != "" {
+			interpreter = value
+		}
+		timeoutSeconds := int32(processors.DefaultTimeoutSeconds)
+		if value, ok := contexts[ParameterKeyScriptRecoverTimeoutSeconds]; ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, fmt.Sprintf("invalid timeout seconds %s", value), http.StatusBadRequest)
+				return
+			}
+			timeoutSeconds = int32(parsed)
+		}
+
+		output, exitCode, err := sr.runScript(body, interpreter, timeoutSeconds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to run recovery script: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		result := make(map[string]string)
+		result[ContextKeyScriptRecoverOutput] = output
+		result[ContextKeyScriptRecoverExitCode] = strconv.Itoa(exitCode)
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal result: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("method %s is not supported", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// runScript writes the script body into a temporary file under data root, executes it with the
+// interpreter and returns the combined output and exit code. The command and all of its children
+// are killed on timeout and the temporary file is removed afterwards.
+func (sr *scriptRecover) runScript(body string, interpreter string, timeoutSeconds int32) (string, int, error) {
+	scriptDir := filepath.Join(sr.dataRoot, scriptRecoverSubDirectory)
+	if err := os.MkdirAll(scriptDir, os.ModePerm); err != nil {
+		return "", 0, err
+	}
+	scriptFile, err := ioutil.TempFile(scriptDir, "script")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(scriptFile.Name())
+	if _, err := scriptFile.WriteString(body); err != nil {
+		scriptFile.Close()
+		return "", 0, err
+	}
+	if err := scriptFile.Close(); err != nil {
+		return "", 0, err
+	}
+
+	command := append(strings.Fields(interpreter), scriptFile.Name())
+	output, err := util.BlockingRunCommandWithTimeout(command, timeoutSeconds)
+	if err != nil {
+		// A script which exited with a nonzero code completed and its exit code is reported in
+		// the result instead of failing the operation.
+		if exitError, ok := err.(*exec.ExitError); ok {
+			return string(output), exitError.ExitCode(), nil
+		}
+		return "", 0, fmt.Errorf("execute script with error %v: %s", err, string(output))
+	}
+
+	return string(output), 0, nil
+}
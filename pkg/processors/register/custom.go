@@ -0,0 +1,68 @@
+package register
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+var (
+	// customProcessorsMutex protects customProcessors.
+	customProcessorsMutex sync.Mutex
+	// customProcessors holds the handlers of custom processors keyed by processor name. Nothing
+	// is registered by default.
+	customProcessors map[string]http.HandlerFunc
+)
+
+// RegisterCustomProcessor registers the handler of a custom processor under the specified name.
+// The handler is mounted at /processor/<name> with the same authentication, in flight limiting
+// and duration metric middlewares as built in processors when RegisterProcessors runs.
+//
+// Custom builds register their processors from an init function of a package imported for side
+// effects by main:
+//
+//	func init() {
+//	    register.RegisterCustomProcessor("myProfiler", myProfiler.Handler)
+//	}
+//
+// A custom profiler processor which starts a long running result endpoint should record the
+// endpoint with processors.RegisterProfilerSession and set its expiration time from the
+// param.diagnoser.runtime.*.expiration_seconds parameter it accepts, so the profiler session
+// reaper shuts the endpoint down after it expires like built in profilers.
+//
+// Registration must happen before RegisterProcessors runs. An error is returned if the name is
+// empty or already registered. Names of built in processors must not be reused since built in
+// routes are mounted first and take precedence.
+func RegisterCustomProcessor(name string, handler http.HandlerFunc) error {
+	customProcessorsMutex.Lock()
+	defer customProcessorsMutex.Unlock()
+
+	if name == "" {
+		return fmt.Errorf("custom processor name must not be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("custom processor %s must have a handler", name)
+	}
+	if _, ok := customProcessors[name]; ok {
+		return fmt.Errorf("custom processor %s is already registered", name)
+	}
+
+	if customProcessors == nil {
+		customProcessors = make(map[string]http.HandlerFunc)
+	}
+	customProcessors[name] = handler
+
+	return nil
+}
+
+// listCustomProcessors returns the registered custom processors.
+func listCustomProcessors() map[string]http.HandlerFunc {
+	customProcessorsMutex.Lock()
+	defer customProcessorsMutex.Unlock()
+
+	handlers := make(map[string]http.HandlerFunc, len(customProcessors))
+	for name, handler := range customProcessors {
+		handlers[name] = handler
+	}
+	return handlers
+}
@@ -2,21 +2,47 @@ package register
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/kubediag/kubediag/pkg/features"
+	"github.com/kubediag/kubediag/pkg/processors"
 	kubecollector "github.com/kubediag/kubediag/pkg/processors/collector/kubernetes"
 	logcollector "github.com/kubediag/kubediag/pkg/processors/collector/log"
 	runtimecollector "github.com/kubediag/kubediag/pkg/processors/collector/runtime"
 	systemcollector "github.com/kubediag/kubediag/pkg/processors/collector/system"
 	kubediagnoser "github.com/kubediag/kubediag/pkg/processors/diagnoser/kubernetes"
+	promdiagnoser "github.com/kubediag/kubediag/pkg/processors/diagnoser/prometheus"
 	runtimediagnoser "github.com/kubediag/kubediag/pkg/processors/diagnoser/runtime"
+	systemdiagnoser "github.com/kubediag/kubediag/pkg/processors/diagnoser/system"
 	kuberecover "github.com/kubediag/kubediag/pkg/processors/recover/kubernetes"
+	notificationrecover "github.com/kubediag/kubediag/pkg/processors/recover/notification"
+	systemrecover "github.com/kubediag/kubediag/pkg/processors/recover/system"
+)
+
+var (
+	processorHandlerDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "processor_handler_duration_seconds",
+			Help:    "Histogram of processor handler execution duration by processor",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"processor"},
+	)
 )
 
 // RegistryOption contains options of all kinds of Processors, it might be append in the future.
@@ -29,6 +55,113 @@ type RegistryOption struct {
 	DataRoot string
 	// BindAddress is the address on which to advertise.
 	BindAddress string
+	// MaxRequestsInFlight is the maximum number of requests a processor handles simultaneously.
+	// Requests over the limit are rejected with a 429. Defaults to 0 which means unlimited.
+	MaxRequestsInFlight int
+	// TokenFile is the path of a file containing the bearer token which processor requests are
+	// authenticated against. Authentication is disabled if empty.
+	TokenFile string
+	// WebhookNotifierURL is the default url which the webhook notifier delivers notifications to.
+	WebhookNotifierURL string
+	// FileCollectorAllowedPathPrefixes is the list of path prefixes the file collector may read
+	// files from.
+	FileCollectorAllowedPathPrefixes []string
+}
+
+// bearerTokenAuthenticator validates the Authorization header of processor requests against a
+// token stored in a file. The token is reloaded whenever the file changes.
+type bearerTokenAuthenticator struct {
+	// mutex protects the cached token.
+	mutex sync.Mutex
+	// tokenFile is the path of the file containing the bearer token.
+	tokenFile string
+	// modTime is the modification time of the token file on the last load.
+	modTime time.Time
+	// token is the token loaded from the token file.
+	token string
+}
+
+// currentToken returns the token in the token file. The cached token is returned if the file has
+// not changed since the last load.
+func (authenticator *bearerTokenAuthenticator) currentToken() (string, error) {
+	authenticator.mutex.Lock()
+	defer authenticator.mutex.Unlock()
+
+	fileInfo, err := os.Stat(authenticator.tokenFile)
+	if err != nil {
+		return "", err
+	}
+	if fileInfo.ModTime().Equal(authenticator.modTime) && authenticator.token != "" {
+		return authenticator.token, nil
+	}
+
+	data, err := ioutil.ReadFile(authenticator.tokenFile)
+	if err != nil {
+		return "", err
+	}
+	authenticator.modTime = fileInfo.ModTime()
+	authenticator.token = strings.TrimSpace(string(data))
+
+	return authenticator.token, nil
+}
+
+// withBearerTokenAuth wraps a processor handler with bearer token authentication. The handler is
+// returned as is if the authenticator is nil.
+func withBearerTokenAuth(handler http.HandlerFunc, authenticator *bearerTokenAuthenticator) http.HandlerFunc {
+	if authenticator == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := authenticator.currentToken()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to load processor token: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, "Bearer ")), []byte(token)) != 1 {
+			http.Error(w, fmt.Sprintf("invalid bearer token"), http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// withMaxRequestsInFlight wraps a processor handler with a semaphore which limits the number of
+// requests handled simultaneously. The handler is returned as is if maxRequestsInFlight is not
+// positive. A request over the limit is rejected with a 429 and a Retry-After header instead of
+// queueing unbounded.
+func withMaxRequestsInFlight(handler http.HandlerFunc, maxRequestsInFlight int) http.HandlerFunc {
+	if maxRequestsInFlight <= 0 {
+		return handler
+	}
+
+	semaphore := make(chan struct{}, maxRequestsInFlight)
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case semaphore <- struct{}{}:
+			defer func() {
+				<-semaphore
+			}()
+			handler(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, fmt.Sprintf("too many requests in flight, limit is %d", maxRequestsInFlight), http.StatusTooManyRequests)
+		}
+	}
+}
+
+// withDurationMetric wraps a processor handler to observe its execution duration in the histogram
+// labeled by processor name.
+func withDurationMetric(handler http.HandlerFunc, histogram *prometheus.HistogramVec) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		handler(w, r)
+		histogram.WithLabelValues(strings.TrimPrefix(r.URL.Path, "/processor/")).Observe(time.Since(startTime).Seconds())
+	}
 }
 
 // RegisterProcessors will initialize all processors and add into router to provide HTTP service.
@@ -37,6 +170,10 @@ func RegisterProcessors(mgr manager.Manager,
 	featureGate features.KubeDiagFeatureGate,
 	router *mux.Router,
 	setupLog logr.Logger) error {
+	metrics.Registry.MustRegister(
+		processorHandlerDuration,
+	)
+
 	// Setup operation processors.
 	podListCollector := kubecollector.NewPodListCollector(
 		context.Background(),
@@ -52,6 +189,23 @@ func RegisterProcessors(mgr manager.Manager,
 		opts.NodeName,
 		featureGate.Enabled(features.PodCollector),
 	)
+	restartHistoryCollector := kubecollector.NewRestartHistoryCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/restartHistoryCollector"),
+		mgr.GetCache(),
+		featureGate.Enabled(features.RestartHistoryCollector),
+	)
+	kubeletStatsCollector := kubecollector.NewKubeletStatsCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/kubeletStatsCollector"),
+		featureGate.Enabled(features.KubeletStatsCollector),
+	)
+	httpProbeCollector := kubecollector.NewHTTPProbeCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/httpProbeCollector"),
+		mgr.GetCache(),
+		featureGate.Enabled(features.HTTPProbeCollector),
+	)
 	containerCollector, err := kubecollector.NewContainerCollector(
 		context.Background(),
 		ctrl.Log.WithName("processor/containerCollector"),
@@ -62,11 +216,72 @@ func RegisterProcessors(mgr manager.Manager,
 		setupLog.Error(err, "unable to create processor", "processors", "containerCollector")
 		return fmt.Errorf("unable to create processor: %v", err)
 	}
+	containerLogCollector, err := kubecollector.NewContainerLogCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/containerLogCollector"),
+		opts.DockerEndpoint,
+		featureGate.Enabled(features.ContainerLogCollector),
+	)
+	if err != nil {
+		setupLog.Error(err, "unable to create processor", "processors", "containerLogCollector")
+		return fmt.Errorf("unable to create processor: %v", err)
+	}
+	containerdCollector := kubecollector.NewContainerdCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/containerdCollector"),
+		featureGate.Enabled(features.ContainerdCollector),
+	)
+	containerDiffCollector, err := kubecollector.NewContainerDiffCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/containerDiffCollector"),
+		opts.DockerEndpoint,
+		featureGate.Enabled(features.ContainerDiffCollector),
+	)
+	if err != nil {
+		setupLog.Error(err, "unable to create processor", "processors", "containerDiffCollector")
+		return fmt.Errorf("unable to create processor: %v", err)
+	}
 	processCollector := systemcollector.NewProcessCollector(
 		context.Background(),
 		ctrl.Log.WithName("processor/processCollector"),
 		featureGate.Enabled(features.ProcessCollector),
 	)
+	smartCollector := systemcollector.NewSMARTCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/smartCollector"),
+		featureGate.Enabled(features.SMARTCollector),
+	)
+	fileCollector := systemcollector.NewFileCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/fileCollector"),
+		opts.FileCollectorAllowedPathPrefixes,
+		featureGate.Enabled(features.FileCollector),
+	)
+	iptablesCollector := systemcollector.NewIptablesCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/iptablesCollector"),
+		featureGate.Enabled(features.IptablesCollector),
+	)
+	kernelStateCollector := systemcollector.NewKernelStateCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/kernelStateCollector"),
+		featureGate.Enabled(features.KernelStateCollector),
+	)
+	netInterfaceCollector := systemcollector.NewNetInterfaceCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/netInterfaceCollector"),
+		featureGate.Enabled(features.NetInterfaceCollector),
+	)
+	processTreeCollector, err := systemcollector.NewProcessTreeCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/processTreeCollector"),
+		opts.DockerEndpoint,
+		featureGate.Enabled(features.ProcessTreeCollector),
+	)
+	if err != nil {
+		setupLog.Error(err, "unable to create processor", "processors", "processTreeCollector")
+		return fmt.Errorf("unable to create processor: %v", err)
+	}
 	dockerInfoCollector, err := kubecollector.NewDockerInfoCollector(
 		context.Background(),
 		ctrl.Log.WithName("processor/dockerInfoCollector"),
@@ -88,6 +303,68 @@ func RegisterProcessors(mgr manager.Manager,
 		ctrl.Log.WithName("processor/containerdGoroutineCollector"),
 		featureGate.Enabled(features.ContainerdGoroutineCollector),
 	)
+	arthasThreadDumpCollector, err := runtimecollector.NewArthasThreadDumpCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/arthasThreadDumpCollector"),
+		opts.DockerEndpoint,
+		featureGate.Enabled(features.ArthasThreadDumpCollector),
+	)
+	if err != nil {
+		setupLog.Error(err, "unable to create processor", "processors", "arthasThreadDumpCollector")
+		return fmt.Errorf("unable to create processor: %v", err)
+	}
+	heapDumpCollector, err := runtimecollector.NewHeapDumpCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/heapDumpCollector"),
+		opts.DockerEndpoint,
+		opts.DataRoot,
+		featureGate.Enabled(features.HeapDumpCollector),
+	)
+	if err != nil {
+		setupLog.Error(err, "unable to create processor", "processors", "heapDumpCollector")
+		return fmt.Errorf("unable to create processor: %v", err)
+	}
+	cgroupMemoryCollector := runtimecollector.NewCgroupMemoryCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/cgroupMemoryCollector"),
+		mgr.GetCache(),
+		featureGate.Enabled(features.CgroupMemoryCollector),
+	)
+	journaldCollector := systemcollector.NewJournaldCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/journaldCollector"),
+		featureGate.Enabled(features.JournaldCollector),
+	)
+	dmesgCollector := systemcollector.NewDmesgCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/dmesgCollector"),
+		featureGate.Enabled(features.DmesgCollector),
+	)
+	diskUsageCollector := systemcollector.NewDiskUsageCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/diskUsageCollector"),
+		featureGate.Enabled(features.DiskUsageCollector),
+	)
+	resourcePressureCollector := systemcollector.NewResourcePressureCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/resourcePressureCollector"),
+		featureGate.Enabled(features.ResourcePressureCollector),
+	)
+	socketStatCollector := systemcollector.NewSocketStatCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/socketStatCollector"),
+		featureGate.Enabled(features.SocketStatCollector),
+	)
+	sysctlCollector := systemcollector.NewSysctlCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/sysctlCollector"),
+		featureGate.Enabled(features.SysctlCollector),
+	)
+	conntrackCollector := systemcollector.NewConntrackCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/conntrackCollector"),
+		featureGate.Enabled(features.ConntrackCollector),
+	)
 	mountInfoCollector := systemcollector.NewMountInfoCollector(
 		context.Background(),
 		ctrl.Log.WithName("processor/mountInfoCollector"),
@@ -102,6 +379,28 @@ func RegisterProcessors(mgr manager.Manager,
 		featureGate.Enabled(features.NodeCordon),
 	)
 
+	nodeUncordon := kuberecover.NewNodeUncordon(
+		context.Background(),
+		ctrl.Log.WithName("processor/nodeUncordon"),
+		mgr.GetClient(),
+		opts.NodeName,
+		featureGate.Enabled(features.NodeUncordon),
+	)
+
+	kubernetesClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create processor", "processors", "nodeDrainRecover")
+		return fmt.Errorf("unable to create processor: %v", err)
+	}
+	nodeDrainRecover := kuberecover.NewNodeDrainRecover(
+		context.Background(),
+		ctrl.Log.WithName("processor/nodeDrainRecover"),
+		mgr.GetClient(),
+		kubernetesClient,
+		opts.NodeName,
+		featureGate.Enabled(features.NodeDrainRecover),
+	)
+
 	goProfiler := runtimediagnoser.NewGoProfiler(
 		context.Background(),
 		ctrl.Log.WithName("processor/goProfiler"),
@@ -110,6 +409,12 @@ func RegisterProcessors(mgr manager.Manager,
 		opts.BindAddress,
 		featureGate.Enabled(features.GoProfiler),
 	)
+	goroutineLeakDiagnoser := runtimediagnoser.NewGoroutineLeakDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/goroutineLeakDiagnoser"),
+		featureGate.Enabled(features.GoroutineLeakDiagnoser),
+	)
+
 	coreFileProfiler, err := runtimediagnoser.NewCoreFileProfiler(
 		context.Background(),
 		ctrl.Log.WithName("processor/coreFileProfiler"),
@@ -121,6 +426,32 @@ func RegisterProcessors(mgr manager.Manager,
 		return fmt.Errorf("unable to create processor: %v", err)
 	}
 
+	pythonProfiler, err := runtimediagnoser.NewPythonProfiler(
+		context.Background(),
+		ctrl.Log.WithName("processor/pythonProfiler"),
+		opts.DockerEndpoint,
+		opts.DataRoot,
+		opts.BindAddress,
+		featureGate.Enabled(features.PythonProfiler),
+	)
+	if err != nil {
+		setupLog.Error(err, "unable to create processor", "processors", "pythonProfiler")
+		return fmt.Errorf("unable to create processor: %v", err)
+	}
+
+	perfProfiler, err := runtimediagnoser.NewPerfProfiler(
+		context.Background(),
+		ctrl.Log.WithName("processor/perfProfiler"),
+		opts.DockerEndpoint,
+		opts.DataRoot,
+		opts.BindAddress,
+		featureGate.Enabled(features.PerfProfiler),
+	)
+	if err != nil {
+		setupLog.Error(err, "unable to create processor", "processors", "perfProfiler")
+		return fmt.Errorf("unable to create processor: %v", err)
+	}
+
 	subpathRemountDiagnoser := kubediagnoser.NewSubPathRemountDiagnoser(
 		context.Background(),
 		ctrl.Log.WithName("processor/subpathRemountDiagnoser"),
@@ -128,6 +459,107 @@ func RegisterProcessors(mgr manager.Manager,
 		featureGate.Enabled(features.SubpathRemountDiagnoser),
 	)
 
+	staleMountDiagnoser := kubediagnoser.NewStaleMountDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/staleMountDiagnoser"),
+		featureGate.Enabled(features.StaleMountDiagnoser),
+	)
+
+	volumeDiagnoser := kubediagnoser.NewVolumeDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/volumeDiagnoser"),
+		mgr.GetCache(),
+		featureGate.Enabled(features.VolumeDiagnoser),
+	)
+
+	cpuThrottlingDiagnoser := runtimediagnoser.NewCPUThrottlingDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/cpuThrottlingDiagnoser"),
+		mgr.GetCache(),
+		featureGate.Enabled(features.CPUThrottlingDiagnoser),
+	)
+
+	oomKillDiagnoser := kubediagnoser.NewOOMKillDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/oomKillDiagnoser"),
+		mgr.GetCache(),
+		featureGate.Enabled(features.OOMKillDiagnoser),
+	)
+
+	fdExhaustionDiagnoser := systemdiagnoser.NewFDExhaustionDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/fdExhaustionDiagnoser"),
+		featureGate.Enabled(features.FDExhaustionDiagnoser),
+	)
+
+	clockSkewDiagnoser := systemdiagnoser.NewClockSkewDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/clockSkewDiagnoser"),
+		featureGate.Enabled(features.ClockSkewDiagnoser),
+	)
+
+	dnsResolutionDiagnoser := systemdiagnoser.NewDNSResolutionDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/dnsResolutionDiagnoser"),
+		featureGate.Enabled(features.DNSResolutionDiagnoser),
+	)
+
+	prometheusQueryDiagnoser := promdiagnoser.NewPrometheusQueryDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/prometheusQueryDiagnoser"),
+		featureGate.Enabled(features.PrometheusQueryDiagnoser),
+	)
+
+	crashLoopDiagnoser := kubediagnoser.NewCrashLoopDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/crashLoopDiagnoser"),
+		mgr.GetCache(),
+		featureGate.Enabled(features.CrashLoopDiagnoser),
+	)
+
+	nodeNotReadyDiagnoser := kubediagnoser.NewNodeNotReadyDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/nodeNotReadyDiagnoser"),
+		mgr.GetCache(),
+		opts.NodeName,
+		featureGate.Enabled(features.NodeNotReadyDiagnoser),
+	)
+
+	imagePullDiagnoser := kubediagnoser.NewImagePullDiagnoser(
+		context.Background(),
+		ctrl.Log.WithName("processor/imagePullDiagnoser"),
+		mgr.GetCache(),
+		featureGate.Enabled(features.ImagePullDiagnoser),
+	)
+
+	dropCachesRecover := systemrecover.NewDropCachesRecover(
+		context.Background(),
+		ctrl.Log.WithName("processor/dropCachesRecover"),
+		featureGate.Enabled(features.DropCachesRecover),
+	)
+
+	scriptRecover := systemrecover.NewScriptRecover(
+		context.Background(),
+		ctrl.Log.WithName("processor/scriptRecover"),
+		opts.DataRoot,
+		featureGate.Enabled(features.ScriptRecover),
+	)
+
+	podRestart := kuberecover.NewPodRestart(
+		context.Background(),
+		ctrl.Log.WithName("processor/podRestartRecover"),
+		mgr.GetClient(),
+		featureGate.Enabled(features.PodRestartRecover),
+	)
+
+	webhookNotifier := notificationrecover.NewWebhookNotifier(
+		context.Background(),
+		ctrl.Log.WithName("processor/webhookNotifier"),
+		mgr.GetCache(),
+		opts.WebhookNotifierURL,
+		featureGate.Enabled(features.WebhookNotifier),
+	)
+
 	subpathRemountRecover := kuberecover.NewSubPathRemountRecover(
 		context.Background(),
 		ctrl.Log.WithName("processor/subpathRemountRecover"),
@@ -138,26 +570,93 @@ func RegisterProcessors(mgr manager.Manager,
 		ctrl.Log.WithName("processor/elasticsearchCollector"),
 		featureGate.Enabled(features.ElasticsearchCollector),
 	)
+	lokiLogCollector := logcollector.NewLokiLogCollector(
+		context.Background(),
+		ctrl.Log.WithName("processor/lokiLogCollector"),
+		featureGate.Enabled(features.LokiLogCollector),
+	)
+
+	var authenticator *bearerTokenAuthenticator
+	if opts.TokenFile != "" {
+		authenticator = &bearerTokenAuthenticator{tokenFile: opts.TokenFile}
+	}
+	// wrap applies bearer token authentication, concurrency limiting and duration observation to a
+	// processor handler.
+	wrap := func(handler http.HandlerFunc) http.HandlerFunc {
+		return withBearerTokenAuth(withMaxRequestsInFlight(withDurationMetric(handler, processorHandlerDuration), opts.MaxRequestsInFlight), authenticator)
+	}
 
 	// Handlers for collecting information.
-	router.HandleFunc("/processor/podListCollector", podListCollector.Handler)
-	router.HandleFunc("/processor/podDetailCollector", podDetailCollector.Handler)
-	router.HandleFunc("/processor/containerCollector", containerCollector.Handler)
-	router.HandleFunc("/processor/processCollector", processCollector.Handler)
-	router.HandleFunc("/processor/dockerInfoCollector", dockerInfoCollector.Handler)
-	router.HandleFunc("/processor/dockerdGoroutineCollector", dockerdGoroutineCollector.Handler)
-	router.HandleFunc("/processor/containerdGoroutineCollector", containerdGoroutineCollector.Handler)
-	router.HandleFunc("/processor/mountInfoCollector", mountInfoCollector.Handler)
-	router.HandleFunc("/processor/elasticsearchCollector", elasticsearchCollector.Handler)
+	router.HandleFunc("/processor/podListCollector", wrap(podListCollector.Handler))
+	router.HandleFunc("/processor/podDetailCollector", wrap(podDetailCollector.Handler))
+	router.HandleFunc("/processor/restartHistoryCollector", wrap(restartHistoryCollector.Handler))
+	router.HandleFunc("/processor/kubeletStatsCollector", wrap(kubeletStatsCollector.Handler))
+	router.HandleFunc("/processor/httpProbeCollector", wrap(httpProbeCollector.Handler))
+	router.HandleFunc("/processor/containerCollector", wrap(containerCollector.Handler))
+	router.HandleFunc("/processor/containerLogCollector", wrap(containerLogCollector.Handler))
+	router.HandleFunc("/processor/containerdCollector", wrap(containerdCollector.Handler))
+	router.HandleFunc("/processor/containerDiffCollector", wrap(containerDiffCollector.Handler))
+	router.HandleFunc("/processor/processCollector", wrap(processCollector.Handler))
+	router.HandleFunc("/processor/processTreeCollector", wrap(processTreeCollector.Handler))
+	router.HandleFunc("/processor/netInterfaceCollector", wrap(netInterfaceCollector.Handler))
+	router.HandleFunc("/processor/kernelStateCollector", wrap(kernelStateCollector.Handler))
+	router.HandleFunc("/processor/iptablesCollector", wrap(iptablesCollector.Handler))
+	router.HandleFunc("/processor/fileCollector", wrap(fileCollector.Handler))
+	router.HandleFunc("/processor/smartCollector", wrap(smartCollector.Handler))
+	router.HandleFunc("/processor/dockerInfoCollector", wrap(dockerInfoCollector.Handler))
+	router.HandleFunc("/processor/dockerdGoroutineCollector", wrap(dockerdGoroutineCollector.Handler))
+	router.HandleFunc("/processor/containerdGoroutineCollector", wrap(containerdGoroutineCollector.Handler))
+	router.HandleFunc("/processor/arthasThreadDumpCollector", wrap(arthasThreadDumpCollector.Handler))
+	router.HandleFunc("/processor/heapDumpCollector", wrap(heapDumpCollector.Handler))
+	router.HandleFunc("/processor/cgroupMemoryCollector", wrap(cgroupMemoryCollector.Handler))
+	router.HandleFunc("/processor/diskUsageCollector", wrap(diskUsageCollector.Handler))
+	router.HandleFunc("/processor/dmesgCollector", wrap(dmesgCollector.Handler))
+	router.HandleFunc("/processor/resourcePressureCollector", wrap(resourcePressureCollector.Handler))
+	router.HandleFunc("/processor/journaldCollector", wrap(journaldCollector.Handler))
+	router.HandleFunc("/processor/sysctlCollector", wrap(sysctlCollector.Handler))
+	router.HandleFunc("/processor/socketStatCollector", wrap(socketStatCollector.Handler))
+	router.HandleFunc("/processor/conntrackCollector", wrap(conntrackCollector.Handler))
+	router.HandleFunc("/processor/mountInfoCollector", wrap(mountInfoCollector.Handler))
+	router.HandleFunc("/processor/elasticsearchCollector", wrap(elasticsearchCollector.Handler))
+	router.HandleFunc("/processor/lokiLogCollector", wrap(lokiLogCollector.Handler))
 	// Handlers for executing specified command.
-	router.HandleFunc("/processor/nodeCordon", nodeCordon.Handler)
+	router.HandleFunc("/processor/nodeCordon", wrap(nodeCordon.Handler))
+	router.HandleFunc("/processor/nodeUncordon", wrap(nodeUncordon.Handler))
+	router.HandleFunc("/processor/nodeDrainRecover", wrap(nodeDrainRecover.Handler))
 	// Handlers for profiling programs.
-	router.HandleFunc("/processor/coreFileProfiler", coreFileProfiler.Handler)
-	router.HandleFunc("/processor/goProfiler", goProfiler.Handler)
+	router.HandleFunc("/processor/coreFileProfiler", wrap(coreFileProfiler.Handler))
+	router.HandleFunc("/processor/goProfiler", wrap(goProfiler.Handler))
+	router.HandleFunc("/processor/goroutineLeakDiagnoser", wrap(goroutineLeakDiagnoser.Handler))
+	router.HandleFunc("/processor/pythonProfiler", wrap(pythonProfiler.Handler))
+	router.HandleFunc("/processor/perfProfiler", wrap(perfProfiler.Handler))
 
 	// Handlers for diagnosing programs
-	router.HandleFunc("/processor/subpathRemountDiagnoser", subpathRemountDiagnoser.Handler)
+	router.HandleFunc("/processor/subpathRemountDiagnoser", wrap(subpathRemountDiagnoser.Handler))
+	router.HandleFunc("/processor/staleMountDiagnoser", wrap(staleMountDiagnoser.Handler))
+	router.HandleFunc("/processor/volumeDiagnoser", wrap(volumeDiagnoser.Handler))
+	router.HandleFunc("/processor/oomKillDiagnoser", wrap(oomKillDiagnoser.Handler))
+	router.HandleFunc("/processor/crashLoopDiagnoser", wrap(crashLoopDiagnoser.Handler))
+	router.HandleFunc("/processor/nodeNotReadyDiagnoser", wrap(nodeNotReadyDiagnoser.Handler))
+	router.HandleFunc("/processor/imagePullDiagnoser", wrap(imagePullDiagnoser.Handler))
+	router.HandleFunc("/processor/fdExhaustionDiagnoser", wrap(fdExhaustionDiagnoser.Handler))
+	router.HandleFunc("/processor/clockSkewDiagnoser", wrap(clockSkewDiagnoser.Handler))
+	router.HandleFunc("/processor/dnsResolutionDiagnoser", wrap(dnsResolutionDiagnoser.Handler))
+	router.HandleFunc("/processor/prometheusQueryDiagnoser", wrap(prometheusQueryDiagnoser.Handler))
+	router.HandleFunc("/processor/cpuThrottlingDiagnoser", wrap(cpuThrottlingDiagnoser.Handler))
 
-	router.HandleFunc("/processor/subpathRemountRecover", subpathRemountRecover.Handler)
+	router.HandleFunc("/processor/subpathRemountRecover", wrap(subpathRemountRecover.Handler))
+	router.HandleFunc("/processor/podRestartRecover", wrap(podRestart.Handler))
+	router.HandleFunc("/processor/dropCachesRecover", wrap(dropCachesRecover.Handler))
+	router.HandleFunc("/processor/scriptRecover", wrap(scriptRecover.Handler))
+	router.HandleFunc("/processor/webhookNotifier", wrap(webhookNotifier.Handler))
+
+	// Handler for listing live profiler sessions on the node.
+	router.HandleFunc("/profilers", wrap(processors.ProfilerSessionsHandler))
+
+	// Handlers of custom processors registered by custom builds.
+	for name, handler := range listCustomProcessors() {
+		setupLog.Info("mounting custom processor", "processor", name)
+		router.HandleFunc("/processor/"+name, wrap(handler))
+	}
 	return nil
 }
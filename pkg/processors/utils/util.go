@@ -19,9 +19,11 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
 
 	v1 "github.com/kubediag/kubediag/api/v1"
 	"github.com/kubediag/kubediag/pkg/executor"
@@ -67,6 +69,56 @@ func GetAvailablePort() (int, error) {
 	return l.Addr().(*net.TCPAddr).Port, nil
 }
 
+// ReadFileTail reads the last tailLines lines from the file without loading the whole file
+// into memory.
+func ReadFileTail(path string, tailLines int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the file backwards in chunks until enough lines have been found.
+	var lines int
+	chunk := make([]byte, 4096)
+	offset := info.Size()
+	for offset > 0 && lines <= tailLines {
+		size := int64(len(chunk))
+		if offset < size {
+			size = offset
+		}
+		offset = offset - size
+		if _, err := file.ReadAt(chunk[:size], offset); err != nil {
+			return nil, err
+		}
+
+		for i := size - 1; i >= 0; i-- {
+			if chunk[i] == '\n' {
+				// The trailing newline does not terminate an extra line.
+				if offset+i == info.Size()-1 {
+					continue
+				}
+				lines++
+				if lines > tailLines {
+					offset = offset + i + 1
+					break
+				}
+			}
+		}
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(file)
+}
+
 // GetPodInfoFromContext gets pod information from http json object payload.
 func GetPodInfoFromContext(data map[string]string) v1.PodReference {
 	return v1.PodReference{
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rpc defines the grpc contract between kubediag and external grpc operation processors.
+// The message and service definitions mirror processor.proto and are maintained by hand to keep
+// protoc out of the build.
+package rpc
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// ProcessRequest carries the diagnosis context sent to an operation processor.
+type ProcessRequest struct {
+	// Context contains parameters and operation results of the diagnosis.
+	Context map[string]string `protobuf:"bytes,1,rep,name=context" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"context,omitempty"`
+}
+
+// Reset implements the proto.Message interface.
+func (m *ProcessRequest) Reset() { *m = ProcessRequest{} }
+
+// String implements the proto.Message interface.
+func (m *ProcessRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements the proto.Message interface.
+func (*ProcessRequest) ProtoMessage() {}
+
+// ProcessResponse carries the operation results produced by an operation processor.
+type ProcessResponse struct {
+	// Context contains operation results to be merged into the diagnosis.
+	Context map[string]string `protobuf:"bytes,1,rep,name=context" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value" json:"context,omitempty"`
+}
+
+// Reset implements the proto.Message interface.
+func (m *ProcessResponse) Reset() { *m = ProcessResponse{} }
+
+// String implements the proto.Message interface.
+func (m *ProcessResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements the proto.Message interface.
+func (*ProcessResponse) ProtoMessage() {}
+
+// OperationProcessorClient is the client API for the OperationProcessor service.
+type OperationProcessorClient interface {
+	// Process executes the operation with the diagnosis context.
+	Process(ctx context.Context, in *ProcessRequest, opts ...grpc.CallOption) (*ProcessResponse, error)
+}
+
+type operationProcessorClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewOperationProcessorClient creates a new OperationProcessorClient.
+func NewOperationProcessorClient(cc *grpc.ClientConn) OperationProcessorClient {
+	return &operationProcessorClient{cc}
+}
+
+func (c *operationProcessorClient) Process(ctx context.Context, in *ProcessRequest, opts ...grpc.CallOption) (*ProcessResponse, error) {
+	out := new(ProcessResponse)
+	err := c.cc.Invoke(ctx, "/kubediag.OperationProcessor/Process", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OperationProcessorServer is the server API for the OperationProcessor service.
+type OperationProcessorServer interface {
+	// Process executes the operation with the diagnosis context.
+	Process(ctx context.Context, in *ProcessRequest) (*ProcessResponse, error)
+}
+
+// RegisterOperationProcessorServer registers the OperationProcessor service implementation with
+// the grpc server.
+func RegisterOperationProcessorServer(s *grpc.Server, srv OperationProcessorServer) {
+	s.RegisterService(&operationProcessorServiceDesc, srv)
+}
+
+func operationProcessorProcessHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProcessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OperationProcessorServer).Process(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kubediag.OperationProcessor/Process",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OperationProcessorServer).Process(ctx, req.(*ProcessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var operationProcessorServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kubediag.OperationProcessor",
+	HandlerType: (*OperationProcessorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Process",
+			Handler:    operationProcessorProcessHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "processor.proto",
+}
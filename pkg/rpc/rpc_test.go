@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testOperationProcessor echoes the request context with a fixed result appended, or fails if the
+// context contains a fail key.
+type testOperationProcessor struct{}
+
+func (testOperationProcessor) Process(ctx context.Context, in *ProcessRequest) (*ProcessResponse, error) {
+	if _, ok := in.Context["fail"]; ok {
+		return nil, status.Error(codes.Internal, "processor failed")
+	}
+
+	result := make(map[string]string)
+	for key, value := range in.Context {
+		result[key] = value
+	}
+	result["collector.test.result"] = "value"
+
+	return &ProcessResponse{Context: result}, nil
+}
+
+func TestOperationProcessorRoundTrip(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	RegisterOperationProcessorServer(server, testOperationProcessor{})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := NewOperationProcessorClient(conn)
+
+	response, err := client.Process(context.Background(), &ProcessRequest{
+		Context: map[string]string{
+			"param.test.key": "value1",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", response.Context["param.test.key"], "request context echoed")
+	assert.Equal(t, "value", response.Context["collector.test.result"], "processor result returned")
+
+	_, err = client.Process(context.Background(), &ProcessRequest{
+		Context: map[string]string{
+			"fail": "true",
+		},
+	})
+	assert.Equal(t, codes.Internal, status.Code(err), "processor failure reported as grpc status")
+}
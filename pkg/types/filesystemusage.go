@@ -0,0 +1,40 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// FilesystemUsage contains bytes and inode usage information of a mounted filesystem.
+// See statfs(2) linux manual page for more details:
+//
+// https://man7.org/linux/man-pages/man2/statfs.2.html
+type FilesystemUsage struct {
+	// MountPoint is the mount point of the filesystem.
+	MountPoint string `json:"mountPoint"`
+	// TotalBytes is the total size of the filesystem in bytes.
+	TotalBytes uint64 `json:"totalBytes"`
+	// FreeBytes is the free size of the filesystem in bytes.
+	FreeBytes uint64 `json:"freeBytes"`
+	// AvailableBytes is the size available to unprivileged users of the filesystem in bytes.
+	AvailableBytes uint64 `json:"availableBytes"`
+	// UsedBytes is the used size of the filesystem in bytes.
+	UsedBytes uint64 `json:"usedBytes"`
+	// TotalInodes is the total number of inodes of the filesystem.
+	TotalInodes uint64 `json:"totalInodes"`
+	// FreeInodes is the number of free inodes of the filesystem.
+	FreeInodes uint64 `json:"freeInodes"`
+	// UsedInodes is the number of used inodes of the filesystem.
+	UsedInodes uint64 `json:"usedInodes"`
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The KubeDiag Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
+)
+
+const (
+	// DuplicatesAnnotation records how many duplicate diagnoses have been merged into a
+	// diagnosis instead of being created.
+	DuplicatesAnnotation = KubeDiagPrefix + "duplicates"
+	// LastDuplicateTimeAnnotation records when a duplicate diagnosis was last merged into a
+	// diagnosis.
+	LastDuplicateTimeAnnotation = KubeDiagPrefix + "last-duplicate-time"
+)
+
+// DiagnosisDedupKeyFunc derives the key used to detect duplicate diagnoses. Diagnoses with the
+// same key describe the same underlying problem. An empty key disables deduplication for the
+// diagnosis.
+type DiagnosisDedupKeyFunc func(diagnosis diagnosisv1.Diagnosis) string
+
+// DefaultDiagnosisDedupKey keys a diagnosis by its source, node name and pod reference so that
+// multiple triggers firing for the same failing pod merge into one diagnosis. A diagnosis
+// without a node name and pod reference is not deduplicated.
+func DefaultDiagnosisDedupKey(diagnosis diagnosisv1.Diagnosis) string {
+	if diagnosis.Spec.NodeName == "" && diagnosis.Spec.PodReference == nil {
+		return ""
+	}
+
+	key := fmt.Sprintf("%s/%s", DiagnosisSource(diagnosis), diagnosis.Spec.NodeName)
+	if diagnosis.Spec.PodReference != nil {
+		key = fmt.Sprintf("%s/%s/%s", key, diagnosis.Spec.PodReference.Namespace, diagnosis.Spec.PodReference.Name)
+	}
+
+	return key
+}
+
+// CreateOrMergeDiagnosis creates the diagnosis unless an uncompleted diagnosis with the same
+// dedup key already exists, in which case the evidence of the new diagnosis is merged into the
+// existing one instead to avoid running the same operations twice for one underlying problem.
+// A nil key func selects DefaultDiagnosisDedupKey. It returns the diagnosis which covers the
+// problem and whether the new diagnosis was merged into an existing one.
+func CreateOrMergeDiagnosis(ctx context.Context, cli client.Client, reader client.Reader, diagnosis *diagnosisv1.Diagnosis, keyFunc DiagnosisDedupKeyFunc) (*diagnosisv1.Diagnosis, bool, error) {
+	if keyFunc == nil {
+		keyFunc = DefaultDiagnosisDedupKey
+	}
+
+	key := keyFunc(*diagnosis)
+	if key != "" {
+		var diagnosisList diagnosisv1.DiagnosisList
+		if err := reader.List(ctx, &diagnosisList, client.InNamespace(diagnosis.Namespace)); err != nil {
+			return nil, false, err
+		}
+
+		for i := range diagnosisList.Items {
+			existing := &diagnosisList.Items[i]
+			if existing.Name == diagnosis.Name || IsDiagnosisCompleted(*existing) {
+				continue
+			}
+			if keyFunc(*existing) != key {
+				continue
+			}
+
+			MergeDiagnosisEvidence(existing, *diagnosis, time.Now())
+			if err := cli.Update(ctx, existing); err != nil {
+				return nil, false, err
+			}
+
+			return existing, true, nil
+		}
+	}
+
+	if err := cli.Create(ctx, diagnosis); err != nil {
+		return nil, false, err
+	}
+
+	return diagnosis, false, nil
+}
+
+// MergeDiagnosisEvidence merges the evidence of a duplicate diagnosis into an existing one.
+// Parameters and annotations of the duplicate which are not set on the existing diagnosis are
+// added, and the duplicate count and last duplicate time annotations are updated. Values
+// already set on the existing diagnosis are never overwritten.
+func MergeDiagnosisEvidence(existing *diagnosisv1.Diagnosis, duplicate diagnosisv1.Diagnosis, now time.Time) {
+	if len(duplicate.Spec.Parameters) > 0 && existing.Spec.Parameters == nil {
+		existing.Spec.Parameters = make(map[string]string)
+	}
+	for key, value := range duplicate.Spec.Parameters {
+		if _, ok := existing.Spec.Parameters[key]; !ok {
+			existing.Spec.Parameters[key] = value
+		}
+	}
+
+	if existing.Annotations == nil {
+		existing.Annotations = make(map[string]string)
+	}
+	for key, value := range duplicate.Annotations {
+		if _, ok := existing.Annotations[key]; !ok {
+			existing.Annotations[key] = value
+		}
+	}
+
+	duplicates := 1
+	if value, err := strconv.Atoi(existing.Annotations[DuplicatesAnnotation]); err == nil {
+		duplicates = value + 1
+	}
+	existing.Annotations[DuplicatesAnnotation] = strconv.Itoa(duplicates)
+	existing.Annotations[LastDuplicateTimeAnnotation] = now.UTC().Format(time.RFC3339)
+}
@@ -17,22 +17,30 @@ limitations under the License.
 package util
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"hash/fnv"
 	"net"
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
 
 	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
 )
@@ -46,6 +54,10 @@ const (
 	KubeletPodDirectory = "/var/lib/kubelet/pods"
 	// DefautlNamespace is the default namespace of kubediag.
 	DefautlNamespace = "kubediag"
+	// DefaultCommandTimeoutSeconds is the default timeout in seconds of executing a command.
+	DefaultCommandTimeoutSeconds = 30
+	// MinimumCommandTimeoutSeconds is the minimum timeout in seconds of executing a command.
+	MinimumCommandTimeoutSeconds = 1
 	// PodKillGracePeriodSeconds is the duration in seconds after the pod is forcibly halted
 	// with a kill signal and the time when the pod is taken as an abormal pod.
 	PodKillGracePeriodSeconds = 30
@@ -76,6 +88,39 @@ const (
 	AlphaNums = "bcdfghjklmnpqrstvwxz2456789"
 )
 
+const (
+	// DiagnosisSourcePrometheusAlert marks a diagnosis generated from a prometheus alert.
+	DiagnosisSourcePrometheusAlert = "PrometheusAlert"
+	// DiagnosisSourceKubernetesEvent marks a diagnosis generated from a kubernetes event.
+	DiagnosisSourceKubernetesEvent = "KubernetesEvent"
+	// DiagnosisSourceKafkaMessage marks a diagnosis generated from a kafka message.
+	DiagnosisSourceKafkaMessage = "KafkaMessage"
+	// DiagnosisSourceCron marks a diagnosis generated by a cron trigger.
+	DiagnosisSourceCron = "Cron"
+	// DiagnosisSourceCustom marks a diagnosis created directly by a user or an external system.
+	DiagnosisSourceCustom = "Custom"
+)
+
+// DiagnosisSource reports the source a diagnosis was generated from according to the annotations
+// set by the source on creation. The returned value is one of the known source constants so it is
+// safe to use as a metric label.
+func DiagnosisSource(diagnosis diagnosisv1.Diagnosis) string {
+	if _, ok := diagnosis.Annotations[KubeDiagPrefix+"prometheus-alert"]; ok {
+		return DiagnosisSourcePrometheusAlert
+	}
+	if _, ok := diagnosis.Annotations[KubeDiagPrefix+"kubernetes-event"]; ok {
+		return DiagnosisSourceKubernetesEvent
+	}
+	if _, ok := diagnosis.Annotations[KubeDiagPrefix+"kafka-message-topic"]; ok {
+		return DiagnosisSourceKafkaMessage
+	}
+	if _, ok := diagnosis.Annotations[KubeDiagPrefix+"cron"]; ok {
+		return DiagnosisSourceCron
+	}
+
+	return DiagnosisSourceCustom
+}
+
 // UpdateDiagnosisCondition updates existing diagnosis condition or creates a new one. Sets
 // LastTransitionTime to now if the status has changed.
 // Returns true if diagnosis condition has changed or has been added.
@@ -87,10 +132,12 @@ func UpdateDiagnosisCondition(status *diagnosisv1.DiagnosisStatus, condition *di
 	if oldCondition == nil {
 		// We are adding new diagnosis condition.
 		status.Conditions = append(status.Conditions, *condition)
+		normalizeDiagnosisConditions(status)
 		return true
 	}
 
-	// We are updating an existing condition, so we need to check if it has changed.
+	// We are updating an existing condition. The transition time is only advanced when the
+	// status value actually transitions.
 	if condition.Status == oldCondition.Status {
 		condition.LastTransitionTime = oldCondition.LastTransitionTime
 	}
@@ -101,11 +148,58 @@ func UpdateDiagnosisCondition(status *diagnosisv1.DiagnosisStatus, condition *di
 		condition.LastTransitionTime.Equal(&oldCondition.LastTransitionTime)
 
 	status.Conditions[conditionIndex] = *condition
+	normalizeDiagnosisConditions(status)
 
 	// Return true if one of the fields have changed.
 	return !isEqual
 }
 
+// SetDiagnosisOwnerReferenceToTrigger sets the controller owner reference of the diagnosis to
+// the trigger which generated it. The diagnosis is garbage collected by Kubernetes when the
+// trigger is deleted.
+func SetDiagnosisOwnerReferenceToTrigger(diagnosis *diagnosisv1.Diagnosis, trigger diagnosisv1.Trigger) {
+	diagnosis.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(&trigger, diagnosisv1.GroupVersion.WithKind("Trigger")),
+	}
+}
+
+// SetDiagnosisConditionError updates the condition of the specified type with a False status,
+// a machine readable reason and the error in the message. It is intended for failure paths so
+// that the reason a stage failed is visible in the diagnosis status without parsing logs.
+// Returns true if diagnosis condition has changed or has been added.
+func SetDiagnosisConditionError(status *diagnosisv1.DiagnosisStatus, conditionType diagnosisv1.DiagnosisConditionType, reason string, err error) bool {
+	var message string
+	if err != nil {
+		message = err.Error()
+	}
+
+	return UpdateDiagnosisCondition(status, &diagnosisv1.DiagnosisCondition{
+		Type:    conditionType,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// normalizeDiagnosisConditions removes duplicate condition types and keeps conditions sorted
+// by type so status diffs are stable across reconciles. The first condition of a type is kept.
+func normalizeDiagnosisConditions(status *diagnosisv1.DiagnosisStatus) {
+	seen := make(map[diagnosisv1.DiagnosisConditionType]bool, len(status.Conditions))
+	deduplicated := status.Conditions[:0]
+	for _, condition := range status.Conditions {
+		if seen[condition.Type] {
+			continue
+		}
+		seen[condition.Type] = true
+		deduplicated = append(deduplicated, condition)
+	}
+
+	status.Conditions = deduplicated
+	sort.SliceStable(status.Conditions, func(i, j int) bool {
+		return status.Conditions[i].Type < status.Conditions[j].Type
+	})
+}
+
 // GetDiagnosisCondition extracts the provided condition from the given status.
 // Returns -1 and nil if the condition is not present, otherwise returns the index of the located condition.
 func GetDiagnosisCondition(status *diagnosisv1.DiagnosisStatus, conditionType diagnosisv1.DiagnosisConditionType) (int, *diagnosisv1.DiagnosisCondition) {
@@ -244,6 +338,52 @@ func QueueDiagnosis(ctx context.Context, channel chan diagnosisv1.Diagnosis, dia
 	}
 }
 
+// QueueOverflowPolicy determines the behavior of enqueuing a diagnosis on a full channel.
+type QueueOverflowPolicy string
+
+const (
+	// QueueOverflowPolicyRejectNew rejects the diagnosis being enqueued with an error. This is the
+	// default policy.
+	QueueOverflowPolicyRejectNew QueueOverflowPolicy = "reject-new"
+	// QueueOverflowPolicyDropOldest drops the oldest queued diagnosis to make room for the
+	// diagnosis being enqueued.
+	QueueOverflowPolicyDropOldest QueueOverflowPolicy = "drop-oldest"
+	// QueueOverflowPolicyBlock blocks until the channel has room or the context is done.
+	QueueOverflowPolicyBlock QueueOverflowPolicy = "block"
+)
+
+// QueueDiagnosisWithPolicy sends a diagnosis to a channel with the provided overflow policy. It
+// returns an error only with the reject new policy if the channel is blocked.
+func QueueDiagnosisWithPolicy(ctx context.Context, channel chan diagnosisv1.Diagnosis, diagnosis diagnosisv1.Diagnosis, policy QueueOverflowPolicy) error {
+	switch policy {
+	case QueueOverflowPolicyBlock:
+		select {
+		case <-ctx.Done():
+			return nil
+		case channel <- diagnosis:
+			return nil
+		}
+	case QueueOverflowPolicyDropOldest:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case channel <- diagnosis:
+				return nil
+			default:
+			}
+			// The channel is full. Drop the oldest queued diagnosis and retry the send. Another
+			// consumer may have made room in the meantime, in which case the receive is skipped.
+			select {
+			case <-channel:
+			default:
+			}
+		}
+	default:
+		return QueueDiagnosis(ctx, channel, diagnosis)
+	}
+}
+
 // QueueOperationSet sends an operation set to a channel. It returns an error if the channel is blocked.
 func QueueOperationSet(ctx context.Context, channel chan diagnosisv1.OperationSet, operationSet diagnosisv1.OperationSet) error {
 	select {
@@ -268,6 +408,106 @@ func QueueEvent(ctx context.Context, channel chan corev1.Event, event corev1.Eve
 	}
 }
 
+// GetDiagnosisContext retrieves the raw value of a key from parameters and operation results of a diagnosis.
+// A value in operation results overrides the value of the same key in parameters, which is consistent with
+// the order of request data construction on running diagnosis.
+func GetDiagnosisContext(diagnosis diagnosisv1.Diagnosis, key string) (string, error) {
+	if value, ok := diagnosis.Status.OperationResults[key]; ok {
+		return value, nil
+	}
+	if value, ok := diagnosis.Spec.Parameters[key]; ok {
+		return value, nil
+	}
+
+	return "", fmt.Errorf("key %s not found in parameters and operation results of diagnosis %s/%s", key, diagnosis.Namespace, diagnosis.Name)
+}
+
+// GetDiagnosisContextValue retrieves the value of a key from parameters and operation results of a diagnosis
+// and unmarshals the json encoded value into the provided value pointer. It spares callers from handling
+// raw strings and unmarshalling on every typed read.
+func GetDiagnosisContextValue(diagnosis diagnosisv1.Diagnosis, key string, value interface{}) error {
+	raw, err := GetDiagnosisContext(diagnosis, key)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(raw), value); err != nil {
+		return fmt.Errorf("unable to unmarshal value of key %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// GetDiagnosisContextByPath evaluates a jsonpath expression against the decoded context of a diagnosis
+// and returns the matched value. The context consists of parameters and operation results of the
+// diagnosis with values in json encoding decoded before evaluation. Collectors store nested json
+// objects in the context and the jsonpath expression reaches into them, e.g. passing the expression
+// "{.podlist[0].name}" returns the name of the first pod stored under the "podlist" key.
+func GetDiagnosisContextByPath(diagnosis diagnosisv1.Diagnosis, path string) (string, error) {
+	if diagnosis.Spec.Parameters == nil && diagnosis.Status.OperationResults == nil {
+		return "", fmt.Errorf("parameters and operation results of diagnosis %s/%s are nil", diagnosis.Namespace, diagnosis.Name)
+	}
+
+	// Operation results take precedence over parameters on duplicated keys.
+	decoded := make(map[string]interface{})
+	for key, value := range diagnosis.Spec.Parameters {
+		decoded[key] = decodeContextValue(value)
+	}
+	for key, value := range diagnosis.Status.OperationResults {
+		decoded[key] = decodeContextValue(value)
+	}
+
+	parser := jsonpath.New("diagnosis-context")
+	if err := parser.Parse(path); err != nil {
+		return "", fmt.Errorf("malformed jsonpath %s: %v", path, err)
+	}
+	var buf bytes.Buffer
+	if err := parser.Execute(&buf, decoded); err != nil {
+		return "", fmt.Errorf("failed to evaluate jsonpath %s on diagnosis %s/%s: %v", path, diagnosis.Namespace, diagnosis.Name, err)
+	}
+
+	return buf.String(), nil
+}
+
+// SetDiagnosisContextMap merges all entries into the operation results of the diagnosis in a
+// single pass. String values are stored as they are while other values are encoded as json.
+// Existing keys are overwritten instead of duplicated and a nil operation result map is
+// initialized before the merge.
+func SetDiagnosisContextMap(diagnosis *diagnosisv1.Diagnosis, entries map[string]interface{}) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if diagnosis.Status.OperationResults == nil {
+		diagnosis.Status.OperationResults = make(map[string]string, len(entries))
+	}
+
+	for key, value := range entries {
+		switch typed := value.(type) {
+		case string:
+			diagnosis.Status.OperationResults[key] = typed
+		default:
+			data, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("unable to marshal value of key %s: %v", key, err)
+			}
+			diagnosis.Status.OperationResults[key] = string(data)
+		}
+	}
+
+	return nil
+}
+
+// decodeContextValue decodes a context value in json encoding. The raw string is returned if the
+// value is not in json encoding.
+func decodeContextValue(value string) interface{} {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return value
+	}
+
+	return decoded
+}
+
 // IsDiagnosisCompleted return true if Diagnosis is failed or succeed
 func IsDiagnosisCompleted(diagnosis diagnosisv1.Diagnosis) bool {
 	return diagnosis.Status.Phase == diagnosisv1.DiagnosisSucceeded || diagnosis.Status.Phase == diagnosisv1.DiagnosisFailed
@@ -279,6 +519,31 @@ func IsDiagnosisNodeNameMatched(diagnosis diagnosisv1.Diagnosis, nodeName string
 	return diagnosis.Spec.NodeName == "" || diagnosis.Spec.NodeName == nodeName
 }
 
+// IsDiagnosisNodeMatchedByPattern checks if the diagnosis is on one of the nodes described by the
+// patterns. A pattern wrapped in slashes is interpreted as a regular expression and as a glob
+// pattern otherwise. It returns true if node name of the diagnosis is empty or matches any of the
+// provided patterns, otherwise false. Invalid patterns do not match any node name.
+func IsDiagnosisNodeMatchedByPattern(diagnosis diagnosisv1.Diagnosis, patterns []string) bool {
+	if diagnosis.Spec.NodeName == "" {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") && len(pattern) > 1 {
+			matched, err := regexp.MatchString(strings.Trim(pattern, "/"), diagnosis.Spec.NodeName)
+			if err == nil && matched {
+				return true
+			}
+			continue
+		}
+		if matched, err := path.Match(pattern, diagnosis.Spec.NodeName); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
 // RetrievePodsOnNode retrieves all pods on the provided node.
 func RetrievePodsOnNode(pods []corev1.Pod, nodeName string) []corev1.Pod {
 	podsOnNode := make([]corev1.Pod, 0)
@@ -291,6 +556,24 @@ func RetrievePodsOnNode(pods []corev1.Pod, nodeName string) []corev1.Pod {
 	return podsOnNode
 }
 
+// RetrievePodsOnNodeWithSelector retrieves all pods on the provided node which are in the provided
+// namespace and match the label selector. An empty namespace or a nil selector does not restrict
+// the result.
+func RetrievePodsOnNodeWithSelector(pods []corev1.Pod, nodeName string, namespace string, selector labels.Selector) []corev1.Pod {
+	matchedPods := make([]corev1.Pod, 0)
+	for _, pod := range RetrievePodsOnNode(pods, nodeName) {
+		if namespace != "" && pod.Namespace != namespace {
+			continue
+		}
+		if selector != nil && !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		matchedPods = append(matchedPods, pod)
+	}
+
+	return matchedPods
+}
+
 // RetrieveDiagnosesOnNode retrieves all diagnoses on the provided node.
 func RetrieveDiagnosesOnNode(diagnoses []diagnosisv1.Diagnosis, nodeName string) []diagnosisv1.Diagnosis {
 	diagnosesOnNode := make([]diagnosisv1.Diagnosis, 0)
@@ -440,16 +723,56 @@ func Unzip(src string, dst string, timeoutSeconds int32) error {
 	return nil
 }
 
-// BlockingRunCommandWithTimeout executes command in blocking mode with timeout seconds.
+// BlockingRunCommandWithTimeout executes command in blocking mode with timeout seconds. A zero
+// timeout defaults to 30 seconds and a timeout below 1 second is clamped up to 1 second. The
+// command and all of its children are killed if the command does not complete before the timeout.
 func BlockingRunCommandWithTimeout(command []string, timeoutSeconds int32) ([]byte, error) {
-	timeoutCommand := []string{"timeout", fmt.Sprintf("%ds", timeoutSeconds)}
-	timeoutCommand = append(timeoutCommand, command...)
-	out, err := exec.Command(timeoutCommand[0], timeoutCommand[1:]...).CombinedOutput()
-	if err != nil {
-		return out, err
+	return BlockingRunCommandWithTimeoutEnv(command, nil, timeoutSeconds)
+}
+
+// BlockingRunCommandWithTimeoutEnv behaves like BlockingRunCommandWithTimeout and additionally
+// appends the environment variables in env, each in the form key=value, to the environment of
+// the command.
+func BlockingRunCommandWithTimeoutEnv(command []string, env []string, timeoutSeconds int32) ([]byte, error) {
+	if timeoutSeconds == 0 {
+		timeoutSeconds = DefaultCommandTimeoutSeconds
+	} else if timeoutSeconds < MinimumCommandTimeoutSeconds {
+		timeoutSeconds = MinimumCommandTimeoutSeconds
+	}
+
+	var buf bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	// Setting a new process group id to kill the command and all of its children on timeout.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Start(); err != nil {
+		return nil, err
 	}
 
-	return out, nil
+	exit := make(chan error, 1)
+	go func() {
+		exit <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exit:
+		return buf.Bytes(), err
+	case <-time.After(time.Duration(timeoutSeconds) * time.Second):
+		// Kill the command and all of its children with its process group id.
+		pgid, err := syscall.Getpgid(cmd.Process.Pid)
+		if err != nil {
+			_ = cmd.Process.Kill()
+		} else {
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+		<-exit
+
+		return buf.Bytes(), fmt.Errorf("command %s timed out after %ds", command[0], timeoutSeconds)
+	}
 }
 
 // GetAvailablePort returns a free open port that is ready to use.
@@ -505,3 +828,135 @@ func SafeEncodeString(s string) string {
 	}
 	return string(r)
 }
+
+// Supported formats of FormatDiagnosisSummary.
+const (
+	// DiagnosisSummaryFormatSlack renders the summary as a slack block kit json payload.
+	DiagnosisSummaryFormatSlack = "slack"
+	// DiagnosisSummaryFormatMarkdown renders the summary as plain markdown.
+	DiagnosisSummaryFormatMarkdown = "markdown"
+)
+
+// FormatDiagnosisSummary renders a human readable summary of the diagnosis in the provided format.
+// The summary contains phase, node, severity, conditions and the last operation which acted on the
+// diagnosis. An error is returned on unsupported formats.
+func FormatDiagnosisSummary(diagnosis diagnosisv1.Diagnosis, format string) (string, error) {
+	switch format {
+	case DiagnosisSummaryFormatSlack:
+		return formatDiagnosisSummarySlack(diagnosis)
+	case DiagnosisSummaryFormatMarkdown:
+		return formatDiagnosisSummaryMarkdown(diagnosis), nil
+	default:
+		return "", fmt.Errorf("unsupported diagnosis summary format %s", format)
+	}
+}
+
+// diagnosisLastOperation retrieves the name of the last operation which acted on the diagnosis, or
+// an empty string if no operation has succeeded.
+func diagnosisLastOperation(diagnosis diagnosisv1.Diagnosis) string {
+	if len(diagnosis.Status.SucceededPath) == 0 {
+		return ""
+	}
+
+	return diagnosis.Status.SucceededPath[len(diagnosis.Status.SucceededPath)-1].Operation
+}
+
+// slackText is a text object of a slack block.
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackBlock is one block of a slack block kit payload.
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+// slackBlockKitPayload is a slack message payload in block kit layout.
+type slackBlockKitPayload struct {
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// formatDiagnosisSummarySlack renders the summary of the diagnosis as a slack block kit json payload.
+func formatDiagnosisSummarySlack(diagnosis diagnosisv1.Diagnosis) (string, error) {
+	fields := []slackText{
+		{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*Phase:*\n%s", diagnosis.Status.Phase),
+		},
+		{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*Node:*\n%s", diagnosis.Spec.NodeName),
+		},
+	}
+	if diagnosis.Spec.Severity != "" {
+		fields = append(fields, slackText{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*Severity:*\n%s", diagnosis.Spec.Severity),
+		})
+	}
+	if operation := diagnosisLastOperation(diagnosis); operation != "" {
+		fields = append(fields, slackText{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*Last Operation:*\n%s", operation),
+		})
+	}
+
+	blocks := []slackBlock{
+		{
+			Type: "header",
+			Text: &slackText{
+				Type: "plain_text",
+				Text: fmt.Sprintf("Diagnosis %s/%s", diagnosis.Namespace, diagnosis.Name),
+			},
+		},
+		{
+			Type:   "section",
+			Fields: fields,
+		},
+	}
+	if len(diagnosis.Status.Conditions) > 0 {
+		lines := make([]string, 0, len(diagnosis.Status.Conditions))
+		for _, condition := range diagnosis.Status.Conditions {
+			lines = append(lines, fmt.Sprintf("• %s: %s (%s)", condition.Type, condition.Status, condition.Reason))
+		}
+		blocks = append(blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*Conditions:*\n%s", strings.Join(lines, "\n")),
+			},
+		})
+	}
+
+	data, err := json.Marshal(slackBlockKitPayload{Blocks: blocks})
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// formatDiagnosisSummaryMarkdown renders the summary of the diagnosis as plain markdown.
+func formatDiagnosisSummaryMarkdown(diagnosis diagnosisv1.Diagnosis) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("## Diagnosis %s/%s\n\n", diagnosis.Namespace, diagnosis.Name))
+	builder.WriteString(fmt.Sprintf("- Phase: %s\n", diagnosis.Status.Phase))
+	builder.WriteString(fmt.Sprintf("- Node: %s\n", diagnosis.Spec.NodeName))
+	if diagnosis.Spec.Severity != "" {
+		builder.WriteString(fmt.Sprintf("- Severity: %s\n", diagnosis.Spec.Severity))
+	}
+	if operation := diagnosisLastOperation(diagnosis); operation != "" {
+		builder.WriteString(fmt.Sprintf("- Last Operation: %s\n", operation))
+	}
+	if len(diagnosis.Status.Conditions) > 0 {
+		builder.WriteString("\n### Conditions\n\n")
+		for _, condition := range diagnosis.Status.Conditions {
+			builder.WriteString(fmt.Sprintf("- %s: %s (%s) %s\n", condition.Type, condition.Status, condition.Reason, condition.Message))
+		}
+	}
+
+	return builder.String()
+}
@@ -17,12 +17,17 @@ limitations under the License.
 package util
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
 	diagnosisv1 "github.com/kubediag/kubediag/api/v1"
 )
@@ -86,6 +91,135 @@ func TestUpdateDiagnosisCondition(t *testing.T) {
 	}
 }
 
+func TestUpdateDiagnosisConditionKeepsConditionsSortedAndDeduplicated(t *testing.T) {
+	status := &diagnosisv1.DiagnosisStatus{
+		Conditions: []diagnosisv1.DiagnosisCondition{
+			{
+				Type:   diagnosisv1.DiagnosisComplete,
+				Status: corev1.ConditionTrue,
+			},
+			{
+				Type:   diagnosisv1.DiagnosisAccepted,
+				Status: corev1.ConditionTrue,
+			},
+			{
+				Type:   diagnosisv1.DiagnosisComplete,
+				Status: corev1.ConditionFalse,
+			},
+		},
+	}
+
+	updated := UpdateDiagnosisCondition(status, &diagnosisv1.DiagnosisCondition{
+		Type:   diagnosisv1.DiagnosisAccepted,
+		Status: corev1.ConditionTrue,
+	})
+
+	assert.False(t, updated, "status did not transition, no update")
+	assert.Equal(t, 2, len(status.Conditions), "duplicate condition types removed")
+	assert.Equal(t, diagnosisv1.DiagnosisAccepted, status.Conditions[0].Type, "conditions sorted by type")
+	assert.Equal(t, diagnosisv1.DiagnosisComplete, status.Conditions[1].Type, "conditions sorted by type")
+	assert.Equal(t, corev1.ConditionTrue, status.Conditions[1].Status, "first condition of a duplicated type kept")
+}
+
+func TestSetDiagnosisOwnerReferenceToTrigger(t *testing.T) {
+	trigger := diagnosisv1.Trigger{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "trigger1",
+			UID:  "f3c2a570-c250-4f1d-bbcb-59e72cd8d1ae",
+		},
+	}
+	diagnosis := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis1",
+			Namespace: "default",
+		},
+	}
+
+	SetDiagnosisOwnerReferenceToTrigger(&diagnosis, trigger)
+
+	assert.Equal(t, 1, len(diagnosis.OwnerReferences))
+	ownerReference := diagnosis.OwnerReferences[0]
+	assert.Equal(t, "Trigger", ownerReference.Kind)
+	assert.Equal(t, diagnosisv1.GroupVersion.String(), ownerReference.APIVersion)
+	assert.Equal(t, trigger.Name, ownerReference.Name)
+	assert.Equal(t, trigger.UID, ownerReference.UID)
+	assert.NotNil(t, ownerReference.Controller)
+	assert.True(t, *ownerReference.Controller)
+}
+
+func TestSetDiagnosisConditionError(t *testing.T) {
+	tests := []struct {
+		status            *diagnosisv1.DiagnosisStatus
+		conditionType     diagnosisv1.DiagnosisConditionType
+		reason            string
+		err               error
+		expected          bool
+		expectedCondition diagnosisv1.DiagnosisCondition
+		desc              string
+	}{
+		{
+			status:        &diagnosisv1.DiagnosisStatus{},
+			conditionType: diagnosisv1.DiagnosisComplete,
+			reason:        "OperationFailed",
+			err:           errors.New("operation operation1 failed"),
+			expected:      true,
+			expectedCondition: diagnosisv1.DiagnosisCondition{
+				Type:    diagnosisv1.DiagnosisComplete,
+				Status:  corev1.ConditionFalse,
+				Reason:  "OperationFailed",
+				Message: "operation operation1 failed",
+			},
+			desc: "failure condition added with error in message",
+		},
+		{
+			status: &diagnosisv1.DiagnosisStatus{
+				Conditions: []diagnosisv1.DiagnosisCondition{
+					{
+						Type:    diagnosisv1.DiagnosisComplete,
+						Status:  corev1.ConditionTrue,
+						Reason:  "DiagnosisComplete",
+						Message: "Diagnosis is completed",
+					},
+				},
+			},
+			conditionType: diagnosisv1.DiagnosisComplete,
+			reason:        "OperationTimedOut",
+			err:           errors.New("operation operation1 timed out"),
+			expected:      true,
+			expectedCondition: diagnosisv1.DiagnosisCondition{
+				Type:    diagnosisv1.DiagnosisComplete,
+				Status:  corev1.ConditionFalse,
+				Reason:  "OperationTimedOut",
+				Message: "operation operation1 timed out",
+			},
+			desc: "existing condition transitioned to failure",
+		},
+		{
+			status:        &diagnosisv1.DiagnosisStatus{},
+			conditionType: diagnosisv1.DiagnosisComplete,
+			reason:        "AllPathsFailed",
+			err:           nil,
+			expected:      true,
+			expectedCondition: diagnosisv1.DiagnosisCondition{
+				Type:   diagnosisv1.DiagnosisComplete,
+				Status: corev1.ConditionFalse,
+				Reason: "AllPathsFailed",
+			},
+			desc: "nil error leaves message empty",
+		},
+	}
+
+	for _, test := range tests {
+		updated := SetDiagnosisConditionError(test.status, test.conditionType, test.reason, test.err)
+		assert.Equal(t, test.expected, updated, test.desc)
+		_, condition := GetDiagnosisCondition(test.status, test.conditionType)
+		assert.NotNil(t, condition, test.desc)
+		assert.Equal(t, test.expectedCondition.Status, condition.Status, test.desc)
+		assert.Equal(t, test.expectedCondition.Reason, condition.Reason, test.desc)
+		assert.Equal(t, test.expectedCondition.Message, condition.Message, test.desc)
+	}
+}
+
 func TestGetDiagnosisCondition(t *testing.T) {
 	type expectedStruct struct {
 		index     int
@@ -447,6 +581,81 @@ func TestIsDiagnosisNodeNameMatched(t *testing.T) {
 	}
 }
 
+func TestIsDiagnosisNodeMatchedByPattern(t *testing.T) {
+	tests := []struct {
+		diagnosis diagnosisv1.Diagnosis
+		patterns  []string
+		expected  bool
+		desc      string
+	}{
+		{
+			diagnosis: diagnosisv1.Diagnosis{
+				Spec: diagnosisv1.DiagnosisSpec{
+					NodeName: "",
+				},
+			},
+			patterns: []string{"node-*"},
+			expected: true,
+			desc:     "empty node name",
+		},
+		{
+			diagnosis: diagnosisv1.Diagnosis{
+				Spec: diagnosisv1.DiagnosisSpec{
+					NodeName: "node-1",
+				},
+			},
+			patterns: []string{"node-*"},
+			expected: true,
+			desc:     "node name matched by glob pattern",
+		},
+		{
+			diagnosis: diagnosisv1.Diagnosis{
+				Spec: diagnosisv1.DiagnosisSpec{
+					NodeName: "node-1",
+				},
+			},
+			patterns: []string{"/^node-[0-9]+$/"},
+			expected: true,
+			desc:     "node name matched by regular expression pattern",
+		},
+		{
+			diagnosis: diagnosisv1.Diagnosis{
+				Spec: diagnosisv1.DiagnosisSpec{
+					NodeName: "master-1",
+				},
+			},
+			patterns: []string{"node-*", "/^worker-[0-9]+$/"},
+			expected: false,
+			desc:     "node name not matched by any pattern",
+		},
+		{
+			diagnosis: diagnosisv1.Diagnosis{
+				Spec: diagnosisv1.DiagnosisSpec{
+					NodeName: "node-1",
+				},
+			},
+			patterns: nil,
+			expected: false,
+			desc:     "no patterns",
+		},
+		{
+			diagnosis: diagnosisv1.Diagnosis{
+				Spec: diagnosisv1.DiagnosisSpec{
+					NodeName: "node-1",
+				},
+			},
+			patterns: []string{"/^node-[/"},
+			expected: false,
+			desc:     "invalid regular expression pattern",
+		},
+	}
+
+	for _, test := range tests {
+		matched := IsDiagnosisNodeMatchedByPattern(test.diagnosis, test.patterns)
+		assert.Equal(t, test.expected, matched, test.desc)
+	}
+}
+
 func TestRetrievePodsOnNode(t *testing.T) {
 	tests := []struct {
 		pods     []corev1.Pod
@@ -516,6 +725,231 @@ func TestRetrievePodsOnNode(t *testing.T) {
 	}
 }
 
+func TestRetrievePodsOnNodeWithSelector(t *testing.T) {
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod1",
+				Namespace: "default",
+				Labels: map[string]string{
+					"app": "nginx",
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "node1",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod2",
+				Namespace: "kube-system",
+				Labels: map[string]string{
+					"app": "nginx",
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "node1",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod3",
+				Namespace: "default",
+				Labels: map[string]string{
+					"app": "redis",
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "node1",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod4",
+				Namespace: "default",
+				Labels: map[string]string{
+					"app": "nginx",
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "node2",
+			},
+		},
+	}
+
+	mustParseSelector := func(selector string) labels.Selector {
+		parsed, err := labels.Parse(selector)
+		assert.NoError(t, err)
+		return parsed
+	}
+
+	tests := []struct {
+		pods      []corev1.Pod
+		nodeName  string
+		namespace string
+		selector  labels.Selector
+		expected  []string
+		desc      string
+	}{
+		{
+			pods:     pods,
+			nodeName: "node1",
+			expected: []string{"pod1", "pod2", "pod3"},
+			desc:     "no filter returns all pods on node",
+		},
+		{
+			pods:     pods,
+			nodeName: "node1",
+			selector: mustParseSelector("app=nginx"),
+			expected: []string{"pod1", "pod2"},
+			desc:     "pods not matching label selector removed",
+		},
+		{
+			pods:      pods,
+			nodeName:  "node1",
+			namespace: "default",
+			selector:  mustParseSelector("app=nginx"),
+			expected:  []string{"pod1"},
+			desc:      "pods filtered by namespace and label selector",
+		},
+		{
+			pods:     pods,
+			nodeName: "node1",
+			selector: mustParseSelector("app=mysql"),
+			expected: []string{},
+			desc:     "no pod matches label selector",
+		},
+		{
+			pods:      pods,
+			nodeName:  "node1",
+			namespace: "monitoring",
+			expected:  []string{},
+			desc:      "no pod in namespace",
+		},
+	}
+
+	for _, test := range tests {
+		resultPods := RetrievePodsOnNodeWithSelector(test.pods, test.nodeName, test.namespace, test.selector)
+		names := make([]string, 0, len(resultPods))
+		for _, pod := range resultPods {
+			names = append(names, pod.Name)
+		}
+		assert.Equal(t, test.expected, names, test.desc)
+	}
+}
+
+func TestQueueDiagnosisWithPolicy(t *testing.T) {
+	oldest := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "oldest",
+		},
+	}
+	newest := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "newest",
+		},
+	}
+
+	// The reject new policy returns an error and keeps the queued diagnosis.
+	channel := make(chan diagnosisv1.Diagnosis, 1)
+	channel <- oldest
+	err := QueueDiagnosisWithPolicy(context.Background(), channel, newest, QueueOverflowPolicyRejectNew)
+	assert.Error(t, err, "reject new policy rejects on full channel")
+	assert.Equal(t, "oldest", (<-channel).Name, "reject new policy keeps queued diagnosis")
+
+	// The drop oldest policy drops the queued diagnosis to make room.
+	channel = make(chan diagnosisv1.Diagnosis, 1)
+	channel <- oldest
+	err = QueueDiagnosisWithPolicy(context.Background(), channel, newest, QueueOverflowPolicyDropOldest)
+	assert.NoError(t, err, "drop oldest policy enqueues on full channel")
+	assert.Equal(t, "newest", (<-channel).Name, "drop oldest policy drops queued diagnosis")
+
+	// The block policy waits until the channel has room.
+	channel = make(chan diagnosisv1.Diagnosis, 1)
+	channel <- oldest
+	received := make(chan diagnosisv1.Diagnosis, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		received <- <-channel
+	}()
+	err = QueueDiagnosisWithPolicy(context.Background(), channel, newest, QueueOverflowPolicyBlock)
+	assert.NoError(t, err, "block policy enqueues once the channel has room")
+	assert.Equal(t, "oldest", (<-received).Name, "block policy does not drop queued diagnosis")
+	assert.Equal(t, "newest", (<-channel).Name, "block policy enqueues new diagnosis")
+
+	// The block policy returns without enqueuing if the context is done.
+	channel = make(chan diagnosisv1.Diagnosis, 1)
+	channel <- oldest
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = QueueDiagnosisWithPolicy(ctx, channel, newest, QueueOverflowPolicyBlock)
+	assert.NoError(t, err, "block policy returns on done context")
+}
+
+func TestFormatDiagnosisSummary(t *testing.T) {
+	diagnosis := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "diagnosis1",
+		},
+		Spec: diagnosisv1.DiagnosisSpec{
+			NodeName: "node1",
+			Severity: diagnosisv1.DiagnosisSeverityCritical,
+		},
+		Status: diagnosisv1.DiagnosisStatus{
+			Phase: diagnosisv1.DiagnosisFailed,
+			Conditions: []diagnosisv1.DiagnosisCondition{
+				{
+					Type:    diagnosisv1.DiagnosisAccepted,
+					Status:  corev1.ConditionTrue,
+					Reason:  "DiagnosisAccepted",
+					Message: "Diagnosis is accepted by agent on node node1",
+				},
+			},
+			SucceededPath: diagnosisv1.Path{
+				{
+					Operation: "podListCollector",
+				},
+				{
+					Operation: "signalRecover",
+				},
+			},
+		},
+	}
+
+	markdown, err := FormatDiagnosisSummary(diagnosis, DiagnosisSummaryFormatMarkdown)
+	assert.NoError(t, err)
+	for _, expected := range []string{
+		"## Diagnosis default/diagnosis1",
+		"- Phase: Failed",
+		"- Node: node1",
+		"- Severity: Critical",
+		"- Last Operation: signalRecover",
+		"- Accepted: True (DiagnosisAccepted) Diagnosis is accepted by agent on node node1",
+	} {
+		assert.Contains(t, markdown, expected, "markdown summary contains rendered field")
+	}
+
+	slack, err := FormatDiagnosisSummary(diagnosis, DiagnosisSummaryFormatSlack)
+	assert.NoError(t, err)
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(slack), &payload), "slack summary is valid json")
+	assert.Contains(t, payload, "blocks")
+	for _, expected := range []string{
+		"Diagnosis default/diagnosis1",
+		"*Phase:*\\nFailed",
+		"*Node:*\\nnode1",
+		"*Severity:*\\nCritical",
+		"*Last Operation:*\\nsignalRecover",
+		"Accepted: True (DiagnosisAccepted)",
+	} {
+		assert.Contains(t, slack, expected, "slack summary contains rendered field")
+	}
+
+	_, err = FormatDiagnosisSummary(diagnosis, "xml")
+	assert.Error(t, err, "unsupported format rejected")
+}
+
 func TestRetrieveDiagnosesOnNode(t *testing.T) {
 	tests := []struct {
 		diagnoses []diagnosisv1.Diagnosis
@@ -584,3 +1018,350 @@ func TestRetrieveDiagnosesOnNode(t *testing.T) {
 		assert.Equal(t, test.expected, resultDiagnoses, test.desc)
 	}
 }
+
+func TestGetDiagnosisContext(t *testing.T) {
+	diagnosis := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis1",
+			Namespace: "default",
+		},
+		Spec: diagnosisv1.DiagnosisSpec{
+			Parameters: map[string]string{
+				"key1": "value1",
+				"key2": "value2",
+			},
+		},
+		Status: diagnosisv1.DiagnosisStatus{
+			OperationResults: map[string]string{
+				"key2": "value3",
+			},
+		},
+	}
+
+	tests := []struct {
+		key      string
+		expected string
+		err      bool
+		desc     string
+	}{
+		{
+			key:      "key1",
+			expected: "value1",
+			err:      false,
+			desc:     "value retrieved from parameters",
+		},
+		{
+			key:      "key2",
+			expected: "value3",
+			err:      false,
+			desc:     "value in operation results overrides parameters",
+		},
+		{
+			key:      "key3",
+			expected: "",
+			err:      true,
+			desc:     "key not found",
+		},
+	}
+
+	for _, test := range tests {
+		value, err := GetDiagnosisContext(diagnosis, test.key)
+		assert.Equal(t, test.expected, value, test.desc)
+		if test.err {
+			assert.Error(t, err, test.desc)
+		} else {
+			assert.NoError(t, err, test.desc)
+		}
+	}
+}
+
+func TestGetDiagnosisContextValue(t *testing.T) {
+	type object struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	diagnosis := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis1",
+			Namespace: "default",
+		},
+		Spec: diagnosisv1.DiagnosisSpec{
+			Parameters: map[string]string{
+				"object":  `{"name":"pod1","count":2}`,
+				"slice":   `["value1","value2"]`,
+				"number":  "10",
+				"invalid": "value1",
+			},
+		},
+	}
+
+	var objectValue object
+	err := GetDiagnosisContextValue(diagnosis, "object", &objectValue)
+	assert.NoError(t, err)
+	assert.Equal(t, object{Name: "pod1", Count: 2}, objectValue, "struct value unmarshalled")
+
+	var sliceValue []string
+	err = GetDiagnosisContextValue(diagnosis, "slice", &sliceValue)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"value1", "value2"}, sliceValue, "slice value unmarshalled")
+
+	var numberValue int
+	err = GetDiagnosisContextValue(diagnosis, "number", &numberValue)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, numberValue, "primitive value unmarshalled")
+
+	var stringValue string
+	err = GetDiagnosisContextValue(diagnosis, "invalid", &stringValue)
+	assert.Error(t, err, "value not in json encoding")
+
+	err = GetDiagnosisContextValue(diagnosis, "missing", &stringValue)
+	assert.Error(t, err, "key not found")
+}
+
+func TestBlockingRunCommandWithTimeout(t *testing.T) {
+	out, err := BlockingRunCommandWithTimeout([]string{"echo", "hello"}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(out), "command executed successfully")
+
+	// A zero timeout defaults to 30 seconds instead of returning immediately.
+	out, err = BlockingRunCommandWithTimeout([]string{"echo", "hello"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(out), "command executed with default timeout")
+
+	// A sleeping command is killed once the timeout expires. A timeout below 1 second is
+	// clamped up to 1 second.
+	start := time.Now()
+	_, err = BlockingRunCommandWithTimeout([]string{"sleep", "60"}, -5)
+	assert.Error(t, err, "command timed out")
+	assert.Contains(t, err.Error(), "timed out after 1s")
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Second), "command killed on timeout")
+}
+
+func TestGetDiagnosisContextByPath(t *testing.T) {
+	diagnosis := diagnosisv1.Diagnosis{
+		Spec: diagnosisv1.DiagnosisSpec{
+			Parameters: map[string]string{
+				"key1": "value1",
+			},
+		},
+		Status: diagnosisv1.DiagnosisStatus{
+			OperationResults: map[string]string{
+				"podlist": `[{"name":"pod1","containers":[{"name":"container1"}]},{"name":"pod2"}]`,
+			},
+		},
+	}
+
+	value, err := GetDiagnosisContextByPath(diagnosis, "{.podlist[0].name}")
+	assert.NoError(t, err)
+	assert.Equal(t, "pod1", value, "nested field retrieved from stored pod list")
+
+	value, err = GetDiagnosisContextByPath(diagnosis, "{.podlist[0].containers[0].name}")
+	assert.NoError(t, err)
+	assert.Equal(t, "container1", value, "deeply nested field retrieved from stored pod list")
+
+	value, err = GetDiagnosisContextByPath(diagnosis, "{.key1}")
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", value, "plain string value retrieved")
+
+	_, err = GetDiagnosisContextByPath(diagnosis, "{.podlist[0")
+	assert.Error(t, err, "malformed jsonpath")
+
+	_, err = GetDiagnosisContextByPath(diagnosis, "{.missing.field}")
+	assert.Error(t, err, "path not found in context")
+
+	_, err = GetDiagnosisContextByPath(diagnosisv1.Diagnosis{}, "{.key1}")
+	assert.Error(t, err, "nil context")
+}
+
+func TestSetDiagnosisContextMap(t *testing.T) {
+	diagnosis := diagnosisv1.Diagnosis{
+		Status: diagnosisv1.DiagnosisStatus{
+			OperationResults: map[string]string{
+				"key1": "value1",
+			},
+		},
+	}
+
+	// Existing keys are overwritten instead of duplicated and non string values are encoded
+	// as json.
+	err := SetDiagnosisContextMap(&diagnosis, map[string]interface{}{
+		"key1": "updated1",
+		"key2": map[string]string{"name": "pod1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(diagnosis.Status.OperationResults))
+	assert.Equal(t, "updated1", diagnosis.Status.OperationResults["key1"])
+	assert.Equal(t, `{"name":"pod1"}`, diagnosis.Status.OperationResults["key2"])
+
+	// Merging the same entries in a different order results in an identical context.
+	first := diagnosisv1.Diagnosis{}
+	assert.NoError(t, SetDiagnosisContextMap(&first, map[string]interface{}{"key1": "value1"}))
+	assert.NoError(t, SetDiagnosisContextMap(&first, map[string]interface{}{"key2": "value2"}))
+	second := diagnosisv1.Diagnosis{}
+	assert.NoError(t, SetDiagnosisContextMap(&second, map[string]interface{}{"key2": "value2"}))
+	assert.NoError(t, SetDiagnosisContextMap(&second, map[string]interface{}{"key1": "value1"}))
+	assert.Equal(t, first.Status.OperationResults, second.Status.OperationResults)
+
+	// A nil operation result map is initialized before the merge and an empty entry map is
+	// a no-op.
+	empty := diagnosisv1.Diagnosis{}
+	assert.NoError(t, SetDiagnosisContextMap(&empty, nil))
+	assert.Nil(t, empty.Status.OperationResults)
+	assert.NoError(t, SetDiagnosisContextMap(&empty, map[string]interface{}{"key1": "value1"}))
+	assert.Equal(t, map[string]string{"key1": "value1"}, empty.Status.OperationResults)
+}
+
+func TestDiagnosisSource(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		expected    string
+		desc        string
+	}{
+		{
+			annotations: nil,
+			expected:    DiagnosisSourceCustom,
+			desc:        "diagnosis without annotations",
+		},
+		{
+			annotations: map[string]string{
+				KubeDiagPrefix + "prometheus-alert": "alert1",
+			},
+			expected: DiagnosisSourcePrometheusAlert,
+			desc:     "diagnosis generated from prometheus alert",
+		},
+		{
+			annotations: map[string]string{
+				KubeDiagPrefix + "kubernetes-event": "event1",
+			},
+			expected: DiagnosisSourceKubernetesEvent,
+			desc:     "diagnosis generated from kubernetes event",
+		},
+		{
+			annotations: map[string]string{
+				KubeDiagPrefix + "kafka-message-topic": "topic1",
+			},
+			expected: DiagnosisSourceKafkaMessage,
+			desc:     "diagnosis generated from kafka message",
+		},
+		{
+			annotations: map[string]string{
+				KubeDiagPrefix + "cron": "trigger1",
+			},
+			expected: DiagnosisSourceCron,
+			desc:     "diagnosis generated by cron trigger",
+		},
+		{
+			annotations: map[string]string{
+				"unrelated": "value",
+			},
+			expected: DiagnosisSourceCustom,
+			desc:     "diagnosis with unrelated annotations",
+		},
+	}
+
+	for _, test := range tests {
+		diagnosis := diagnosisv1.Diagnosis{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "diagnosis1",
+				Namespace:   "default",
+				Annotations: test.annotations,
+			},
+		}
+		assert.Equal(t, test.expected, DiagnosisSource(diagnosis), test.desc)
+	}
+}
+
+func TestDefaultDiagnosisDedupKey(t *testing.T) {
+	tests := []struct {
+		diagnosis diagnosisv1.Diagnosis
+		expected  string
+		desc      string
+	}{
+		{
+			diagnosis: diagnosisv1.Diagnosis{},
+			expected:  "",
+			desc:      "diagnosis without node name and pod reference is not deduplicated",
+		},
+		{
+			diagnosis: diagnosisv1.Diagnosis{
+				Spec: diagnosisv1.DiagnosisSpec{
+					NodeName: "node1",
+				},
+			},
+			expected: "Custom/node1",
+			desc:     "diagnosis keyed by source and node name",
+		},
+		{
+			diagnosis: diagnosisv1.Diagnosis{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						KubeDiagPrefix + "kubernetes-event": "event1",
+					},
+				},
+				Spec: diagnosisv1.DiagnosisSpec{
+					NodeName: "node1",
+					PodReference: &diagnosisv1.PodReference{
+						NamespacedName: diagnosisv1.NamespacedName{
+							Namespace: "namespace1",
+							Name:      "pod1",
+						},
+					},
+				},
+			},
+			expected: "KubernetesEvent/node1/namespace1/pod1",
+			desc:     "diagnosis keyed by source, node name and pod reference",
+		},
+	}
+
+	for _, test := range tests {
+		key := DefaultDiagnosisDedupKey(test.diagnosis)
+		assert.Equal(t, test.expected, key, test.desc)
+	}
+}
+
+func TestMergeDiagnosisEvidence(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+	existing := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis1",
+			Namespace: "namespace1",
+			Annotations: map[string]string{
+				"annotation1": "value1",
+			},
+		},
+		Spec: diagnosisv1.DiagnosisSpec{
+			Parameters: map[string]string{
+				"parameter1": "value1",
+			},
+		},
+	}
+	duplicate := diagnosisv1.Diagnosis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "diagnosis2",
+			Namespace: "namespace1",
+			Annotations: map[string]string{
+				"annotation1": "overwritten",
+				"annotation2": "value2",
+			},
+		},
+		Spec: diagnosisv1.DiagnosisSpec{
+			Parameters: map[string]string{
+				"parameter1": "overwritten",
+				"parameter2": "value2",
+			},
+		},
+	}
+
+	MergeDiagnosisEvidence(&existing, duplicate, now)
+	assert.Equal(t, "value1", existing.Spec.Parameters["parameter1"], "existing parameter not overwritten")
+	assert.Equal(t, "value2", existing.Spec.Parameters["parameter2"], "additional parameter merged")
+	assert.Equal(t, "value1", existing.Annotations["annotation1"], "existing annotation not overwritten")
+	assert.Equal(t, "value2", existing.Annotations["annotation2"], "additional annotation merged")
+	assert.Equal(t, "1", existing.Annotations[DuplicatesAnnotation], "duplicate count recorded")
+	assert.Equal(t, "2021-03-01T10:00:00Z", existing.Annotations[LastDuplicateTimeAnnotation], "last duplicate time recorded")
+
+	MergeDiagnosisEvidence(&existing, duplicate, now.Add(time.Minute))
+	assert.Equal(t, "2", existing.Annotations[DuplicatesAnnotation], "duplicate count incremented")
+	assert.Equal(t, "2021-03-01T10:01:00Z", existing.Annotations[LastDuplicateTimeAnnotation], "last duplicate time updated")
+}